@@ -0,0 +1,10 @@
+// Package gowebrtc bundles the browser client so the server binary can serve
+// it without the source tree being present.
+package gowebrtc
+
+import "embed"
+
+// ClientAssets holds the static files of the browser client under client/
+//
+//go:embed client/index.html client/webrtc.js
+var ClientAssets embed.FS
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var disableExtensions = flag.String("disable-extensions", "", "Comma-separated RTP header extensions to leave out of the offer: "+strings.Join(extensionNames(), ", "))
+
+// headerExtensions maps the names accepted by -disable-extensions to the
+// header extensions pion registers by default
+var headerExtensions = map[string]string{
+	"mid":          sdp.SDESMidURI,
+	"rid":          sdp.SDESRTPStreamIDURI,
+	"repaired-rid": sdp.SDESRepairRTPStreamIDURI,
+	"transport-cc": sdp.TransportCCURI,
+}
+
+func extensionNames() []string {
+	names := make([]string, 0, len(headerExtensions))
+	for name := range headerExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseDisabledExtensions validates the -disable-extensions list against
+// the known extensions and the features that depend on them
+func parseDisabledExtensions(list string) (map[string]bool, error) {
+	disabled := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := headerExtensions[name]; !ok {
+			return nil, fmt.Errorf("unknown header extension %q (known: %s)", name, strings.Join(extensionNames(), ", "))
+		}
+		disabled[name] = true
+	}
+
+	if *enableBWE && disabled["transport-cc"] {
+		return nil, errors.New("bandwidth estimation (-bwe) needs the transport-cc extension")
+	}
+	// RID values are only meaningful alongside the MID they belong to
+	if disabled["mid"] && (!disabled["rid"] || !disabled["repaired-rid"]) {
+		return nil, errors.New("disabling mid also requires disabling rid and repaired-rid")
+	}
+	return disabled, nil
+}
+
+// newWebRTCAPI builds the pion API used to create peer connections.
+// It mirrors pion's defaults and layers on the optional features selected by
+// flags, some of which depend on whether this client is the caller.
+func newWebRTCAPI(isCaller bool) (*webrtc.API, error) {
+	disabled, err := parseDisabledExtensions(*disableExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := parseCodecAllowlist(*allowCodecs)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := registerCodecs(mediaEngine, allowed); err != nil {
+		return nil, err
+	}
+
+	// The equivalent of webrtc.RegisterDefaultInterceptors, minus any disabled extensions
+	registry := &interceptor.Registry{}
+	// Added first so TapRTP sees packets as they are on the wire
+	registry.Add(tapFactory{})
+	if err := webrtc.ConfigureNack(mediaEngine, registry); err != nil {
+		return nil, err
+	}
+	if err := webrtc.ConfigureRTCPReports(registry); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"mid", "rid", "repaired-rid"} {
+		if disabled[name] {
+			continue
+		}
+		extension := webrtc.RTPHeaderExtensionCapability{URI: headerExtensions[name]}
+		if err := mediaEngine.RegisterHeaderExtension(extension, webrtc.RTPCodecTypeVideo); err != nil {
+			return nil, err
+		}
+	}
+	// Pion only registers MID for video; audio needs it too for bundle demux
+	if !disabled["mid"] {
+		extension := webrtc.RTPHeaderExtensionCapability{URI: headerExtensions["mid"]}
+		if err := mediaEngine.RegisterHeaderExtension(extension, webrtc.RTPCodecTypeAudio); err != nil {
+			return nil, err
+		}
+	}
+	if !disabled["transport-cc"] {
+		if err := webrtc.ConfigureTWCCSender(mediaEngine, registry); err != nil {
+			return nil, err
+		}
+	}
+
+	if *enableBWE {
+		if err := configureBandwidthEstimation(mediaEngine, registry); err != nil {
+			return nil, err
+		}
+	}
+
+	settings := webrtc.SettingEngine{}
+	configureICE(&settings, isCaller)
+	configureDTLS(&settings)
+
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithInterceptorRegistry(registry),
+		webrtc.WithSettingEngine(settings),
+	), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// offerWith builds the API with -disable-extensions set to disabled and
+// returns an offer for an audio and a video track
+func offerWith(t *testing.T, disabled string) string {
+	t.Helper()
+	previous := *disableExtensions
+	*disableExtensions = disabled
+	t.Cleanup(func() { *disableExtensions = previous })
+
+	api, err := newWebRTCAPI(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offer.SDP
+}
+
+// TestDisableExtensions checks a disabled header extension is left out of
+// the offer while the rest stay, and that inconsistent lists are refused
+func TestDisableExtensions(t *testing.T) {
+	if offer := offerWith(t, ""); !strings.Contains(offer, sdp.TransportCCURI) {
+		t.Fatal("transport-cc missing from the default offer")
+	}
+	offer := offerWith(t, "transport-cc")
+	if strings.Contains(offer, sdp.TransportCCURI) {
+		t.Fatal("offer still carries transport-cc after disabling it")
+	}
+	if !strings.Contains(offer, sdp.SDESMidURI) {
+		t.Fatal("disabling transport-cc also removed mid")
+	}
+
+	previousBWE := *enableBWE
+	t.Cleanup(func() { *enableBWE = previousBWE })
+	for list, bwe := range map[string]bool{
+		"abs-send-time": false,
+		"mid":           false,
+		"transport-cc":  true,
+	} {
+		*enableBWE = bwe
+		if _, err := parseDisabledExtensions(list); err == nil {
+			t.Errorf("%q with bwe %v accepted", list, bwe)
+		}
+	}
+	*enableBWE = false
+	if _, err := parseDisabledExtensions("mid, rid, repaired-rid"); err != nil {
+		t.Errorf("disabling mid with its rids refused: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// minRebuildBackoff is the wait before the first rebuild of a failed connection
+const minRebuildBackoff = time.Second
+
+var (
+	disconnectGrace   = flag.Duration("disconnect-grace", 5*time.Second, "How long a disconnected peer connection may recover on its own before ICE is restarted (0 disables the restart)")
+	maxRebuildBackoff = flag.Duration("max-rebuild-backoff", 30*time.Second, "Cap on the doubling wait before rebuilding a failed peer connection (0 disables rebuilding)")
+)
+
+// peerReconnector recovers the media peer connection when it drops: a
+// disconnected one gets an ICE restart if it hasn't come back within the
+// grace period, and a failed one is torn down and started again, waiting
+// longer after each failure until a connection succeeds.
+type peerReconnector struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	backoff time.Duration
+}
+
+var peerReconnect = &peerReconnector{backoff: minRebuildBackoff}
+
+// observe acts on pc moving to state
+func (r *peerReconnector) observe(pc *webrtc.PeerConnection, state webrtc.PeerConnectionState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch state {
+	case webrtc.PeerConnectionStateConnected:
+		r.stopLocked()
+		r.backoff = minRebuildBackoff
+	case webrtc.PeerConnectionStateDisconnected:
+		if *disconnectGrace <= 0 {
+			return
+		}
+		r.stopLocked()
+		r.timer = time.AfterFunc(*disconnectGrace, func() {
+			if currentPeerConnection(pc) && pc.ConnectionState() == webrtc.PeerConnectionStateDisconnected {
+				log.Printf("Peer connection still disconnected after %v, restarting ICE", *disconnectGrace)
+				restartICE(pc)
+			}
+		})
+	case webrtc.PeerConnectionStateFailed:
+		if *maxRebuildBackoff <= 0 {
+			return
+		}
+		r.stopLocked()
+		delay := r.backoff
+		r.backoff = min(r.backoff*2, *maxRebuildBackoff)
+		log.Printf("Peer connection failed, rebuilding it in %v", delay)
+		r.timer = time.AfterFunc(delay, func() { rebuildPeerConnection(pc) })
+	}
+}
+
+func (r *peerReconnector) stopLocked() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// currentPeerConnection reports whether pc is still the media peer connection
+func currentPeerConnection(pc *webrtc.PeerConnection) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return peerConnection == pc
+}
+
+// rebuildPeerConnection closes pc and starts a new connection in the role set
+// by -caller, unless pc was already replaced. A callee waits for the peer's
+// new offer.
+func rebuildPeerConnection(pc *webrtc.PeerConnection) {
+	if !currentPeerConnection(pc) {
+		return
+	}
+	if err := pc.Close(); err != nil {
+		log.Printf("Failed to close peer connection: %v", err)
+	}
+	start(*callerFlag, defaultConfiguration())
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v4"
+)
+
+// defaultVideoFrameSize is the simulated frame size used when no estimate is available
+const defaultVideoFrameSize = 640 * 480 * 3 // RGB data
+
+var (
+	enableBWE         = flag.Bool("bwe", false, "Enable send-side bandwidth estimation and adapt the video bitrate to it")
+	bweInitialBitrate = flag.Int("bwe-initial-bitrate", 1_000_000, "Initial bandwidth estimate in bits per second")
+	bweMinBitrate     = flag.Int("bwe-min-bitrate", 100_000, "Lowest bitrate the estimator may target in bits per second")
+	bweMaxBitrate     = flag.Int("bwe-max-bitrate", 5_000_000, "Highest bitrate the estimator may target in bits per second")
+
+	// videoTargetBitrate is the current outbound video target in bits per second; 0 means unconstrained
+	videoTargetBitrate atomic.Int64
+
+	// roomBitrateCap is the server's per-stream share of the room budget; 0 means none
+	roomBitrateCap atomic.Int64
+)
+
+// configureBandwidthEstimation registers the GCC congestion controller and the
+// transport-wide CC header extension it relies on. Pion does not support
+// changing RTPSender encoding parameters after negotiation, so the estimate is
+// applied at the media source instead; either way no renegotiation is needed.
+func configureBandwidthEstimation(mediaEngine *webrtc.MediaEngine, registry *interceptor.Registry) error {
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(*bweInitialBitrate),
+			gcc.SendSideBWEMinBitrate(*bweMinBitrate),
+			gcc.SendSideBWEMaxBitrate(*bweMaxBitrate),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	congestionController.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		setVideoTargetBitrate(estimator.GetTargetBitrate())
+		estimator.OnTargetBitrateChange(setVideoTargetBitrate)
+	})
+	registry.Add(congestionController)
+
+	return webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, registry)
+}
+
+// setVideoTargetBitrate updates the bitrate the video source encodes at
+func setVideoTargetBitrate(bitrate int) {
+	if old := videoTargetBitrate.Swap(int64(bitrate)); old != int64(bitrate) {
+		log.Printf("Video target bitrate: %d -> %d bps", old, bitrate)
+	}
+}
+
+// setRoomBitrateCap applies the signaling server's share of the room budget
+func setRoomBitrateCap(bitrate int64) {
+	if old := roomBitrateCap.Swap(bitrate); old != bitrate {
+		log.Printf("Room bitrate cap: %d -> %d bps", old, bitrate)
+	}
+}
+
+// videoBitrate returns the bitrate video may use in total: the bandwidth
+// estimate, lowered to the room cap if there is one. 0 means unconstrained.
+func videoBitrate() int64 {
+	target, limit := videoTargetBitrate.Load(), roomBitrateCap.Load()
+	if limit > 0 && (target <= 0 || limit < target) {
+		return limit
+	}
+	return target
+}
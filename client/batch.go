@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var batchCandidates = flag.Duration("batch-candidates", 0, "Coalesce ICE candidates gathered within this window into one message (0 sends each candidate individually)")
+
+// candidateBatch is the wire format for several trickled candidates sent at once
+type candidateBatch struct {
+	Type string                    `json:"type"` // Always "candidates"
+	ICE  []webrtc.ICECandidateInit `json:"ice"`
+	UUID string                    `json:"uuid"`
+	To   string                    `json:"to,omitempty"`
+
+	ServerTime int64 `json:"serverTime,omitempty"`
+}
+
+var (
+	pendingCandidates []webrtc.ICECandidateInit
+	batchTimer        *time.Timer
+	batchMu           sync.Mutex
+)
+
+// queueCandidate sends a local candidate, batching it with others gathered
+// within the -batch-candidates window when batching is enabled
+func queueCandidate(candidate webrtc.ICECandidateInit) {
+	if *batchCandidates <= 0 {
+		sendSignal(Signal{ICE: &candidate, UUID: currentUUID()})
+		return
+	}
+
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	pendingCandidates = append(pendingCandidates, candidate)
+	if batchTimer == nil {
+		batchTimer = time.AfterFunc(*batchCandidates, flushCandidates)
+	}
+}
+
+// flushCandidates sends any batched candidates immediately
+func flushCandidates() {
+	batchMu.Lock()
+	batch := pendingCandidates
+	pendingCandidates = nil
+	if batchTimer != nil {
+		batchTimer.Stop()
+		batchTimer = nil
+	}
+	batchMu.Unlock()
+
+	switch len(batch) {
+	case 0:
+	case 1:
+		sendSignal(Signal{ICE: &batch[0], UUID: currentUUID()})
+	default:
+		sendMessage(candidateBatch{Type: "candidates", ICE: batch, UUID: currentUUID(), To: recipient()})
+	}
+}
+
+// handleCandidateBatch applies a batch of remote candidates in the order they were gathered
+func handleCandidateBatch(message []byte) error {
+	var batch candidateBatch
+	if err := json.Unmarshal(message, &batch); err != nil {
+		return err
+	}
+	for i := range batch.ICE {
+		signal := Signal{ICE: &batch.ICE[i], UUID: batch.UUID, ServerTime: batch.ServerTime}
+		// Subscribers see batched candidates as individual signals
+		publishSignal(signal)
+		if batch.UUID != currentUUID() {
+			handleSignal(signal)
+		}
+	}
+	return nil
+}
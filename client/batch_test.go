@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestCandidatesBatched queues candidates in quick succession and checks they
+// reach the server as one batch, in order, with batching on and one by one
+// with it off
+func TestCandidatesBatched(t *testing.T) {
+	candidates := make([]webrtc.ICECandidateInit, 3)
+	for i := range candidates {
+		candidates[i] = webrtc.ICECandidateInit{Candidate: fmt.Sprintf("candidate:%d 1 udp 1 192.0.2.1 9 typ host", i)}
+	}
+	previous := *batchCandidates
+	t.Cleanup(func() { *batchCandidates = previous })
+
+	next := func(t *testing.T, server *fakeSignalingServer) receivedSignal {
+		t.Helper()
+		select {
+		case received := <-server.received:
+			return received
+		case <-time.After(time.Second):
+			t.Fatal("nothing sent")
+			return receivedSignal{}
+		}
+	}
+
+	t.Run("batched", func(t *testing.T) {
+		server := newFakeSignalingServer(t, "batched")
+		server.connect(t)
+		*batchCandidates = 50 * time.Millisecond
+		for _, candidate := range candidates {
+			queueCandidate(candidate)
+		}
+
+		received := next(t, server)
+		var batch candidateBatch
+		if err := json.Unmarshal(received.raw, &batch); err != nil || batch.Type != "candidates" {
+			t.Fatalf("sent %s, want a candidate batch", received.raw)
+		}
+		if len(batch.ICE) != len(candidates) {
+			t.Fatalf("batch holds %d candidates, want %d", len(batch.ICE), len(candidates))
+		}
+		for i, candidate := range batch.ICE {
+			if candidate.Candidate != candidates[i].Candidate {
+				t.Errorf("batch[%d] = %s, want %s", i, candidate.Candidate, candidates[i].Candidate)
+			}
+		}
+	})
+
+	t.Run("individual", func(t *testing.T) {
+		server := newFakeSignalingServer(t, "individual")
+		server.connect(t)
+		*batchCandidates = 0
+		for _, candidate := range candidates {
+			queueCandidate(candidate)
+		}
+		for i := range candidates {
+			received := next(t, server)
+			if received.ICE == nil || received.ICE.Candidate != candidates[i].Candidate {
+				t.Fatalf("message %d is %s, want candidate %d alone", i, received.raw, i)
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	bitrateInterval  = flag.Duration("bitrate-interval", time.Second, "How often the outbound and inbound bitrates are sampled from the connection stats (0 disables)")
+	bitrateSmoothing = flag.Duration("bitrate-smoothing", 5*time.Second, "Time constant of the moving average over the sampled bitrates; longer is steadier but slower to follow changes")
+)
+
+// BitrateStats is the media bitrate of the current connection in bits per
+// second. The raw values cover the last sampling interval and jump around
+// with every keyframe; the smoothed ones are an exponential moving average
+// suited to quality indicators.
+type BitrateStats struct {
+	Outbound         float64
+	Inbound          float64
+	OutboundSmoothed float64
+	InboundSmoothed  float64
+	Sampled          time.Time // Zero until the first interval has passed
+}
+
+// movingAverage is an exponential moving average for irregularly spaced
+// samples. Each sample is weighted by how much of the time constant passed
+// since the previous one, so a late sample moves the average further.
+type movingAverage struct {
+	value  float64
+	primed bool
+}
+
+// update folds in x, observed elapsed after the previous sample, and returns
+// the new average. The first sample is taken as is.
+func (m *movingAverage) update(x float64, elapsed, timeConstant time.Duration) float64 {
+	if !m.primed || timeConstant <= 0 {
+		m.value, m.primed = x, true
+		return m.value
+	}
+	alpha := 1 - math.Exp(-elapsed.Seconds()/timeConstant.Seconds())
+	m.value += alpha * (x - m.value)
+	return m.value
+}
+
+var (
+	bitrates   BitrateStats
+	bitratePC  *webrtc.PeerConnection // Connection being sampled
+	bitratesMu sync.Mutex
+)
+
+// Bitrates returns the latest bitrate sample
+func Bitrates() BitrateStats {
+	bitratesMu.Lock()
+	defer bitratesMu.Unlock()
+	return bitrates
+}
+
+// startBitrateSampler samples pc's bitrates every -bitrate-interval until it
+// closes. It runs once per connection.
+func startBitrateSampler(pc *webrtc.PeerConnection) {
+	if *bitrateInterval <= 0 {
+		return
+	}
+	bitratesMu.Lock()
+	if bitratePC == pc {
+		bitratesMu.Unlock()
+		return
+	}
+	bitratePC, bitrates = pc, BitrateStats{}
+	bitratesMu.Unlock()
+
+	go sampleBitrates(pc, *bitrateInterval)
+}
+
+// sampleBitrates turns the RTP byte counters of pc into bitrates every interval
+func sampleBitrates(pc *webrtc.PeerConnection, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var outbound, inbound movingAverage
+	lastSent, lastReceived := rtpBytes(pc)
+	last := time.Now()
+	for range ticker.C {
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		sent, received := rtpBytes(pc)
+		now := time.Now()
+		elapsed := now.Sub(last)
+		// Counters restart with a new transport; skip the interval rather than go negative
+		if sent < lastSent || received < lastReceived || elapsed <= 0 {
+			lastSent, lastReceived, last = sent, received, now
+			continue
+		}
+		out := float64(sent-lastSent) * 8 / elapsed.Seconds()
+		in := float64(received-lastReceived) * 8 / elapsed.Seconds()
+		lastSent, lastReceived, last = sent, received, now
+
+		bitratesMu.Lock()
+		if bitratePC != pc {
+			bitratesMu.Unlock()
+			return
+		}
+		bitrates = BitrateStats{
+			Outbound:         out,
+			Inbound:          in,
+			OutboundSmoothed: outbound.update(out, elapsed, *bitrateSmoothing),
+			InboundSmoothed:  inbound.update(in, elapsed, *bitrateSmoothing),
+			Sampled:          now,
+		}
+		bitratesMu.Unlock()
+	}
+}
+
+// rtpBytes totals the RTP payload bytes pc has sent and received
+func rtpBytes(pc *webrtc.PeerConnection) (sent, received uint64) {
+	for _, s := range pc.GetStats() {
+		switch s := s.(type) {
+		case webrtc.OutboundRTPStreamStats:
+			sent += s.BytesSent
+		case webrtc.InboundRTPStreamStats:
+			received += s.BytesReceived
+		}
+	}
+	return sent, received
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestMovingAverageTracksTrend feeds the average a bitrate ramping from 1 to
+// 2 Mbps with ±40% noise, sampled at uneven intervals as a late ticker would,
+// and checks the average stays close to the trend, which it follows a time
+// constant behind, while the raw samples don't
+func TestMovingAverageTracksTrend(t *testing.T) {
+	const (
+		timeConstant = 10 * time.Second
+		duration     = 2 * time.Minute
+		tolerance    = 0.2 // Of the trend
+	)
+	trend := func(at time.Duration) float64 {
+		return 1e6 + 1e6*at.Seconds()/duration.Seconds()
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	var avg movingAverage
+	var rawErr, smoothedErr float64
+	var compared int
+	for at := time.Duration(0); at < duration; {
+		elapsed := 500*time.Millisecond + time.Duration(rng.Int63n(int64(time.Second)))
+		at += elapsed
+		raw := trend(at) * (1 + 0.8*(rng.Float64()-0.5))
+		smoothed := avg.update(raw, elapsed, timeConstant)
+
+		// Give the average three time constants to settle from its first sample
+		if at < 3*timeConstant {
+			continue
+		}
+		lagged := trend(at - timeConstant)
+		off := math.Abs(smoothed-lagged) / lagged
+		if off > tolerance {
+			t.Fatalf("at %v the average is %.0f bps, %.0f%% off the trend of %.0f bps", at, smoothed, off*100, lagged)
+		}
+		smoothedErr += off
+		rawErr += math.Abs(raw-lagged) / lagged
+		compared++
+	}
+	if smoothedErr > rawErr/2 {
+		t.Fatalf("average is off the trend by %.1f%% on average, the raw samples by %.1f%%; want it at least twice as close",
+			100*smoothedErr/float64(compared), 100*rawErr/float64(compared))
+	}
+}
+
+// TestMovingAverageWeighsElapsed checks a sample a whole time constant late
+// closes about 63% of the gap, and that no smoothing takes samples as is
+func TestMovingAverageWeighsElapsed(t *testing.T) {
+	var avg movingAverage
+	if got := avg.update(1000, time.Second, 5*time.Second); got != 1000 {
+		t.Fatalf("first sample averaged to %v, want it taken as is", got)
+	}
+	got := avg.update(2000, 5*time.Second, 5*time.Second)
+	if want := 1000 + 1000*(1-1/math.E); math.Abs(got-want) > 1e-6 {
+		t.Fatalf("after one time constant the average is %v, want %v", got, want)
+	}
+	if got := avg.update(3000, time.Second, 0); got != 3000 {
+		t.Fatalf("unsmoothed average is %v, want the sample", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	maxCallDuration = flag.Duration("max-call-duration", 0, "End the call this long after the peer connection is established (0 means no limit)")
+	callEndWarning  = flag.Duration("call-end-warning", 30*time.Second, "How long before -max-call-duration the peer is warned that the call is ending")
+)
+
+// callEnded receives the reason once the call limit tears the call down
+var callEnded = make(chan string, 1)
+
+var (
+	callTimers  []*time.Timer
+	callTimerPC *webrtc.PeerConnection // Connection the timers run for
+	callTimerMu sync.Mutex
+)
+
+// startCallTimer starts the -max-call-duration clock for pc. It runs once per
+// connection, so reconnecting after an ICE restart doesn't extend the call.
+func startCallTimer(pc *webrtc.PeerConnection) {
+	limit := *maxCallDuration
+	if limit <= 0 {
+		return
+	}
+	callTimerMu.Lock()
+	defer callTimerMu.Unlock()
+	if callTimerPC == pc {
+		return
+	}
+	for _, timer := range callTimers {
+		timer.Stop()
+	}
+	callTimers, callTimerPC = nil, pc
+
+	if warning := *callEndWarning; warning > 0 && warning < limit {
+		callTimers = append(callTimers, time.AfterFunc(limit-warning, func() {
+			log.Printf("Call ends in %s: maximum call duration reached", warning)
+			sendSignal(Signal{Type: "call-ending", UUID: currentUUID(), Reason: fmt.Sprintf("maximum call duration of %s reached in %s", limit, warning)})
+		}))
+	}
+	callTimers = append(callTimers, time.AfterFunc(limit, func() {
+		endCall(pc, fmt.Sprintf("maximum call duration of %s reached", limit))
+	}))
+}
+
+// endCall tears down pc and tells main to leave the call for reason
+func endCall(pc *webrtc.PeerConnection, reason string) {
+	log.Printf("Ending call: %s", reason)
+	emitEvent(Event{Kind: "call-ended", Detail: reason})
+	if err := pc.Close(); err != nil {
+		log.Printf("Failed to close peer connection: %v", err)
+	}
+	select {
+	case callEnded <- reason:
+	default:
+	}
+}
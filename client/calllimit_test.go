@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestMaxCallDuration starts a short call limit and checks the peer is warned
+// before it, and that at the limit the connection is closed and the call is
+// ended with the reason
+func TestMaxCallDuration(t *testing.T) {
+	server := newFakeSignalingServer(t, "call-limit")
+	server.connect(t)
+	previousLimit, previousWarning := *maxCallDuration, *callEndWarning
+	*maxCallDuration, *callEndWarning = 300*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() {
+		*maxCallDuration, *callEndWarning = previousLimit, previousWarning
+		callTimerMu.Lock()
+		callTimerPC = nil
+		callTimerMu.Unlock()
+	})
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	start := time.Now()
+	startCallTimer(pc)
+	// A second connected state, as after an ICE restart, doesn't restart the clock
+	startCallTimer(pc)
+
+	warning := server.expect(t, "call-ending")
+	if !strings.Contains(warning.Reason, "maximum call duration") {
+		t.Fatalf("warned %q, want the call limit as the reason", warning.Reason)
+	}
+	if len(callEnded) != 0 || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		t.Fatal("call ended before its limit")
+	}
+
+	select {
+	case reason := <-callEnded:
+		if elapsed := time.Since(start); elapsed < *maxCallDuration {
+			t.Fatalf("call ended after %v, before its %v limit", elapsed, *maxCallDuration)
+		}
+		if !strings.Contains(reason, "maximum call duration") {
+			t.Fatalf("call ended for %q, want the call limit", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call outlived its limit")
+	}
+	if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Fatalf("connection %s at the call limit, want closed", state)
+	}
+	if ev := expectEvent(t, "call-ended", time.Second); !strings.Contains(ev.Detail, "maximum call duration") {
+		t.Fatalf("call-ended event for %q, want the call limit", ev.Detail)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"sort"
+	"strings"
+)
+
+var maxSDPCandidates = flag.Int("max-sdp-candidates", 0, "Most candidates embedded in each media section of a signalled SDP, keeping the highest priority ones; bounds the SDP on multi-homed hosts without trickle (0 is unlimited)")
+
+// validateMaxSDPCandidates checks -max-sdp-candidates
+func validateMaxSDPCandidates() error {
+	if *maxSDPCandidates < 0 {
+		return errors.New("-max-sdp-candidates must not be negative")
+	}
+	return nil
+}
+
+// capSDPCandidates applies -max-sdp-candidates to sdp
+func capSDPCandidates(sdp string) string {
+	if *maxSDPCandidates == 0 {
+		return sdp
+	}
+	return withCandidateCap(sdp, *maxSDPCandidates)
+}
+
+// withCandidateCap drops all but the n highest priority a=candidate lines of
+// each media section, leaving the order of the rest as it was. Candidates
+// that can't be parsed rank last.
+func withCandidateCap(sdp string, n int) string {
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+	out := make([]string, 0, len(lines))
+	var section []string
+	flushSection := func() {
+		var candidates []int
+		for i, line := range section {
+			if strings.HasPrefix(line, "a=candidate:") {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) <= n {
+			out = append(out, section...)
+			section = section[:0]
+			return
+		}
+
+		priority := func(i int) uint32 {
+			c, err := parseCandidate(section[i])
+			if err != nil {
+				return 0
+			}
+			return c.Priority
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return priority(candidates[a]) > priority(candidates[b])
+		})
+		dropped := make(map[int]bool, len(candidates)-n)
+		for _, i := range candidates[n:] {
+			dropped[i] = true
+		}
+		for i, line := range section {
+			if !dropped[i] {
+				out = append(out, line)
+			}
+		}
+		section = section[:0]
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			flushSection()
+		}
+		section = append(section, line)
+	}
+	flushSection()
+	return strings.Join(out, "\r\n") + "\r\n"
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3/vnet"
+	"github.com/pion/webrtc/v4"
+)
+
+// multiHomedPeerConnection returns a peer connection on a virtual host with
+// an address on each of interfaces networks, so it gathers that many host
+// candidates
+func multiHomedPeerConnection(t *testing.T, interfaces int) *webrtc.PeerConnection {
+	t.Helper()
+	router, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "10.0.0.0/16", LoggerFactory: logging.NewDefaultLoggerFactory()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for i := range interfaces {
+		ips = append(ips, fmt.Sprintf("10.0.%d.1", i+1))
+	}
+	nw, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: ips})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.AddNet(nw); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Stop() })
+
+	se := webrtc.SettingEngine{}
+	se.SetNet(nw)
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	peerConnection = pc
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		peerConnection = nil
+		mutex.Unlock()
+		pc.Close()
+	})
+	return pc
+}
+
+// TestMaxSDPCandidates sends a non-trickle offer from a host on twelve
+// networks with -max-sdp-candidates set, and checks each media section keeps
+// only that many candidates, the highest priority ones, so the signalled SDP
+// stays within the size of its other lines plus that many candidates
+func TestMaxSDPCandidates(t *testing.T) {
+	const limit = 4
+	server := newFakeSignalingServer(t, "multi-homed")
+	server.connect(t)
+	previous := *maxSDPCandidates
+	*maxSDPCandidates = limit
+	setPeerTrickle(false)
+	t.Cleanup(func() {
+		*maxSDPCandidates = previous
+		setPeerTrickle(true)
+		offers.answered()
+	})
+
+	pc := multiHomedPeerConnection(t, 12)
+	if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	signalled := sendDescription(pc, offer).SDP.SDP
+	gathered := pc.LocalDescription().SDP
+
+	// The bound: everything but the candidates, plus the longest ones allowed
+	var longest, sections int
+	bound := len(withEndOfCandidates(gathered))
+	for _, section := range strings.Split(gathered, "\r\nm=") {
+		candidates := 0
+		for _, line := range strings.Split(section, "\r\n") {
+			if strings.HasPrefix(line, "a=candidate:") {
+				candidates++
+				bound -= len(line) + len("\r\n")
+				longest = max(longest, len(line)+len("\r\n"))
+			}
+		}
+		if candidates > limit {
+			sections++
+		}
+	}
+	if sections == 0 {
+		t.Fatalf("no media section gathered more than %d candidates:\n%s", limit, gathered)
+	}
+	bound += strings.Count(gathered, "\r\nm=") * limit * longest
+	if len(signalled) > bound {
+		t.Fatalf("signalled SDP is %d bytes, want at most %d", len(signalled), bound)
+	}
+
+	var lowestKept uint32 = ^uint32(0)
+	for _, section := range strings.Split(signalled, "\r\nm=") {
+		kept := 0
+		for _, line := range strings.Split(section, "\r\n") {
+			if !strings.HasPrefix(line, "a=candidate:") {
+				continue
+			}
+			kept++
+			c, err := parseCandidate(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lowestKept = min(lowestKept, c.Priority)
+		}
+		if kept > limit {
+			t.Fatalf("media section carries %d candidates, want at most %d", kept, limit)
+		}
+	}
+	for _, line := range strings.Split(gathered, "\r\n") {
+		if !strings.HasPrefix(line, "a=candidate:") || strings.Contains(signalled, line) {
+			continue
+		}
+		if c, err := parseCandidate(line); err == nil && c.Priority > lowestKept {
+			t.Errorf("dropped %q, which outranks a kept candidate", line)
+		}
+	}
+
+	*maxSDPCandidates = -1
+	if err := validateSDPFlags(); err == nil || !strings.Contains(err.Error(), "-max-sdp-candidates") {
+		t.Errorf("-max-sdp-candidates -1: %v, want it refused", err)
+	}
+}
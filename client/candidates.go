@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// CandidateInfo is a snapshot of a locally gathered ICE candidate
+type CandidateInfo struct {
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     uint16 `json:"port"`
+	Priority uint32 `json:"priority"`
+}
+
+var (
+	localCandidates   []CandidateInfo
+	localCandidatesMu sync.Mutex
+)
+
+// recordLocalCandidate stores a gathered candidate so it can be inspected later
+func recordLocalCandidate(candidate *webrtc.ICECandidate) {
+	info := CandidateInfo{
+		Type:     candidate.Typ.String(),
+		Protocol: candidate.Protocol.String(),
+		Address:  candidate.Address,
+		Port:     candidate.Port,
+		Priority: candidate.Priority,
+	}
+
+	localCandidatesMu.Lock()
+	localCandidates = append(localCandidates, info)
+	localCandidatesMu.Unlock()
+
+	if *logCandidates {
+		log.Printf("Gathered %s candidate: %s %s:%d (priority %d)",
+			info.Type, info.Protocol, info.Address, info.Port, info.Priority)
+	}
+}
+
+// LocalCandidates returns every candidate gathered so far, in gathering order
+func LocalCandidates() []CandidateInfo {
+	localCandidatesMu.Lock()
+	defer localCandidatesMu.Unlock()
+	return append([]CandidateInfo(nil), localCandidates...)
+}
+
+// resetLocalCandidates clears the recorded candidates for a new peer connection
+func resetLocalCandidates() {
+	localCandidatesMu.Lock()
+	localCandidates = nil
+	localCandidatesMu.Unlock()
+}
+
+// dumpLocalCandidates logs a summary of all gathered candidates
+func dumpLocalCandidates() {
+	candidates := LocalCandidates()
+	log.Printf("ICE gathering complete: %d local candidates", len(candidates))
+	for i, c := range candidates {
+		log.Printf("  [%d] %s %s %s:%d priority=%d", i, c.Type, c.Protocol, c.Address, c.Port, c.Priority)
+	}
+}
+
+// Candidate is the parsed form of an SDP candidate attribute (RFC 8839 section 5.1)
+type Candidate struct {
+	Foundation     string
+	Component      uint16
+	Protocol       string // "udp" or "tcp", lower-cased
+	Priority       uint32
+	IP             string
+	Port           uint16
+	Type           string // host, srflx, prflx or relay
+	RelatedAddress string
+	RelatedPort    uint16
+	TCPType        string // active, passive or so; TCP candidates only
+}
+
+// parseCandidate parses a candidate line such as
+// "candidate:1 1 udp 2130706431 192.0.2.1 54400 typ host".
+// The "candidate:" and "a=candidate:" prefixes are optional.
+func parseCandidate(s string) (Candidate, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "a=")
+	s = strings.TrimPrefix(s, "candidate:")
+
+	fields := strings.Fields(s)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return Candidate{}, fmt.Errorf("malformed candidate %q", s)
+	}
+
+	component, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("invalid component %q: %w", fields[1], err)
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("invalid priority %q: %w", fields[3], err)
+	}
+	port, err := strconv.ParseUint(fields[5], 10, 16)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("invalid port %q: %w", fields[5], err)
+	}
+
+	c := Candidate{
+		Foundation: fields[0],
+		Component:  uint16(component),
+		Protocol:   strings.ToLower(fields[2]),
+		Priority:   uint32(priority),
+		IP:         fields[4],
+		Port:       uint16(port),
+		Type:       fields[7],
+	}
+
+	// The remaining fields are name/value extension pairs
+	for i := 8; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "raddr":
+			c.RelatedAddress = fields[i+1]
+		case "rport":
+			rport, err := strconv.ParseUint(fields[i+1], 10, 16)
+			if err != nil {
+				return Candidate{}, fmt.Errorf("invalid rport %q: %w", fields[i+1], err)
+			}
+			c.RelatedPort = uint16(rport)
+		case "tcptype":
+			c.TCPType = fields[i+1]
+		}
+	}
+	return c, nil
+}
+
+// String formats the candidate for structured logs
+func (c Candidate) String() string {
+	s := fmt.Sprintf("type=%s protocol=%s addr=%s:%d priority=%d foundation=%s", c.Type, c.Protocol, c.IP, c.Port, c.Priority, c.Foundation)
+	if c.RelatedAddress != "" {
+		s += fmt.Sprintf(" related=%s:%d", c.RelatedAddress, c.RelatedPort)
+	}
+	if c.TCPType != "" {
+		s += " tcptype=" + c.TCPType
+	}
+	return s
+}
+
+// logRemoteCandidate logs a candidate received from the peer in structured form
+func logRemoteCandidate(line string) {
+	if line == "" {
+		return
+	}
+	c, err := parseCandidate(line)
+	if err != nil {
+		log.Printf("Received unparseable remote candidate: %v", err)
+		return
+	}
+	log.Printf("Received remote candidate: %s", c)
+}
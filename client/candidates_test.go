@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestLocalCandidatesRecorded gathers candidates on a loopback connection and
+// checks a host candidate is recorded with its details
+func TestLocalCandidatesRecorded(t *testing.T) {
+	resetLocalCandidates()
+	t.Cleanup(resetLocalCandidates)
+
+	offerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offerer.Close()
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer answerer.Close()
+	offerer.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			recordLocalCandidate(candidate)
+		}
+	})
+	if _, err := offerer.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+	connectLoopback(t, offerer, answerer)
+
+	candidates := LocalCandidates()
+	for _, c := range candidates {
+		if c.Type == webrtc.ICECandidateTypeHost.String() {
+			if c.Address == "" || c.Port == 0 || c.Priority == 0 || c.Protocol == "" {
+				t.Fatalf("host candidate missing details: %+v", c)
+			}
+			return
+		}
+	}
+	t.Fatalf("no host candidate among %+v", candidates)
+}
+
+// TestParseCandidate parses host, srflx and relay candidates over UDP and TCP
+// and checks every field, and that malformed lines are rejected
+func TestParseCandidate(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want Candidate
+	}{
+		{
+			"candidate:1 1 udp 2130706431 192.168.1.20 54400 typ host",
+			Candidate{Foundation: "1", Component: 1, Protocol: "udp", Priority: 2130706431, IP: "192.168.1.20", Port: 54400, Type: "host"},
+		},
+		{
+			"a=candidate:2 1 UDP 1694498815 203.0.113.7 61000 typ srflx raddr 192.168.1.20 rport 54400",
+			Candidate{Foundation: "2", Component: 1, Protocol: "udp", Priority: 1694498815, IP: "203.0.113.7", Port: 61000, Type: "srflx", RelatedAddress: "192.168.1.20", RelatedPort: 54400},
+		},
+		{
+			"candidate:3 1 udp 16777215 198.51.100.9 3478 typ relay raddr 203.0.113.7 rport 61000",
+			Candidate{Foundation: "3", Component: 1, Protocol: "udp", Priority: 16777215, IP: "198.51.100.9", Port: 3478, Type: "relay", RelatedAddress: "203.0.113.7", RelatedPort: 61000},
+		},
+		{
+			"candidate:4 1 tcp 1518280447 2001:db8::1 9 typ host tcptype active",
+			Candidate{Foundation: "4", Component: 1, Protocol: "tcp", Priority: 1518280447, IP: "2001:db8::1", Port: 9, Type: "host", TCPType: "active"},
+		},
+	} {
+		got, err := parseCandidate(tc.line)
+		if err != nil {
+			t.Errorf("%q: %v", tc.line, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q:\n got %+v\nwant %+v", tc.line, got, tc.want)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		"candidate:1 1 udp 2130706431 192.168.1.20 54400",
+		"candidate:1 1 udp 2130706431 192.168.1.20 54400 host",
+		"candidate:1 1 udp high 192.168.1.20 54400 typ host",
+		"candidate:1 1 udp 2130706431 192.168.1.20 99999 typ host",
+	} {
+		if c, err := parseCandidate(line); err == nil {
+			t.Errorf("%q parsed as %+v, want an error", line, c)
+		}
+	}
+}
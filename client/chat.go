@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const chatLabel = "chat"
+
+var (
+	chatEnabled        = flag.Bool("chat", false, "Open a chat data channel: lines typed on stdin are sent to the peer and its messages are logged")
+	chatUnordered      = flag.Bool("chat-unordered", false, "Let chat messages arrive out of order")
+	chatMaxRetransmits = flag.Int("chat-max-retransmits", -1, "Give up on a chat message after this many retransmissions (-1 retransmits until delivered)")
+)
+
+// errChatClosed is returned when sending chat without an open channel
+var errChatClosed = errors.New("chat channel is not open")
+
+var (
+	chatChannel   *webrtc.DataChannel
+	chatChannelMu sync.Mutex
+)
+
+func init() {
+	dataChannelHandlers[chatLabel] = attachChatChannel
+}
+
+// validateChat checks -chat-max-retransmits fits the SCTP field
+func validateChat() error {
+	if *chatMaxRetransmits < -1 || *chatMaxRetransmits > 65535 {
+		return errors.New("-chat-max-retransmits must be between -1 and 65535")
+	}
+	return nil
+}
+
+// setupChat creates the chat channel on the caller side with the configured
+// ordering and reliability. The callee receives it through OnDataChannel,
+// along with those settings.
+func setupChat(pc *webrtc.PeerConnection, isCaller bool) error {
+	if !*chatEnabled || !isCaller {
+		return nil
+	}
+
+	ordered := !*chatUnordered
+	options := &webrtc.DataChannelInit{Ordered: &ordered}
+	if *chatMaxRetransmits >= 0 {
+		maxRetransmits := uint16(*chatMaxRetransmits)
+		options.MaxRetransmits = &maxRetransmits
+	}
+	dc, err := pc.CreateDataChannel(chatLabel, options)
+	if err != nil {
+		return err
+	}
+	attachChatChannel(dc)
+	return nil
+}
+
+// attachChatChannel makes dc the channel SendChat writes to and logs what
+// arrives on it. Each message is also published as a "chat" event.
+func attachChatChannel(dc *webrtc.DataChannel) {
+	if !*chatEnabled {
+		log.Printf("Ignoring chat channel: -chat is off")
+		return
+	}
+
+	chatChannelMu.Lock()
+	chatChannel = dc
+	chatChannelMu.Unlock()
+
+	dc.OnOpen(func() {
+		log.Printf("Chat channel open (ordered %v)", dc.Ordered())
+	})
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		log.Printf("Chat from %s: %s", recipient(), msg.Data)
+		emitEvent(Event{Kind: "chat", Detail: string(msg.Data)})
+	})
+	dc.OnClose(func() {
+		log.Println("Chat channel closed")
+		chatChannelMu.Lock()
+		if chatChannel == dc {
+			chatChannel = nil
+		}
+		chatChannelMu.Unlock()
+	})
+}
+
+// SendChat sends text to the peer over the chat channel
+func SendChat(text string) error {
+	chatChannelMu.Lock()
+	dc := chatChannel
+	chatChannelMu.Unlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return errChatClosed
+	}
+	return dc.SendText(text)
+}
+
+// readChatInput sends each line typed on stdin as a chat message until stdin closes
+func readChatInput() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if err := SendChat(scanner.Text()); err != nil {
+			log.Printf("Failed to send chat: %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestChatRoundTrip opens the chat channel between two in-process peer
+// connections, reliable and ordered and then unordered with a retransmit
+// limit, and checks the callee sees the caller's settings and that a
+// message crosses each way
+func TestChatRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		unordered      bool
+		maxRetransmits int
+	}{
+		{"reliable", false, -1},
+		{"unordered", true, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			previousEnabled, previousUnordered, previousMax := *chatEnabled, *chatUnordered, *chatMaxRetransmits
+			*chatEnabled, *chatUnordered, *chatMaxRetransmits = true, tc.unordered, tc.maxRetransmits
+			t.Cleanup(func() {
+				*chatEnabled, *chatUnordered, *chatMaxRetransmits = previousEnabled, previousUnordered, previousMax
+				chatChannelMu.Lock()
+				chatChannel = nil
+				chatChannelMu.Unlock()
+			})
+			if err := SendChat("too early"); !errors.Is(err, errChatClosed) {
+				t.Fatalf("sending without a channel: %v, want errChatClosed", err)
+			}
+
+			caller, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { caller.Close() })
+			callee, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { callee.Close() })
+
+			if err := setupChat(caller, true); err != nil {
+				t.Fatal(err)
+			}
+			chatChannelMu.Lock()
+			callerChannel := chatChannel
+			chatChannelMu.Unlock()
+			callerOpen := make(chan struct{})
+			callerChannel.OnOpen(func() { close(callerOpen) })
+
+			// Both ends share the process, so SendChat writes on whichever
+			// channel was attached last: the callee's
+			calleeChannel := make(chan *webrtc.DataChannel, 1)
+			callee.OnDataChannel(func(dc *webrtc.DataChannel) {
+				handleDataChannel(dc)
+				calleeChannel <- dc
+			})
+			connectLoopback(t, caller, callee)
+
+			var dc *webrtc.DataChannel
+			select {
+			case dc = <-calleeChannel:
+			case <-time.After(5 * time.Second):
+				t.Fatal("callee never received the chat channel")
+			}
+			if dc.Ordered() == tc.unordered {
+				t.Fatalf("callee's channel ordered %v, want %v", dc.Ordered(), !tc.unordered)
+			}
+			if tc.maxRetransmits < 0 {
+				if dc.MaxRetransmits() != nil {
+					t.Fatalf("callee's channel gives up after %d retransmits, want it reliable", *dc.MaxRetransmits())
+				}
+			} else if dc.MaxRetransmits() == nil || int(*dc.MaxRetransmits()) != tc.maxRetransmits {
+				t.Fatalf("callee's channel retransmits %v, want %d", dc.MaxRetransmits(), tc.maxRetransmits)
+			}
+			select {
+			case <-callerOpen:
+			case <-time.After(5 * time.Second):
+				t.Fatal("caller's chat channel never opened")
+			}
+			waitFor(t, "the callee's chat channel to open", func() bool {
+				return dc.ReadyState() == webrtc.DataChannelStateOpen
+			})
+
+			if err := SendChat("hello caller"); err != nil {
+				t.Fatal(err)
+			}
+			if ev := expectEvent(t, "chat", 5*time.Second); ev.Detail != "hello caller" {
+				t.Fatalf("caller got %q, want hello caller", ev.Detail)
+			}
+			if err := callerChannel.SendText("hello callee"); err != nil {
+				t.Fatal(err)
+			}
+			if ev := expectEvent(t, "chat", 5*time.Second); ev.Detail != "hello callee" {
+				t.Fatalf("callee got %q, want hello callee", ev.Detail)
+			}
+		})
+	}
+}
@@ -1,133 +1,351 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
+	"net/url"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v4"
 )
 
 // Global variables
 var (
 	peerConnection *webrtc.PeerConnection
 	serverConn     *websocket.Conn
-	uuid           string
 	mutex          sync.Mutex
+	writeMu        sync.Mutex
+	dialSignaling  = dialWith(websocket.DefaultDialer) // Opens every signaling connection
+	signalingURL   string
+
+	// encodeBuffers are reused to marshal outgoing signals
+	encodeBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+	logCandidates = flag.Bool("log-candidates", false, "Log every locally gathered ICE candidate and dump the full list once gathering completes")
+	noTrickle     = flag.Bool("no-trickle", false, "Disable trickle ICE: gather fully and send candidates inside the SDP")
+	roomName      = flag.String("room", "", "Signaling room to join on -server (empty joins the default room)")
+	serverFlag    = flag.String("server", "wss://localhost:8443/ws", "Signaling server WebSocket URL, used unless -servers is set")
+	callerFlag    = flag.Bool("caller", true, "Send the first offer once connected; with -caller=false wait for the peer's offer")
+	sendVideo     = flag.Bool("video", true, "Send a video track; without one, video is only received")
+	sendAudio     = flag.Bool("audio", true, "Send an audio track; without one, audio is only received")
 )
 
 // Signal represents the WebRTC signaling message
 type Signal struct {
-	SDP  *webrtc.SessionDescription `json:"sdp,omitempty"`
-	ICE  *webrtc.ICECandidateInit   `json:"ice,omitempty"`
-	UUID string                     `json:"uuid"`
+	Type    string                     `json:"type,omitempty"` // Control message type such as "bye" or "roster"; empty for SDP/ICE
+	SDP     *webrtc.SessionDescription `json:"sdp,omitempty"`
+	ICE     *webrtc.ICECandidateInit   `json:"ice,omitempty"`
+	UUID    string                     `json:"uuid"`
+	To      string                     `json:"to,omitempty"`      // Recipient UUID; empty reaches the whole room
+	Trickle *bool                      `json:"trickle,omitempty"` // Sender's trickle ICE capability, set on SDP messages
+	Stream  string                     `json:"stream,omitempty"`  // "data" for the data-only connection; empty for media
+
+	// Clock sync: ServerTime is stamped by the server on every forwarded
+	// message; ClientTime is echoed back on "time" probes
+	ServerTime int64 `json:"serverTime,omitempty"`
+	ClientTime int64 `json:"clientTime,omitempty"`
+
+	// Roster updates and server notices
+	Event   string   `json:"event,omitempty"`
+	Peers   []string `json:"peers,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	ConnID  string   `json:"connId,omitempty"`  // Set on the server's welcome
+	Bitrate int64    `json:"bitrate,omitempty"` // Per-stream cap, set on "bandwidth" messages
+
+	// ICE servers the server's config hands out, set on its welcome
+	ICEServers []webrtc.ICEServer `json:"iceServers,omitempty"`
 }
 
 func main() {
+	flag.Parse()
+	if err := validateSDPFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if priorities, err := parseTrackPriorities(*trackPriorityFlag); err != nil {
+		log.Fatal(err)
+	} else {
+		configuredPriorities = priorities
+	}
+	if _, err := parseCodecAllowlist(*allowCodecs); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateStartupKeyframes(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateReconnectRecovery(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateExtraTracks(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateVideoFile(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateAudioFile(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateChat(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateServerURL(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateDTLSTimeout(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateReconnect(); err != nil {
+		log.Fatal(err)
+	}
+	if servers, err := loadICEConfig(); err != nil {
+		log.Fatalf("Failed to load ICE servers: %v", err)
+	} else {
+		staticICEServers = servers
+	}
+
 	// Initialize
-	uuid = createUUID()
-	log.Printf("Client UUID: %s", uuid)
+	startDiagnostics()
+	dialSignaling = dialWith(signalingDialer())
+	if *chatEnabled {
+		go readChatInput()
+	}
+	setUUID(newUUID())
+	log.Printf("Client UUID: %s", currentUUID())
 
 	// Connect to WebSocket server
-	serverURL := "wss://localhost:8443/ws"
+	serverURL := *serverFlag
+	if *roomName != "" {
+		serverURL += "/" + url.PathEscape(*roomName)
+	}
+	signalingState = newSignalingState()
+	signalingState.Fire(TriggerConnect)
 	var err error
-	serverConn, _, err = websocket.DefaultDialer.Dial(serverURL, nil)
+	if candidates := serverCandidates(); len(candidates) > 0 {
+		if serverURL, err = selectServer(candidates); err != nil {
+			log.Fatalf("Failed to select signaling server: %v", err)
+		}
+		log.Printf("Selected signaling server %s", serverURL)
+	}
+	signalingURL = serverURL
+	serverConn, err = dialSignaling(serverURL)
 	if err != nil {
+		signalingState.Fire(TriggerDropped)
 		log.Fatalf("Failed to connect to WebSocket server: %v", err)
 	}
 	defer serverConn.Close()
+	signalingState.Fire(TriggerConnected)
 	log.Println("Connected to signaling server")
+	register()
+	if *standbyServer != "" {
+		startStandby(*standbyServer)
+	}
 
 	// Configure WebRTC
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.stunprotocol.org:3478", "stun:stun.l.google.com:19302"},
-			},
-		},
-	}
+	config := defaultConfiguration()
 
 	// Create media tracks
 	// Note: In a real implementation, you would use gstreamer or similar
 	// to capture real media, but that's beyond a simple example
 	log.Println("Creating media tracks (simulated)")
 
-	// Prepare to handle incoming messages from the server
+	// Start as the caller (initiator) unless told to wait for an offer
+	start(*callerFlag, config)
+
+	// Handle incoming messages from the server once there is a peer
+	// connection, so an offer already waiting for us doesn't make its own
 	go handleServerMessages()
+	go runClockSync()
+	// Only the caller offers the data connection; the callee answers it
+	if *dataConnection && *callerFlag {
+		if err := startDataConnection(config); err != nil {
+			log.Fatalf("Failed to start data connection: %v", err)
+		}
+	}
 
-	// Start as a caller (initiator)
-	start(true, config)
+	// Keep the application running until interrupted or the call limit ends
+	// the call, then leave gracefully
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	var reason string
+	select {
+	case <-interrupt:
+	case reason = <-callEnded:
+	}
 
-	// Keep the application running
-	select {}
+	log.Println("Leaving call")
+	sendSignal(Signal{Type: "bye", UUID: currentUUID(), Reason: reason})
+	signalingState.Fire(TriggerClose)
+	stopStandby()
+	closeDataConnection()
+	stopMediaStream()
+	closeRecordings()
+}
+
+// defaultConfiguration returns the ICE configuration for new peer connections.
+// Servers come from -ice-provider when set, then from -ice-config or
+// ICE_SERVERS, then from the signaling server's welcome, falling back to
+// public STUN.
+func defaultConfiguration() webrtc.Configuration {
+	if provider := configuredICEProvider(); provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		servers, err := provider.Fetch(ctx)
+		if err == nil {
+			return completeConfiguration(webrtc.Configuration{ICEServers: servers})
+		}
+		log.Printf("Failed to fetch ICE servers, using defaults: %v", err)
+	}
+	if len(staticICEServers) > 0 {
+		return completeConfiguration(webrtc.Configuration{ICEServers: staticICEServers})
+	}
+	if servers := serverICEServers(); len(servers) > 0 {
+		return completeConfiguration(webrtc.Configuration{ICEServers: servers})
+	}
+
+	return completeConfiguration(webrtc.Configuration{
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.stunprotocol.org:3478", "stun:stun.l.google.com:19302"},
+			},
+		},
+	})
+}
+
+// completeConfiguration applies the transport policies the -peer-compat peer
+// needs, -force-relay and the shared DTLS certificate
+func completeConfiguration(config webrtc.Configuration) webrtc.Configuration {
+	if *peerCompat == "safari" {
+		config.BundlePolicy = webrtc.BundlePolicyMaxBundle
+		config.RTCPMuxPolicy = webrtc.RTCPMuxPolicyRequire
+	}
+	applyRelayPolicy(&config)
+	if cert, err := certificate(); err == nil {
+		config.Certificates = []webrtc.Certificate{*cert}
+	} else {
+		log.Printf("Failed to generate DTLS certificate, pion will make its own: %v", err)
+	}
+	return config
 }
 
 func start(isCaller bool, config webrtc.Configuration) {
 	var err error
-	
+
 	// Create a new PeerConnection
+	resetLocalCandidates()
+	resetDeferredCandidates()
+	renegotiations.reset()
+	perfect.reset()
+	api, err := newWebRTCAPI(isCaller)
+	if err != nil {
+		log.Fatalf("Failed to configure WebRTC API: %v", err)
+	}
 	mutex.Lock()
-	peerConnection, err = webrtc.NewPeerConnection(config)
+	peerConnection, err = api.NewPeerConnection(config)
 	mutex.Unlock()
 	if err != nil {
 		log.Fatalf("Failed to create peer connection: %v", err)
 	}
 
+	watchConnection(peerConnection)
+
 	// Set up ICE candidate handling
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate == nil {
+			releaseDeferredCandidates()
+			flushCandidates()
+			if *logCandidates {
+				dumpLocalCandidates()
+			}
 			return
 		}
+		recordLocalCandidate(candidate)
 
-		candidateInit := candidate.ToJSON()
-		signal := Signal{
-			ICE:  &candidateInit,
-			UUID: uuid,
+		// Non-trickle peers receive all candidates embedded in the SDP instead
+		if !trickleEnabled() {
+			return
 		}
 
-		sendSignal(signal)
+		// Candidates gathered for the initial offer wait until it is sent, and
+		// those of the non-preferred family until gathering completes
+		if init := candidate.ToJSON(); !holdCandidate(init) && !deferCandidate(init) {
+			queueCandidate(init)
+		}
 	})
 
 	// Set up track handling
+	pc := peerConnection
 	peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 		log.Printf("Received remote track: %s", track.ID())
-		// In a real implementation, you would handle the media here
+		rt := RemoteTracks.add(peerOf(pc), track)
+		done := make(chan struct{})
+		go requestKeyframes(pc, track, done)
+		go func() {
+			readRemoteTrack(pc, track, newMidTagger(pc, receiver))
+			close(done)
+			RemoteTracks.remove(rt)
+		}()
 	})
 
-	// Create and add a simulated video track (in a real app, this would be a real camera)
-	videoTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: "video/vp8"},
-		"video",
-		"pion-video",
-	)
-	if err != nil {
-		log.Fatalf("Failed to create video track: %v", err)
+	// Route incoming data channels to their feature by label
+	peerConnection.OnDataChannel(handleDataChannel)
+	if err := setupFrameMetadata(peerConnection, isCaller); err != nil {
+		log.Fatalf("Failed to create frame metadata channel: %v", err)
 	}
-	_, err = peerConnection.AddTrack(videoTrack)
-	if err != nil {
-		log.Fatalf("Failed to add video track: %v", err)
+	if err := setupChat(peerConnection, isCaller); err != nil {
+		log.Fatalf("Failed to create chat channel: %v", err)
 	}
 
-	// Create and add a simulated audio track
-	audioTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: "audio/opus"},
-		"audio",
-		"pion-audio",
-	)
-	if err != nil {
-		log.Fatalf("Failed to create audio track: %v", err)
+	// Create and add a simulated video track (in a real app, this would be a
+	// real camera), or just receive video under -video=false
+	var videoTrack, audioTrack *webrtc.TrackLocalStaticSample
+	if *sendVideo {
+		videoTrack, err = webrtc.NewTrackLocalStaticSample(
+			webrtc.RTPCodecCapability{MimeType: "video/vp8"},
+			"video",
+			"pion-video",
+		)
+		if err != nil {
+			log.Fatalf("Failed to create video track: %v", err)
+		}
+		videoSender, err := peerConnection.AddTrack(videoTrack)
+		if err != nil {
+			log.Fatalf("Failed to add video track: %v", err)
+		}
+		go readSenderRTCP(videoSender)
+		addVideoTrack(videoTrack.ID())
+	} else {
+		receiveOnly(peerConnection, webrtc.RTPCodecTypeVideo)
 	}
-	_, err = peerConnection.AddTrack(audioTrack)
-	if err != nil {
-		log.Fatalf("Failed to add audio track: %v", err)
+
+	// Create and add a simulated audio track, or just receive audio
+	if *sendAudio {
+		audioTrack, err = webrtc.NewTrackLocalStaticSample(
+			webrtc.RTPCodecCapability{MimeType: "audio/opus"},
+			"audio",
+			"pion-audio",
+		)
+		if err != nil {
+			log.Fatalf("Failed to create audio track: %v", err)
+		}
+		if _, err = peerConnection.AddTrack(audioTrack); err != nil {
+			log.Fatalf("Failed to add audio track: %v", err)
+		}
+	} else {
+		receiveOnly(peerConnection, webrtc.RTPCodecTypeAudio)
 	}
 
-	// Start simulating video frames in a goroutine
-	go simulateMediaStream(videoTrack, audioTrack)
+	// Start simulating media; audio and video run on independent clocks
+	startMediaStream(peerConnection, videoTrack, audioTrack)
 
 	// If this client is the caller, create an offer
 	if isCaller {
@@ -136,48 +354,172 @@ func start(isCaller bool, config webrtc.Configuration) {
 }
 
 func createOffer() {
+	negotiation.begin(peerConnection)
+	done := perfect.offering()
+	defer done()
+
 	// Create an offer
-	offer, err := peerConnection.CreateOffer(nil)
+	offer, err := makeOffer(peerConnection, OfferOptions{})
 	if err != nil {
-		log.Fatalf("Failed to create offer: %v", err)
+		log.Printf("Failed to create offer: %v", err)
+		negotiationFailed(peerConnection, webrtc.SDPTypeOffer, err)
+		return
 	}
 
-	// Set local description
-	err = peerConnection.SetLocalDescription(offer)
-	if err != nil {
-		log.Fatalf("Failed to set local description: %v", err)
+	// Set local description, which starts gathering
+	holdCandidates()
+	if err := setLocalDescription(peerConnection, offer); err != nil {
+		stopHolding()
+		log.Printf("Failed to set local description: %v", err)
+		return
 	}
 
-	// Send the offer to the signaling server
-	signal := Signal{
-		SDP:  &offer,
-		UUID: uuid,
-	}
-	sendSignal(signal)
+	// Send the offer to the signaling server, with host candidates under -half-trickle
+	offer, release := withHostCandidates(peerConnection, offer)
+	sendDescription(peerConnection, offer)
+	release()
 }
 
 func handleServerMessages() {
 	for {
-		_, message, err := serverConn.ReadMessage()
+		// Reconnects and rejoins swap the connection under writeMu
+		writeMu.Lock()
+		conn := serverConn
+		writeMu.Unlock()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket read error: %v", err)
-			return
+			// The standby's reader carries on as the primary's
+			if promoteStandby() {
+				recoverAfterReconnect()
+				return
+			}
+			if state, _ := signalingState.Fire(TriggerDropped); state != StateReconnecting || !reconnectSignaling() {
+				return
+			}
+			recoverAfterReconnect()
+			continue
 		}
 
-		var signal Signal
-		if err := json.Unmarshal(message, &signal); err != nil {
-			log.Printf("Failed to parse signal message: %v", err)
-			continue
+		if !duplicateDelivery(message) {
+			handleServerMessage(message)
+		}
+	}
+}
+
+// handleServerMessage dispatches one message from the signaling server
+func handleServerMessage(message []byte) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &probe); err == nil && probe.Type == "candidates" {
+		if err := handleCandidateBatch(message); err != nil {
+			log.Printf("Failed to parse candidate batch: %v", err)
 		}
+		return
+	}
 
-		// Ignore messages from ourselves
-		if signal.UUID == uuid {
-			continue
+	var signal Signal
+	if err := json.Unmarshal(message, &signal); err != nil {
+		log.Printf("Failed to parse signal message: %v", err)
+		return
+	}
+	publishSignal(signal)
+
+	switch signal.Type {
+	case "welcome":
+		initial := ConnID() == ""
+		setConnID(signal.ConnID)
+		// A welcome after a reconnect may carry refreshed TURN credentials.
+		// The first one arrives before any peer connection is configured.
+		if setServerICEServers(signal.ICEServers) && !initial {
+			go refreshICEServers()
+		}
+		return
+	case "roster":
+		// Roster updates come from the server rather than a peer
+		log.Printf("Roster %s (%s): %v", signal.Event, signal.UUID, signal.Peers)
+		return
+	case "peers":
+		// The server picks which peers we connect to when the mesh is capped
+		setMeshTargets(signal.Peers)
+		return
+	case "time":
+		// Replies to our own clock probes
+		if signal.UUID == currentUUID() {
+			recordClockSample(signal.ClientTime, signal.ServerTime, time.Now().UnixNano())
+		}
+		return
+	case "bye":
+		log.Printf("Received bye from %s: %s", signal.UUID, signal.Reason)
+		return
+	case "call-ending":
+		// The peer's call limit is about to end the call
+		if signal.UUID != currentUUID() {
+			log.Printf("Peer %s is ending the call: %s", signal.UUID, signal.Reason)
+			emitEvent(Event{Kind: "call-ending", Detail: signal.Reason})
+		}
+		return
+	case "pause", "resume":
+		// The peer paused or resumed its side of the call
+		if signal.UUID != currentUUID() {
+			log.Printf("Peer %s sent %s", signal.UUID, signal.Type)
+			emitEvent(Event{Kind: "peer-" + signal.Type, Detail: signal.UUID})
+		}
+		return
+	case "ice-restart":
+		// The peer or the server asks us to offer an ICE restart
+		if signal.UUID != currentUUID() {
+			log.Printf("ICE restart requested by %s", signal.UUID)
+			if err := RestartICE(); err != nil {
+				log.Printf("Failed to restart ICE: %v", err)
+			}
+		}
+		return
+	case "record-start", "record-stop":
+		// The peer asks us to record the call, if we let it
+		if signal.UUID != currentUUID() && *recordRequests {
+			log.Printf("Peer %s sent %s", signal.UUID, signal.Type)
+			if signal.Type == "record-stop" {
+				StopRecording()
+			} else if err := StartRecording(); err != nil {
+				log.Printf("Failed to start recording: %v", err)
+			}
+		}
+		return
+	case "bandwidth":
+		// The server's share of the room's bandwidth budget
+		setRoomBitrateCap(signal.Bitrate)
+		return
+	case "rejected":
+		// The server refused our SDP and is about to disconnect us
+		log.Printf("Rejected by server: %s", signal.Reason)
+		emitEvent(Event{Kind: "rejected", Detail: signal.Reason})
+		if signal.Reason == "uuid-conflict" {
+			rejoinWithFreshUUID()
 		}
+		return
+	}
+
+	// Ignore messages from ourselves
+	if signal.UUID == currentUUID() {
+		return
+	}
+
+	// Peers the server didn't link us to are over the mesh cap
+	if !meshAllows(signal.UUID) {
+		log.Printf("Ignoring signal from %s: not one of our mesh peers", signal.UUID)
+		return
+	}
 
-		// Handle the signal
-		handleSignal(signal)
+	// Handle the signal
+	// The data connection waits for its own gathering, so it mustn't hold up
+	// the signals behind it
+	if signal.Stream == dataStream {
+		go handleDataSignal(signal)
+		return
 	}
+	handleSignal(signal)
 }
 
 func handleSignal(signal Signal) {
@@ -185,16 +527,9 @@ func handleSignal(signal Signal) {
 	pc := peerConnection
 	mutex.Unlock()
 
-	if pc == nil {
-		// If we don't have a peer connection yet, create one
-		config := webrtc.Configuration{
-			ICEServers: []webrtc.ICEServer{
-				{
-					URLs: []string{"stun:stun.stunprotocol.org:3478", "stun:stun.l.google.com:19302"},
-				},
-			},
-		}
-		start(false, config)
+	if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		// If we don't have a live peer connection, create one
+		start(false, defaultConfiguration())
 		mutex.Lock()
 		pc = peerConnection
 		mutex.Unlock()
@@ -202,96 +537,155 @@ func handleSignal(signal Signal) {
 
 	// Handle SDP (offer or answer)
 	if signal.SDP != nil {
-		err := pc.SetRemoteDescription(*signal.SDP)
-		if err != nil {
+		if signal.Trickle != nil {
+			setPeerTrickle(*signal.Trickle)
+		}
+		signal.SDP.SDP = applyNormalization(signal.SDP.SDP)
+
+		// Glare: both peers offered at once
+		var admitted bool
+		pc, admitted = perfect.admit(pc, *signal.SDP, signal.UUID)
+		if signal.SDP.Type == webrtc.SDPTypeAnswer {
+			// admit marks an answer as being applied, whichever way this returns
+			defer perfect.answerApplied()
+		}
+		if !admitted {
+			return
+		}
+
+		switch signal.SDP.Type {
+		case webrtc.SDPTypeOffer:
+			// A resent offer we already answered must not renegotiate
+			if duplicateOffer(signal.SDP.SDP) {
+				return
+			}
+		case webrtc.SDPTypeAnswer:
+			offers.answered()
+		}
+
+		if signal.SDP.Type == webrtc.SDPTypeOffer {
+			negotiation.begin(pc)
+		}
+
+		// An offer on an already negotiated connection is a renegotiation
+		if signal.SDP.Type == webrtc.SDPTypeOffer && pc.RemoteDescription() != nil && !acceptRenegotiation() {
+			return
+		}
+
+		if err := checkRemoteFingerprint(*signal.SDP); err != nil {
+			rejectPeer(pc, "fingerprint-mismatch", err)
+			return
+		}
+		if err := checkRemoteCodecs(*signal.SDP); err != nil {
+			rejectPeer(pc, "unsupported-codecs", err)
+			return
+		}
+
+		if err := pc.SetRemoteDescription(*signal.SDP); err != nil {
 			log.Printf("Failed to set remote description: %v", err)
+			// Pion has applied the answer but can't send a track the peer has no codec for
+			if errors.Is(err, webrtc.ErrUnsupportedCodec) {
+				checkRejectedMedia(pc)
+			}
 			return
 		}
+		remoteCandidates.flush(pc)
+		setRemotePeer(pc, signal.UUID)
+		if signal.SDP.Type == webrtc.SDPTypeAnswer {
+			checkRejectedMedia(pc)
+			negotiation.complete(pc, phaseSDP)
+		}
 
 		// If we received an offer, create an answer
 		if signal.SDP.Type == webrtc.SDPTypeOffer {
-			answer, err := pc.CreateAnswer(nil)
+			answer, err := makeAnswer(pc, AnswerOptions{})
 			if err != nil {
 				log.Printf("Failed to create answer: %v", err)
 				return
 			}
 
-			err = pc.SetLocalDescription(answer)
-			if err != nil {
+			if err := setLocalDescription(pc, answer); err != nil {
 				log.Printf("Failed to set local description: %v", err)
 				return
 			}
+			checkRejectedMedia(pc)
+			negotiation.complete(pc, phaseSDP)
 
-			answerSignal := Signal{
-				SDP:  &answer,
-				UUID: uuid,
-			}
-			sendSignal(answerSignal)
+			rememberAnswer(signal.SDP.SDP, sendDescription(pc, answer))
 		}
 	}
 
 	// Handle ICE candidate
 	if signal.ICE != nil {
-		err := pc.AddICECandidate(*signal.ICE)
-		if err != nil {
+		if *logCandidates {
+			logRemoteCandidate(signal.ICE.Candidate)
+		}
+		// Candidates that overtook the remote description wait for it
+		err := remoteCandidates.add(pc, *signal.ICE)
+		if err != nil && !perfect.ignoringOffer() {
 			log.Printf("Failed to add ICE candidate: %v", err)
 			return
 		}
 	}
 }
 
+// sendSignal sends signal to the server. Offers, answers and candidates go
+// to the remote peer alone once it is known.
 func sendSignal(signal Signal) {
-	data, err := json.Marshal(signal)
-	if err != nil {
+	if signal.Type == "" && signal.To == "" {
+		signal.To = recipient()
+	}
+	sendMessage(signal)
+}
+
+// sendMessage marshals any signaling payload and writes it to the server
+func sendMessage(v any) {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer encodeBuffers.Put(buf)
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
 		log.Printf("Failed to marshal signal: %v", err)
 		return
 	}
+	data := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
 
-	err = serverConn.WriteMessage(websocket.TextMessage, data)
+	// Gorilla connections allow only one concurrent writer
+	writeMu.Lock()
+	err := serverConn.WriteMessage(websocket.TextMessage, data)
+	writeMu.Unlock()
 	if err != nil {
 		log.Printf("Failed to send signal: %v", err)
 		return
 	}
 }
 
-// simulateMediaStream simulates sending video and audio frames
-func simulateMediaStream(videoTrack, audioTrack *webrtc.TrackLocalStaticSample) {
-	// In a real application, this would capture from a camera and microphone
-	// For this example, we'll just simulate sending frames
-	ticker := time.NewTicker(33 * time.Millisecond) // ~30fps
-	for range ticker.C {
-		// Create dummy video frame
-		videoSample := &webrtc.Sample{
-			Data:     make([]byte, 640*480*3), // RGB data
-			Duration: 33 * time.Millisecond,
-		}
-		// Fill with random data to simulate changing video
-		rand.Read(videoSample.Data)
-		
-		if err := videoTrack.WriteSample(*videoSample); err != nil {
-			log.Printf("Failed to write video sample: %v", err)
-		}
+// validateServerURL checks that -server is a WebSocket URL
+func validateServerURL() error {
+	u, err := url.Parse(*serverFlag)
+	if err != nil {
+		return fmt.Errorf("-server: %w", err)
+	}
+	if (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return fmt.Errorf("-server %q must be a ws:// or wss:// URL", *serverFlag)
+	}
+	return nil
+}
 
-		// Create dummy audio sample
-		audioSample := &webrtc.Sample{
-			Data:     make([]byte, 1024), // Audio data
-			Duration: 33 * time.Millisecond,
-		}
-		rand.Read(audioSample.Data)
-		
-		if err := audioTrack.WriteSample(*audioSample); err != nil {
-			log.Printf("Failed to write audio sample: %v", err)
-		}
+// receiveOnly adds a recvonly transceiver of kind to pc, so the offer still
+// asks the peer for media of a kind we don't send
+func receiveOnly(pc *webrtc.PeerConnection, kind webrtc.RTPCodecType) {
+	_, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	if err != nil {
+		log.Fatalf("Failed to add %s transceiver: %v", kind, err)
 	}
 }
 
-// createUUID generates a UUID v4-like string
+// createUUID generates a random version 4 UUID as defined by RFC 4122
 func createUUID() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%04x%04x-%04x-%04x-%04x-%04x%04x%04x",
-		rand.Intn(0x10000), rand.Intn(0x10000),
-		rand.Intn(0x10000),
-		rand.Intn(0x10000),
-		rand.Intn(0x10000),
-		rand.Intn(0x10000), rand.Intn(0x10000), rand.Intn(0x10000))
+	var b [16]byte
+	rand.Read(b[:])         // Never fails; crypto/rand aborts the program instead
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
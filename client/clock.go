@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+// clockSampleWindow is how many recent round trips the offset estimate considers
+const clockSampleWindow = 8
+
+var clockSyncInterval = flag.Duration("clock-sync-interval", 30*time.Second, "How often to probe the server clock for offset estimation (0 disables)")
+
+// clockSample is one request/response round trip against the server clock
+type clockSample struct {
+	offset time.Duration
+	rtt    time.Duration
+}
+
+var (
+	clockSamples []clockSample
+	clockMu      sync.Mutex
+)
+
+// runClockSync periodically sends time probes to the server
+func runClockSync() {
+	if *clockSyncInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(*clockSyncInterval)
+	defer ticker.Stop()
+	for {
+		sendSignal(Signal{Type: "time", UUID: currentUUID(), ClientTime: time.Now().UnixNano()})
+		<-ticker.C
+	}
+}
+
+// recordClockSample folds a probe reply into the offset estimate.
+// Assuming symmetric paths, the server stamped the probe halfway through the round trip.
+func recordClockSample(sentAt, serverTime, receivedAt int64) {
+	if sentAt == 0 || serverTime == 0 || receivedAt < sentAt {
+		return
+	}
+	sample := clockSample{
+		offset: time.Duration(serverTime - (sentAt+receivedAt)/2),
+		rtt:    time.Duration(receivedAt - sentAt),
+	}
+
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	clockSamples = append(clockSamples, sample)
+	if len(clockSamples) > clockSampleWindow {
+		clockSamples = clockSamples[len(clockSamples)-clockSampleWindow:]
+	}
+}
+
+// ClockOffset returns the estimated server clock minus the local clock.
+// The sample with the shortest round trip is used since it has the least
+// room for asymmetric delay. It returns 0 until a probe has completed.
+func ClockOffset() time.Duration {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+
+	var best *clockSample
+	for i := range clockSamples {
+		if best == nil || clockSamples[i].rtt < best.rtt {
+			best = &clockSamples[i]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return best.offset
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestClockOffset feeds round trips against a server clock running a known
+// offset ahead, some with lopsided network delays, and checks the estimate
+// recovers the offset from the tightest round trip
+func TestClockOffset(t *testing.T) {
+	clockMu.Lock()
+	clockSamples = nil
+	clockMu.Unlock()
+	t.Cleanup(func() {
+		clockMu.Lock()
+		clockSamples = nil
+		clockMu.Unlock()
+	})
+	if got := ClockOffset(); got != 0 {
+		t.Fatalf("offset before any probe = %v, want 0", got)
+	}
+
+	const offset = 250 * time.Millisecond
+	base := time.Now().UnixNano()
+	// Each probe takes out and back to reach the server and return
+	for i, delay := range []struct{ out, back time.Duration }{
+		{40 * time.Millisecond, 5 * time.Millisecond},
+		{3 * time.Millisecond, 3 * time.Millisecond},
+		{5 * time.Millisecond, 30 * time.Millisecond},
+		{20 * time.Millisecond, 20 * time.Millisecond},
+	} {
+		sentAt := base + int64(time.Duration(i)*time.Second)
+		serverTime := sentAt + int64(delay.out+offset)
+		receivedAt := sentAt + int64(delay.out+delay.back)
+		recordClockSample(sentAt, serverTime, receivedAt)
+	}
+	if got := ClockOffset(); got != offset {
+		t.Fatalf("ClockOffset = %v, want %v", got, offset)
+	}
+
+	// A reply that can't be timed is ignored
+	recordClockSample(base, 0, base+1)
+	recordClockSample(base+10, base, base)
+	if got := ClockOffset(); got != offset {
+		t.Fatalf("ClockOffset after bad replies = %v, want %v", got, offset)
+	}
+}
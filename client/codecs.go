@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var allowCodecs = flag.String("codecs", "", "Comma-separated codecs to negotiate, such as opus,VP8 (empty allows every codec pion supports); offers with none of them are refused")
+
+// sentCodecs are the codecs of the tracks this client sends, which any
+// allowlist has to keep
+var sentCodecs = []string{"VP8", "opus"}
+
+// parseCodecAllowlist returns the lower-cased codec names in -codecs, or nil
+// when every codec is allowed
+func parseCodecAllowlist(list string) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			allowed[name] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+	for _, name := range sentCodecs {
+		if !allowed[strings.ToLower(name)] {
+			return nil, fmt.Errorf("-codecs must include %s, which this client sends", strings.Join(sentCodecs, " and "))
+		}
+	}
+	return allowed, nil
+}
+
+// codecName returns the codec part of a MIME type, such as vp8 for video/VP8
+func codecName(mimeType string) string {
+	_, name, _ := strings.Cut(mimeType, "/")
+	return strings.ToLower(name)
+}
+
+// registerCodecs registers pion's default codecs with mediaEngine, leaving
+// out any not in allowed, or none when allowed is nil. Retransmission formats
+// are kept for the codecs they repair.
+func registerCodecs(mediaEngine *webrtc.MediaEngine, allowed map[string]bool) error {
+	if allowed == nil && !*comfortNoise {
+		return mediaEngine.RegisterDefaultCodecs()
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		codecs, err := defaultCodecs(kind)
+		if err != nil {
+			return err
+		}
+		allows := func(codec webrtc.RTPCodecParameters) bool {
+			return allowed == nil || allowed[codecName(codec.MimeType)]
+		}
+		kept := make(map[string]bool)
+		for _, codec := range codecs {
+			if allows(codec) {
+				kept[fmt.Sprintf("apt=%d", codec.PayloadType)] = true
+			}
+		}
+		for _, codec := range codecs {
+			if codecName(codec.MimeType) == "rtx" && !kept[codec.SDPFmtpLine] {
+				continue
+			}
+			if codecName(codec.MimeType) != "rtx" && !allows(codec) {
+				continue
+			}
+			if err := mediaEngine.RegisterCodec(withDTX(codec), kind); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultCodecs lists the codecs pion registers by default for kind. Pion
+// doesn't export the list, so it is read back from a throwaway peer
+// connection, which gathers nothing until it is negotiated.
+func defaultCodecs(kind webrtc.RTPCodecType) ([]webrtc.RTPCodecParameters, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	// An empty registry, as pion otherwise adds the feedback of its default interceptors
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithInterceptorRegistry(&interceptor.Registry{}))
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	transceiver, err := pc.AddTransceiverFromKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	return transceiver.Sender().GetParameters().Codecs, nil
+}
+
+// checkRemoteCodecs returns an error naming the codecs of an offered media
+// section when none of them is allowed by -codecs, since pion would quietly
+// reject the section and the call would go ahead without it
+func checkRemoteCodecs(desc webrtc.SessionDescription) error {
+	allowed, err := parseCodecAllowlist(*allowCodecs)
+	if err != nil || allowed == nil || desc.Type != webrtc.SDPTypeOffer {
+		return err
+	}
+
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(desc.SDP); err != nil {
+		return fmt.Errorf("unparseable SDP: %w", err)
+	}
+	for _, media := range parsed.MediaDescriptions {
+		kind := media.MediaName.Media
+		// Port 0 marks a rejected section; data channels carry no codecs
+		if (kind != "audio" && kind != "video") || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		var offered []string
+		supported := false
+		for _, attr := range media.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+			fields := strings.Fields(attr.Value)
+			if len(fields) < 2 {
+				continue
+			}
+			name, _, _ := strings.Cut(fields[1], "/")
+			switch strings.ToLower(name) {
+			case "rtx", "red", "ulpfec", "flexfec-03":
+				continue
+			}
+			offered = append(offered, name)
+			supported = supported || allowed[strings.ToLower(name)]
+		}
+		if len(offered) > 0 && !supported {
+			return fmt.Errorf("peer offered %s only in unsupported codecs %s (allowed: %s)", kind, strings.Join(offered, ", "), *allowCodecs)
+		}
+	}
+	return nil
+}
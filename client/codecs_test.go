@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestCodecAllowlist negotiates with -codecs=opus,VP8 and checks only those
+// codecs are offered, that a publisher offering video only in H264 is refused
+// with the reason naming it, and that an allowlist dropping a codec this
+// client sends is itself refused
+func TestCodecAllowlist(t *testing.T) {
+	previous := *allowCodecs
+	*allowCodecs = "opus,VP8"
+	t.Cleanup(func() { *allowCodecs = previous })
+
+	if _, err := parseCodecAllowlist("opus,H264"); err == nil {
+		t.Fatal("allowlist without VP8 accepted")
+	}
+
+	api, err := newWebRTCAPI(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=rtpmap:") {
+			continue
+		}
+		_, codec, _ := strings.Cut(line, " ")
+		name, _, _ := strings.Cut(codec, "/")
+		if name != "opus" && name != "VP8" && name != "rtx" {
+			t.Errorf("allowlisted engine offered %q", line)
+		}
+	}
+	if err := checkRemoteCodecs(offer); err != nil {
+		t.Fatalf("offer in allowed codecs refused: %v", err)
+	}
+
+	publisher := videoOnlyPeer(t, webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+		PayloadType:        102,
+	})
+	if _, err := publisher.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
+		t.Fatal(err)
+	}
+	h264, err := publisher.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkRemoteCodecs(h264)
+	if err == nil || !strings.Contains(err.Error(), "video only in unsupported codecs H264") {
+		t.Fatalf("H264-only offer: %v, want it refused naming H264", err)
+	}
+}
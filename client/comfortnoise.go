@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var comfortNoise = flag.Bool("comfort-noise", false, "While paused, send Opus DTX frames so the peer's decoder plays comfort noise and its jitter buffer keeps running, instead of one silent frame per keep-alive; also signals usedtx=1 for opus")
+
+// comfortNoiseInterval is how often an Opus encoder in DTX sends a frame
+// during silence, which is what the peer's decoder expects
+const comfortNoiseInterval = 400 * time.Millisecond
+
+// opusDTXFrame is an Opus packet of just a TOC byte for a 20ms SILK wideband
+// mono frame. Decoders treat a packet this short as discontinuous
+// transmission and fill the gap with comfort noise.
+var opusDTXFrame = []byte{0x48}
+
+// withDTX adds usedtx=1 to an Opus codec's fmtp line when -comfort-noise is
+// on, telling the peer this client handles DTX. Pion matches fmtp parameters
+// only when both sides list them, so peers that leave it out still match.
+func withDTX(codec webrtc.RTPCodecParameters) webrtc.RTPCodecParameters {
+	if !*comfortNoise || codecName(codec.MimeType) != "opus" || strings.Contains(codec.SDPFmtpLine, "usedtx=") {
+		return codec
+	}
+	if codec.SDPFmtpLine == "" {
+		codec.SDPFmtpLine = "usedtx=1"
+	} else {
+		codec.SDPFmtpLine += ";usedtx=1"
+	}
+	return codec
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestComfortNoise pauses a call with -comfort-noise and checks the offer
+// signals usedtx=1 for Opus and that, while paused, only Opus DTX frames
+// reach the peer, about one per comfortNoiseInterval
+func TestComfortNoise(t *testing.T) {
+	server := newFakeSignalingServer(t, "comfort-noise")
+	server.connect(t)
+	previousNoise, previousKeepAlive := *comfortNoise, *pauseKeepAlive
+	*comfortNoise, *pauseKeepAlive = true, 0
+	t.Cleanup(func() { *comfortNoise, *pauseKeepAlive = previousNoise, previousKeepAlive })
+
+	api, err := newWebRTCAPI(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ResumeCall()
+		stopMediaFor(local)
+		stopMediaStream()
+		local.Close()
+	})
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "comfort-noise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.AddTrack(audioTrack); err != nil {
+		t.Fatal(err)
+	}
+	payloads := make(chan []byte, 1024)
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			p, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			case payloads <- p.Payload:
+			default:
+			}
+		}
+	})
+	connectLoopback(t, local, remote)
+	if !strings.Contains(local.LocalDescription().SDP, "usedtx=1") {
+		t.Fatalf("offer doesn't signal usedtx=1:\n%s", local.LocalDescription().SDP)
+	}
+	startMediaStream(local, nil, audioTrack)
+	select {
+	case <-payloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no audio before pausing")
+	}
+
+	if err := PauseCall(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect(t, "pause")
+	// Let frames already in flight land before watching
+	time.Sleep(100 * time.Millisecond)
+	for len(payloads) > 0 {
+		<-payloads
+	}
+
+	const window = 5 * comfortNoiseInterval
+	frames := 0
+	deadline := time.After(window)
+collect:
+	for {
+		select {
+		case payload := <-payloads:
+			if !bytes.Equal(payload, opusDTXFrame) {
+				t.Fatalf("audio packet while paused isn't an Opus DTX frame: %x", payload)
+			}
+			frames++
+		case <-deadline:
+			break collect
+		}
+	}
+	if frames < 3 || frames > 6 {
+		t.Errorf("%d DTX frames in %v, want about one per %v", frames, window, comfortNoiseInterval)
+	}
+
+	*comfortNoise = false
+	if codec := withDTX(webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, SDPFmtpLine: "minptime=10"}}); codec.SDPFmtpLine != "minptime=10" {
+		t.Errorf("without -comfort-noise the Opus fmtp is %q, want it unchanged", codec.SDPFmtpLine)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+var (
+	connID   string
+	connIDMu sync.Mutex
+)
+
+// setConnID adopts the connection ID from the server's welcome message and
+// tags every later log line with it, so they can be matched with the
+// server's lines carrying connID=<id>. A reconnect brings a new ID.
+func setConnID(id string) {
+	connIDMu.Lock()
+	connID = id
+	connIDMu.Unlock()
+
+	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
+	log.SetPrefix("conn=" + id + " ")
+	log.Printf("Signaling connection ID %s", id)
+}
+
+// ConnID returns the server-assigned ID of the current signaling connection
+func ConnID() string {
+	connIDMu.Lock()
+	defer connIDMu.Unlock()
+	return connID
+}
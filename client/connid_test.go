@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a log destination safe for concurrent writers, as goroutines
+// left by earlier tests may still log
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// TestConnIDTagsLogs hands the client the server's welcome and checks its
+// later log lines carry the connection ID, and that a reconnect's welcome
+// replaces it
+func TestConnIDTagsLogs(t *testing.T) {
+	var logs syncBuffer
+	writer, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(&logs)
+	t.Cleanup(func() {
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		connIDMu.Lock()
+		connID = ""
+		connIDMu.Unlock()
+	})
+
+	for _, id := range []string{"3f2a9c1e0b7d4a55", "a1b2c3d4e5f60718"} {
+		handleServerMessage([]byte(`{"type":"welcome","uuid":"server","connId":"` + id + `"}`))
+		if got := ConnID(); got != id {
+			t.Fatalf("ConnID() = %q, want %q", got, id)
+		}
+		logs.Reset()
+		log.Printf("Sending offer")
+		if line := logs.String(); !strings.Contains(line, "conn="+id+" Sending offer\n") {
+			t.Fatalf("logged %q, want it tagged conn=%s", line, id)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// dataChannelHandlers attaches remotely created data channels to the feature that owns their label
+var dataChannelHandlers = map[string]func(dc *webrtc.DataChannel){}
+
+// handleDataChannel dispatches a channel announced by the remote peer
+func handleDataChannel(dc *webrtc.DataChannel) {
+	handler, ok := dataChannelHandlers[dc.Label()]
+	if !ok {
+		log.Printf("Ignoring unexpected data channel %q", dc.Label())
+		return
+	}
+	handler(dc)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// midTagger checks the MID header extension on a track's packets against
+// the transceiver the track was delivered on. On a bundled transport the MID
+// is what ties a packet to its transceiver when SSRCs aren't signalled.
+type midTagger struct {
+	mid         string // The transceiver's negotiated MID
+	extensionID uint8  // 0 when the MID extension wasn't negotiated
+	mismatches  uint64
+}
+
+// newMidTagger looks up the MID and MID extension ID negotiated for receiver
+func newMidTagger(pc *webrtc.PeerConnection, receiver *webrtc.RTPReceiver) *midTagger {
+	t := &midTagger{}
+	for _, transceiver := range pc.GetTransceivers() {
+		if transceiver.Receiver() == receiver {
+			t.mid = transceiver.Mid()
+			break
+		}
+	}
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		if ext.URI == sdp.SDESMidURI {
+			t.extensionID = uint8(ext.ID)
+		}
+	}
+	return t
+}
+
+// observe checks one packet's MID. Senders may stop including the extension
+// once the SSRC is known, so packets without it are accepted.
+func (t *midTagger) observe(trackID string, packet *rtp.Packet) {
+	if t.extensionID == 0 {
+		return
+	}
+	value := packet.GetExtension(t.extensionID)
+	if value == nil || string(value) == t.mid {
+		return
+	}
+	t.mismatches++
+	if t.mismatches == 1 {
+		log.Printf("Track %s: packet tagged with MID %q arrived on transceiver %q", trackID, value, t.mid)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// diagLogLines is how many recent log lines a bundle carries
+const diagLogLines = 2000
+
+// Placeholders substituted for redacted values, as the server's -redact-sdp uses
+const (
+	redactedIP          = "<ip>"
+	redactedFingerprint = "<fingerprint>"
+	redactedSecret      = "<redacted>"
+)
+
+var (
+	diagBundlePath = flag.String("diag-bundle", "", "Write a diagnostics zip of recent logs, SDP, candidates and stats to this path when the connection fails or on SIGUSR1")
+	redactSignals  = flag.Bool("redact-sdp", false, "Mask IP addresses, DTLS fingerprints and ICE passwords in diagnostics bundles")
+)
+
+// recentLogs keeps the tail of the log for diagnostics bundles
+var recentLogs = &logRing{}
+
+// logRing is an io.Writer keeping the last diagLogLines writes. The log
+// package writes each entry in one call, so every write is one line.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) < diagLogLines {
+		r.lines = append(r.lines, string(p))
+	} else {
+		r.lines[r.next] = string(p)
+		r.next = (r.next + 1) % diagLogLines
+	}
+	return len(p), nil
+}
+
+// String returns the kept lines, oldest first
+func (r *logRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	for i := range r.lines {
+		b.WriteString(r.lines[(r.next+i)%len(r.lines)])
+	}
+	return b.String()
+}
+
+// startDiagnostics starts keeping recent logs and writes a bundle of the
+// current peer connection on every SIGUSR1. It does nothing without
+// -diag-bundle.
+func startDiagnostics() {
+	if *diagBundlePath == "" {
+		return
+	}
+	log.SetOutput(io.MultiWriter(log.Writer(), recentLogs))
+
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			mutex.Lock()
+			pc := peerConnection
+			mutex.Unlock()
+			writeDiagBundleOrLog(pc, "requested")
+		}
+	}()
+}
+
+// writeDiagBundleOrLog writes a bundle of pc to -diag-bundle, if set, and
+// logs the outcome
+func writeDiagBundleOrLog(pc *webrtc.PeerConnection, reason string) {
+	if *diagBundlePath == "" {
+		return
+	}
+	if err := WriteDiagBundle(pc, *diagBundlePath); err != nil {
+		log.Printf("Failed to write diagnostics bundle: %v", err)
+		return
+	}
+	log.Printf("Wrote diagnostics bundle to %s (%s)", *diagBundlePath, reason)
+}
+
+// diagFile is one entry of a diagnostics bundle
+type diagFile struct {
+	name string
+	data []byte
+}
+
+// WriteDiagBundle writes a zip to path holding the recent log, pc's local and
+// remote descriptions as offer.sdp and answer.sdp, the gathered candidates
+// and a stats snapshot. With -redact-sdp, addresses, fingerprints and ICE
+// passwords are masked throughout. pc may be nil before a call starts.
+func WriteDiagBundle(pc *webrtc.PeerConnection, path string) error {
+	var files []diagFile
+	add := func(name string, data []byte) { files = append(files, diagFile{name, data}) }
+	add("log.txt", []byte(recentLogs.String()))
+
+	if pc != nil {
+		for _, desc := range []*webrtc.SessionDescription{pc.LocalDescription(), pc.RemoteDescription()} {
+			if desc == nil {
+				continue
+			}
+			sdp := desc.SDP
+			if *redactSignals {
+				sdp = redactSDP(sdp)
+			}
+			add(desc.Type.String()+".sdp", []byte(sdp))
+		}
+
+		stats := pc.GetStats()
+		if *redactSignals {
+			for id, s := range stats {
+				switch s := s.(type) {
+				case webrtc.ICECandidateStats:
+					s.IP, s.URL = redactedIP, ""
+					stats[id] = s
+				case webrtc.CertificateStats:
+					s.Fingerprint, s.Base64Certificate = redactedFingerprint, ""
+					stats[id] = s
+				}
+			}
+		}
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode stats: %w", err)
+		}
+		add("stats.json", data)
+	}
+
+	candidates := LocalCandidates()
+	if *redactSignals {
+		for i := range candidates {
+			candidates[i].Address = redactedIP
+		}
+	}
+	data, err := json.MarshalIndent(candidates, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode candidates: %w", err)
+	}
+	add("candidates.json", data)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err == nil {
+			_, err = w.Write(file.data)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("write %s: %w", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// redactSDP returns s with addresses, fingerprints and ICE passwords replaced
+// by placeholders. Every line is kept so the structure stays readable.
+func redactSDP(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line, cr := strings.CutSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "a=fingerprint:"):
+			// a=fingerprint:<hash> <value>
+			if hash, _, ok := strings.Cut(line, " "); ok {
+				line = hash + " " + redactedFingerprint
+			}
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + redactedSecret
+		case strings.HasPrefix(line, "a=candidate:"), strings.HasPrefix(line, "c="),
+			strings.HasPrefix(line, "o="), strings.HasPrefix(line, "a=rtcp:"):
+			line = redactIPs(line)
+		}
+		if cr {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactIPs replaces every space-separated token that is a specified IP address
+func redactIPs(line string) string {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if ip := net.ParseIP(field); ip != nil && !ip.IsUnspecified() {
+			fields[i] = redactedIP
+		}
+	}
+	return strings.Join(fields, " ")
+}
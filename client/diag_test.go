@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestDiagBundle connects two peers, writes a redacted bundle of one and
+// checks the zip holds the log, both descriptions, the candidates and the
+// stats, with no addresses or ICE passwords left in them
+func TestDiagBundle(t *testing.T) {
+	previous := *redactSignals
+	*redactSignals = true
+	t.Cleanup(func() {
+		*redactSignals = previous
+		resetLocalCandidates()
+	})
+	resetLocalCandidates()
+
+	offerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { offerer.Close() })
+	offerer.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			recordLocalCandidate(candidate)
+		}
+	})
+	if _, err := offerer.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { answerer.Close() })
+	connectLoopback(t, offerer, answerer)
+	recentLogs.Write([]byte("2026/10/15 12:00:00 Peer connection state: failed\n"))
+
+	path := filepath.Join(t.TempDir(), "diag.zip")
+	if err := WriteDiagBundle(offerer, path); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"answer.sdp", "candidates.json", "log.txt", "offer.sdp", "stats.json"}; !slices.Equal(names, want) {
+		t.Fatalf("bundle holds %v, want %v", names, want)
+	}
+	if !strings.Contains(files["log.txt"], "Peer connection state: failed") {
+		t.Error("bundle log lacks the recent log line")
+	}
+
+	// Nothing identifying may appear anywhere in the bundle
+	var secrets []string
+	for _, c := range LocalCandidates() {
+		secrets = append(secrets, `"`+c.Address+`"`, " "+c.Address+" ")
+	}
+	for _, desc := range []*webrtc.SessionDescription{offerer.LocalDescription(), offerer.RemoteDescription()} {
+		for _, line := range strings.Split(desc.SDP, "\r\n") {
+			if pwd, ok := strings.CutPrefix(line, "a=ice-pwd:"); ok {
+				secrets = append(secrets, pwd)
+			}
+			if fingerprint, ok := strings.CutPrefix(line, "a=fingerprint:sha-256 "); ok {
+				secrets = append(secrets, fingerprint, strings.ToLower(fingerprint))
+			}
+		}
+	}
+	if len(secrets) < 4 {
+		t.Fatalf("found only %v to look for", secrets)
+	}
+	for name, data := range files {
+		for _, secret := range secrets {
+			if strings.Contains(data, secret) {
+				t.Errorf("%s carries %s", name, secret)
+			}
+		}
+	}
+	for _, name := range []string{"offer.sdp", "answer.sdp"} {
+		if !strings.Contains(files[name], "a=ice-pwd:"+redactedSecret) || !strings.Contains(files[name], redactedIP) {
+			t.Errorf("%s lacks its redacted password and addresses", name)
+		}
+	}
+	var candidates []CandidateInfo
+	if err := json.Unmarshal([]byte(files["candidates.json"]), &candidates); err != nil || len(candidates) == 0 {
+		t.Fatalf("candidates.json holds %d candidates (%v), want the gathered ones", len(candidates), err)
+	}
+}
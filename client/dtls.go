@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var dtlsTimeout = flag.Duration("dtls-timeout", 30*time.Second, "How long the DTLS handshake may take once ICE has connected before the connection fails with a dtls-timeout event")
+
+// errDTLSTimeout is the error of a "dtls-timeout" event
+var errDTLSTimeout = errors.New("DTLS handshake timed out")
+
+// validateDTLSTimeout checks -dtls-timeout
+func validateDTLSTimeout() error {
+	if *dtlsTimeout <= 0 {
+		return errors.New("-dtls-timeout must be positive")
+	}
+	return nil
+}
+
+// configureDTLS hands pion -dtls-timeout as its handshake deadline. Pion
+// drops the cancel func, so each context lives until its deadline.
+func configureDTLS(settings *webrtc.SettingEngine) {
+	settings.SetDTLSConnectContextMaker(func() (context.Context, func()) {
+		return context.WithTimeout(context.Background(), *dtlsTimeout)
+	})
+}
+
+// startDTLSWatchdog checks -dtls-timeout after ICE connects on pc. The
+// handshake only starts once ICE has connected, so a timeout means a path
+// that carries STUN but drops DTLS, such as a firewall inspecting UDP. It is
+// reported as a "dtls-timeout" event rather than a plain failure.
+//
+// Pion's handshake doesn't always return when its deadline passes: it keeps
+// waiting for packets while the peer retransmits. So the watchdog fails the
+// connection itself, handing it to the reconnector, unless pion already has.
+func startDTLSWatchdog(pc *webrtc.PeerConnection) {
+	transport := pc.SCTP().Transport()
+	if transport.State() == webrtc.DTLSTransportStateConnected {
+		return // An ICE restart on an established connection
+	}
+	time.AfterFunc(*dtlsTimeout, func() {
+		if transport.State() == webrtc.DTLSTransportStateConnected || !currentPeerConnection(pc) {
+			return
+		}
+		state := pc.ConnectionState()
+		if state == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		log.Printf("DTLS handshake timed out after %v although ICE connected; something on the path is dropping DTLS", *dtlsTimeout)
+		emitEvent(Event{Kind: "dtls-timeout", Err: errDTLSTimeout})
+		if state != webrtc.PeerConnectionStateFailed {
+			writeDiagBundleOrLog(pc, "DTLS handshake timed out")
+			peerReconnect.observe(pc, webrtc.PeerConnectionStateFailed)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3/vnet"
+	"github.com/pion/webrtc/v4"
+)
+
+// isDTLSRecord reports whether a UDP payload is a DTLS record rather than
+// STUN (RFC 7983)
+func isDTLSRecord(payload []byte) bool {
+	return len(payload) > 0 && payload[0] >= 20 && payload[0] <= 63
+}
+
+// TestDTLSTimeout connects two peers over a virtual network that carries
+// STUN, so ICE connects, and checks that when it also drops DTLS the
+// watchdog reports a dtls-timeout while ICE is still connected, and that
+// when it passes DTLS nothing is reported
+func TestDTLSTimeout(t *testing.T) {
+	previousTimeout, previousBackoff := *dtlsTimeout, *maxRebuildBackoff
+	*dtlsTimeout = 300 * time.Millisecond
+	*maxRebuildBackoff = 0
+	t.Cleanup(func() { *dtlsTimeout, *maxRebuildBackoff = previousTimeout, previousBackoff })
+
+	for _, tc := range []struct {
+		name     string
+		dropDTLS bool
+	}{
+		{"dropped", true},
+		{"passed", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "10.0.0.0/24", LoggerFactory: logging.NewDefaultLoggerFactory()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.dropDTLS {
+				router.AddChunkFilter(func(c vnet.Chunk) bool { return !isDTLSRecord(c.UserData()) })
+			}
+			peers := make([]*webrtc.PeerConnection, 2)
+			for i := range peers {
+				nw, err := vnet.NewNet(&vnet.NetConfig{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := router.AddNet(nw); err != nil {
+					t.Fatal(err)
+				}
+				se := webrtc.SettingEngine{}
+				se.SetNet(nw)
+				configureDTLS(&se)
+				if peers[i], err = webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{}); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { peers[i].Close() })
+			}
+			if err := router.Start(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { router.Stop() })
+
+			local, remote := peers[0], peers[1]
+			mutex.Lock()
+			peerConnection = local
+			mutex.Unlock()
+			t.Cleanup(func() {
+				mutex.Lock()
+				peerConnection = nil
+				mutex.Unlock()
+			})
+			watchConnection(local)
+			if _, err := local.CreateDataChannel("probe", nil); err != nil {
+				t.Fatal(err)
+			}
+			connectLoopback(t, local, remote)
+			waitFor(t, "ICE to connect", func() bool {
+				return local.ICEConnectionState() == webrtc.ICEConnectionStateConnected
+			})
+
+			if !tc.dropDTLS {
+				waitFor(t, "the connection to come up", func() bool {
+					return local.ConnectionState() == webrtc.PeerConnectionStateConnected
+				})
+				time.Sleep(2 * *dtlsTimeout)
+				for len(Events) > 0 {
+					if ev := <-Events; ev.Kind == "dtls-timeout" {
+						t.Fatal("reported a DTLS timeout on a path that passes DTLS")
+					}
+				}
+				return
+			}
+
+			ev := expectEvent(t, "dtls-timeout", 5*time.Second)
+			if !errors.Is(ev.Err, errDTLSTimeout) {
+				t.Fatalf("dtls-timeout event carries %v, want errDTLSTimeout", ev.Err)
+			}
+			if state := local.ICEConnectionState(); state != webrtc.ICEConnectionStateConnected {
+				t.Fatalf("ICE %s at the DTLS timeout, want it still connected", state)
+			}
+			if state := local.SCTP().Transport().State(); state == webrtc.DTLSTransportStateConnected {
+				t.Fatal("DTLS connected through a path that drops it")
+			}
+		})
+	}
+}
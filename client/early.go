@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// earlyCandidates holds remote candidates that arrive before the remote
+// description they belong to. Trickled candidates can overtake the offer,
+// and pion refuses candidates until a remote description is set.
+type earlyCandidates struct {
+	mu      sync.Mutex
+	pc      *webrtc.PeerConnection
+	pending []webrtc.ICECandidateInit
+}
+
+var remoteCandidates = &earlyCandidates{}
+
+// add applies candidate to pc, or holds it until pc has a remote description.
+// Candidates held for an earlier peer connection are discarded.
+func (e *earlyCandidates) add(pc *webrtc.PeerConnection, candidate webrtc.ICECandidateInit) error {
+	e.mu.Lock()
+	if pc.RemoteDescription() == nil {
+		if e.pc != pc {
+			e.pc, e.pending = pc, nil
+		}
+		e.pending = append(e.pending, candidate)
+		e.mu.Unlock()
+		return nil
+	}
+	e.mu.Unlock()
+	return pc.AddICECandidate(candidate)
+}
+
+// flush applies the candidates held for pc in the order they arrived. It is
+// called once pc's remote description is set; later candidates go straight
+// to pc.
+func (e *earlyCandidates) flush(pc *webrtc.PeerConnection) {
+	e.mu.Lock()
+	var pending []webrtc.ICECandidateInit
+	if e.pc == pc {
+		pending = e.pending
+	}
+	e.pc, e.pending = nil, nil
+	e.mu.Unlock()
+
+	for _, candidate := range pending {
+		if err := pc.AddICECandidate(candidate); err != nil {
+			log.Printf("Failed to add buffered ICE candidate: %v", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// remoteCandidateCount returns how many remote candidates pc has been given
+func remoteCandidateCount(pc *webrtc.PeerConnection) int {
+	n := 0
+	for _, s := range pc.GetStats() {
+		if c, ok := s.(webrtc.ICECandidateStats); ok && c.Type == webrtc.StatsTypeRemoteCandidate {
+			n++
+		}
+	}
+	return n
+}
+
+// TestCandidatesBeforeOffer hands the client a peer's trickled candidates
+// before its offer, which carries none, and checks every candidate is added
+// once the offer is applied and that a later candidate is added straight away
+func TestCandidatesBeforeOffer(t *testing.T) {
+	server := newFakeSignalingServer(t, "early")
+	server.connect(t)
+	pc := withPeerConnection(t, nil)
+	t.Cleanup(func() {
+		forgetPeerOf(pc)
+		answerMu.Lock()
+		lastRemoteOffer, lastAnswer = "", nil
+		answerMu.Unlock()
+	})
+
+	offerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { offerer.Close() })
+	if _, err := offerer.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The offer as created carries no candidates; they are all trickled
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := []string{
+		"candidate:1 1 udp 2130706431 192.0.2.1 50001 typ host",
+		"candidate:2 1 udp 2130706431 192.0.2.2 50002 typ host",
+		"candidate:3 1 udp 1694498815 198.51.100.1 50003 typ srflx raddr 192.0.2.1 rport 50001",
+	}
+	early, late := candidates[:2], candidates[2]
+	mid := "0"
+	for _, candidate := range early {
+		handleSignal(Signal{UUID: "offerer", ICE: &webrtc.ICECandidateInit{Candidate: candidate, SDPMid: &mid}})
+	}
+	if n := remoteCandidateCount(pc); n != 0 {
+		t.Fatalf("%d candidates added before the offer", n)
+	}
+
+	handleSignal(Signal{UUID: "offerer", SDP: &offer})
+	if pc.RemoteDescription() == nil {
+		t.Fatal("offer wasn't applied")
+	}
+	if n := remoteCandidateCount(pc); n != len(early) {
+		t.Fatalf("%d candidates added after the offer, want the %d held back", n, len(early))
+	}
+
+	handleSignal(Signal{UUID: "offerer", ICE: &webrtc.ICECandidateInit{Candidate: late, SDPMid: &mid}})
+	if n := remoteCandidateCount(pc); n != len(candidates) {
+		t.Fatalf("%d candidates added after a late one, want %d", n, len(candidates))
+	}
+	remoteCandidates.mu.Lock()
+	defer remoteCandidates.mu.Unlock()
+	if len(remoteCandidates.pending) != 0 {
+		t.Fatalf("%d candidates still held after the offer", len(remoteCandidates.pending))
+	}
+}
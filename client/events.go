@@ -0,0 +1,26 @@
+package main
+
+import "log"
+
+// Event is published on Events so code embedding the client can observe it
+type Event struct {
+	Kind   string    // "state" for connection state changes
+	State  ConnState // New state, for "state" events
+	Prev   ConnState // Previous state, for "state" events
+	Detail string
+	Err    error
+	Track  *RemoteTrack // The track, for "track-*" events
+}
+
+// Events carries client events. Sends never block: if nobody drains the
+// channel and it fills up, further events are logged and dropped.
+var Events = make(chan Event, 64)
+
+// emitEvent publishes ev without blocking the caller
+func emitEvent(ev Event) {
+	select {
+	case Events <- ev:
+	default:
+		log.Printf("Event channel full, dropping %s event", ev.Kind)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var icePrefer = flag.String("ice-prefer", "auto", "Signal candidates of this address family first: ipv4, ipv6 or auto (gathering order)")
+
+var (
+	// deferredCandidates holds trickled candidates of the non-preferred family
+	// until gathering completes
+	deferredCandidates []webrtc.ICECandidateInit
+	deferredMu         sync.Mutex
+)
+
+// validateICEPrefer checks the -ice-prefer flag
+func validateICEPrefer() error {
+	switch *icePrefer {
+	case "auto", "ipv4", "ipv6":
+		return nil
+	}
+	return fmt.Errorf("-ice-prefer must be ipv4, ipv6 or auto, got %q", *icePrefer)
+}
+
+// candidateFamily returns "ipv4" or "ipv6" for a candidate line, or "" when
+// the address family can't be told, such as for mDNS hostnames
+func candidateFamily(candidate string) string {
+	c, err := parseCandidate(candidate)
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(c.IP)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "ipv4"
+	default:
+		return "ipv6"
+	}
+}
+
+// preferredFamily reports whether a candidate should be signalled ahead of
+// others. Candidates of unknown family are never held back.
+func preferredFamily(candidate string) bool {
+	family := candidateFamily(candidate)
+	return *icePrefer == "auto" || family == "" || family == *icePrefer
+}
+
+// deferCandidate holds back a trickled candidate of the non-preferred family,
+// reporting whether it did. Nothing is filtered out: held candidates are
+// still sent by releaseDeferredCandidates once gathering completes, so
+// connectivity survives when the preferred family is unavailable.
+func deferCandidate(candidate webrtc.ICECandidateInit) bool {
+	if preferredFamily(candidate.Candidate) {
+		return false
+	}
+	deferredMu.Lock()
+	deferredCandidates = append(deferredCandidates, candidate)
+	deferredMu.Unlock()
+	return true
+}
+
+// releaseDeferredCandidates queues every held candidate in gathering order
+func releaseDeferredCandidates() {
+	deferredMu.Lock()
+	held := deferredCandidates
+	deferredCandidates = nil
+	deferredMu.Unlock()
+
+	for _, candidate := range held {
+		queueCandidate(candidate)
+	}
+}
+
+// resetDeferredCandidates discards held candidates from a previous connection
+func resetDeferredCandidates() {
+	deferredMu.Lock()
+	deferredCandidates = nil
+	deferredMu.Unlock()
+}
+
+// withPreferredFamilyFirst reorders the a=candidate lines of each media
+// section so the preferred address family comes first, keeping gathering
+// order within each family. The lines are placed where the first one was.
+func withPreferredFamilyFirst(sdp string) string {
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+	out := make([]string, 0, len(lines))
+	var section []string
+	flushSection := func() {
+		first := -1
+		var candidates []string
+		rest := make([]string, 0, len(section))
+		for _, line := range section {
+			if strings.HasPrefix(line, "a=candidate:") {
+				if first < 0 {
+					first = len(rest)
+				}
+				candidates = append(candidates, line)
+				continue
+			}
+			rest = append(rest, line)
+		}
+		if first < 0 {
+			out = append(out, section...)
+			section = section[:0]
+			return
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return preferredFamily(candidates[i]) && !preferredFamily(candidates[j])
+		})
+		out = append(out, rest[:first]...)
+		out = append(out, candidates...)
+		out = append(out, rest[first:]...)
+		section = section[:0]
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			flushSection()
+		}
+		section = append(section, line)
+	}
+	flushSection()
+	return strings.Join(out, "\r\n") + "\r\n"
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestPreferredFamilySignalledFirst gathers on this dual-stack host, loopback
+// included, with each -ice-prefer setting and checks the preferred family's
+// candidates are signalled first, with the other family still sent after them
+func TestPreferredFamilySignalledFirst(t *testing.T) {
+	previousPrefer, previousBatch := *icePrefer, *batchCandidates
+	t.Cleanup(func() {
+		*icePrefer, *batchCandidates = previousPrefer, previousBatch
+		resetDeferredCandidates()
+	})
+	*batchCandidates = 0
+
+	for _, prefer := range []string{"ipv6", "ipv4"} {
+		t.Run(prefer, func(t *testing.T) {
+			*icePrefer = prefer
+			server := newFakeSignalingServer(t, prefer)
+			server.connect(t)
+
+			settings := webrtc.SettingEngine{}
+			settings.SetIncludeLoopbackCandidate(true)
+			settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6})
+			pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(settings)).NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+			// As the client's candidate handler does for a trickle peer
+			pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+				if candidate == nil {
+					releaseDeferredCandidates()
+					return
+				}
+				if init := candidate.ToJSON(); !deferCandidate(init) {
+					queueCandidate(init)
+				}
+			})
+			if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+				t.Fatal(err)
+			}
+			offer, err := pc.CreateOffer(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pc.SetLocalDescription(offer); err != nil {
+				t.Fatal(err)
+			}
+
+			var families []string
+			for len(families) < 2 {
+				select {
+				case received := <-server.received:
+					if received.ICE == nil {
+						continue
+					}
+					family := candidateFamily(received.ICE.Candidate)
+					if len(families) == 0 || families[len(families)-1] != family {
+						families = append(families, family)
+					}
+				case <-time.After(2 * time.Second):
+					if !hasAddress(t, "ipv6") {
+						t.Skip("host has no IPv6 address to gather")
+					}
+					t.Fatalf("signalled families %v, want both", families)
+				}
+			}
+			if families[0] != prefer {
+				t.Fatalf("signalled %v, want %s first", families, prefer)
+			}
+		})
+	}
+}
+
+// hasAddress reports whether the host has an address of family that pion
+// gathers, which leaves out IPv6 loopback and link-local addresses
+func hasAddress(t *testing.T, family string) bool {
+	t.Helper()
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		ip, _, _ := net.ParseCIDR(addr.String())
+		if ip == nil || (ip.To4() != nil) != (family == "ipv4") {
+			continue
+		}
+		if ip.To4() != nil || !(ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+			return true
+		}
+	}
+	return false
+}
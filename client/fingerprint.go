@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var expectFingerprint = flag.String("expect-fingerprint", "", "SHA-256 DTLS fingerprint the peer must present, as XX:XX:...; connections to any other peer are refused")
+
+var (
+	// localCertificate is shared by every peer connection so the fingerprint
+	// stays the same for the life of the process and can be compared out of band
+	localCertificate     *webrtc.Certificate
+	localCertificateErr  error
+	localCertificateOnce sync.Once
+)
+
+// errFingerprintMismatch is returned when the peer's DTLS fingerprint isn't the expected one
+var errFingerprintMismatch = errors.New("remote DTLS fingerprint does not match -expect-fingerprint")
+
+// certificate returns the process-wide DTLS certificate, generating it on first use
+func certificate() (*webrtc.Certificate, error) {
+	localCertificateOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			localCertificateErr = err
+			return
+		}
+		localCertificate, localCertificateErr = webrtc.GenerateCertificate(key)
+		if localCertificateErr == nil {
+			log.Printf("Local DTLS fingerprint: sha-256 %s", certificateFingerprint(localCertificate))
+		}
+	})
+	return localCertificate, localCertificateErr
+}
+
+// LocalFingerprint returns the SHA-256 fingerprint of this client's DTLS
+// certificate as XX:XX:..., or "" if it couldn't be generated
+func LocalFingerprint() string {
+	cert, err := certificate()
+	if err != nil {
+		return ""
+	}
+	return certificateFingerprint(cert)
+}
+
+// certificateFingerprint returns cert's SHA-256 fingerprint as XX:XX:...
+func certificateFingerprint(cert *webrtc.Certificate) string {
+	fingerprints, err := cert.GetFingerprints()
+	if err != nil {
+		return ""
+	}
+	for _, fp := range fingerprints {
+		if fp.Algorithm == "sha-256" {
+			return strings.ToUpper(fp.Value)
+		}
+	}
+	return ""
+}
+
+// checkRemoteFingerprint verifies the fingerprint in a remote description
+// against -expect-fingerprint before it is applied. Pion then makes sure the
+// DTLS handshake presents a certificate with that same fingerprint.
+func checkRemoteFingerprint(desc webrtc.SessionDescription) error {
+	if *expectFingerprint == "" {
+		return nil
+	}
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(desc.SDP); err != nil {
+		return err
+	}
+
+	var found []string
+	if value, ok := parsed.Attribute("fingerprint"); ok {
+		found = append(found, value)
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if value, ok := media.Attribute("fingerprint"); ok {
+			found = append(found, value)
+		}
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("%w: the peer sent none", errFingerprintMismatch)
+	}
+	for _, value := range found {
+		algorithm, fp, _ := strings.Cut(value, " ")
+		if !strings.EqualFold(algorithm, "sha-256") || !sameFingerprint(fp, *expectFingerprint) {
+			return fmt.Errorf("%w: got %s", errFingerprintMismatch, value)
+		}
+	}
+	return nil
+}
+
+// verifyRemoteCertificate checks the certificate the peer actually presented
+// once DTLS has connected, as a second line of defence
+func verifyRemoteCertificate(pc *webrtc.PeerConnection) error {
+	if *expectFingerprint == "" {
+		return nil
+	}
+	cert := pc.SCTP().Transport().GetRemoteCertificate()
+	sum := sha256.Sum256(cert)
+	if !sameFingerprint(hex.EncodeToString(sum[:]), *expectFingerprint) {
+		return errFingerprintMismatch
+	}
+	return nil
+}
+
+// sameFingerprint compares fingerprints ignoring case and colons
+func sameFingerprint(a, b string) bool {
+	normalize := func(s string) string { return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), ":", "")) }
+	return normalize(a) == normalize(b)
+}
+
+// rejectPeer refuses a peer, publishing err as an event of the given kind
+func rejectPeer(pc *webrtc.PeerConnection, kind string, err error) {
+	log.Printf("Refusing peer: %v", err)
+	emitEvent(Event{Kind: kind, Err: err})
+	if closeErr := pc.Close(); closeErr != nil {
+		log.Printf("Failed to close peer connection: %v", closeErr)
+	}
+}
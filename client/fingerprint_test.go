@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// offerFrom returns a gathered offer from a new peer connection with config
+func offerFrom(t *testing.T, config webrtc.Configuration) (*webrtc.PeerConnection, webrtc.SessionDescription) {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel("chat", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pc, offer
+}
+
+// connectedPeer answers offerer over loopback and returns the answerer once
+// the connection is up
+func connectedPeer(t *testing.T, offerer *webrtc.PeerConnection) *webrtc.PeerConnection {
+	t.Helper()
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { answerer.Close() })
+	connected := make(chan struct{})
+	answerer.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			close(connected)
+		}
+	})
+	connectLoopback(t, offerer, answerer)
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer never connected")
+	}
+	return answerer
+}
+
+// TestExpectFingerprint expects this client's own fingerprint and checks a
+// peer presenting it is accepted, in its description and its DTLS
+// certificate, while a peer with any other certificate is refused
+func TestExpectFingerprint(t *testing.T) {
+	local := LocalFingerprint()
+	if len(local) != 95 || local != LocalFingerprint() {
+		t.Fatalf("LocalFingerprint() = %q, want a stable SHA-256 fingerprint as XX:XX:...", local)
+	}
+	previous := *expectFingerprint
+	// Case and colons don't matter
+	*expectFingerprint = strings.ToLower(strings.ReplaceAll(local, ":", ""))
+	t.Cleanup(func() { *expectFingerprint = previous })
+
+	trusted, offer := offerFrom(t, completeConfiguration(webrtc.Configuration{}))
+	if err := checkRemoteFingerprint(offer); err != nil {
+		t.Fatalf("expected fingerprint refused: %v", err)
+	}
+	stranger, offer := offerFrom(t, webrtc.Configuration{})
+	if err := checkRemoteFingerprint(offer); !errors.Is(err, errFingerprintMismatch) {
+		t.Fatalf("another certificate's description: %v, want %v", err, errFingerprintMismatch)
+	}
+
+	if err := verifyRemoteCertificate(connectedPeer(t, trusted)); err != nil {
+		t.Fatalf("expected certificate refused: %v", err)
+	}
+	if err := verifyRemoteCertificate(connectedPeer(t, stranger)); !errors.Is(err, errFingerprintMismatch) {
+		t.Fatalf("another certificate: %v, want %v", err, errFingerprintMismatch)
+	}
+}
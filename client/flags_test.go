@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v4"
+)
+
+// parseFlags parses args as the command line, restoring every flag once the
+// test ends
+func parseFlags(t *testing.T, args ...string) {
+	t.Helper()
+	previous := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) { previous[f.Name] = f.Value.String() })
+	t.Cleanup(func() {
+		for name, value := range previous {
+			flag.Set(name, value)
+		}
+	})
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClientFlags parses a representative command line and checks the
+// server URL, role and media flags reach the dialer and start
+func TestClientFlags(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ws.Close()
+	}))
+	t.Cleanup(srv.Close)
+	url := "wss" + strings.TrimPrefix(srv.URL, "https") + "/ws"
+
+	parseFlags(t, "-server", url, "-caller=false", "-video=false", "-insecure")
+	if *serverFlag != url || *callerFlag || *sendVideo || !*sendAudio || !*insecureTLS {
+		t.Fatalf("parsed -server %q -caller %v -video %v -audio %v -insecure %v", *serverFlag, *callerFlag, *sendVideo, *sendAudio, *insecureTLS)
+	}
+	if err := validateServerURL(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dev server's certificate is self-signed, so only -insecure gets through
+	conn, err := dialWith(signalingDialer())(*serverFlag)
+	if err != nil {
+		t.Fatalf("dialing with -insecure: %v", err)
+	}
+	conn.Close()
+	*insecureTLS = false
+	if conn, err := dialWith(signalingDialer())(*serverFlag); err == nil {
+		conn.Close()
+		t.Fatal("dialed a self-signed server without -insecure")
+	}
+
+	// A callee without -video receives video but sends none, and makes no offer
+	start(*callerFlag, webrtc.Configuration{})
+	mutex.Lock()
+	pc := peerConnection
+	mutex.Unlock()
+	t.Cleanup(func() {
+		stopMediaFor(pc)
+		stopMediaStream()
+		mutex.Lock()
+		peerConnection = nil
+		mutex.Unlock()
+		pc.Close()
+	})
+	sending := map[webrtc.RTPCodecType]bool{}
+	for _, tr := range pc.GetTransceivers() {
+		if tr.Sender() != nil && tr.Sender().Track() != nil {
+			sending[tr.Kind()] = true
+		} else if tr.Direction() != webrtc.RTPTransceiverDirectionRecvonly {
+			t.Errorf("%s transceiver is %s without a track, want recvonly", tr.Kind(), tr.Direction())
+		}
+	}
+	if sending[webrtc.RTPCodecTypeVideo] || !sending[webrtc.RTPCodecTypeAudio] {
+		t.Fatalf("sending %v, want audio only", sending)
+	}
+	if pc.LocalDescription() != nil {
+		t.Fatal("a callee made an offer")
+	}
+
+	for _, bad := range []string{"https://localhost:8443/ws", "wss://"} {
+		*serverFlag = bad
+		if err := validateServerURL(); err == nil {
+			t.Errorf("-server %q accepted", bad)
+		}
+	}
+}
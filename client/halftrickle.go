@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var halfTrickle = flag.Duration("half-trickle", 0, "Wait up to this long for host candidates and embed them in the initial offer, trickling srflx and relay candidates afterwards (0 trickles every candidate)")
+
+var (
+	// heldCandidates collects the candidates gathered while the initial offer
+	// waits for host candidates; the ones that don't end up in the offer are
+	// trickled once it has been sent
+	heldCandidates []webrtc.ICECandidateInit
+	holding        bool
+	holdMu         sync.Mutex
+)
+
+// holdCandidates starts holding trickled candidates back for the initial
+// offer. It does nothing unless -half-trickle is set and trickle is in use.
+func holdCandidates() {
+	holdMu.Lock()
+	defer holdMu.Unlock()
+	holding = *halfTrickle > 0 && trickleEnabled()
+	heldCandidates = nil
+}
+
+// stopHolding drops the hold when the initial offer could not be applied, so
+// later restarts trickle as usual
+func stopHolding() {
+	holdMu.Lock()
+	defer holdMu.Unlock()
+	heldCandidates, holding = nil, false
+}
+
+// holdCandidate keeps a gathered candidate back while the initial offer is
+// being prepared, reporting whether it did
+func holdCandidate(candidate webrtc.ICECandidateInit) bool {
+	holdMu.Lock()
+	defer holdMu.Unlock()
+	if !holding {
+		return false
+	}
+	heldCandidates = append(heldCandidates, candidate)
+	return true
+}
+
+// withHostCandidates waits up to -half-trickle for gathering, then returns
+// offer carrying the host candidates found so far. The returned func must be
+// called once the offer is sent: it stops holding and trickles every held
+// candidate the offer doesn't carry.
+func withHostCandidates(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (webrtc.SessionDescription, func()) {
+	holdMu.Lock()
+	active := holding
+	holdMu.Unlock()
+	if !active {
+		return offer, func() {}
+	}
+
+	select {
+	case <-webrtc.GatheringCompletePromise(pc):
+	case <-time.After(*halfTrickle):
+	}
+	if local := pc.LocalDescription(); local != nil {
+		// Host candidates past -max-sdp-candidates are trickled with the rest
+		offer.SDP = capSDPCandidates(onlyHostCandidates(local.SDP))
+	}
+
+	return offer, func() {
+		holdMu.Lock()
+		held := heldCandidates
+		heldCandidates, holding = nil, false
+		holdMu.Unlock()
+
+		gathered := pc.ICEGatheringState() == webrtc.ICEGatheringStateComplete
+		for _, candidate := range held {
+			if carriesCandidate(offer.SDP, candidate.Candidate) {
+				continue
+			}
+			// Family deferral only applies while gathering is still running
+			if gathered || !deferCandidate(candidate) {
+				queueCandidate(candidate)
+			}
+		}
+		if gathered {
+			releaseDeferredCandidates()
+			flushCandidates()
+		}
+	}
+}
+
+// onlyHostCandidates drops every non-host a=candidate line from sdp, along with
+// a=end-of-candidates, since the remaining candidates are trickled afterwards
+func onlyHostCandidates(sdp string) string {
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line == "a=end-of-candidates" {
+			continue
+		}
+		if strings.HasPrefix(line, "a=candidate:") {
+			if c, err := parseCandidate(line); err != nil || c.Type != "host" {
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\r\n") + "\r\n"
+}
+
+// carriesCandidate reports whether sdp has an a=candidate line for the same
+// transport address as candidate, whatever extension attributes either has
+func carriesCandidate(sdp, candidate string) bool {
+	want, err := parseCandidate(candidate)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(sdp, "\r\n") {
+		if !strings.HasPrefix(line, "a=candidate:") {
+			continue
+		}
+		c, err := parseCandidate(line)
+		if err == nil && c.Foundation == want.Foundation && c.Component == want.Component &&
+			c.Protocol == want.Protocol && c.IP == want.IP && c.Port == want.Port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestHalfTrickleOffer sends the initial offer with and without -half-trickle
+// and checks that with it the offer carries the host candidates, none of
+// which are trickled again, while without it every candidate is trickled
+func TestHalfTrickleOffer(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wait time.Duration
+	}{
+		{"on", 500 * time.Millisecond},
+		{"off", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeSignalingServer(t, "half-trickle")
+			server.connect(t)
+			previous := *halfTrickle
+			*halfTrickle = tc.wait
+			t.Cleanup(func() {
+				*halfTrickle = previous
+				offers.answered()
+			})
+
+			pc := withPeerConnection(t, nil)
+			// As in start, less the bookkeeping
+			pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+				if candidate == nil {
+					flushCandidates()
+					return
+				}
+				if init := candidate.ToJSON(); !holdCandidate(init) {
+					queueCandidate(init)
+				}
+			})
+			if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+				t.Fatal(err)
+			}
+			createOffer()
+
+			offer := server.expect(t, "")
+			if offer.SDP == nil {
+				t.Fatalf("sent %+v, want the offer", offer.Signal)
+			}
+			var embedded int
+			for _, line := range strings.Split(offer.SDP.SDP, "\r\n") {
+				if !strings.HasPrefix(line, "a=candidate:") {
+					continue
+				}
+				embedded++
+				if c, err := parseCandidate(line); err != nil || c.Type != "host" {
+					t.Errorf("offer carries %q, want host candidates only", line)
+				}
+			}
+
+			var trickled int
+			timeout := time.After(500 * time.Millisecond)
+		drain:
+			for {
+				select {
+				case received := <-server.received:
+					if received.ICE == nil {
+						continue
+					}
+					trickled++
+					if carriesCandidate(offer.SDP.SDP, received.ICE.Candidate) {
+						t.Errorf("trickled %q, which the offer already carries", received.ICE.Candidate)
+					}
+				case <-timeout:
+					break drain
+				}
+			}
+
+			if tc.wait > 0 && embedded == 0 {
+				t.Fatal("offer carries no host candidates")
+			}
+			if tc.wait == 0 && (embedded != 0 || trickled == 0) {
+				t.Fatalf("offer carries %d candidates and %d were trickled, want none embedded and all trickled", embedded, trickled)
+			}
+		})
+	}
+}
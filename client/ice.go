@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Pion doesn't cap how many candidate pairs are checked, so these flags
+// shrink the checklist instead: fewer local interfaces mean fewer pairs, a
+// lower binding request limit gives up on dead pairs sooner, and a shorter
+// acceptance wait nominates the first working pair rather than waiting for
+// a better one.
+var (
+	iceInterfaces         = flag.String("ice-interfaces", "", "Comma-separated network interfaces to gather candidates on (empty uses all)")
+	iceMaxBindingRequests = flag.Uint("ice-max-binding-requests", 0, "Binding requests sent on a candidate pair before it is considered failed (0 keeps pion's default of 7)")
+	iceNominateAfter      = flag.Duration("ice-nominate-after", -1, "How long to wait for better candidate pairs before nominating a working one, for every candidate type (negative keeps pion's per-type defaults)")
+
+	// ICE-lite skips connectivity checks from our side, which only works
+	// when the offering peer runs full ICE and we are publicly reachable
+	iceLite = flag.Bool("ice-lite", false, "Run ICE-lite when answering, advertising a=ice-lite and gathering host candidates only; for a publicly reachable client")
+)
+
+// configureICE applies the candidate pair flags to settings. ICE-lite is only
+// used on the answering side, never by the caller.
+func configureICE(settings *webrtc.SettingEngine, isCaller bool) {
+	if *iceLite && !isCaller {
+		settings.SetLite(true)
+	}
+	if *iceInterfaces != "" {
+		allowed := make(map[string]bool)
+		for _, name := range strings.Split(*iceInterfaces, ",") {
+			allowed[strings.TrimSpace(name)] = true
+		}
+		settings.SetInterfaceFilter(func(name string) bool { return allowed[name] })
+	}
+	if *iceMaxBindingRequests > 0 {
+		settings.SetICEMaxBindingRequests(uint16(min(*iceMaxBindingRequests, 0xffff)))
+	}
+	if wait := *iceNominateAfter; wait >= 0 {
+		settings.SetHostAcceptanceMinWait(wait)
+		settings.SetSrflxAcceptanceMinWait(wait)
+		settings.SetPrflxAcceptanceMinWait(wait)
+		settings.SetRelayAcceptanceMinWait(wait)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// connectWithAPI connects a caller and an answerer built with the client's API
+// settings over loopback, returning them and how long ICE took from the answer
+// being applied
+func connectWithAPI(t *testing.T) (offerer, answerer *webrtc.PeerConnection, elapsed time.Duration) {
+	t.Helper()
+	peers := make([]*webrtc.PeerConnection, 2)
+	for i, isCaller := range []bool{true, false} {
+		api, err := newWebRTCAPI(isCaller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err := api.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		peers[i] = pc
+	}
+	offerer, answerer = peers[0], peers[1]
+	connected := make(chan struct{})
+	offerer.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			close(connected)
+		}
+	})
+	if _, err := offerer.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	connectLoopback(t, offerer, answerer)
+	start := time.Now()
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("ICE never connected")
+	}
+	return offerer, answerer, time.Since(start)
+}
+
+// TestNominateAfterShortensConnect connects with a long and then a zero
+// -ice-nominate-after and checks the lower setting connects sooner
+func TestNominateAfterShortensConnect(t *testing.T) {
+	previous := *iceNominateAfter
+	t.Cleanup(func() { *iceNominateAfter = previous })
+
+	const wait = 500 * time.Millisecond
+	*iceNominateAfter = wait
+	_, _, slow := connectWithAPI(t)
+	*iceNominateAfter = 0
+	_, _, fast := connectWithAPI(t)
+	t.Logf("connected in %v waiting %v for better pairs, %v nominating at once", slow, wait, fast)
+
+	if slow < wait {
+		t.Fatalf("connected in %v, before the %v nomination wait", slow, wait)
+	}
+	if fast >= slow {
+		t.Fatalf("connected in %v nominating at once, no faster than %v", fast, slow)
+	}
+}
+
+// TestICELiteAnswer connects with -ice-lite and checks the answer advertises
+// a=ice-lite and carries only host candidates while the caller keeps full
+// ICE, and that without the flag neither side is lite
+func TestICELiteAnswer(t *testing.T) {
+	previous := *iceLite
+	t.Cleanup(func() { *iceLite = previous })
+
+	for _, lite := range []bool{true, false} {
+		*iceLite = lite
+		offerer, answerer, _ := connectWithAPI(t)
+		offer, answer := offerer.LocalDescription().SDP, answerer.LocalDescription().SDP
+		if strings.Contains(offer, "a=ice-lite") {
+			t.Fatalf("-ice-lite=%v: the caller's offer advertises a=ice-lite", lite)
+		}
+		if got := strings.Contains(answer, "\r\na=ice-lite\r\n"); got != lite {
+			t.Fatalf("-ice-lite=%v: answer advertises a=ice-lite: %v", lite, got)
+		}
+		if !lite {
+			continue
+		}
+		for _, line := range strings.Split(answer, "\r\n") {
+			if !strings.HasPrefix(line, "a=candidate:") {
+				continue
+			}
+			if c, err := parseCandidate(line); err != nil || c.Type != "host" {
+				t.Errorf("ICE-lite answer carries %q, want host candidates only", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// iceServersEnv names the environment variable read when -ice-config is unset
+const iceServersEnv = "ICE_SERVERS"
+
+var iceConfigPath = flag.String("ice-config", "", "JSON file of {\"iceServers\": [...]} STUN/TURN servers to use before the signaling server's; the "+iceServersEnv+" environment variable may hold the same JSON instead")
+
+// staticICEServers are the servers loaded by loadICEConfig, or nil
+var staticICEServers []webrtc.ICEServer
+
+// loadICEConfig reads the ICE servers from -ice-config, or else from the
+// ICE_SERVERS environment variable. It returns nil when neither is set. TURN
+// entries must carry long-term credentials.
+func loadICEConfig() ([]webrtc.ICEServer, error) {
+	var data []byte
+	source := *iceConfigPath
+	if source != "" {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	} else if env := os.Getenv(iceServersEnv); env != "" {
+		data, source = []byte(env), iceServersEnv
+	} else {
+		return nil, nil
+	}
+
+	var config struct {
+		ICEServers []webrtc.ICEServer `json:"iceServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	if len(config.ICEServers) == 0 {
+		return nil, fmt.Errorf("%s: no iceServers", source)
+	}
+	for i, server := range config.ICEServers {
+		if err := checkICEServer(server); err != nil {
+			return nil, fmt.Errorf("%s: iceServers[%d]: %w", source, i, err)
+		}
+	}
+	return config.ICEServers, nil
+}
+
+// checkICEServer rejects entries pion would only refuse when the first peer
+// connection is created.
+//
+// TURN transport is picked per URL. turn: relays over UDP unless it ends in
+// ?transport=tcp, which is the one to list for networks that block UDP
+// outright. turns: runs TLS over TCP to port 5349 by default, and so looks
+// like HTTPS to most firewalls; turns:...?transport=udp means DTLS, which few
+// servers offer. The allocated relay itself is always UDP, whichever
+// transport reaches the server. stun: and stuns: take no query at all.
+func checkICEServer(server webrtc.ICEServer) error {
+	if len(server.URLs) == 0 {
+		return errors.New("no urls")
+	}
+	for _, url := range server.URLs {
+		scheme, rest, _ := strings.Cut(url, ":")
+		_, query, hasQuery := strings.Cut(rest, "?")
+		switch scheme {
+		case "stun", "stuns":
+			if hasQuery {
+				return fmt.Errorf("%s: %s URLs take no query", url, scheme)
+			}
+		case "turn", "turns":
+			if server.Username == "" || server.Credential == nil || server.Credential == "" {
+				return fmt.Errorf("%s needs a username and credential", url)
+			}
+			if hasQuery && query != "transport=udp" && query != "transport=tcp" {
+				return fmt.Errorf("%s: the only query allowed is transport=udp or transport=tcp", url)
+			}
+		default:
+			return fmt.Errorf("%s is not a stun or turn URL", url)
+		}
+	}
+	return nil
+}
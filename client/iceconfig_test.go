@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sampleICEConfig is an -ice-config file with a STUN and a TURN server
+const sampleICEConfig = `{
+	"iceServers": [
+		{"urls": ["stun:stun.example.org:3478"]},
+		{
+			"urls": ["turn:turn.example.org:3478?transport=tcp", "turns:turn.example.org:5349"],
+			"username": "alice",
+			"credential": "secret"
+		}
+	]
+}`
+
+// withICEConfig points -ice-config at a file holding data, or clears it when
+// data is empty, and sets ICE_SERVERS to env, for the length of a test
+func withICEConfig(t *testing.T, data, env string) {
+	t.Helper()
+	saved := *iceConfigPath
+	t.Cleanup(func() { *iceConfigPath = saved })
+	*iceConfigPath = ""
+	if data != "" {
+		*iceConfigPath = filepath.Join(t.TempDir(), "ice.json")
+		if err := os.WriteFile(*iceConfigPath, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(iceServersEnv, env)
+}
+
+func TestLoadICEConfigFile(t *testing.T) {
+	withICEConfig(t, sampleICEConfig, `{"iceServers": [{"urls": ["stun:ignored.example.org"]}]}`)
+	servers, err := loadICEConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("loaded %d servers, want 2", len(servers))
+	}
+	if got := servers[0].URLs[0]; got != "stun:stun.example.org:3478" {
+		t.Errorf("first URL = %q; the file should win over %s", got, iceServersEnv)
+	}
+	turn := servers[1]
+	if len(turn.URLs) != 2 || turn.Username != "alice" || turn.Credential != "secret" {
+		t.Errorf("TURN entry = %+v", turn)
+	}
+}
+
+func TestLoadICEConfigEnv(t *testing.T) {
+	withICEConfig(t, "", sampleICEConfig)
+	servers, err := loadICEConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("loaded %d servers, want 2", len(servers))
+	}
+
+	withICEConfig(t, "", "")
+	if servers, err := loadICEConfig(); servers != nil || err != nil {
+		t.Fatalf("with nothing configured got %v, %v; want nil, nil", servers, err)
+	}
+}
+
+func TestLoadICEConfigRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"malformed":         `{"iceServers": [`,
+		"empty":             `{"iceServers": []}`,
+		"no urls":           `{"iceServers": [{"urls": []}]}`,
+		"bad scheme":        `{"iceServers": [{"urls": ["http://example.org"]}]}`,
+		"stun query":        `{"iceServers": [{"urls": ["stun:example.org?transport=udp"]}]}`,
+		"turn without auth": `{"iceServers": [{"urls": ["turn:example.org"]}]}`,
+		"turn bad query":    `{"iceServers": [{"urls": ["turn:example.org?foo=bar"], "username": "a", "credential": "b"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			withICEConfig(t, data, "")
+			if _, err := loadICEConfig(); err == nil {
+				t.Fatal("config was accepted")
+			}
+		})
+	}
+}
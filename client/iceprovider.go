@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// maxProviderCooldown caps the breaker cooldown as it backs off
+const maxProviderCooldown = 10 * time.Minute
+
+var (
+	iceProviderURL      = flag.String("ice-provider", "", "URL returning {\"iceServers\": [...]} with STUN/TURN servers and credentials (empty uses the built-in STUN servers)")
+	iceProviderFailures = flag.Int("ice-provider-failures", 3, "Consecutive ICE provider failures before the circuit breaker opens")
+	iceProviderCooldown = flag.Duration("ice-provider-cooldown", 30*time.Second, "How long the open breaker waits before trying the ICE provider again; doubles on each failed retry")
+)
+
+// errBreakerOpen is returned while the breaker is refusing calls and nothing is cached
+var errBreakerOpen = errors.New("ICE provider circuit breaker open")
+
+// ICEProvider supplies ICE servers, typically with short-lived TURN credentials
+type ICEProvider interface {
+	Fetch(ctx context.Context) ([]webrtc.ICEServer, error)
+}
+
+// httpICEProvider fetches ICE servers from a JSON endpoint
+type httpICEProvider struct {
+	url    string
+	client *http.Client
+}
+
+func (p *httpICEProvider) Fetch(ctx context.Context) ([]webrtc.ICEServer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ICE provider returned %s", resp.Status)
+	}
+
+	var body struct {
+		ICEServers []webrtc.ICEServer `json:"iceServers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if len(body.ICEServers) == 0 {
+		return nil, errors.New("ICE provider returned no servers")
+	}
+	return body.ICEServers, nil
+}
+
+// breakerProvider wraps an ICEProvider with a circuit breaker. After
+// maxFailures consecutive failures it stops calling the provider for a
+// cooldown, which doubles each time a trial call after the cooldown fails.
+// While the provider is failing, the last servers it returned are served in
+// its place, even if their credentials may have expired.
+type breakerProvider struct {
+	provider    ICEProvider
+	maxFailures int
+	cooldown    time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	backoff   time.Duration
+	lastGood  []webrtc.ICEServer
+}
+
+func newBreakerProvider(provider ICEProvider, maxFailures int, cooldown time.Duration) *breakerProvider {
+	return &breakerProvider{provider: provider, maxFailures: max(maxFailures, 1), cooldown: cooldown, backoff: cooldown}
+}
+
+func (b *breakerProvider) Fetch(ctx context.Context) ([]webrtc.ICEServer, error) {
+	b.mu.Lock()
+	if now := time.Now(); now.Before(b.openUntil) {
+		defer b.mu.Unlock()
+		return b.fallbackLocked(errBreakerOpen)
+	}
+	b.mu.Unlock()
+
+	servers, err := b.provider.Fetch(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.failures >= b.maxFailures {
+			log.Println("ICE provider recovered, closing circuit breaker")
+		}
+		b.failures = 0
+		b.backoff = b.cooldown
+		b.lastGood = servers
+		return servers, nil
+	}
+
+	b.failures++
+	if b.failures >= b.maxFailures {
+		// A failed trial call after a cooldown backs off further
+		if b.failures > b.maxFailures {
+			b.backoff = min(b.backoff*2, maxProviderCooldown)
+		}
+		b.openUntil = time.Now().Add(b.backoff)
+		log.Printf("Warning: ICE provider failed %d times (%v), circuit breaker open for %v", b.failures, err, b.backoff)
+	}
+	return b.fallbackLocked(err)
+}
+
+// fallbackLocked returns the last good servers, or err if there are none. b.mu must be held.
+func (b *breakerProvider) fallbackLocked(err error) ([]webrtc.ICEServer, error) {
+	if b.lastGood == nil {
+		return nil, err
+	}
+	log.Printf("Warning: serving cached ICE servers: %v", err)
+	return b.lastGood, nil
+}
+
+var (
+	iceProvider     ICEProvider
+	iceProviderOnce sync.Once
+)
+
+// configuredICEProvider returns the -ice-provider source, or nil if none is set
+func configuredICEProvider() ICEProvider {
+	iceProviderOnce.Do(func() {
+		if *iceProviderURL == "" {
+			return
+		}
+		iceProvider = newBreakerProvider(
+			&httpICEProvider{url: *iceProviderURL, client: &http.Client{Timeout: 5 * time.Second}},
+			*iceProviderFailures, *iceProviderCooldown,
+		)
+	})
+	return iceProvider
+}
+
+var (
+	// welcomeICEServers are the servers the signaling server's welcome listed
+	welcomeICEServers   []webrtc.ICEServer
+	welcomeICEServersMu sync.Mutex
+)
+
+// setServerICEServers records the ICE servers from the signaling server's
+// welcome, reporting whether they differ from the previous welcome's
+func setServerICEServers(servers []webrtc.ICEServer) bool {
+	welcomeICEServersMu.Lock()
+	defer welcomeICEServersMu.Unlock()
+	changed := !reflect.DeepEqual(welcomeICEServers, servers)
+	welcomeICEServers = servers
+	return changed
+}
+
+// serverICEServers returns the ICE servers handed out by the signaling server, if any
+func serverICEServers() []webrtc.ICEServer {
+	welcomeICEServersMu.Lock()
+	defer welcomeICEServersMu.Unlock()
+	return welcomeICEServers
+}
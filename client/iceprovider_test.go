@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// scriptedProvider fails while down is set, and counts the calls it gets
+type scriptedProvider struct {
+	down  bool
+	calls int
+}
+
+func (p *scriptedProvider) Fetch(context.Context) ([]webrtc.ICEServer, error) {
+	p.calls++
+	if p.down {
+		return nil, errors.New("provider unavailable")
+	}
+	return []webrtc.ICEServer{{URLs: []string{"turn:turn.example.com"}, Username: "user", Credential: "fresh"}}, nil
+}
+
+// TestICEProviderBreaker fails the provider until the breaker opens and checks
+// the open breaker stops calling it, serves the cached servers, backs off on
+// a failed trial and closes once the provider recovers
+func TestICEProviderBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	provider := &scriptedProvider{}
+	breaker := newBreakerProvider(provider, 3, cooldown)
+	ctx := context.Background()
+
+	fetch := func(what string) []webrtc.ICEServer {
+		t.Helper()
+		servers, err := breaker.Fetch(ctx)
+		if err != nil || len(servers) != 1 || servers[0].Credential != "fresh" {
+			t.Fatalf("%s: got %v (%v), want the provider's servers", what, servers, err)
+		}
+		return servers
+	}
+
+	fetch("healthy provider")
+	provider.down = true
+	for range 3 {
+		fetch("failure served from cache")
+	}
+	if provider.calls != 4 {
+		t.Fatalf("provider called %d times, want 4", provider.calls)
+	}
+
+	// Open: the provider is left alone until the cooldown passes
+	fetch("open breaker")
+	if provider.calls != 4 {
+		t.Fatal("open breaker still called the provider")
+	}
+
+	// A failed trial call reopens it for twice as long
+	time.Sleep(cooldown + 10*time.Millisecond)
+	fetch("failed trial")
+	if provider.calls != 5 {
+		t.Fatalf("provider called %d times, want a trial call", provider.calls)
+	}
+	time.Sleep(cooldown + 10*time.Millisecond)
+	fetch("backed off")
+	if provider.calls != 5 {
+		t.Fatal("breaker didn't back off after the failed trial")
+	}
+
+	provider.down = false
+	time.Sleep(cooldown)
+	fetch("recovered")
+	provider.down = true
+	fetch("first failure after recovery")
+	if provider.calls != 7 {
+		t.Fatalf("provider called %d times, want the breaker closed again", provider.calls)
+	}
+
+	// With nothing cached the open breaker reports itself
+	empty := newBreakerProvider(&scriptedProvider{down: true}, 1, time.Minute)
+	if _, err := empty.Fetch(ctx); err == nil || errors.Is(err, errBreakerOpen) {
+		t.Fatalf("first failure: %v, want the provider's error", err)
+	}
+	if _, err := empty.Fetch(ctx); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("open with no cache: %v, want %v", err, errBreakerOpen)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"log"
+)
+
+// errNotNegotiated is returned when restarting ICE before the first negotiation
+var errNotNegotiated = errors.New("peer connection has not negotiated yet")
+
+// RestartICE renegotiates the current peer connection with fresh ICE
+// credentials so both sides gather again, such as after switching from Wi-Fi
+// to cellular. The connection, its tracks and its data channels are kept.
+func RestartICE() error {
+	mutex.Lock()
+	pc := peerConnection
+	mutex.Unlock()
+	if pc == nil || pc.RemoteDescription() == nil {
+		return errNotNegotiated
+	}
+	log.Println("Restarting ICE")
+	restartICE(pc)
+	return nil
+}
+
+// RequestICERestart asks the peer to restart ICE with an "ice-restart"
+// message, for when only the peer can tell its network path changed or it
+// should be the one making the offer
+func RequestICERestart() {
+	sendSignal(Signal{Type: "ice-restart", UUID: currentUUID(), To: recipient()})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// TestICERestartKeepsMedia connects two peers with audio and a data channel,
+// has the peer request an ICE restart and checks the client offers new ICE
+// credentials, and that audio and the data channel keep working over the
+// restarted connection
+func TestICERestartKeepsMedia(t *testing.T) {
+	server := newFakeSignalingServer(t, "ice-restart")
+	server.connect(t)
+	// Candidates ride in the descriptions, so the test needn't relay them
+	setPeerTrickle(false)
+	t.Cleanup(func() {
+		setPeerTrickle(true)
+		offers.answered()
+	})
+	local := withPeerConnection(t, nil)
+	t.Cleanup(func() { forgetPeerOf(local) })
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+
+	audio, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "restart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.AddTrack(audio); err != nil {
+		t.Fatal(err)
+	}
+	channel, err := local.CreateDataChannel("chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan struct{})
+	channel.OnOpen(func() { close(opened) })
+	var received, messages atomic.Int64
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	})
+	remote.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnMessage(func(webrtc.DataChannelMessage) { messages.Add(1) })
+	})
+	connectLoopback(t, local, remote)
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("data channel never opened")
+	}
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		ticker := time.NewTicker(audioFrameInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				audio.WriteSample(media.Sample{Data: opusSilence, Duration: audioFrameInterval})
+			}
+		}
+	}()
+	flowing := func(what string) {
+		t.Helper()
+		before := received.Load()
+		waitFor(t, what, func() bool { return received.Load() > before+5 })
+		sent := messages.Load()
+		if err := channel.SendText("hello"); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, what+" on the data channel", func() bool { return messages.Load() > sent })
+	}
+	flowing("audio to flow")
+	ufrag, _ := iceCredentials(local.LocalDescription().SDP)
+
+	handleServerMessage([]byte(`{"type":"ice-restart","uuid":"peer"}`))
+	offer := server.expect(t, "")
+	if offer.SDP == nil || offer.SDP.Type != webrtc.SDPTypeOffer {
+		t.Fatalf("sent %+v, want an ICE restart offer", offer.Signal)
+	}
+	if u, _ := iceCredentials(offer.SDP.SDP); u == "" || u == ufrag {
+		t.Fatalf("restart offer has ufrag %q, want a new one in place of %q", u, ufrag)
+	}
+	if err := remote.SetRemoteDescription(*offer.SDP); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := remote.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(remote)
+	if err := remote.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	handleSignal(Signal{UUID: "peer", SDP: remote.LocalDescription()})
+	if local.SignalingState() != webrtc.SignalingStateStable {
+		t.Fatalf("signaling %s after the answer, want stable", local.SignalingState())
+	}
+
+	flowing("audio to keep flowing after the restart")
+	if state := local.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		t.Fatalf("connection %s after the restart, want connected", state)
+	}
+}
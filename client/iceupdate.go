@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	// updatedICEPC is the peer connection whose ICE servers were changed
+	// after it was created, or nil
+	updatedICEPC   *webrtc.PeerConnection
+	updatedICEPCMu sync.Mutex
+)
+
+// UpdateICEServers replaces the live peer connection's ICE servers, such as
+// when TURN credentials are refreshed mid-call, so the next ICE restart uses
+// them. Pion accepts the change through SetConfiguration but its ICE agent
+// keeps the servers it was created with, so restartICE rebuilds a connection
+// whose servers were updated instead of restarting it in place.
+func UpdateICEServers(servers []webrtc.ICEServer) error {
+	mutex.Lock()
+	pc := peerConnection
+	mutex.Unlock()
+	if pc == nil || len(servers) == 0 {
+		return nil
+	}
+
+	config := pc.GetConfiguration()
+	if reflect.DeepEqual(config.ICEServers, servers) {
+		return nil
+	}
+	config.ICEServers = servers
+	if err := pc.SetConfiguration(config); err != nil {
+		return fmt.Errorf("update ICE servers: %w", err)
+	}
+
+	updatedICEPCMu.Lock()
+	updatedICEPC = pc
+	updatedICEPCMu.Unlock()
+	log.Printf("Updated ICE servers; they apply from the next ICE restart")
+	return nil
+}
+
+// refreshICEServers hands the live peer connection whatever servers a new
+// one would get now. It is called when a source of ICE servers changes.
+func refreshICEServers() {
+	if err := UpdateICEServers(defaultConfiguration().ICEServers); err != nil {
+		log.Printf("Failed to update ICE servers, keeping the old ones: %v", err)
+	}
+}
+
+// iceServersUpdated reports whether pc's ICE servers changed since it was created
+func iceServersUpdated(pc *webrtc.PeerConnection) bool {
+	updatedICEPCMu.Lock()
+	defer updatedICEPCMu.Unlock()
+	return updatedICEPC == pc
+}
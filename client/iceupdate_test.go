@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	testSTUN = []webrtc.ICEServer{{URLs: []string{"stun:stun.example.org:3478"}}}
+	testTURN = []webrtc.ICEServer{{URLs: []string{"turn:turn.example.org:3478"}, Username: "u", Credential: "c"}}
+)
+
+// withPeerConnection makes a peer connection with servers the live one for
+// the length of a test
+func withPeerConnection(t *testing.T, servers []webrtc.ICEServer) *webrtc.PeerConnection {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: servers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	peerConnection = pc
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		peerConnection = nil
+		mutex.Unlock()
+		pc.Close()
+	})
+	return pc
+}
+
+func TestSetServerICEServersReportsChanges(t *testing.T) {
+	t.Cleanup(func() { setServerICEServers(nil) })
+	setServerICEServers(nil)
+	if !setServerICEServers(testTURN) {
+		t.Error("first servers not reported as a change")
+	}
+	if setServerICEServers([]webrtc.ICEServer{{URLs: []string{"turn:turn.example.org:3478"}, Username: "u", Credential: "c"}}) {
+		t.Error("an equal list was reported as a change")
+	}
+	if !setServerICEServers(testSTUN) {
+		t.Error("a different list was not reported as a change")
+	}
+}
+
+func TestUpdateICEServersMarksOnlyChanges(t *testing.T) {
+	pc := withPeerConnection(t, testSTUN)
+	if err := UpdateICEServers(testSTUN); err != nil {
+		t.Fatal(err)
+	}
+	if iceServersUpdated(pc) {
+		t.Fatal("unchanged servers marked the peer connection as updated")
+	}
+	if err := UpdateICEServers(testTURN); err != nil {
+		t.Fatal(err)
+	}
+	if !iceServersUpdated(pc) {
+		t.Fatal("changed servers did not mark the peer connection")
+	}
+}
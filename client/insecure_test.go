@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSignalingDialer checks the signaling dialer verifies certificates by
+// default, and that -insecure gives it a TLS config that skips verification,
+// leaves the default dialer alone and logs a warning
+func TestSignalingDialer(t *testing.T) {
+	var logs syncBuffer
+	writer := log.Writer()
+	log.SetOutput(&logs)
+	previous := *insecureTLS
+	t.Cleanup(func() {
+		log.SetOutput(writer)
+		*insecureTLS = previous
+	})
+
+	*insecureTLS = false
+	if d := signalingDialer(); d != websocket.DefaultDialer || (d.TLSClientConfig != nil && d.TLSClientConfig.InsecureSkipVerify) {
+		t.Fatal("the default dialer skips certificate verification")
+	}
+	if strings.Contains(logs.String(), "WARNING") {
+		t.Fatalf("warned without -insecure: %q", logs.String())
+	}
+
+	*insecureTLS = true
+	d := signalingDialer()
+	if d.TLSClientConfig == nil || !d.TLSClientConfig.InsecureSkipVerify {
+		t.Fatalf("-insecure dialer has TLS config %+v, want verification skipped", d.TLSClientConfig)
+	}
+	if d == websocket.DefaultDialer || websocket.DefaultDialer.TLSClientConfig != nil {
+		t.Fatal("-insecure changed websocket.DefaultDialer")
+	}
+	if d.HandshakeTimeout != websocket.DefaultDialer.HandshakeTimeout {
+		t.Fatalf("-insecure dialer has handshake timeout %v, want the default's %v", d.HandshakeTimeout, websocket.DefaultDialer.HandshakeTimeout)
+	}
+	if !strings.Contains(logs.String(), "WARNING: -insecure") {
+		t.Fatalf("logged %q, want a warning about -insecure", logs.String())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+)
+
+var (
+	videoFile = flag.String("video-file", "", "VP8 IVF file to stream as video, looping at the end (empty sends synthetic frames)")
+	synthetic = flag.Bool("synthetic", false, "Send random bytes as media even when a media file is given, for benchmarking")
+)
+
+// ivfSource reads VP8 frames from an IVF file, starting over at the end
+type ivfSource struct {
+	path     string
+	file     *os.File
+	reader   *ivfreader.IVFReader
+	interval time.Duration // Frame duration from the file's timebase
+}
+
+// useVideoFile reports whether video comes from -video-file
+func useVideoFile() bool {
+	return *videoFile != "" && !*synthetic
+}
+
+// validateVideoFile checks that -video-file, if used, is a VP8 IVF file
+// holding at least one frame
+func validateVideoFile() error {
+	if !useVideoFile() {
+		return nil
+	}
+	src, err := openIVF(*videoFile)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+	if _, _, err := src.reader.ParseNextFrame(); err != nil {
+		return fmt.Errorf("%s: no frames: %w", *videoFile, err)
+	}
+	return nil
+}
+
+// openIVF opens path and reads its header. The timebase is taken as the
+// frame duration, as ffmpeg and the pion examples write it.
+func openIVF(path string) (*ivfSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if header.FourCC != "VP80" {
+		file.Close()
+		return nil, fmt.Errorf("%s: codec %q is not VP8", path, header.FourCC)
+	}
+	interval := time.Second * time.Duration(header.TimebaseNumerator) / time.Duration(header.TimebaseDenominator)
+	if interval <= 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s: invalid timebase %d/%d", path, header.TimebaseNumerator, header.TimebaseDenominator)
+	}
+	return &ivfSource{path: path, file: file, reader: reader, interval: interval}, nil
+}
+
+// next returns the next frame and its duration, rewinding to the first frame
+// at the end of the file. The frame is nil if the file can't be read from the
+// start either.
+func (s *ivfSource) next() ([]byte, time.Duration) {
+	return s.nextFrame(), s.interval
+}
+
+func (s *ivfSource) nextFrame() []byte {
+	frame, _, err := s.reader.ParseNextFrame()
+	if err == nil {
+		return frame
+	}
+	if !errors.Is(err, io.EOF) {
+		log.Printf("Failed to read %s, starting over: %v", s.path, err)
+	}
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Failed to rewind %s: %v", s.path, err)
+		return nil
+	}
+	if s.reader, _, err = ivfreader.NewWith(s.file); err != nil {
+		log.Printf("Failed to reread %s: %v", s.path, err)
+		return nil
+	}
+	if frame, _, err = s.reader.ParseNextFrame(); err != nil {
+		log.Printf("Failed to read %s: %v", s.path, err)
+		return nil
+	}
+	return frame
+}
+
+func (s *ivfSource) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+)
+
+var uuidRetries = flag.Int("uuid-retries", 3, "Times to rejoin with a fresh UUID after the server reports a uuid-conflict (0 gives up on the first conflict)")
+
+// newUUID generates this client's UUIDs; embedders may replace it before main runs
+var newUUID = createUUID
+
+var (
+	uuid   string
+	uuidMu sync.Mutex
+)
+
+// setUUID changes the UUID this client signals as. It is set once in main and
+// again only when a conflict forces a rejoin, while other goroutines read it.
+func setUUID(id string) {
+	uuidMu.Lock()
+	uuid = id
+	uuidMu.Unlock()
+}
+
+// currentUUID returns the UUID this client signals as
+func currentUUID() string {
+	uuidMu.Lock()
+	defer uuidMu.Unlock()
+	return uuid
+}
+
+// uuidConflicts counts the uuid-conflict rejections seen so far
+var uuidConflicts int
+
+// rejoinWithFreshUUID handles a uuid-conflict rejection by picking a new UUID
+// and redialing the signaling server, reporting whether it rejoined. An offer
+// still waiting for its answer is resent under the new UUID.
+func rejoinWithFreshUUID() bool {
+	if uuidConflicts >= *uuidRetries {
+		log.Printf("UUID conflict persists after %d retries, giving up", uuidConflicts)
+		return false
+	}
+	uuidConflicts++
+
+	conn, err := dialSignaling(signalingURL)
+	if err != nil {
+		log.Printf("Failed to rejoin %s: %v", signalingURL, err)
+		return false
+	}
+	id := newUUID()
+	setUUID(id)
+	log.Printf("UUID conflict, rejoining as %s (retry %d/%d)", id, uuidConflicts, *uuidRetries)
+
+	writeMu.Lock()
+	previous := serverConn
+	serverConn = conn
+	writeMu.Unlock()
+	previous.Close()
+
+	register()
+	offers.resendAs(id)
+	return true
+}
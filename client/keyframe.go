@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// pliInterval is how often a keyframe is requested again while a gate waits for one
+const pliInterval = time.Second
+
+var keyframeRequestInterval = flag.Duration("pli-interval", 0, "Ask the sender of each incoming video track for a keyframe this often, on top of the request made when the track arrives (0 asks only once)")
+
+// keyframeRequested is set when the peer asks for a video keyframe with a PLI
+// or FIR, and cleared by the next simulated frame, which is sent as one
+var keyframeRequested atomic.Bool
+
+// keyframeGate holds a newly attached consumer of a VP8 track back until a
+// keyframe arrives, so it never starts on a partial GOP. The sender is asked
+// for a keyframe with a PLI on attach and again every pliInterval until then.
+// A nil gate admits every packet.
+type keyframeGate struct {
+	pc      *webrtc.PeerConnection
+	track   *webrtc.TrackRemote
+	open    bool
+	lastPLI time.Time
+}
+
+// newKeyframeGate returns a gate for track and requests a keyframe, or nil
+// when the track's codec isn't gated
+func newKeyframeGate(pc *webrtc.PeerConnection, track *webrtc.TrackRemote) *keyframeGate {
+	if !strings.EqualFold(track.Codec().MimeType, webrtc.MimeTypeVP8) {
+		return nil
+	}
+	g := &keyframeGate{pc: pc, track: track}
+	g.requestKeyframe()
+	return g
+}
+
+// admit reports whether packet may be passed on. Once a keyframe has been
+// admitted the gate stays open.
+func (g *keyframeGate) admit(packet *rtp.Packet) bool {
+	if g == nil || g.open {
+		return true
+	}
+	if isVP8Keyframe(packet) {
+		g.open = true
+		log.Printf("Track %s starts on a keyframe after %s", g.track.ID(), time.Since(g.lastPLI).Round(time.Millisecond))
+		return true
+	}
+	if time.Since(g.lastPLI) >= pliInterval {
+		g.requestKeyframe()
+	}
+	return false
+}
+
+// requestKeyframe sends the track's sender a Picture Loss Indication
+func (g *keyframeGate) requestKeyframe() {
+	g.lastPLI = time.Now()
+	sendPLI(g.pc, g.track)
+}
+
+// sendPLI asks the sender of track for a keyframe
+func sendPLI(pc *webrtc.PeerConnection, track *webrtc.TrackRemote) {
+	pli := &rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}
+	if err := pc.WriteRTCP([]rtcp.Packet{pli}); err != nil {
+		log.Printf("Failed to request a keyframe for track %s: %v", track.ID(), err)
+	}
+}
+
+// requestKeyframes asks for a keyframe as soon as a video track arrives, so
+// joining mid-stream doesn't mean waiting out the sender's GOP on a frozen
+// picture, then again every -pli-interval until done is closed
+func requestKeyframes(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, done <-chan struct{}) {
+	if track.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+	sendPLI(pc, track)
+	if *keyframeRequestInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(*keyframeRequestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			sendPLI(pc, track)
+		}
+	}
+}
+
+// readSenderRTCP drains the RTCP the peer sends about our video, noting
+// keyframe requests for the video source. It returns when the sender stops.
+// Frames read from -video-file can't be turned into keyframes, so requests
+// only take effect on simulated video.
+func readSenderRTCP(sender *webrtc.RTPSender) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				keyframeRequested.Store(true)
+			}
+		}
+	}
+}
+
+// isVP8Keyframe reports whether packet starts a VP8 keyframe: the first
+// packet of the first partition, with the inverse key frame bit clear
+func isVP8Keyframe(packet *rtp.Packet) bool {
+	var vp8 codecs.VP8Packet
+	payload, err := vp8.Unmarshal(packet.Payload)
+	if err != nil || vp8.S != 1 || vp8.PID != 0 || len(payload) == 0 {
+		return false
+	}
+	return payload[0]&0x01 == 0
+}
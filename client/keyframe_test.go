@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+func TestIsVP8Keyframe(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"keyframe start", append([]byte{0x10}, blackKeyframe...), true},
+		{"interframe start", []byte{0x10, 0x01, 0x00, 0x00}, false},
+		{"keyframe continuation", append([]byte{0x00}, blackKeyframe...), false},
+		{"second partition", append([]byte{0x11}, blackKeyframe...), false},
+		{"descriptor only", []byte{0x10}, false},
+		{"empty", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isVP8Keyframe(&rtp.Packet{Payload: tc.payload}); got != tc.want {
+				t.Fatalf("isVP8Keyframe = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestKeyframeRequestReachesSender connects two peer connections in process
+// and checks that the PLI the receiver sends when a VP8 track arrives is
+// noted by the sender as a keyframe request
+func TestKeyframeRequestReachesSender(t *testing.T) {
+	keyframeRequested.Store(false)
+	sender, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	receiver, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtpSender, err := sender.AddTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go readSenderRTCP(rtpSender)
+
+	gated := make(chan bool, 1)
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		gate := newKeyframeGate(receiver, remote)
+		for {
+			packet, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			if gate.admit(packet) {
+				gated <- true
+				return
+			}
+		}
+	})
+
+	connectLoopback(t, sender, receiver)
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for !keyframeRequested.Load() {
+		select {
+		case <-deadline:
+			t.Fatal("the sender never saw a keyframe request")
+		case <-ticker.C:
+			if err := track.WriteSample(media.Sample{Data: blackKeyframe, Duration: 20 * time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	select {
+	case <-gated:
+	case <-deadline:
+		t.Fatal("the receiver's gate never admitted the keyframe")
+	}
+}
+
+// connectLoopback negotiates offerer with answerer directly, without trickle
+func connectLoopback(t *testing.T, offerer, answerer *webrtc.PeerConnection) {
+	t.Helper()
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(offerer)
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if err := answerer.SetRemoteDescription(*offerer.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered = webrtc.GatheringCompletePromise(answerer)
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if err := offerer.SetRemoteDescription(*answerer.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+}
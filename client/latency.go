@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var latencyReportInterval = flag.Duration("latency-report-interval", 0, "Log a capture-to-send latency summary this often (0 disables)")
+
+// latencyBounds are the upper bounds of the capture latency histogram buckets
+var latencyBounds = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+}
+
+// LatencyHistogram is a snapshot of the time from a sample being produced to
+// WriteSample returning. Counts[i] holds samples no slower than Bounds[i];
+// the final count holds everything slower than the last bound.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// Mean returns the average latency, or 0 if nothing was recorded
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket containing quantile q.
+// Samples in the overflow bucket report Max.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen > rank {
+			if i < len(h.Bounds) {
+				return h.Bounds[i]
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+// latencyRecorder accumulates capture latency histograms per media kind
+type latencyRecorder struct {
+	mu    sync.Mutex
+	kinds map[string]*LatencyHistogram
+}
+
+var captureLatency = &latencyRecorder{kinds: make(map[string]*LatencyHistogram)}
+
+// observe records one sample's capture-to-send latency
+func (r *latencyRecorder) observe(kind string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.kinds[kind]
+	if !ok {
+		h = &LatencyHistogram{Bounds: latencyBounds, Counts: make([]uint64, len(latencyBounds)+1)}
+		r.kinds[kind] = h
+	}
+	h.Counts[sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })]++
+	h.Count++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+}
+
+// CaptureLatency returns a copy of the capture latency histogram for a media
+// kind ("video" or "audio"), and false if no samples have been sent
+func CaptureLatency(kind string) (LatencyHistogram, bool) {
+	captureLatency.mu.Lock()
+	defer captureLatency.mu.Unlock()
+
+	h, ok := captureLatency.kinds[kind]
+	if !ok {
+		return LatencyHistogram{}, false
+	}
+	snapshot := *h
+	snapshot.Counts = append([]uint64(nil), h.Counts...)
+	return snapshot, true
+}
+
+// reportCaptureLatency logs a latency summary for each media kind until ctx is done
+func reportCaptureLatency(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var parts []string
+		for _, kind := range []string{"video", "audio"} {
+			h, ok := CaptureLatency(kind)
+			if !ok {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s: n=%d mean=%v p50<=%v p99<=%v max=%v",
+				kind, h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.99), h.Max))
+		}
+		if len(parts) > 0 {
+			log.Printf("Capture latency %s", strings.Join(parts, "; "))
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// slowWire is a track binding whose writes take delay(n) on clk for the nth
+// packet, standing in for a stalled send path
+type slowWire struct {
+	webrtc.TrackLocalContext
+	clk     *fakeClock
+	delay   func(n int) time.Duration
+	written int
+}
+
+func (w *slowWire) CodecParameters() []webrtc.RTPCodecParameters {
+	return []webrtc.RTPCodecParameters{{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, PayloadType: 111}}
+}
+func (w *slowWire) SSRC() webrtc.SSRC                       { return 1 }
+func (w *slowWire) SSRCRetransmission() webrtc.SSRC         { return 0 }
+func (w *slowWire) SSRCForwardErrorCorrection() webrtc.SSRC { return 0 }
+func (w *slowWire) ID() string                              { return "slow-wire" }
+func (w *slowWire) WriteStream() webrtc.TrackLocalWriter    { return w }
+
+func (w *slowWire) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.clk.advance(w.delay(w.written))
+	w.written++
+	return len(payload), nil
+}
+
+func (w *slowWire) Write(b []byte) (int, error) { return len(b), nil }
+
+// TestCaptureLatencyMeasured sends samples through a send path that takes a
+// known time per sample and checks the histogram records exactly that time
+func TestCaptureLatencyMeasured(t *testing.T) {
+	const (
+		kind   = "latency-test"
+		frames = 40
+	)
+	captureLatency.mu.Lock()
+	delete(captureLatency.kinds, kind)
+	captureLatency.mu.Unlock()
+	t.Cleanup(func() {
+		captureLatency.mu.Lock()
+		delete(captureLatency.kinds, kind)
+		captureLatency.mu.Unlock()
+	})
+
+	clk := newFakeClock()
+	// 1, 3, 12 and 300ms in turn: one per bucket of interest, and one past the last
+	delays := []time.Duration{time.Millisecond, 3 * time.Millisecond, 12 * time.Millisecond, 300 * time.Millisecond}
+	wire := &slowWire{clk: clk, delay: func(n int) time.Duration { return delays[n%len(delays)] }}
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, kind, "latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := track.Bind(wire); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan struct{}, frames)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runSampleWriter(ctx, clk, kind, track, &sampleCursor{}, func() ([]byte, time.Duration) {
+			return []byte{0}, audioFrameInterval
+		}, func(uint64, time.Duration) { sent <- struct{}{} })
+	}()
+	for range frames {
+		clk.wakeLate(<-clk.waits, 0)
+		<-sent
+	}
+	<-clk.waits
+	cancel()
+	<-done
+
+	h, ok := CaptureLatency(kind)
+	if !ok {
+		t.Fatal("no latency recorded")
+	}
+	var want time.Duration
+	for n := range frames {
+		want += delays[n%len(delays)]
+	}
+	if h.Count != frames || h.Sum != want || h.Max != 300*time.Millisecond {
+		t.Fatalf("recorded %d samples totalling %v, max %v; want %d totalling %v, max 300ms", h.Count, h.Sum, h.Max, frames, want)
+	}
+	// Each delay lands in the first bucket bounding it
+	perDelay := uint64(frames / len(delays))
+	for bound, count := range map[time.Duration]uint64{time.Millisecond: perDelay, 5 * time.Millisecond: perDelay, 20 * time.Millisecond: perDelay} {
+		for i, b := range h.Bounds {
+			if b == bound && h.Counts[i] != count {
+				t.Errorf("bucket <=%v holds %d, want %d", bound, h.Counts[i], count)
+			}
+		}
+	}
+	if overflow := h.Counts[len(h.Bounds)]; overflow != perDelay {
+		t.Errorf("overflow bucket holds %d, want %d", overflow, perDelay)
+	}
+	if q := h.Quantile(0.99); q != 300*time.Millisecond {
+		t.Errorf("p99 %v, want the 300ms max", q)
+	}
+}
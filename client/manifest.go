@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	manifestFile = "manifest.json"
+
+	// recordingGapThreshold is how long a track must go quiet to count as a gap
+	recordingGapThreshold = time.Second
+)
+
+// RecordingManifest ties the files in -record-dir to the tracks they hold.
+// It is rewritten whenever a recording starts, stops or records a gap.
+type RecordingManifest struct {
+	Tracks []*ManifestTrack `json:"tracks"`
+}
+
+// ManifestTrack describes one recorded track
+type ManifestTrack struct {
+	File        string     `json:"file"` // Relative to the manifest
+	Participant string     `json:"participant,omitempty"`
+	TrackID     string     `json:"trackId"`
+	StreamID    string     `json:"streamId"`
+	MID         string     `json:"mid,omitempty"`
+	Kind        string     `json:"kind"`
+	Codec       string     `json:"codec"`
+	ClockRate   uint32     `json:"clockRate"`
+	SSRC        uint32     `json:"ssrc"`
+	Started     time.Time  `json:"started"`
+	Stopped     *time.Time `json:"stopped,omitempty"`
+	LostPackets uint64     `json:"lostPackets"` // Inferred from RTP sequence number jumps
+	Gaps        []Gap      `json:"gaps,omitempty"`
+}
+
+// Gap is a stretch of at least recordingGapThreshold with no packets
+type Gap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+var (
+	manifest   RecordingManifest
+	manifestMu sync.Mutex
+
+	// remotePeer is the UUID of the peer whose description we last applied,
+	// the recipient of our signals
+	remotePeer string
+	// connPeers holds the peer each peer connection was negotiated with, the
+	// participant recorded for the tracks it receives
+	connPeers    = make(map[*webrtc.PeerConnection]string)
+	remotePeerMu sync.Mutex
+)
+
+// setRemotePeer records id as the peer we are negotiating with on pc
+func setRemotePeer(pc *webrtc.PeerConnection, id string) {
+	remotePeerMu.Lock()
+	remotePeer = id
+	connPeers[pc] = id
+	remotePeerMu.Unlock()
+}
+
+// peerOf returns the UUID of the peer pc was negotiated with
+func peerOf(pc *webrtc.PeerConnection) string {
+	remotePeerMu.Lock()
+	defer remotePeerMu.Unlock()
+	return connPeers[pc]
+}
+
+// forgetPeerOf drops a closed peer connection's peer
+func forgetPeerOf(pc *webrtc.PeerConnection) {
+	remotePeerMu.Lock()
+	delete(connPeers, pc)
+	remotePeerMu.Unlock()
+}
+
+// addManifestTrack lists a newly started recording of participant's track
+// in the manifest
+func addManifestTrack(participant string, track *webrtc.TrackRemote, mid, path string) *ManifestTrack {
+	codec := track.Codec()
+	entry := &ManifestTrack{
+		File:        filepath.Base(path),
+		Participant: participant,
+		TrackID:     track.ID(),
+		StreamID:    track.StreamID(),
+		MID:         mid,
+		Kind:        track.Kind().String(),
+		Codec:       codec.MimeType,
+		ClockRate:   codec.ClockRate,
+		SSRC:        uint32(track.SSRC()),
+		Started:     time.Now(),
+	}
+
+	manifestMu.Lock()
+	manifest.Tracks = append(manifest.Tracks, entry)
+	manifestMu.Unlock()
+	writeManifest()
+	return entry
+}
+
+// trackGaps follows one recording's packet arrival to fill in its manifest entry
+type trackGaps struct {
+	entry    *ManifestTrack
+	last     time.Time
+	lastSeq  uint16
+	havePrev bool
+}
+
+// observe accounts for one packet, updating the manifest if it ends a gap
+func (g *trackGaps) observe(packet *rtp.Packet) {
+	now := time.Now()
+	var lost uint64
+	gap := false
+	if g.havePrev {
+		// Sequence numbers wrap, so the uint16 difference is the distance
+		if diff := packet.SequenceNumber - g.lastSeq; diff > 1 && diff < 0x8000 {
+			lost = uint64(diff - 1)
+		}
+		gap = now.Sub(g.last) >= recordingGapThreshold
+	}
+
+	if lost > 0 || gap {
+		manifestMu.Lock()
+		g.entry.LostPackets += lost
+		if gap {
+			g.entry.Gaps = append(g.entry.Gaps, Gap{From: g.last, To: now})
+		}
+		manifestMu.Unlock()
+		if gap {
+			writeManifest()
+		}
+	}
+	g.last, g.lastSeq, g.havePrev = now, packet.SequenceNumber, true
+}
+
+// stop marks the recording finished in the manifest
+func (g *trackGaps) stop() {
+	now := time.Now()
+	manifestMu.Lock()
+	g.entry.Stopped = &now
+	manifestMu.Unlock()
+	writeManifest()
+}
+
+// writeManifest saves the manifest, replacing the old file atomically so a
+// reader never sees a partial write
+func writeManifest() {
+	manifestMu.Lock()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	manifestMu.Unlock()
+	if err != nil {
+		log.Printf("Failed to encode recording manifest: %v", err)
+		return
+	}
+
+	path := filepath.Join(*recordDir, manifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Failed to write recording manifest: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("Failed to replace recording manifest: %v", err)
+	}
+}
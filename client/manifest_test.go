@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// sendLoopback connects a new sending peer connection to receiver and sends
+// sample on a mimeType track until the test ends, returning the sender
+func sendLoopback(t *testing.T, receiver *webrtc.PeerConnection, mimeType, trackID string, sample []byte) *webrtc.PeerConnection {
+	t.Helper()
+	sender, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender.Close() })
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: mimeType}, trackID, trackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	connectLoopback(t, sender, receiver)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: sample, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+	return sender
+}
+
+// TestManifestListsTracks records an audio track from one peer and a video
+// track from another, each on its own peer connection, and checks the
+// manifest credits each file to the peer that sent it
+func TestManifestListsTracks(t *testing.T) {
+	dir := t.TempDir()
+	previousDir := *recordDir
+	*recordDir = dir
+	manifestMu.Lock()
+	manifest = RecordingManifest{}
+	manifestMu.Unlock()
+	t.Cleanup(func() {
+		*recordDir = previousDir
+		remotePeerMu.Lock()
+		remotePeer = ""
+		remotePeerMu.Unlock()
+	})
+
+	peers := map[string]struct {
+		mimeType string
+		trackID  string
+		sample   []byte
+	}{
+		"alice": {webrtc.MimeTypeOpus, "alice-audio", opusSilence},
+		"bob":   {webrtc.MimeTypeVP8, "bob-video", append([]byte{0x10}, blackKeyframe...)},
+	}
+	var senders []*webrtc.PeerConnection
+	for peer, send := range peers {
+		receiver, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			receiver.Close()
+			forgetPeerOf(receiver)
+		})
+		receiver.OnTrack(func(track *webrtc.TrackRemote, rtpReceiver *webrtc.RTPReceiver) {
+			readRemoteTrack(receiver, track, newMidTagger(receiver, rtpReceiver))
+		})
+		setRemotePeer(receiver, peer)
+		senders = append(senders, sendLoopback(t, receiver, send.mimeType, send.trackID, send.sample))
+	}
+
+	waitFor(t, "both tracks to be recorded", func() bool {
+		manifestMu.Lock()
+		defer manifestMu.Unlock()
+		return len(manifest.Tracks) == len(peers)
+	})
+	// Ending the calls ends the tracks, which stops their recordings
+	for _, sender := range senders {
+		sender.Close()
+	}
+	waitFor(t, "both recordings to stop", func() bool {
+		manifestMu.Lock()
+		defer manifestMu.Unlock()
+		for _, track := range manifest.Tracks {
+			if track.Stopped == nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written RecordingManifest
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ManifestTrack{
+		"alice": {File: "alice-audio.ogg", TrackID: "alice-audio", Kind: "audio", Codec: webrtc.MimeTypeOpus, ClockRate: 48000},
+		"bob":   {File: "bob-video.ivf", TrackID: "bob-video", Kind: "video", Codec: webrtc.MimeTypeVP8, ClockRate: 90000},
+	}
+	if len(written.Tracks) != len(want) {
+		t.Fatalf("manifest lists %d tracks, want %d", len(written.Tracks), len(want))
+	}
+	for _, got := range written.Tracks {
+		w, ok := want[got.Participant]
+		if !ok {
+			t.Errorf("track %s credited to %q", got.TrackID, got.Participant)
+			continue
+		}
+		if got.File != w.File || got.TrackID != w.TrackID || got.Kind != w.Kind || got.Codec != w.Codec || got.ClockRate != w.ClockRate {
+			t.Errorf("%s's track: %+v, want %+v", got.Participant, got, w)
+		}
+		if got.SSRC == 0 || got.Started.IsZero() || got.Stopped == nil || got.Stopped.Before(got.Started) {
+			t.Errorf("%s's track has SSRC %d, started %v, stopped %v", got.Participant, got.SSRC, got.Started, got.Stopped)
+		}
+		if _, err := os.Stat(filepath.Join(dir, got.File)); err != nil {
+			t.Errorf("%s's recording: %v", got.Participant, err)
+		}
+	}
+}
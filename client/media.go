@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+const (
+	videoFrameInterval = 33 * time.Millisecond // ~30fps
+	audioFrameInterval = 20 * time.Millisecond // One Opus frame
+)
+
+var (
+	mediaCancel context.CancelFunc
+	mediaWG     sync.WaitGroup
+	mediaMu     sync.Mutex
+
+	// The tracks the media writers feed, kept so RestartMedia can reuse them,
+	// and the connection they were added to
+	mediaVideoTrack, mediaAudioTrack *webrtc.TrackLocalStaticSample
+	mediaPC                          *webrtc.PeerConnection
+
+	// Sample positions carried across RestartMedia so presentation times keep
+	// matching the RTP timestamps of the existing tracks
+	videoCursor, audioCursor sampleCursor
+)
+
+// errNoMedia is returned by RestartMedia before any media has been started
+var errNoMedia = errors.New("no media stream to restart")
+
+// sampleCursor is the position of the next sample a writer will send
+type sampleCursor struct {
+	frameID uint64
+	pts     time.Duration
+}
+
+// advance moves c past a sample lasting interval and returns the position
+// that sample was sent at. startMediaStream resets the cursors while writers
+// stopped without waiting may still be running, so they are guarded by mediaMu.
+func (c *sampleCursor) advance(interval time.Duration) (frameID uint64, pts time.Duration) {
+	mediaMu.Lock()
+	defer mediaMu.Unlock()
+	frameID, pts = c.frameID, c.pts
+	c.frameID++
+	c.pts += interval
+	return frameID, pts
+}
+
+// startMediaStream stops any running media writers and starts new ones for
+// the given tracks of pc
+func startMediaStream(pc *webrtc.PeerConnection, videoTrack, audioTrack *webrtc.TrackLocalStaticSample) {
+	stopMediaStream()
+
+	mediaMu.Lock()
+	mediaVideoTrack, mediaAudioTrack, mediaPC = videoTrack, audioTrack, pc
+	videoCursor, audioCursor = sampleCursor{}, sampleCursor{}
+	mediaMu.Unlock()
+
+	runMediaStream(videoTrack, audioTrack)
+}
+
+// RestartMedia stops the media sources and starts fresh ones on the same
+// tracks, for recovering from a failed capture or encoder. The peer
+// connection, data channels, signaling and ICE are left untouched.
+//
+// A real encoder should be asked for a keyframe here so the remote decoder
+// can resume at once; every simulated frame is independent, so the first
+// frame after a restart already serves as one.
+func RestartMedia() error {
+	mediaMu.Lock()
+	videoTrack, audioTrack := mediaVideoTrack, mediaAudioTrack
+	mediaMu.Unlock()
+	if videoTrack == nil && audioTrack == nil {
+		return errNoMedia
+	}
+
+	stopMediaStream()
+	// A paused call gets fresh sources when it resumes
+	if callPaused.Load() {
+		startKeepAlive()
+	} else {
+		runMediaStream(videoTrack, audioTrack)
+	}
+	log.Println("Media pipeline restarted")
+	emitEvent(Event{Kind: "media-restarted"})
+	return nil
+}
+
+// runMediaStream starts the media writers under a new cancellable context
+func runMediaStream(videoTrack, audioTrack *webrtc.TrackLocalStaticSample) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mediaMu.Lock()
+	mediaCancel = cancel
+	mediaMu.Unlock()
+
+	simulateMediaStream(ctx, videoTrack, audioTrack)
+	if *latencyReportInterval > 0 {
+		mediaWG.Add(1)
+		go func() {
+			defer mediaWG.Done()
+			reportCaptureLatency(ctx, *latencyReportInterval)
+		}()
+	}
+}
+
+// stopMediaStream cancels the running media writers and waits for them to return
+func stopMediaStream() {
+	mediaMu.Lock()
+	cancel := mediaCancel
+	mediaCancel = nil
+	mediaMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	mediaWG.Wait()
+}
+
+// stopMediaFor stops the media writers when pc, the connection they feed,
+// has closed, rather than have them write to dead tracks until the next
+// connection replaces them. The tracks are forgotten, so RestartMedia and
+// ResumeCall return errNoMedia until new media starts. It doesn't wait for
+// the writers, since a new connection may be starting its own meanwhile.
+func stopMediaFor(pc *webrtc.PeerConnection) {
+	mediaMu.Lock()
+	defer mediaMu.Unlock()
+	if mediaPC != pc {
+		return
+	}
+	if mediaCancel != nil {
+		mediaCancel()
+		mediaCancel = nil
+	}
+	mediaVideoTrack, mediaAudioTrack, mediaPC = nil, nil, nil
+	log.Println("Media stopped with its peer connection")
+}
+
+// simulateMediaStream sends video and audio frames: video from -video-file and
+// audio from -audio-file when set, otherwise random bytes. Each kind gets its
+// own goroutine so a slow write on one doesn't delay the other. A nil track,
+// for a kind that isn't sent, gets no writer.
+func simulateMediaStream(ctx context.Context, videoTrack, audioTrack *webrtc.TrackLocalStaticSample) {
+	// In a real application, this would capture from a camera and microphone
+	if videoTrack != nil {
+		mediaWG.Add(1)
+		go writeVideo(ctx, videoTrack)
+	}
+	if audioTrack != nil {
+		mediaWG.Add(1)
+		go writeAudio(ctx, audioTrack)
+	}
+}
+
+// writeVideo feeds videoTrack until ctx is done
+func writeVideo(ctx context.Context, videoTrack *webrtc.TrackLocalStaticSample) {
+	defer mediaWG.Done()
+	if useVideoFile() {
+		src, err := openIVF(*videoFile)
+		if err != nil {
+			log.Printf("Failed to open video file: %v", err)
+			return
+		}
+		defer src.close()
+		// Real frames can't be turned into keyframes, so startup keyframes and PLIs don't apply
+		runSampleWriter(ctx, realClock{}, "video", videoTrack, &videoCursor, src.next, sendFrameMetadata)
+		return
+	}
+	runSampleWriter(ctx, realClock{}, "video", videoTrack, &videoCursor, func() ([]byte, time.Duration) {
+		// Fill with random data to simulate changing video
+		data := make([]byte, trackFrameSize(videoTrack.ID(), videoFrameInterval))
+		rand.Read(data)
+		requested := keyframeRequested.Swap(false)
+		if startupKeyframeDue() || requested {
+			markVP8Keyframe(data)
+		}
+		return data, videoFrameInterval
+	}, sendFrameMetadata)
+}
+
+// writeAudio feeds audioTrack until ctx is done
+func writeAudio(ctx context.Context, audioTrack *webrtc.TrackLocalStaticSample) {
+	defer mediaWG.Done()
+	if useAudioFile() {
+		src, err := openOgg(*audioFile)
+		if err != nil {
+			log.Printf("Failed to open audio file: %v", err)
+			return
+		}
+		defer src.close()
+		runSampleWriter(ctx, realClock{}, "audio", audioTrack, &audioCursor, src.next, nil)
+		return
+	}
+	runSampleWriter(ctx, realClock{}, "audio", audioTrack, &audioCursor, func() ([]byte, time.Duration) {
+		data := make([]byte, 1024) // Audio data
+		rand.Read(data)
+		return data, audioFrameInterval
+	}, nil)
+}
+
+// sampleClock is the time source of a sample writer
+type sampleClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// runSampleWriter writes the samples nextFrame returns until ctx is done,
+// each one lasting the duration returned with it. Deadlines are computed from
+// the start time rather than from the previous tick, so a slow write is
+// absorbed by the next sleep instead of accumulating as lag. If the writer
+// falls more than one frame behind it resynchronises rather than bursting to
+// catch up.
+//
+// If onSent is set it is called after each successful write with the frame's
+// sequence number and presentation time, both continuing from cursor. The presentation time advances by
+// exactly each frame's duration, matching the RTP timestamps pion generates.
+// The time from nextFrame returning to WriteSample returning is recorded in
+// the capture latency histogram for kind. Time is read from clk.
+func runSampleWriter(ctx context.Context, clk sampleClock, kind string, track *webrtc.TrackLocalStaticSample, cursor *sampleCursor, nextFrame func() ([]byte, time.Duration), onSent func(frameID uint64, pts time.Duration)) {
+	next := clk.Now()
+	wait := clk.After(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wait:
+		}
+
+		data, interval := nextFrame()
+		sample := media.Sample{
+			Data:     data,
+			Duration: interval,
+		}
+		captured := clk.Now()
+		err := track.WriteSample(sample)
+		latency := clk.Now().Sub(captured)
+		frameID, pts := cursor.advance(interval)
+		if err != nil {
+			log.Printf("Failed to write %s sample: %v", kind, err)
+		} else {
+			captureLatency.observe(kind, latency)
+			if onSent != nil {
+				onSent(frameID, pts)
+			}
+		}
+
+		next = next.Add(interval)
+		now := clk.Now()
+		if now.Sub(next) > interval {
+			next = now
+		}
+		wait = clk.After(next.Sub(now))
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// fakeClock is a sampleClock that only moves when the test advances it.
+// Each After call is handed to the test on waits.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits chan fakeWait
+}
+
+// fakeWait is a writer asleep until the clock reaches until
+type fakeWait struct {
+	until time.Time
+	wake  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), waits: make(chan fakeWait, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	w := fakeWait{until: c.Now().Add(d), wake: make(chan time.Time, 1)}
+	c.waits <- w
+	return w.wake
+}
+
+// advance moves the clock forward by d
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// wakeLate moves the clock to late past w's deadline and wakes its writer
+func (c *fakeClock) wakeLate(w fakeWait, late time.Duration) {
+	c.mu.Lock()
+	c.now = w.until.Add(late)
+	now := c.now
+	c.mu.Unlock()
+	w.wake <- now
+}
+
+// TestSampleWriterTiming runs the audio and video writers on fake clocks
+// that wake them late and make some frames slow to produce, and checks that
+// every frame is still sent within that jitter of its ideal time, so the
+// delays never add up to lag
+func TestSampleWriterTiming(t *testing.T) {
+	for _, tc := range []struct {
+		kind     string
+		interval time.Duration
+	}{
+		{"audio", audioFrameInterval},
+		{"video", videoFrameInterval},
+	} {
+		t.Run(tc.kind, func(t *testing.T) {
+			const (
+				frames  = 300
+				maxLate = 4 * time.Millisecond // How late a wake-up can be
+				maxWork = 6 * time.Millisecond // How long a frame can take to produce
+			)
+			track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, tc.kind, "timing")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clk := newFakeClock()
+			start := clk.Now()
+			var produced int
+			nextFrame := func() ([]byte, time.Duration) {
+				// Every third frame is slow to produce, as after a hiccup in capture
+				if produced%3 == 0 {
+					clk.advance(maxWork)
+				}
+				produced++
+				return []byte{0}, tc.interval
+			}
+			sent := make(chan time.Time, frames+1)
+			onSent := func(uint64, time.Duration) { sent <- clk.Now() }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				runSampleWriter(ctx, clk, tc.kind, track, &sampleCursor{}, nextFrame, onSent)
+			}()
+
+			for n := range frames {
+				w := <-clk.waits
+				ideal := start.Add(time.Duration(n) * tc.interval)
+				if !w.until.Equal(ideal) {
+					t.Fatalf("frame %d scheduled %v after its ideal time", n, w.until.Sub(ideal))
+				}
+				clk.wakeLate(w, time.Duration(n%5)*maxLate/4)
+				offset := (<-sent).Sub(ideal)
+				if offset < 0 || offset > maxLate+maxWork {
+					t.Fatalf("frame %d sent %v from its ideal time, want within %v", n, offset, maxLate+maxWork)
+				}
+			}
+			<-clk.waits
+			cancel()
+			<-done
+		})
+	}
+}
+
+// TestRestartMediaResumes starts media whose audio source fails at once,
+// restarts it with a working source and checks audio then reaches the peer
+// over the same connection, with its data channel still open
+func TestRestartMediaResumes(t *testing.T) {
+	sender, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender.Close() })
+	receiver, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { receiver.Close() })
+
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "restart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.AddTrack(audioTrack); err != nil {
+		t.Fatal(err)
+	}
+	channel, err := sender.CreateDataChannel("chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan struct{})
+	channel.OnOpen(func() { close(opened) })
+
+	var received atomic.Int64
+	receiver.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		received.Add(1)
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	})
+	connectLoopback(t, sender, receiver)
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("data channel never opened")
+	}
+
+	// The source can't open its input, so its writer gives up straight away
+	previousAudio := *audioFile
+	*audioFile = filepath.Join(t.TempDir(), "missing.ogg")
+	t.Cleanup(func() {
+		stopMediaFor(sender)
+		stopMediaStream()
+		*audioFile = previousAudio
+	})
+	startMediaStream(sender, nil, audioTrack)
+	mediaWG.Wait()
+	if n := received.Load(); n != 0 {
+		t.Fatalf("received %d packets from a failed source", n)
+	}
+
+	*audioFile = ""
+	if err := RestartMedia(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for received.Load() < 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d packets after the restart, want 10", received.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := sender.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		t.Fatalf("connection %s after the restart, want connected", state)
+	}
+	if state := channel.ReadyState(); state != webrtc.DataChannelStateOpen {
+		t.Fatalf("data channel %s after the restart, want open", state)
+	}
+}
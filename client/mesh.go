@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sync"
+)
+
+var (
+	meshTargets   []string
+	meshAssigned  bool // The server has sent a peer list
+	meshTargetsMu sync.Mutex
+)
+
+// setMeshTargets records the peers the server linked this client to, sent on
+// join and again whenever a newcomer is linked to it
+func setMeshTargets(peers []string) {
+	meshTargetsMu.Lock()
+	meshTargets = append([]string(nil), peers...)
+	meshAssigned = true
+	meshTargetsMu.Unlock()
+	log.Printf("Mesh targets assigned by server: %v", peers)
+}
+
+// meshAllows reports whether this client may negotiate with peer. Before the
+// server has sent a peer list, as with servers that don't cap the mesh,
+// every peer is allowed.
+func meshAllows(peer string) bool {
+	meshTargetsMu.Lock()
+	defer meshTargetsMu.Unlock()
+	return !meshAssigned || slices.Contains(meshTargets, peer)
+}
+
+// MeshTargets returns the peers this client was asked to connect to
+func MeshTargets() []string {
+	meshTargetsMu.Lock()
+	defer meshTargetsMu.Unlock()
+	return append([]string(nil), meshTargets...)
+}
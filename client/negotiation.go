@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Negotiation phases, in the order they complete
+const (
+	phaseSDP       = "sdp"       // Until both descriptions are applied
+	phaseGathering = "gathering" // Candidate gathering and checks, until ICE connects
+	phaseDTLS      = "dtls"      // The DTLS handshake, until the connection is up
+)
+
+var negotiationPhases = []string{phaseSDP, phaseGathering, phaseDTLS}
+
+var negotiationBudget = flag.Duration("negotiation-budget", 0, "Abort a negotiation that takes longer than this from the offer to connected, reporting the phase that overran (0 disables)")
+
+// negotiationTimer enforces -negotiation-budget on one peer connection
+type negotiationTimer struct {
+	mu      sync.Mutex
+	pc      *webrtc.PeerConnection
+	phase   string
+	started time.Time
+	marks   map[string]time.Duration // When each phase completed, since started
+	timer   *time.Timer
+}
+
+var negotiation = &negotiationTimer{}
+
+// begin starts the budget when pc begins negotiating. Later calls while a
+// negotiation is running are ignored.
+func (n *negotiationTimer) begin(pc *webrtc.PeerConnection) {
+	if *negotiationBudget <= 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.timer != nil && n.pc == pc {
+		return
+	}
+	if n.timer != nil {
+		n.timer.Stop()
+	}
+	n.pc, n.phase, n.started = pc, phaseSDP, time.Now()
+	n.marks = make(map[string]time.Duration)
+	n.timer = time.AfterFunc(*negotiationBudget, n.expire)
+}
+
+// complete records that phase finished on pc, stopping the budget once the
+// last phase is done. A later phase completing implies the earlier ones did,
+// since the state callbacks may be delivered out of order.
+func (n *negotiationTimer) complete(pc *webrtc.PeerConnection, phase string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.timer == nil || n.pc != pc {
+		return
+	}
+	done, current := phaseIndex(phase), phaseIndex(n.phase)
+	if done < current {
+		return
+	}
+	elapsed := time.Since(n.started)
+	for _, p := range negotiationPhases[current : done+1] {
+		n.marks[p] = elapsed
+	}
+
+	if done+1 < len(negotiationPhases) {
+		n.phase = negotiationPhases[done+1]
+		return
+	}
+	n.timer.Stop()
+	n.timer = nil
+	log.Printf("Negotiated in %v (sdp %v, gathering %v, dtls %v)", elapsed,
+		n.marks[phaseSDP], n.marks[phaseGathering]-n.marks[phaseSDP], n.marks[phaseDTLS]-n.marks[phaseGathering])
+}
+
+// phaseIndex returns a phase's position in negotiationPhases
+func phaseIndex(phase string) int {
+	for i, p := range negotiationPhases {
+		if p == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// expire aborts the negotiation, reporting the phase it was stuck in
+func (n *negotiationTimer) expire() {
+	n.mu.Lock()
+	pc, phase := n.pc, n.phase
+	n.timer = nil
+	n.mu.Unlock()
+
+	err := fmt.Errorf("negotiation exceeded its %v budget during the %s phase", *negotiationBudget, phase)
+	log.Printf("Aborting: %v", err)
+	emitEvent(Event{Kind: "negotiation-timeout", Detail: phase, Err: err})
+	if err := pc.Close(); err != nil {
+		log.Printf("Failed to close peer connection: %v", err)
+	}
+}
+
+// watchConnection hands pc's ICE and connection state changes to the
+// features that act on them
+func watchConnection(pc *webrtc.PeerConnection) {
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			negotiation.complete(pc, phaseGathering)
+			startDTLSWatchdog(pc)
+		}
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("Peer connection state: %s", state)
+		peerReconnect.observe(pc, state)
+		if state == webrtc.PeerConnectionStateConnected {
+			negotiation.complete(pc, phaseDTLS)
+			logSelectedPair(pc)
+			startCallTimer(pc)
+			startBitrateSampler(pc)
+			scheduleStartupKeyframes()
+			if err := verifyRemoteCertificate(pc); err != nil {
+				rejectPeer(pc, "fingerprint-mismatch", err)
+			}
+		}
+		if state == webrtc.PeerConnectionStateFailed {
+			writeDiagBundleOrLog(pc, "connection failed")
+		}
+		if state == webrtc.PeerConnectionStateClosed {
+			stopMediaFor(pc)
+			forgetPeerOf(pc)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// expectEvent reads Events until one of kind arrives, failing after wait
+func expectEvent(t *testing.T, kind string, wait time.Duration) Event {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case ev := <-Events:
+			if ev.Kind == kind {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %s event within %v", kind, wait)
+		}
+	}
+}
+
+// TestNegotiationBudget stalls a negotiation in each phase in turn and checks
+// the budget aborts it, closing the connection and reporting the phase that
+// overran, while a negotiation finishing in time is left alone
+func TestNegotiationBudget(t *testing.T) {
+	previous := *negotiationBudget
+	*negotiationBudget = 50 * time.Millisecond
+	t.Cleanup(func() { *negotiationBudget = previous })
+
+	for i, stalled := range negotiationPhases {
+		t.Run(stalled, func(t *testing.T) {
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+
+			n := &negotiationTimer{}
+			n.begin(pc)
+			for _, phase := range negotiationPhases[:i] {
+				n.complete(pc, phase)
+			}
+			ev := expectEvent(t, "negotiation-timeout", time.Second)
+			if ev.Detail != stalled || ev.Err == nil {
+				t.Fatalf("reported phase %q (%v), want %q", ev.Detail, ev.Err, stalled)
+			}
+			if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+				t.Fatalf("connection %s after the budget ran out, want closed", state)
+			}
+		})
+	}
+
+	t.Run("in time", func(t *testing.T) {
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+
+		n := &negotiationTimer{}
+		n.begin(pc)
+		// Completing the last phase implies the others
+		n.complete(pc, phaseDTLS)
+		time.Sleep(2 * *negotiationBudget)
+		if state := pc.ConnectionState(); state == webrtc.PeerConnectionStateClosed {
+			t.Fatal("connection closed after negotiating within the budget")
+		}
+		for len(Events) > 0 {
+			if ev := <-Events; ev.Kind == "negotiation-timeout" {
+				t.Fatalf("negotiation within the budget reported a timeout in %s", ev.Detail)
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+	"strings"
+)
+
+var (
+	normalizeSDP       = flag.Bool("normalize-sdp", false, "Canonicalize remote SDP before applying it, so peers on different stacks are handled alike")
+	stripSDPAttributes = flag.String("strip-sdp-attributes", "", "Comma-separated a= attributes removed from remote SDP when -normalize-sdp is set, e.g. x-google-flag")
+)
+
+// normalizeRemoteSDP puts a remote SDP into a canonical form: CRLF line
+// endings, no blank lines or stray whitespace, the attributes listed in
+// -strip-sdp-attributes removed, and each section's a= lines sorted by
+// attribute name after its other lines. Attributes sharing a name, such as
+// the rtpmap lines of a section, keep their relative order. Two descriptions
+// that differ only in attribute order normalize to the same SDP.
+func normalizeRemoteSDP(sdp string) string {
+	strip := map[string]bool{}
+	for _, name := range strings.Split(*stripSDPAttributes, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			strip[name] = true
+		}
+	}
+
+	var sections [][]string
+	var current []string
+	for _, line := range strings.Split(strings.ReplaceAll(sdp, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "m=") {
+			sections = append(sections, current)
+			current = nil
+		}
+		if strings.HasPrefix(line, "a=") && strip[attributeName(line)] {
+			continue
+		}
+		current = append(current, line)
+	}
+	sections = append(sections, current)
+
+	var out []string
+	for _, section := range sections {
+		out = append(out, orderAttributes(section)...)
+	}
+	return strings.Join(out, "\r\n") + "\r\n"
+}
+
+// orderAttributes moves a section's a= lines after its other lines, sorted by
+// attribute name
+func orderAttributes(section []string) []string {
+	var head, attrs []string
+	for _, line := range section {
+		if strings.HasPrefix(line, "a=") {
+			attrs = append(attrs, line)
+		} else {
+			head = append(head, line)
+		}
+	}
+	sort.SliceStable(attrs, func(i, j int) bool { return attributeName(attrs[i]) < attributeName(attrs[j]) })
+	return append(head, attrs...)
+}
+
+// attributeName returns the name of an a= line, such as rtpmap for
+// a=rtpmap:111 opus/48000/2
+func attributeName(line string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(line, "a="), ":")
+	return name
+}
+
+// applyNormalization normalizes a remote SDP when -normalize-sdp is set,
+// logging the original if normalizing changed it
+func applyNormalization(sdp string) string {
+	if !*normalizeSDP {
+		return sdp
+	}
+	normalized := normalizeRemoteSDP(sdp)
+	if normalized != sdp {
+		log.Printf("Normalized remote SDP; original:\n%s", sdp)
+	}
+	return normalized
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// reorderedSDP returns sdp with every section's a= lines in reverse name
+// order, keeping the order of lines with the same name, with LF line endings, stray whitespace and an extra x-google-flag attribute, as
+// another stack might send the same description
+func reorderedSDP(sdp string) string {
+	var out, attrs []string
+	flush := func() {
+		sort.SliceStable(attrs, func(i, j int) bool { return attributeName(attrs[i]) > attributeName(attrs[j]) })
+		out = append(out, attrs...)
+		attrs = nil
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n") {
+		if strings.HasPrefix(line, "m=") {
+			flush()
+		}
+		if strings.HasPrefix(line, "a=") {
+			attrs = append(attrs, line)
+			continue
+		}
+		out = append(out, line+" ")
+		if strings.HasPrefix(line, "m=") {
+			out = append(out, "a=x-google-flag:conference", "")
+		}
+	}
+	flush()
+	return strings.Join(out, "\n") + "\n"
+}
+
+// TestNormalizeRemoteSDP normalizes an offer and a differently ordered copy
+// of it and checks both come out identical, with the stripped attribute gone,
+// the order of same-named attributes kept and the result still accepted
+func TestNormalizeRemoteSDP(t *testing.T) {
+	previous := *stripSDPAttributes
+	*stripSDPAttributes = "x-google-flag"
+	t.Cleanup(func() { *stripSDPAttributes = previous })
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	normalized := normalizeRemoteSDP(offer.SDP)
+	if other := normalizeRemoteSDP(reorderedSDP(offer.SDP)); other != normalized {
+		t.Fatalf("equivalent SDPs normalized differently:\n%s\nand\n%s", normalized, other)
+	}
+	if strings.Contains(normalized, "x-google-flag") {
+		t.Error("stripped attribute survived normalization")
+	}
+	rtpmaps := func(sdp string) []string {
+		var lines []string
+		for _, line := range strings.Split(sdp, "\r\n") {
+			if strings.HasPrefix(line, "a=rtpmap:") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	if got, want := rtpmaps(normalized), rtpmaps(offer.SDP); !slices.Equal(got, want) {
+		t.Errorf("rtpmap lines reordered to %v, want %v", got, want)
+	}
+
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { answerer.Close() })
+	if err := answerer.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: normalized}); err != nil {
+		t.Fatalf("normalized offer refused: %v", err)
+	}
+}
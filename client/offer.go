@@ -0,0 +1,35 @@
+package main
+
+import "github.com/pion/webrtc/v4"
+
+// OfferOptions controls how makeOffer builds an offer. The zero value is a
+// plain offer on the current ICE credentials.
+type OfferOptions struct {
+	// ICERestart generates new ICE credentials and restarts gathering, so the
+	// peers find a new candidate pair without tearing the connection down
+	ICERestart bool
+	// VoiceActivityDetection tells the peer whether we want VAD on audio.
+	// Pion accepts the option but doesn't change the SDP for it yet.
+	VoiceActivityDetection bool
+}
+
+// AnswerOptions controls how makeAnswer builds an answer
+type AnswerOptions struct {
+	// VoiceActivityDetection is as for OfferOptions
+	VoiceActivityDetection bool
+}
+
+// makeOffer creates an offer on pc with explicit options instead of pion's nil default
+func makeOffer(pc *webrtc.PeerConnection, opts OfferOptions) (webrtc.SessionDescription, error) {
+	return pc.CreateOffer(&webrtc.OfferOptions{
+		OfferAnswerOptions: webrtc.OfferAnswerOptions{VoiceActivityDetection: opts.VoiceActivityDetection},
+		ICERestart:         opts.ICERestart,
+	})
+}
+
+// makeAnswer creates an answer on pc with explicit options instead of pion's nil default
+func makeAnswer(pc *webrtc.PeerConnection, opts AnswerOptions) (webrtc.SessionDescription, error) {
+	return pc.CreateAnswer(&webrtc.AnswerOptions{
+		OfferAnswerOptions: webrtc.OfferAnswerOptions{VoiceActivityDetection: opts.VoiceActivityDetection},
+	})
+}
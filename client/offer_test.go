@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// iceCredentials returns the first ICE username fragment and password in sdp
+func iceCredentials(sdp string) (ufrag, pwd string) {
+	for _, line := range strings.Split(sdp, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "a=ice-ufrag:"); ok && ufrag == "" {
+			ufrag = v
+		}
+		if v, ok := strings.CutPrefix(line, "a=ice-pwd:"); ok && pwd == "" {
+			pwd = v
+		}
+	}
+	return ufrag, pwd
+}
+
+// TestMakeOfferICERestart checks a plain offer from makeOffer keeps the ICE
+// credentials in use, that one with ICERestart replaces them, and that
+// makeAnswer answers it
+func TestMakeOfferICERestart(t *testing.T) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := makeOffer(pc, OfferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(first); err != nil {
+		t.Fatal(err)
+	}
+	// Pion can't restart ICE while the first gathering is still running
+	<-gathered
+	ufrag, pwd := iceCredentials(first.SDP)
+	if ufrag == "" || pwd == "" {
+		t.Fatal("offer carries no ICE credentials")
+	}
+
+	again, err := makeOffer(pc, OfferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, p := iceCredentials(again.SDP); u != ufrag || p != pwd {
+		t.Fatalf("plain offer changed the ICE credentials from %s/%s to %s/%s", ufrag, pwd, u, p)
+	}
+
+	restart, err := makeOffer(pc, OfferOptions{ICERestart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, p := iceCredentials(restart.SDP); u == "" || u == ufrag || p == pwd {
+		t.Fatalf("ICE restart offer kept ufrag %s (now %s) or its password", ufrag, u)
+	}
+
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { answerer.Close() })
+	if err := answerer.SetRemoteDescription(restart); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := makeAnswer(answerer, AnswerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Type != webrtc.SDPTypeAnswer {
+		t.Fatalf("makeAnswer made a %s, want an answer", answer.Type)
+	}
+}
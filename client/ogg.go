@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+)
+
+// opusSampleRate is the clock of Ogg Opus granule positions, whatever rate
+// the audio was recorded at
+const opusSampleRate = 48000
+
+// incompletePacket is the granule position of a page on which no packet ends
+const incompletePacket = ^uint64(0)
+
+var audioFile = flag.String("audio-file", "", "Ogg Opus file to stream as audio, looping at the end; encode one packet per page, e.g. ffmpeg -page_duration 20000 (empty sends synthetic frames)")
+
+// oggSource reads Opus packets from an Ogg file, one per page, starting over
+// at the end. Each packet lasts as long as its TOC byte says, normally 20ms;
+// how far the granule position advanced is the fallback, since some writers
+// start it at an arbitrary value.
+//
+// Pages may be any size: a page no packet ends on (granule position -1) is
+// held and joined with the next one. The first packets include the header's
+// pre-skip, the encoder's priming samples. RTP has no way to tell the decoder
+// to drop them, so they are sent like the rest and only delay playback by a
+// few milliseconds.
+type oggSource struct {
+	path    string
+	file    *os.File
+	reader  *oggreader.OggReader
+	granule uint64 // Granule position of the last page sent
+	pending []byte // Start of a packet continued on the next page
+	warned  bool   // A page held more than one packet
+}
+
+// useAudioFile reports whether audio comes from -audio-file
+func useAudioFile() bool {
+	return *audioFile != "" && !*synthetic
+}
+
+// validateAudioFile checks that -audio-file, if used, is an Ogg Opus file
+// holding at least one packet
+func validateAudioFile() error {
+	if !useAudioFile() {
+		return nil
+	}
+	src, err := openOgg(*audioFile)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+	if _, _, err := src.read(); err != nil {
+		return fmt.Errorf("%s: no audio: %w", *audioFile, err)
+	}
+	return nil
+}
+
+// openOgg opens path and reads its Opus identification header
+func openOgg(path string) (*oggSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, _, err := oggreader.NewWith(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &oggSource{path: path, file: file, reader: reader}, nil
+}
+
+// next returns the next packet and its duration, rewinding to the first
+// packet at the end of the file. The packet is nil if the file can't be read
+// from the start either, in which case a 20ms gap is left.
+func (s *oggSource) next() ([]byte, time.Duration) {
+	packet, duration, err := s.read()
+	if err == nil {
+		return packet, duration
+	}
+	if !errors.Is(err, io.EOF) {
+		log.Printf("Failed to read %s, starting over: %v", s.path, err)
+	}
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Failed to rewind %s: %v", s.path, err)
+		return nil, audioFrameInterval
+	}
+	if s.reader, _, err = oggreader.NewWith(s.file); err != nil {
+		log.Printf("Failed to reread %s: %v", s.path, err)
+		return nil, audioFrameInterval
+	}
+	s.granule, s.pending = 0, nil
+	if packet, duration, err = s.read(); err != nil {
+		log.Printf("Failed to read %s: %v", s.path, err)
+		return nil, audioFrameInterval
+	}
+	return packet, duration
+}
+
+// read returns the packet completed by the next audio page, skipping the
+// comment header
+func (s *oggSource) read() ([]byte, time.Duration, error) {
+	for {
+		payload, header, err := s.reader.ParseNextPage()
+		if err != nil {
+			return nil, 0, err
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || header.GranulePosition == 0 {
+			continue // Comment header pages
+		}
+		if header.GranulePosition == incompletePacket {
+			s.pending = append(s.pending, payload...)
+			continue
+		}
+
+		packet := append(s.pending, payload...)
+		s.pending = nil
+		samples := header.GranulePosition - s.granule
+		s.granule = header.GranulePosition
+		if n := uint64(opusPacketSamples(packet)); n > 0 {
+			if samples > n && !s.warned {
+				s.warned = true
+				log.Printf("Warning: %s has several Opus packets per page, which won't decode; re-encode with one packet per page", s.path)
+			}
+			samples = n
+		}
+		return packet, time.Duration(samples) * time.Second / opusSampleRate, nil
+	}
+}
+
+func (s *oggSource) close() error {
+	return s.file.Close()
+}
+
+// opusPacketSamples returns the 48kHz samples an Opus packet holds according
+// to its TOC byte (RFC 6716 section 3.1), or 0 if it can't tell
+func opusPacketSamples(packet []byte) int {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	config := int(toc >> 3)
+	var frameSamples int
+	switch {
+	case config < 12: // SILK: 10, 20, 40 or 60ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid: 10 or 20ms
+		frameSamples = []int{480, 960}[config%2]
+	default: // CELT: 2.5, 5, 10 or 20ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+
+	switch toc & 0x3 {
+	case 0:
+		return frameSamples
+	case 1, 2:
+		return 2 * frameSamples
+	default:
+		if len(packet) < 2 {
+			return 0
+		}
+		return int(packet[1]&0x3f) * frameSamples
+	}
+}
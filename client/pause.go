@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// blackKeyframe is a complete 16x16 VP8 keyframe of a black picture, the
+// video sent while paused. Being a keyframe it decodes on its own, whatever
+// the receiver missed before it.
+var blackKeyframe = []byte{
+	0xf0, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x10, 0x00, 0x10, 0x00, 0x00, 0x00,
+	0x00, 0x08, 0x00, 0x0d, 0xc0, 0xfe, 0xff, 0xdf, 0x6e, 0xd4, 0x00,
+}
+
+// opusSilence is a single Opus frame of digital silence
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+var (
+	announcePause  = flag.Bool("announce-pause", true, "Tell the peer when the call is paused or resumed so it can show an indicator")
+	pauseKeepAlive = flag.Duration("pause-keepalive", time.Second, "While paused, send a black video frame and Opus silence this often to keep NAT bindings open (0 sends nothing but any -comfort-noise)")
+)
+
+// callPaused is set while PauseCall is in effect. Inbound packets are still
+// read so the receive buffers don't back up, but they are discarded.
+var callPaused atomic.Bool
+
+// PauseCall stops sending local media and drops received media without
+// tearing down the connection. It returns errNoMedia before media has started.
+func PauseCall() error {
+	mediaMu.Lock()
+	started := mediaVideoTrack != nil || mediaAudioTrack != nil
+	mediaMu.Unlock()
+	if !started {
+		return errNoMedia
+	}
+	if callPaused.Swap(true) {
+		return nil
+	}
+
+	stopMediaStream()
+	startKeepAlive()
+	log.Println("Call paused")
+	emitEvent(Event{Kind: "paused"})
+	if *announcePause {
+		sendSignal(Signal{Type: "pause", UUID: currentUUID()})
+	}
+	return nil
+}
+
+// ResumeCall restarts local media on the existing tracks and stops dropping
+// received media
+func ResumeCall() error {
+	mediaMu.Lock()
+	videoTrack, audioTrack := mediaVideoTrack, mediaAudioTrack
+	mediaMu.Unlock()
+	if videoTrack == nil && audioTrack == nil {
+		return errNoMedia
+	}
+	if !callPaused.Swap(false) {
+		return nil
+	}
+
+	stopMediaStream() // Ends the keep-alive writer
+	runMediaStream(videoTrack, audioTrack)
+	log.Println("Call resumed")
+	emitEvent(Event{Kind: "resumed"})
+	if *announcePause {
+		sendSignal(Signal{Type: "resume", UUID: currentUUID()})
+	}
+	return nil
+}
+
+// startKeepAlive runs the paused-call keep-alive writer in place of the media
+// writers, so stopMediaStream ends it too
+func startKeepAlive() {
+	if *pauseKeepAlive <= 0 && !*comfortNoise {
+		return
+	}
+	mediaMu.Lock()
+	videoTrack, audioTrack := mediaVideoTrack, mediaAudioTrack
+	ctx, cancel := context.WithCancel(context.Background())
+	mediaCancel = cancel
+	mediaMu.Unlock()
+
+	mediaWG.Add(1)
+	go func() {
+		defer mediaWG.Done()
+		sendKeepAlive(ctx, videoTrack, audioTrack, *pauseKeepAlive)
+	}()
+}
+
+// sendKeepAlive writes one black video frame and one silent audio frame per
+// interval until ctx is done, or with -comfort-noise an Opus DTX frame every
+// comfortNoiseInterval in place of the silent one. Each sample lasts until
+// the next, so the RTP timestamps and the sample cursors keep pace with real
+// time and the media picks up seamlessly on resume.
+func sendKeepAlive(ctx context.Context, videoTrack, audioTrack *webrtc.TrackLocalStaticSample, interval time.Duration) {
+	var keepAlive, noise <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+	if *comfortNoise {
+		ticker := time.NewTicker(comfortNoiseInterval)
+		defer ticker.Stop()
+		noise = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-noise:
+			if audioTrack != nil {
+				if err := audioTrack.WriteSample(media.Sample{Data: opusDTXFrame, Duration: comfortNoiseInterval}); err != nil {
+					log.Printf("Failed to write comfort noise: %v", err)
+				}
+			}
+			audioCursor.advance(comfortNoiseInterval)
+			continue
+		case <-keepAlive:
+		}
+
+		if videoTrack != nil {
+			if err := videoTrack.WriteSample(media.Sample{Data: blackKeyframe, Duration: interval}); err != nil {
+				log.Printf("Failed to write video keep-alive: %v", err)
+			}
+		}
+		videoCursor.advance(interval)
+		if noise != nil {
+			continue
+		}
+		if audioTrack != nil {
+			if err := audioTrack.WriteSample(media.Sample{Data: opusSilence, Duration: interval}); err != nil {
+				log.Printf("Failed to write audio keep-alive: %v", err)
+			}
+		}
+		audioCursor.advance(interval)
+	}
+}
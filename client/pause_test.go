@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// recordedBytes returns the total size of the recordings in dir
+func recordedBytes(dir string) int64 {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.ogg"))
+	var total int64
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// TestPauseCallBothDirections pauses a call between two peers that each send
+// audio and checks our media stops reaching the peer and the peer's media
+// stops being recorded, that the peer is told, and that both resume after
+func TestPauseCallBothDirections(t *testing.T) {
+	server := newFakeSignalingServer(t, "pause")
+	server.connect(t)
+	dir := t.TempDir()
+	previousDir, previousKeepAlive := *recordDir, *pauseKeepAlive
+	*recordDir, *pauseKeepAlive = dir, 0
+	local, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordingDone := make(chan struct{})
+	t.Cleanup(func() {
+		ResumeCall()
+		stopMediaFor(local)
+		stopMediaStream()
+		local.Close()
+		select {
+		case <-recordingDone:
+		case <-time.After(5 * time.Second): // The track never arrived
+		}
+		forgetPeerOf(local)
+		*recordDir, *pauseKeepAlive = previousDir, previousKeepAlive
+	})
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+
+	localAudio, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "local-audio", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAudio, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "remote-audio", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.AddTrack(localAudio); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.AddTrack(remoteAudio); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our side records what it receives; the remote side counts it
+	local.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		defer close(recordingDone)
+		readRemoteTrack(local, track, newMidTagger(local, receiver))
+	})
+	var reachedRemote atomic.Int64
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			reachedRemote.Add(1)
+		}
+	})
+	connectLoopback(t, local, remote)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		ticker := time.NewTicker(audioFrameInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				remoteAudio.WriteSample(media.Sample{Data: opusSilence, Duration: audioFrameInterval})
+			}
+		}
+	}()
+	startMediaStream(local, nil, localAudio)
+
+	flowing := func(what string) {
+		t.Helper()
+		sent, recorded := reachedRemote.Load(), recordedBytes(dir)
+		waitFor(t, what, func() bool {
+			return reachedRemote.Load() > sent+5 && recordedBytes(dir) > recorded
+		})
+	}
+	flowing("media to flow both ways")
+
+	if err := PauseCall(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect(t, "pause")
+	// Let packets already in flight land before taking the baseline
+	time.Sleep(100 * time.Millisecond)
+	sent, recorded := reachedRemote.Load(), recordedBytes(dir)
+	time.Sleep(300 * time.Millisecond)
+	if n := reachedRemote.Load() - sent; n != 0 {
+		t.Errorf("%d packets reached the peer while paused", n)
+	}
+	if n := recordedBytes(dir) - recorded; n != 0 {
+		t.Errorf("%d bytes of the peer's media recorded while paused", n)
+	}
+
+	if err := ResumeCall(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect(t, "resume")
+	flowing("media to flow both ways again")
+}
+
+// TestPauseKeepAlive pauses a call for many keep-alive intervals and checks a
+// black keyframe and Opus silence reach the peer at that interval, so NAT
+// bindings stay open, and that real media resumes afterwards
+func TestPauseKeepAlive(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	server := newFakeSignalingServer(t, "keepalive")
+	server.connect(t)
+	previousKeepAlive := *pauseKeepAlive
+	*pauseKeepAlive = interval
+	local, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ResumeCall()
+		stopMediaFor(local)
+		stopMediaStream()
+		local.Close()
+		*pauseKeepAlive = previousKeepAlive
+	})
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+
+	videoTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "keepalive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "keepalive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range []webrtc.TrackLocal{videoTrack, audioTrack} {
+		if _, err := local.AddTrack(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each packet is reported as its kind and whether it is keep-alive content
+	type packet struct {
+		kind      string
+		keepAlive bool
+		payload   []byte
+	}
+	packets := make(chan packet, 1024)
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		kind := track.Kind().String()
+		for {
+			p, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			keepAlive := bytes.Equal(p.Payload, opusSilence)
+			if kind == "video" {
+				// The frame follows the VP8 payload descriptor
+				keepAlive = bytes.HasSuffix(p.Payload, blackKeyframe)
+			}
+			select {
+			case packets <- packet{kind, keepAlive, p.Payload}:
+			default:
+			}
+		}
+	})
+	connectLoopback(t, local, remote)
+	startMediaStream(local, videoTrack, audioTrack)
+
+	// next returns the next packet of kind, skipping the others
+	next := func(kind string) packet {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case p := <-packets:
+				if p.kind == kind {
+					return p
+				}
+			case <-timeout:
+				t.Fatalf("no %s packet", kind)
+			}
+		}
+	}
+	next("video")
+	next("audio")
+
+	if err := PauseCall(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect(t, "pause")
+	// Let frames already in flight land before watching
+	time.Sleep(200 * time.Millisecond)
+	for len(packets) > 0 {
+		<-packets
+	}
+
+	const window = 20 * interval
+	counts := map[string]int{}
+	deadline := time.After(window)
+collect:
+	for {
+		select {
+		case p := <-packets:
+			if !p.keepAlive {
+				t.Fatalf("%s packet while paused isn't keep-alive content: %x", p.kind, p.payload)
+			}
+			counts[p.kind]++
+		case <-deadline:
+			break collect
+		}
+	}
+	for _, kind := range []string{"video", "audio"} {
+		if n := counts[kind]; n < 10 || n > 25 {
+			t.Errorf("%d %s keep-alives in %v, want about one per %v", n, kind, window, interval)
+		}
+	}
+
+	if err := ResumeCall(); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"video", "audio"} {
+		for next(kind).keepAlive {
+		}
+	}
+}
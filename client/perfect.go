@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// perfectNegotiation resolves glare, when both peers offer at once, with the
+// perfect negotiation pattern from the WebRTC spec. The polite peer discards
+// its own offer and answers the other; the impolite peer ignores the
+// colliding offer and waits for the answer to its own. Politeness comes from
+// comparing UUIDs, so both sides agree on it without signaling.
+//
+// Pion can't roll back a local offer, so the polite peer discards it by
+// replacing the peer connection with one from rebuild.
+type perfectNegotiation struct {
+	mu sync.Mutex
+
+	makingOffer                  bool // Between creating a local offer and applying it
+	ignoreOffer                  bool // The last remote offer collided and was ignored
+	isSettingRemoteAnswerPending bool // An answer is being applied
+
+	rebuild func(old *webrtc.PeerConnection) *webrtc.PeerConnection
+}
+
+var perfect = &perfectNegotiation{}
+
+func init() {
+	perfect.rebuild = answerOnNewConnection
+}
+
+// answerOnNewConnection closes old and starts an answering peer connection
+// in its place
+func answerOnNewConnection(old *webrtc.PeerConnection) *webrtc.PeerConnection {
+	if err := old.Close(); err != nil {
+		log.Printf("Failed to close peer connection: %v", err)
+	}
+	start(false, defaultConfiguration())
+	mutex.Lock()
+	defer mutex.Unlock()
+	return peerConnection
+}
+
+// polite reports whether this client yields to the peer remote on glare
+func polite(remote string) bool {
+	return currentUUID() < remote
+}
+
+// offering marks a local offer as being made until the returned func is called
+func (p *perfectNegotiation) offering() (done func()) {
+	p.mu.Lock()
+	p.makingOffer = true
+	p.mu.Unlock()
+	return func() {
+		p.mu.Lock()
+		p.makingOffer = false
+		p.mu.Unlock()
+	}
+}
+
+// admit decides what to do with a remote description from the peer remote,
+// returning the peer connection to apply it to, or false when it must be
+// ignored. A polite peer's pending local offer is discarded along with its
+// peer connection so the remote offer can be applied to a new one.
+func (p *perfectNegotiation) admit(pc *webrtc.PeerConnection, desc webrtc.SessionDescription, remote string) (*webrtc.PeerConnection, bool) {
+	p.mu.Lock()
+	readyForOffer := !p.makingOffer &&
+		(pc.SignalingState() == webrtc.SignalingStateStable || p.isSettingRemoteAnswerPending)
+	collision := desc.Type == webrtc.SDPTypeOffer && !readyForOffer
+	p.ignoreOffer = collision && !polite(remote)
+	ignore := p.ignoreOffer
+	if desc.Type == webrtc.SDPTypeAnswer {
+		p.isSettingRemoteAnswerPending = true
+	}
+	p.mu.Unlock()
+
+	if ignore {
+		log.Printf("Offer from %s collided with ours, ignoring it as the impolite peer", remote)
+		return pc, false
+	}
+	if collision {
+		log.Printf("Offer from %s collided with ours, discarding ours as the polite peer", remote)
+		offers.answered()
+		pc = p.rebuild(pc)
+	}
+	return pc, true
+}
+
+// answerApplied clears the pending answer flag once an answer has been set
+func (p *perfectNegotiation) answerApplied() {
+	p.mu.Lock()
+	p.isSettingRemoteAnswerPending = false
+	p.mu.Unlock()
+}
+
+// reset forgets the negotiation state of the previous peer connection
+func (p *perfectNegotiation) reset() {
+	p.mu.Lock()
+	p.makingOffer, p.ignoreOffer, p.isSettingRemoteAnswerPending = false, false, false
+	p.mu.Unlock()
+}
+
+// ignoringOffer reports whether the last remote offer was ignored, in which
+// case candidates that belong to it are expected to fail
+func (p *perfectNegotiation) ignoringOffer() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ignoreOffer
+}
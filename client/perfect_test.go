@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+func TestPerfectNegotiationReset(t *testing.T) {
+	pc := withPeerConnection(t, nil)
+	p := &perfectNegotiation{}
+	p.offering()
+	if _, ok := p.admit(pc, webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer}, "peer"); !ok {
+		t.Fatal("answer was not admitted")
+	}
+	if !p.isSettingRemoteAnswerPending {
+		t.Fatal("admit did not mark the answer as being applied")
+	}
+
+	p.reset()
+	if p.makingOffer || p.ignoreOffer || p.isSettingRemoteAnswerPending {
+		t.Fatalf("reset left state behind: %+v", p)
+	}
+}
+
+// glarePeer is one side of an in-process call: its own negotiation state and
+// the peer UUID it passes to admit
+type glarePeer struct {
+	pc     *webrtc.PeerConnection
+	p      *perfectNegotiation
+	remote string
+	tracks chan *webrtc.TrackRemote
+}
+
+func newGlarePeer(t *testing.T, remote string) *glarePeer {
+	t.Helper()
+	g := &glarePeer{p: &perfectNegotiation{}, remote: remote, tracks: make(chan *webrtc.TrackRemote, 1)}
+	g.pc = g.newPeerConnection(t)
+	g.p.rebuild = func(old *webrtc.PeerConnection) *webrtc.PeerConnection {
+		old.Close()
+		return g.newPeerConnection(t)
+	}
+	return g
+}
+
+// newPeerConnection creates a peer connection sending an audio track and
+// reporting the tracks it receives
+func (g *glarePeer) newPeerConnection(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", g.remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		select {
+		case g.tracks <- remote:
+		default:
+		}
+	})
+	return pc
+}
+
+// offer makes and applies a local offer, returning it once gathered
+func (g *glarePeer) offer(t *testing.T) webrtc.SessionDescription {
+	t.Helper()
+	done := g.p.offering()
+	defer done()
+	offer, err := g.pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(g.pc)
+	if err := g.pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	return *g.pc.LocalDescription()
+}
+
+// receive handles a description from the other peer the way handleSignal
+// does, returning the answer to send back, if any
+func (g *glarePeer) receive(t *testing.T, desc webrtc.SessionDescription) *webrtc.SessionDescription {
+	t.Helper()
+	var admitted bool
+	g.pc, admitted = g.p.admit(g.pc, desc, g.remote)
+	if desc.Type == webrtc.SDPTypeAnswer {
+		defer g.p.answerApplied()
+	}
+	if !admitted {
+		return nil
+	}
+	if err := g.pc.SetRemoteDescription(desc); err != nil {
+		t.Fatal(err)
+	}
+	if desc.Type != webrtc.SDPTypeOffer {
+		return nil
+	}
+	answer, err := g.pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(g.pc)
+	if err := g.pc.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	return g.pc.LocalDescription()
+}
+
+// TestPerfectNegotiationGlare has two peer connections offer to each other at
+// once and checks that the polite one discards its offer and answers, the
+// impolite one ignores the colliding offer, and both reach stable with media
+// flowing both ways
+func TestPerfectNegotiationGlare(t *testing.T) {
+	previous := currentUUID()
+	setUUID("m")
+	t.Cleanup(func() { setUUID(previous) })
+
+	// Politeness compares our UUID with the remote's, so naming the other
+	// side "z" makes a polite and "a" makes b impolite
+	a := newGlarePeer(t, "z")
+	b := newGlarePeer(t, "a")
+
+	offerA, offerB := a.offer(t), b.offer(t)
+	if answer := b.receive(t, offerA); answer != nil {
+		t.Fatal("the impolite peer answered a colliding offer")
+	}
+	if !b.p.ignoringOffer() {
+		t.Fatal("the impolite peer did not note the ignored offer")
+	}
+	answer := a.receive(t, offerB)
+	if answer == nil {
+		t.Fatal("the polite peer did not answer the colliding offer")
+	}
+	if answer := b.receive(t, *answer); answer != nil {
+		t.Fatal("an answer was answered")
+	}
+
+	for name, g := range map[string]*glarePeer{"polite": a, "impolite": b} {
+		if state := g.pc.SignalingState(); state != webrtc.SignalingStateStable {
+			t.Errorf("%s peer is in %s, want stable", name, state)
+		}
+		select {
+		case track := <-g.tracks:
+			if track.Kind() != webrtc.RTPCodecTypeAudio {
+				t.Errorf("%s peer received a %s track", name, track.Kind())
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s peer received no media", name)
+		}
+	}
+}
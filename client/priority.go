@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority is a track's share of the video bandwidth estimate, named after the
+// WebRTC RTCPriorityType levels
+type Priority string
+
+const (
+	PriorityVeryLow Priority = "very-low"
+	PriorityLow     Priority = "low"
+	PriorityMedium  Priority = "medium"
+	PriorityHigh    Priority = "high"
+)
+
+// priorityWeights are the relative bitrates of each level, as in the WebRTC
+// priority spec: each level gets twice the share of the one below
+var priorityWeights = map[Priority]int64{
+	PriorityVeryLow: 1,
+	PriorityLow:     2,
+	PriorityMedium:  4,
+	PriorityHigh:    8,
+}
+
+var trackPriorityFlag = flag.String("track-priority", "", "Comma-separated <track-id>=<very-low|low|medium|high> shares of the estimated video bitrate, e.g. screen=high,video=low (unlisted tracks are low)")
+
+var (
+	// configuredPriorities is -track-priority, parsed once in main
+	configuredPriorities map[string]Priority
+
+	// videoTracks holds the priority of every track sharing the video estimate
+	videoTracks   = make(map[string]Priority)
+	videoTracksMu sync.Mutex
+)
+
+// parseTrackPriorities parses the -track-priority flag
+func parseTrackPriorities(s string) (map[string]Priority, error) {
+	priorities := make(map[string]Priority)
+	if s == "" {
+		return priorities, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		id, level, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid track priority %q (want <track-id>=<level>)", entry)
+		}
+		if _, known := priorityWeights[Priority(level)]; !known {
+			return nil, fmt.Errorf("unknown priority %q for track %s", level, id)
+		}
+		priorities[id] = Priority(level)
+	}
+	return priorities, nil
+}
+
+// addVideoTrack includes a track in the bitrate allocation at its configured priority
+func addVideoTrack(id string) {
+	priority := PriorityLow
+	if p, ok := configuredPriorities[id]; ok {
+		priority = p
+	}
+	if err := SetTrackPriority(id, priority); err != nil {
+		log.Printf("Failed to set priority of track %s: %v", id, err)
+	}
+}
+
+// SetTrackPriority changes a video track's share of the bandwidth estimate.
+// It takes effect from the track's next frame.
+func SetTrackPriority(id string, priority Priority) error {
+	if _, ok := priorityWeights[priority]; !ok {
+		return fmt.Errorf("unknown priority %q", priority)
+	}
+	videoTracksMu.Lock()
+	videoTracks[id] = priority
+	videoTracksMu.Unlock()
+	return nil
+}
+
+// trackBitrate returns a track's share of the video bitrate, or 0 when it is
+// unconstrained. Pion can't set RTPSender encoding priorities,
+// so the estimate is divided between the tracks' sources by weight instead.
+func trackBitrate(id string) int64 {
+	target := videoBitrate()
+	if target <= 0 {
+		return 0
+	}
+
+	videoTracksMu.Lock()
+	defer videoTracksMu.Unlock()
+	priority, ok := videoTracks[id]
+	if !ok {
+		return target
+	}
+	var total int64
+	for _, p := range videoTracks {
+		total += priorityWeights[p]
+	}
+	return target * priorityWeights[priority] / total
+}
+
+// trackFrameSize returns how many bytes a frame of the given duration may use on a track
+func trackFrameSize(id string, interval time.Duration) int {
+	bitrate := trackBitrate(id)
+	if bitrate <= 0 {
+		return defaultVideoFrameSize
+	}
+	return int(bitrate * int64(interval) / int64(8*time.Second))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPriorityAllocation gives screen share high priority and the camera low,
+// constrains the bandwidth estimate and checks screen share gets the larger
+// share, in the ratio of their weights, without the two exceeding the estimate
+func TestPriorityAllocation(t *testing.T) {
+	previousPriorities := configuredPriorities
+	previousTarget := videoTargetBitrate.Load()
+	videoTracksMu.Lock()
+	previousTracks := videoTracks
+	videoTracks = make(map[string]Priority)
+	videoTracksMu.Unlock()
+	t.Cleanup(func() {
+		configuredPriorities = previousPriorities
+		videoTargetBitrate.Store(previousTarget)
+		videoTracksMu.Lock()
+		videoTracks = previousTracks
+		videoTracksMu.Unlock()
+	})
+
+	var err error
+	if configuredPriorities, err = parseTrackPriorities("screen=high,camera=low"); err != nil {
+		t.Fatal(err)
+	}
+	addVideoTrack("screen")
+	addVideoTrack("camera")
+
+	// Unconstrained, neither track is limited
+	videoTargetBitrate.Store(0)
+	if trackBitrate("screen") != 0 || trackFrameSize("camera", videoFrameInterval) != defaultVideoFrameSize {
+		t.Fatal("tracks limited without a bandwidth estimate")
+	}
+
+	setVideoTargetBitrate(1_000_000)
+	screen, camera := trackBitrate("screen"), trackBitrate("camera")
+	if screen != 800_000 || camera != 200_000 {
+		t.Fatalf("screen %d bps, camera %d bps; want 800000 and 200000 of the 1000000 estimate", screen, camera)
+	}
+	if s, c := trackFrameSize("screen", time.Second), trackFrameSize("camera", time.Second); s != 100_000 || c != 25_000 {
+		t.Fatalf("one-second frames of %d and %d bytes, want 100000 and 25000", s, c)
+	}
+
+	// Raising the camera splits the estimate evenly
+	if err := SetTrackPriority("camera", PriorityHigh); err != nil {
+		t.Fatal(err)
+	}
+	if screen, camera := trackBitrate("screen"), trackBitrate("camera"); screen != camera || screen != 500_000 {
+		t.Fatalf("screen %d bps, camera %d bps; want 500000 each", screen, camera)
+	}
+	if err := SetTrackPriority("camera", "urgent"); err == nil {
+		t.Fatal("unknown priority accepted")
+	}
+	if _, err := parseTrackPriorities("screen=urgent"); err == nil {
+		t.Fatal("unknown priority parsed")
+	}
+}
+
+// TestRoomCapLowersTracks has the server cap each stream below the bandwidth
+// estimate and checks the tracks share the cap by priority, then get the
+// whole estimate back once the cap is lifted
+func TestRoomCapLowersTracks(t *testing.T) {
+	previousPriorities := configuredPriorities
+	previousTarget, previousCap := videoTargetBitrate.Load(), roomBitrateCap.Load()
+	videoTracksMu.Lock()
+	previousTracks := videoTracks
+	videoTracks = make(map[string]Priority)
+	videoTracksMu.Unlock()
+	t.Cleanup(func() {
+		configuredPriorities = previousPriorities
+		videoTargetBitrate.Store(previousTarget)
+		roomBitrateCap.Store(previousCap)
+		videoTracksMu.Lock()
+		videoTracks = previousTracks
+		videoTracksMu.Unlock()
+	})
+
+	var err error
+	if configuredPriorities, err = parseTrackPriorities("screen=high,camera=low"); err != nil {
+		t.Fatal(err)
+	}
+	addVideoTrack("screen")
+	addVideoTrack("camera")
+	setVideoTargetBitrate(1_000_000)
+
+	handleServerMessage([]byte(`{"type":"bandwidth","uuid":"server","bitrate":500000}`))
+	if screen, camera := trackBitrate("screen"), trackBitrate("camera"); screen != 400_000 || camera != 100_000 {
+		t.Fatalf("screen %d bps, camera %d bps; want 400000 and 100000 of the 500000 cap", screen, camera)
+	}
+
+	// A cap above the estimate leaves the estimate in charge
+	handleServerMessage([]byte(`{"type":"bandwidth","uuid":"server","bitrate":2000000}`))
+	if got := videoBitrate(); got != 1_000_000 {
+		t.Fatalf("video bitrate %d under a cap above the estimate, want 1000000", got)
+	}
+
+	handleServerMessage([]byte(`{"type":"bandwidth","uuid":"server","bitrate":0}`))
+	if screen, camera := trackBitrate("screen"), trackBitrate("camera"); screen != 800_000 || camera != 200_000 {
+		t.Fatalf("screen %d bps, camera %d bps after the cap lifted; want 800000 and 200000", screen, camera)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// subscriberBuffer is how many signals a slow subscriber may fall behind before drops
+const subscriberBuffer = 32
+
+var (
+	subscribers   = make(map[chan Signal]bool)
+	subscribersMu sync.Mutex
+)
+
+// Subscribe returns a channel receiving a copy of every inbound signal, and a
+// func that unsubscribes and closes the channel. Delivery never blocks the
+// signaling loop: a subscriber whose buffer is full misses that signal.
+func Subscribe() (<-chan Signal, func()) {
+	ch := make(chan Signal, subscriberBuffer)
+	subscribersMu.Lock()
+	subscribers[ch] = true
+	subscribersMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			subscribersMu.Lock()
+			delete(subscribers, ch)
+			subscribersMu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// publishSignal fans an inbound signal out to all subscribers
+func publishSignal(signal Signal) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- copySignal(signal):
+		default:
+			log.Printf("Subscriber is full, dropping signal from %s", signal.UUID)
+		}
+	}
+}
+
+// copySignal gives each subscriber its own copy of the pointer and slice fields
+func copySignal(signal Signal) Signal {
+	if signal.SDP != nil {
+		sdp := *signal.SDP
+		signal.SDP = &sdp
+	}
+	if signal.ICE != nil {
+		ice := *signal.ICE
+		signal.ICE = &ice
+	}
+	if signal.Trickle != nil {
+		trickle := *signal.Trickle
+		signal.Trickle = &trickle
+	}
+	signal.Peers = append([]string(nil), signal.Peers...)
+	return signal
+}
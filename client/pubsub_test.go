@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestSubscribersEachGetSignal publishes to two subscribers and checks both
+// receive their own copy, that a cancelled subscriber's channel closes, and
+// that a full subscriber doesn't hold up the rest
+func TestSubscribersEachGetSignal(t *testing.T) {
+	recorder, cancelRecorder := Subscribe()
+	ui, cancelUI := Subscribe()
+	t.Cleanup(func() {
+		cancelRecorder()
+		cancelUI()
+	})
+
+	publishSignal(Signal{UUID: "peer", SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0"}, Peers: []string{"a"}})
+	first, second := <-recorder, <-ui
+	if first.UUID != "peer" || second.UUID != "peer" || first.SDP.SDP != "v=0" || second.SDP.SDP != "v=0" {
+		t.Fatalf("got %+v and %+v, want the published signal on both", first, second)
+	}
+	// One subscriber changing its copy leaves the other's alone
+	first.SDP.SDP, first.Peers[0] = "changed", "changed"
+	if second.SDP.SDP != "v=0" || second.Peers[0] != "a" {
+		t.Fatalf("subscribers share a signal: %+v", second)
+	}
+
+	cancelRecorder()
+	cancelRecorder()
+	if _, open := <-recorder; open {
+		t.Fatal("cancelled subscriber's channel still open")
+	}
+
+	// Filling ui's buffer, then publishing once more, drops rather than blocks
+	for range subscriberBuffer + 1 {
+		publishSignal(Signal{UUID: "burst"})
+	}
+	if len(ui) != subscriberBuffer {
+		t.Fatalf("ui holds %d signals, want a full buffer of %d", len(ui), subscriberBuffer)
+	}
+}
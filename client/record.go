@@ -0,0 +1,216 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+var (
+	recordDir          = flag.String("record-dir", "", "Record incoming tracks into this directory (empty disables recording)")
+	compressRecordings = flag.Bool("compress-recordings", false, "Gzip recordings on the fly, writing .ivf.gz/.ogg.gz files")
+	recordRequests     = flag.Bool("allow-record-requests", false, "Start and stop recording when a peer sends record-start or record-stop")
+)
+
+// errNoRecordDir is returned when starting a recording without -record-dir
+var errNoRecordDir = errors.New("no -record-dir to record into")
+
+// recordingStopped is set while StopRecording is in effect. Recording is on
+// whenever -record-dir is set and this is clear.
+var recordingStopped atomic.Bool
+
+// rtpWriter is implemented by the pion IVF and Ogg writers
+type rtpWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// recording is one track being written to disk
+type recording struct {
+	path   string
+	writer rtpWriter
+	gaps   *trackGaps
+	closed bool
+	mu     sync.Mutex
+}
+
+var (
+	recordings   = make(map[*recording]bool)
+	recordingsMu sync.Mutex
+)
+
+// gzipFile compresses into a file and closes both, in order, on Close
+type gzipFile struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Writer.Close()
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createRecordingFile opens the output file, wrapping it in gzip when enabled.
+// A compressed IVF is not seekable, so its header keeps a frame count of zero.
+func createRecordingFile(path string) (io.WriteCloser, string, error) {
+	if *compressRecordings {
+		path += ".gz"
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if !*compressRecordings {
+		return file, path, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(file), file: file}, path, nil
+}
+
+// recordingPath names the file for a track's recording. A track recorded
+// again, after StopRecording or in an earlier run, gets a numbered file
+// rather than overwriting the last one.
+func recordingPath(trackID, ext string) string {
+	var gz string
+	if *compressRecordings {
+		gz = ".gz"
+	}
+	base := filepath.Join(*recordDir, trackID)
+	path := base + ext
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path + gz); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+}
+
+// recordingEnabled reports whether incoming tracks should be recorded
+func recordingEnabled() bool {
+	return *recordDir != "" && !recordingStopped.Load()
+}
+
+// StartRecording records incoming tracks again after StopRecording. Tracks
+// already playing are picked up at their next keyframe.
+func StartRecording() error {
+	if *recordDir == "" {
+		return errNoRecordDir
+	}
+	if recordingStopped.Swap(false) {
+		log.Println("Recording started")
+		emitEvent(Event{Kind: "recording-started"})
+	}
+	return nil
+}
+
+// StopRecording finalises the open recordings and records nothing more
+// until StartRecording
+func StopRecording() {
+	if recordingStopped.Swap(true) {
+		return
+	}
+	closeRecordings()
+	log.Println("Recording stopped")
+	emitEvent(Event{Kind: "recording-stopped"})
+}
+
+// startRecording creates a writer for the codec of participant's track, or
+// returns nil if it can't be recorded
+func startRecording(participant string, track *webrtc.TrackRemote, mid string) (*recording, error) {
+	codec := track.Codec()
+
+	var ext string
+	switch strings.ToLower(codec.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		ext = ".ivf"
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		ext = ".ogg"
+	default:
+		log.Printf("Not recording track %s: unsupported codec %s", track.ID(), codec.MimeType)
+		return nil, nil
+	}
+
+	out, path, err := createRecordingFile(recordingPath(track.ID(), ext))
+	if err != nil {
+		return nil, err
+	}
+
+	var writer rtpWriter
+	if ext == ".ivf" {
+		writer, err = ivfwriter.NewWith(out, ivfwriter.WithCodec(codec.MimeType))
+	} else {
+		writer, err = oggwriter.NewWith(out, codec.ClockRate, codec.Channels)
+	}
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	rec := &recording{path: path, writer: writer, gaps: &trackGaps{entry: addManifestTrack(participant, track, mid, path)}}
+	recordingsMu.Lock()
+	recordings[rec] = true
+	recordingsMu.Unlock()
+	log.Printf("Recording track %s to %s", track.ID(), path)
+	return rec, nil
+}
+
+// write appends a packet unless the recording has already been closed
+func (r *recording) write(packet *rtp.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.gaps.observe(packet)
+	return r.writer.WriteRTP(packet)
+}
+
+// close finalises the file. It is safe to call more than once.
+func (r *recording) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if err := r.writer.Close(); err != nil {
+		log.Printf("Failed to close recording %s: %v", r.path, err)
+	} else {
+		log.Printf("Saved recording %s", r.path)
+	}
+	r.gaps.stop()
+
+	recordingsMu.Lock()
+	delete(recordings, r)
+	recordingsMu.Unlock()
+}
+
+// closeRecordings finalises every open recording so files aren't truncated on exit
+func closeRecordings() {
+	recordingsMu.Lock()
+	open := make([]*recording, 0, len(recordings))
+	for rec := range recordings {
+		open = append(open, rec)
+	}
+	recordingsMu.Unlock()
+
+	for _, rec := range open {
+		rec.close()
+	}
+}
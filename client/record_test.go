@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// TestCompressedRecording records Opus packets with -compress-recordings and
+// checks the file decompresses to a complete Ogg stream holding every packet
+func TestCompressedRecording(t *testing.T) {
+	previous := *compressRecordings
+	*compressRecordings = true
+	t.Cleanup(func() { *compressRecordings = previous })
+
+	out, path, err := createRecordingFile(filepath.Join(t.TempDir(), "voice.ogg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, ".ogg.gz") {
+		t.Fatalf("recording written to %s, want a .ogg.gz file", path)
+	}
+	writer, err := oggwriter.NewWith(out, 48000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const packets = 50
+	for i := range packets {
+		packet := &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: uint16(i), Timestamp: uint32(i * 960)},
+			Payload: append([]byte{byte(i)}, opusSilence...),
+		}
+		if err := writer.WriteRTP(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, header, err := oggreader.NewWith(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Channels != 2 || header.SampleRate != 48000 {
+		t.Fatalf("Ogg header %+v, want 2 channels at 48kHz", header)
+	}
+	var got int
+	for {
+		page, _, err := reader.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("after %d packets: %v", got, err)
+		}
+		// The comment page precedes the audio
+		if bytes.HasPrefix(page, []byte("OpusTags")) {
+			continue
+		}
+		if !bytes.Equal(page, append([]byte{byte(got)}, opusSilence...)) {
+			t.Fatalf("packet %d read back as %x", got, page)
+		}
+		got++
+	}
+	if got != packets {
+		t.Fatalf("read back %d packets, want %d", got, packets)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Recovery modes for -reconnect-recovery
+const (
+	recoveryMinimal = "minimal" // Keep, ICE-restart or rebuild, whichever the connection state needs
+	recoveryRebuild = "rebuild" // Always start a new peer connection
+)
+
+var reconnectRecovery = flag.String("reconnect-recovery", recoveryMinimal, "How the peer connection recovers after a signaling reconnect: minimal keeps it and its data channels while ICE is up, restarts ICE when it is down and rebuilds it only once closed; rebuild always starts a new one")
+
+// validateReconnectRecovery checks the -reconnect-recovery flag
+func validateReconnectRecovery() error {
+	switch *reconnectRecovery {
+	case recoveryMinimal, recoveryRebuild:
+		return nil
+	}
+	return fmt.Errorf("-reconnect-recovery must be minimal or rebuild, got %q", *reconnectRecovery)
+}
+
+// recoverAfterReconnect restores the call once signaling is back. A blip that
+// only dropped the signaling socket leaves media and data channels flowing,
+// so the peer connection is kept; ICE that went down too is restarted on the
+// same connection, which keeps its data channels; only a closed connection
+// is replaced.
+func recoverAfterReconnect() {
+	mutex.Lock()
+	pc := peerConnection
+	mutex.Unlock()
+	if pc == nil {
+		return
+	}
+
+	state := pc.ConnectionState()
+	switch {
+	case *reconnectRecovery == recoveryRebuild || state == webrtc.PeerConnectionStateClosed:
+		log.Printf("Signaling reconnected with the peer connection %s, rebuilding it", state)
+		if err := pc.Close(); err != nil {
+			log.Printf("Failed to close peer connection: %v", err)
+		}
+		start(*callerFlag, defaultConfiguration())
+	case state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateDisconnected:
+		log.Printf("Signaling reconnected with the peer connection %s, restarting ICE", state)
+		restartICE(pc)
+	default:
+		log.Printf("Signaling reconnected with the peer connection %s, keeping it", state)
+	}
+}
+
+// restartICE renegotiates pc with fresh ICE credentials. A connection whose
+// ICE servers were updated is rebuilt instead, since pion would restart it
+// on its old servers.
+func restartICE(pc *webrtc.PeerConnection) {
+	if iceServersUpdated(pc) {
+		log.Println("ICE servers changed since the peer connection was created, rebuilding it")
+		if err := pc.Close(); err != nil {
+			log.Printf("Failed to close peer connection: %v", err)
+		}
+		start(*callerFlag, defaultConfiguration())
+		return
+	}
+	negotiation.begin(pc)
+	done := perfect.offering()
+	defer done()
+	offer, err := makeOffer(pc, OfferOptions{ICERestart: true})
+	if err != nil {
+		log.Printf("Failed to create ICE restart offer: %v", err)
+		return
+	}
+	if err := setLocalDescription(pc, offer); err != nil {
+		log.Printf("Failed to set local description: %v", err)
+		return
+	}
+	sendDescription(pc, offer)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// OnMediaRejected, if set, is called with the media kind ("audio" or "video")
+// of every section negotiated without a usable codec
+var OnMediaRejected func(kind string)
+
+// repairCodecs carry no media of their own and don't count as an agreed codec
+var repairCodecs = map[string]bool{"rtx": true, "red": true, "ulpfec": true, "flexfec-03": true}
+
+// checkRejectedMedia reports media sections that ended up with no media after
+// an offer/answer exchange: either side set the port to 0, or the two sides
+// share no codec. It must be called once both descriptions are applied.
+func checkRejectedMedia(pc *webrtc.PeerConnection) {
+	local, remote := pc.CurrentLocalDescription(), pc.CurrentRemoteDescription()
+	if local == nil || remote == nil {
+		return
+	}
+	for _, kind := range rejectedMedia(*local, *remote) {
+		log.Printf("Negotiation rejected %s: no common codec with the peer, no %s will flow", kind, kind)
+		emitEvent(Event{Kind: "media-rejected", Detail: kind})
+		if OnMediaRejected != nil {
+			OnMediaRejected(kind)
+		}
+	}
+}
+
+// rejectedMedia returns the kinds of audio/video sections without usable media
+func rejectedMedia(local, remote webrtc.SessionDescription) []string {
+	localSDP, err := local.Unmarshal()
+	if err != nil {
+		return nil
+	}
+	remoteSDP, err := remote.Unmarshal()
+	if err != nil {
+		return nil
+	}
+
+	localByMid := make(map[string]*sdp.MediaDescription)
+	for _, media := range localSDP.MediaDescriptions {
+		if mid, ok := media.Attribute(sdp.AttrKeyMID); ok {
+			localByMid[mid] = media
+		}
+	}
+
+	var rejected []string
+	for _, media := range remoteSDP.MediaDescriptions {
+		kind := media.MediaName.Media
+		if kind != "audio" && kind != "video" {
+			continue
+		}
+		mid, _ := media.Attribute(sdp.AttrKeyMID)
+		localMedia := localByMid[mid]
+		if media.MediaName.Port.Value == 0 || localMedia == nil || localMedia.MediaName.Port.Value == 0 || !shareCodec(localMedia, media) {
+			rejected = append(rejected, kind)
+		}
+	}
+	return rejected
+}
+
+// shareCodec reports whether two media sections list a common media codec
+func shareCodec(a, b *sdp.MediaDescription) bool {
+	codecs := codecNames(a)
+	for name := range codecNames(b) {
+		if codecs[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// codecNames returns the lower-cased encoding/clock-rate names from a section's rtpmap lines
+func codecNames(media *sdp.MediaDescription) map[string]bool {
+	names := make(map[string]bool)
+	for _, attr := range media.Attributes {
+		if attr.Key != "rtpmap" {
+			continue
+		}
+		fields := strings.Fields(attr.Value)
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.ToLower(fields[1])
+		if repairCodecs[strings.SplitN(name, "/", 2)[0]] {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
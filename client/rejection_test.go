@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// videoOnlyPeer returns a peer connection that can only send and receive
+// video in codec
+func videoOnlyPeer(t *testing.T, codec webrtc.RTPCodecParameters) *webrtc.PeerConnection {
+	t.Helper()
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// TestNoCommonCodec negotiates between a VP8-only peer sending video and an
+// H264-only peer, and checks both sides report the video section as rejected
+func TestNoCommonCodec(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		rejected []string
+	)
+	OnMediaRejected = func(kind string) {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected = append(rejected, kind)
+	}
+	t.Cleanup(func() { OnMediaRejected = nil })
+
+	offerer := videoOnlyPeer(t, webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	})
+	answerer := videoOnlyPeer(t, webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"},
+		PayloadType:        102,
+	})
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "camera")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offerer.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	// Keeps a section both sides accept, so the answer still carries ICE
+	if _, err := offerer.CreateDataChannel("chat", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := answerer.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	checkRejectedMedia(answerer)
+	// The offerer's track has nothing to be sent in, which pion reports after
+	// applying the answer
+	if err := offerer.SetRemoteDescription(answer); !errors.Is(err, webrtc.ErrUnsupportedCodec) {
+		t.Fatalf("applying the answer: %v, want %v", err, webrtc.ErrUnsupportedCodec)
+	}
+	checkRejectedMedia(offerer)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(rejected, []string{"video", "video"}) {
+		t.Fatalf("rejected %v, want video on both sides", rejected)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var forceRelay = flag.Bool("force-relay", false, "Only use TURN relay candidates, to check that the configured TURN servers work")
+
+// applyRelayPolicy restricts config to relay candidates under -force-relay.
+// Without a TURN server nothing can be gathered, so that is logged up front
+// rather than left to surface as an ICE failure.
+func applyRelayPolicy(config *webrtc.Configuration) {
+	if !*forceRelay {
+		return
+	}
+	config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	if !hasTURNServer(config.ICEServers) {
+		log.Println("-force-relay is set but no TURN server is configured; ICE will fail")
+	}
+}
+
+// hasTURNServer reports whether any of servers is a TURN server
+func hasTURNServer(servers []webrtc.ICEServer) bool {
+	for _, server := range servers {
+		for _, url := range server.URLs {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// logSelectedPair logs the candidate types of the pair ICE settled on, so a
+// relayed connection can be told apart from a direct one
+func logSelectedPair(pc *webrtc.PeerConnection) {
+	pair, err := pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		log.Printf("Failed to get selected candidate pair: %v", err)
+		return
+	}
+	log.Printf("Selected candidate pair: local %s/%s %s:%d, remote %s/%s %s:%d",
+		pair.Local.Typ, pair.Local.Protocol, pair.Local.Address, pair.Local.Port,
+		pair.Remote.Typ, pair.Remote.Protocol, pair.Remote.Address, pair.Remote.Port)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	maxRenegotiations       = flag.Int("max-renegotiations", 10, "Most renegotiation offers accepted from the peer per -renegotiation-window (0 disables the limit)")
+	renegotiationWindow     = flag.Duration("renegotiation-window", time.Minute, "Sliding window for -max-renegotiations")
+	closeOnRenegotiationCap = flag.Bool("close-on-renegotiation-cap", false, "Close the peer connection instead of ignoring offers once the renegotiation cap is hit")
+)
+
+// renegotiationLimiter caps how many renegotiation offers are accepted within a sliding window
+type renegotiationLimiter struct {
+	mu     sync.Mutex
+	offers []time.Time
+}
+
+var renegotiations = &renegotiationLimiter{}
+
+// allow records an offer at now and reports whether it is within the cap
+func (l *renegotiationLimiter) allow(now time.Time) bool {
+	if *maxRenegotiations <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-*renegotiationWindow)
+	kept := l.offers[:0]
+	for _, t := range l.offers {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	l.offers = kept
+
+	if len(l.offers) >= *maxRenegotiations {
+		return false
+	}
+	l.offers = append(l.offers, now)
+	return true
+}
+
+// reset forgets past offers, used when a new peer connection is created
+func (l *renegotiationLimiter) reset() {
+	l.mu.Lock()
+	l.offers = nil
+	l.mu.Unlock()
+}
+
+// acceptRenegotiation reports whether a renegotiation offer should be applied,
+// warning (and optionally closing the connection) when the peer exceeds the cap
+func acceptRenegotiation() bool {
+	if renegotiations.allow(time.Now()) {
+		return true
+	}
+
+	log.Printf("Warning: peer exceeded %d renegotiations per %s, refusing offer", *maxRenegotiations, *renegotiationWindow)
+	if *closeOnRenegotiationCap {
+		mutex.Lock()
+		pc := peerConnection
+		mutex.Unlock()
+		if pc != nil {
+			if err := pc.Close(); err != nil {
+				log.Printf("Failed to close peer connection: %v", err)
+			}
+		}
+	}
+	return false
+}
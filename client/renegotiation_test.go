@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestRenegotiationCap fires renegotiation offers faster than the cap allows
+// and checks the excess is refused until the window slides past, and that
+// the connection is closed when so configured
+func TestRenegotiationCap(t *testing.T) {
+	previousMax, previousWindow, previousClose := *maxRenegotiations, *renegotiationWindow, *closeOnRenegotiationCap
+	*maxRenegotiations, *renegotiationWindow = 3, time.Minute
+	t.Cleanup(func() {
+		*maxRenegotiations, *renegotiationWindow, *closeOnRenegotiationCap = previousMax, previousWindow, previousClose
+		renegotiations.reset()
+	})
+
+	l := &renegotiationLimiter{}
+	start := time.Now()
+	for i := range 3 {
+		if !l.allow(start.Add(time.Duration(i) * time.Second)) {
+			t.Fatalf("offer %d refused within the cap", i+1)
+		}
+	}
+	if l.allow(start.Add(3 * time.Second)) {
+		t.Fatal("offer over the cap accepted")
+	}
+	if !l.allow(start.Add(time.Minute + time.Second)) {
+		t.Fatal("offer refused after the first one left the window")
+	}
+
+	*closeOnRenegotiationCap = true
+	renegotiations.reset()
+	pc := withPeerConnection(t, nil)
+	for range 3 {
+		if !acceptRenegotiation() {
+			t.Fatal("renegotiation refused within the cap")
+		}
+	}
+	if acceptRenegotiation() {
+		t.Fatal("renegotiation over the cap accepted")
+	}
+	if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Fatalf("peer connection %s after the cap, want closed", state)
+	}
+}
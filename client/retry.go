@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	offerRetries = flag.Int("offer-retries", 3, "How many times to resend an unanswered offer before giving up")
+	offerTimeout = flag.Duration("offer-timeout", 5*time.Second, "How long to wait for an answer before resending the offer")
+)
+
+// offerRetrier resends the last offer until an answer arrives.
+// It always resends the identical signal so the receiver can deduplicate it.
+type offerRetrier struct {
+	mu       sync.Mutex
+	pending  *Signal
+	attempts int
+	timer    *time.Timer
+}
+
+var offers = &offerRetrier{}
+
+// sent starts waiting for an answer to a freshly sent offer
+func (r *offerRetrier) sent(signal Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked()
+	if *offerRetries <= 0 {
+		return
+	}
+	r.pending = &signal
+	r.attempts = 0
+	r.timer = time.AfterFunc(*offerTimeout, r.timeout)
+}
+
+// answered stops retrying once the peer's answer has arrived
+func (r *offerRetrier) answered() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked()
+}
+
+// resendAs resends the pending offer, if any, under a new client UUID
+func (r *offerRetrier) resendAs(uuid string) {
+	r.mu.Lock()
+	if r.pending == nil {
+		r.mu.Unlock()
+		return
+	}
+	r.pending.UUID = uuid
+	signal := *r.pending
+	r.mu.Unlock()
+
+	sendSignal(signal)
+}
+
+func (r *offerRetrier) stopLocked() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.pending = nil
+}
+
+func (r *offerRetrier) timeout() {
+	r.mu.Lock()
+	if r.pending == nil {
+		r.mu.Unlock()
+		return
+	}
+	if r.attempts >= *offerRetries {
+		log.Printf("No answer after %d offer retries, giving up", r.attempts)
+		r.stopLocked()
+		r.mu.Unlock()
+		return
+	}
+	r.attempts++
+	signal := *r.pending
+	attempt := r.attempts
+	r.timer = time.AfterFunc(*offerTimeout, r.timeout)
+	r.mu.Unlock()
+
+	log.Printf("No answer within %s, resending offer (retry %d/%d)", *offerTimeout, attempt, *offerRetries)
+	sendSignal(signal)
+}
+
+var (
+	// lastRemoteOffer and lastAnswer let a resent offer be answered again
+	// without renegotiating
+	lastRemoteOffer string
+	lastAnswer      *Signal
+	answerMu        sync.Mutex
+)
+
+// duplicateOffer reports whether sdp is the offer we last answered, and if
+// so resends that answer in case it was the answer that got lost
+func duplicateOffer(sdp string) bool {
+	answerMu.Lock()
+	answer := lastAnswer
+	duplicate := answer != nil && sdp == lastRemoteOffer
+	answerMu.Unlock()
+
+	if duplicate {
+		log.Println("Received duplicate offer, resending previous answer")
+		sendSignal(*answer)
+	}
+	return duplicate
+}
+
+// rememberAnswer records the answer sent for a remote offer
+func rememberAnswer(offer string, answer Signal) {
+	answerMu.Lock()
+	lastRemoteOffer = offer
+	lastAnswer = &answer
+	answerMu.Unlock()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestOfferRetry loses an offer and checks the identical offer is resent
+// until answered, that retries stop at -offer-retries, and that the peer
+// answers a resent offer it already answered with its earlier answer
+func TestOfferRetry(t *testing.T) {
+	server := newFakeSignalingServer(t, "retry")
+	server.connect(t)
+	previousRetries, previousTimeout := *offerRetries, *offerTimeout
+	*offerRetries, *offerTimeout = 2, 50*time.Millisecond
+	t.Cleanup(func() {
+		offers.answered()
+		*offerRetries, *offerTimeout = previousRetries, previousTimeout
+	})
+
+	next := func() (receivedSignal, bool) {
+		select {
+		case received := <-server.received:
+			return received, true
+		case <-time.After(200 * time.Millisecond):
+			return receivedSignal{}, false
+		}
+	}
+	offer := Signal{SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0 retried"}, UUID: "offerer"}
+
+	// The first send is lost; the retry carries the same offer
+	offers.sent(offer)
+	retry, ok := next()
+	if !ok || retry.SDP == nil || retry.SDP.SDP != offer.SDP.SDP {
+		t.Fatalf("got %+v, want the offer resent unchanged", retry.Signal)
+	}
+	offers.answered()
+	if extra, ok := next(); ok {
+		t.Fatalf("sent %s after the answer arrived", extra.raw)
+	}
+
+	// Without an answer it gives up after the configured retries
+	offers.sent(offer)
+	for i := range *offerRetries {
+		if _, ok := next(); !ok {
+			t.Fatalf("retry %d never sent", i+1)
+		}
+	}
+	if extra, ok := next(); ok {
+		t.Fatalf("sent %s beyond %d retries", extra.raw, *offerRetries)
+	}
+
+	// The answering side resends its answer rather than renegotiating
+	answer := Signal{SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0 answer"}, UUID: "answerer"}
+	rememberAnswer(offer.SDP.SDP, answer)
+	t.Cleanup(func() {
+		answerMu.Lock()
+		lastRemoteOffer, lastAnswer = "", nil
+		answerMu.Unlock()
+	})
+	if !duplicateOffer(offer.SDP.SDP) {
+		t.Fatal("resent offer not recognised as a duplicate")
+	}
+	if resent, ok := next(); !ok || resent.SDP == nil || resent.SDP.SDP != answer.SDP.SDP {
+		t.Fatalf("got %+v, want the earlier answer resent", resent.Signal)
+	}
+	if duplicateOffer("v=0 new") {
+		t.Fatal("new offer taken for a duplicate")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// setLocalDescription applies desc to pc. If that fails, the media peer
+// connection is returned to the stable signaling state so the next
+// negotiation can start cleanly, and the failure is published as a "negotiation-failed" event with desc's type
+// as the detail.
+func setLocalDescription(pc *webrtc.PeerConnection, desc webrtc.SessionDescription) error {
+	err := pc.SetLocalDescription(desc)
+	if err == nil {
+		return nil
+	}
+	negotiationFailed(pc, desc.Type, err)
+	return err
+}
+
+// negotiationFailed rolls pc back to stable after it failed to create or
+// apply a local description of type sdpType, and publishes the failure as a
+// "negotiation-failed" event. The connection stays usable, so the peer's next
+// offer can still connect it.
+func negotiationFailed(pc *webrtc.PeerConnection, sdpType webrtc.SDPType, err error) {
+	rollbackToStable(pc)
+	emitEvent(Event{Kind: "negotiation-failed", Detail: sdpType.String(), Err: err})
+}
+
+// rollbackToStable discards whichever offer pc has pending: our own, or the
+// peer's that we failed to answer. Pion refuses rollback descriptions, so as
+// on glare the media peer connection is replaced by a stable one that answers
+// the peer's next offer.
+func rollbackToStable(pc *webrtc.PeerConnection) {
+	state := pc.SignalingState()
+	if state != webrtc.SignalingStateHaveLocalOffer && state != webrtc.SignalingStateHaveRemoteOffer {
+		return
+	}
+	if state == webrtc.SignalingStateHaveLocalOffer {
+		offers.answered()
+	}
+	if !currentPeerConnection(pc) {
+		log.Printf("Can't roll back a peer connection left in %s", state)
+		return
+	}
+	log.Printf("Replacing the peer connection left in %s after a failed local description", state)
+	perfect.rebuild(pc)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestSetLocalDescriptionRollsBack makes applying a local description fail
+// while our own offer is pending and while the peer's is, and checks each
+// failure is reported and leaves a stable peer connection that the peer's
+// next offer connects
+func TestSetLocalDescriptionRollsBack(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// fail leaves local mid-negotiation with remote and returns a local
+		// description that local can't apply
+		fail    func(t *testing.T, local, remote *webrtc.PeerConnection) webrtc.SessionDescription
+		pending webrtc.SignalingState
+	}{
+		{
+			name: "own offer",
+			fail: func(t *testing.T, local, _ *webrtc.PeerConnection) webrtc.SessionDescription {
+				if _, err := local.CreateDataChannel("chat", nil); err != nil {
+					t.Fatal(err)
+				}
+				offer, err := local.CreateOffer(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := local.SetLocalDescription(offer); err != nil {
+					t.Fatal(err)
+				}
+				// Answering our own offer is not a valid transition
+				return webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: offer.SDP}
+			},
+			pending: webrtc.SignalingStateHaveLocalOffer,
+		},
+		{
+			name: "peer's offer",
+			fail: func(t *testing.T, local, remote *webrtc.PeerConnection) webrtc.SessionDescription {
+				offer, err := remote.CreateOffer(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := local.SetRemoteDescription(offer); err != nil {
+					t.Fatal(err)
+				}
+				answer, err := local.CreateAnswer(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// An answer mangled on its way to being applied
+				return webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: strings.Replace(answer.SDP, "m=application", "m=bogus", 1)}
+			},
+			pending: webrtc.SignalingStateHaveRemoteOffer,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			local := withPeerConnection(t, nil)
+			remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { remote.Close() })
+			if _, err := remote.CreateDataChannel("chat", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			previousRebuild := perfect.rebuild
+			t.Cleanup(func() { perfect.rebuild = previousRebuild })
+			perfect.rebuild = func(old *webrtc.PeerConnection) *webrtc.PeerConnection {
+				old.Close()
+				pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { pc.Close() })
+				mutex.Lock()
+				peerConnection = pc
+				mutex.Unlock()
+				return pc
+			}
+
+			desc := tc.fail(t, local, remote)
+			if state := local.SignalingState(); state != tc.pending {
+				t.Fatalf("signaling state %s before the failure, want %s", state, tc.pending)
+			}
+			if err := setLocalDescription(local, desc); err == nil {
+				t.Fatal("applying the bad description succeeded")
+			}
+			ev := expectEvent(t, "negotiation-failed", time.Second)
+			if ev.Detail != desc.Type.String() || ev.Err == nil {
+				t.Fatalf("reported %q (%v), want the %s that failed", ev.Detail, ev.Err, desc.Type)
+			}
+
+			mutex.Lock()
+			pc := peerConnection
+			mutex.Unlock()
+			if state := pc.SignalingState(); state != webrtc.SignalingStateStable {
+				t.Fatalf("signaling state %s after the failure, want stable", state)
+			}
+			if pc == local || local.ConnectionState() != webrtc.PeerConnectionStateClosed {
+				t.Fatal("the wedged peer connection was kept")
+			}
+
+			// The peer starts over with a fresh offer
+			connectLoopback(t, remote, pc)
+			waitFor(t, "the fresh negotiation to connect", func() bool {
+				return pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+			})
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// recipient returns the UUID offer, answer and candidate signals are
+// addressed to: the peer whose description we last applied, or "" to
+// broadcast them to the room before there is one
+func recipient() string {
+	remotePeerMu.Lock()
+	defer remotePeerMu.Unlock()
+	return remotePeer
+}
+
+// welcomeTimeout bounds how long register waits for the server's welcome
+const welcomeTimeout = 10 * time.Second
+
+// register announces this client's UUID to the server so signals addressed
+// to it can be delivered, then reads the server's welcome. The welcome is
+// the first message on every connection, and reading it here puts the
+// connection ID and the server's ICE servers in place before the caller
+// configures a peer connection. It is called whenever a signaling connection
+// opens, by the connection's only reader.
+func register() {
+	sendSignal(Signal{Type: "register", UUID: currentUUID()})
+
+	writeMu.Lock()
+	conn := serverConn
+	writeMu.Unlock()
+	conn.SetReadDeadline(time.Now().Add(welcomeTimeout))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		// The read loop sees the same error and reconnects
+		log.Printf("No welcome from the signaling server: %v", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if !duplicateDelivery(message) {
+		handleServerMessage(message)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var peerCompat = flag.String("peer-compat", "", "Shape signalled SDP for a picky peer: safari (empty sends pion's SDP as is)")
+
+// safariAttributeOrder ranks media-level attributes in the order WebKit's
+// libwebrtc writes them. Attributes not listed keep their relative order,
+// after the transport attributes and before the codec descriptions.
+var safariAttributeOrder = map[string]int{
+	"rtcp":              1,
+	"candidate":         2,
+	"end-of-candidates": 3,
+	"ice-ufrag":         4,
+	"ice-pwd":           5,
+	"ice-options":       6,
+	"fingerprint":       7,
+	"setup":             8,
+	"mid":               9,
+	"extmap":            10,
+	"sendrecv":          11,
+	"sendonly":          11,
+	"recvonly":          11,
+	"inactive":          11,
+	"msid":              12,
+	"rtcp-mux":          13,
+	"rtcp-rsize":        14,
+	"rtpmap":            20,
+	"rtcp-fb":           20,
+	"fmtp":              20,
+	"ssrc-group":        30,
+	"ssrc":              31,
+}
+
+// validatePeerCompat checks the -peer-compat flag
+func validatePeerCompat() error {
+	switch *peerCompat {
+	case "", "safari":
+		return nil
+	}
+	return fmt.Errorf("-peer-compat must be safari or empty, got %q", *peerCompat)
+}
+
+// withSafariCompat rewrites SDP into the shape Safari is known to accept.
+// The quirks it addresses:
+//
+//   - Older Safari failed to negotiate when some sections weren't bundled,
+//     so every active section is listed in one a=group:BUNDLE.
+//   - Safari only supports multiplexed RTCP, so every active section carries
+//     a=rtcp-mux. The peer connection also runs with the max-bundle and
+//     require rtcp-mux policies so the local transport matches.
+//   - Safari has rejected otherwise valid SDP whose attributes were ordered
+//     differently from libwebrtc's, so media attributes are put in that order,
+//     keeping codec lines grouped by payload type.
+func withSafariCompat(sdp string) string {
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+
+	var session []string
+	var sections [][]string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			sections = append(sections, []string{line})
+			continue
+		}
+		if len(sections) == 0 {
+			session = append(session, line)
+		} else {
+			sections[len(sections)-1] = append(sections[len(sections)-1], line)
+		}
+	}
+
+	var mids []string
+	for i, section := range sections {
+		// Port 0 marks a rejected section, which must stay out of the bundle
+		if fields := strings.Fields(section[0]); len(fields) > 1 && fields[1] == "0" {
+			continue
+		}
+		hasMux := false
+		for _, line := range section {
+			if mid, ok := strings.CutPrefix(line, "a=mid:"); ok {
+				mids = append(mids, mid)
+			}
+			hasMux = hasMux || line == "a=rtcp-mux"
+		}
+		if !hasMux {
+			section = append(section, "a=rtcp-mux")
+		}
+		sections[i] = orderSafariAttributes(section)
+	}
+
+	out := make([]string, 0, len(lines)+len(sections)+1)
+	bundled := false
+	for _, line := range session {
+		if strings.HasPrefix(line, "a=group:BUNDLE") {
+			if len(mids) > 0 && !bundled {
+				out = append(out, "a=group:BUNDLE "+strings.Join(mids, " "))
+				bundled = true
+			}
+			continue
+		}
+		// The bundle group goes before any other session attribute
+		if strings.HasPrefix(line, "a=") && !bundled && len(mids) > 0 {
+			out = append(out, "a=group:BUNDLE "+strings.Join(mids, " "))
+			bundled = true
+		}
+		out = append(out, line)
+	}
+	if !bundled && len(mids) > 0 {
+		out = append(out, "a=group:BUNDLE "+strings.Join(mids, " "))
+	}
+	for _, section := range sections {
+		out = append(out, section...)
+	}
+	return strings.Join(out, "\r\n") + "\r\n"
+}
+
+// orderSafariAttributes sorts a media section's a= lines by
+// safariAttributeOrder. The m= line and any c=, b= or i= lines stay first.
+func orderSafariAttributes(section []string) []string {
+	split := len(section)
+	for i, line := range section {
+		if strings.HasPrefix(line, "a=") {
+			split = i
+			break
+		}
+	}
+	head := section[:split]
+	attrs := append([]string(nil), section[split:]...)
+
+	rank := func(line string) int {
+		name := strings.TrimPrefix(line, "a=")
+		name, _, _ = strings.Cut(name, ":")
+		if r, ok := safariAttributeOrder[name]; ok {
+			return r
+		}
+		return 16
+	}
+	sort.SliceStable(attrs, func(i, j int) bool { return rank(attrs[i]) < rank(attrs[j]) })
+	return append(head, attrs...)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// unbundledSDP lacks a bundle group and rtcp-mux on its video section, has a
+// rejected section, and orders attributes unlike libwebrtc
+const unbundledSDP = "v=0\r\n" +
+	"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=msid-semantic: WMS *\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n" +
+	"a=sendrecv\r\n" +
+	"a=mid:0\r\n" +
+	"a=ice-ufrag:abcd\r\n" +
+	"a=rtcp-mux\r\n" +
+	"a=setup:actpass\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96 97\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=rtcp-fb:96 nack\r\n" +
+	"a=rtpmap:97 rtx/90000\r\n" +
+	"a=fmtp:97 apt=96\r\n" +
+	"a=ssrc:1 cname:x\r\n" +
+	"a=mid:1\r\n" +
+	"a=fingerprint:sha-256 AA:BB\r\n" +
+	"a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid\r\n" +
+	"a=sendonly\r\n" +
+	"m=application 0 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"a=mid:2\r\n"
+
+// TestSafariCompat applies the Safari transform and checks every documented
+// constraint: one bundle group of the active sections ahead of the other
+// session attributes, rtcp-mux everywhere, and libwebrtc's attribute order
+// with codec lines kept in their original order
+func TestSafariCompat(t *testing.T) {
+	out := withSafariCompat(unbundledSDP)
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(out); err != nil {
+		t.Fatalf("transformed SDP doesn't parse: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	if bundle := slices.Index(lines, "a=group:BUNDLE 0 1"); bundle < 0 || bundle > slices.Index(lines, "a=msid-semantic: WMS *") {
+		t.Fatalf("want a=group:BUNDLE 0 1 first among the session attributes:\n%s", out)
+	}
+
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Port.Value == 0 {
+			continue
+		}
+		if _, ok := media.Attribute(sdp.AttrKeyRTCPMux); !ok {
+			t.Errorf("%s section lacks rtcp-mux", media.MediaName.Media)
+		}
+		last, lastName := 0, ""
+		var codecLines []string
+		for _, attr := range media.Attributes {
+			rank, ok := safariAttributeOrder[attr.Key]
+			if !ok {
+				rank = 16
+			}
+			if rank < last {
+				t.Errorf("%s section has a=%s after a=%s", media.MediaName.Media, attr.Key, lastName)
+			}
+			last, lastName = rank, attr.Key
+			if rank == 20 {
+				codecLines = append(codecLines, attr.String())
+			}
+		}
+		if media.MediaName.Media == "video" {
+			want := []string{"rtpmap:96 VP8/90000", "rtcp-fb:96 nack", "rtpmap:97 rtx/90000", "fmtp:97 apt=96"}
+			if !slices.Equal(codecLines, want) {
+				t.Errorf("video codec lines %q, want %q", codecLines, want)
+			}
+		}
+	}
+
+	if got := withSafariCompat(out); got != out {
+		t.Errorf("transform isn't idempotent:\n%s", got)
+	}
+}
+
+// TestSafariCompatAccepted checks -peer-compat=safari sets the matching
+// transport policies and that an offer reshaped for Safari is still accepted
+func TestSafariCompatAccepted(t *testing.T) {
+	previous := *peerCompat
+	*peerCompat = "safari"
+	t.Cleanup(func() { *peerCompat = previous })
+	config := completeConfiguration(webrtc.Configuration{})
+	if config.BundlePolicy != webrtc.BundlePolicyMaxBundle || config.RTCPMuxPolicy != webrtc.RTCPMuxPolicyRequire {
+		t.Fatalf("bundle policy %s, rtcp-mux policy %s; want max-bundle and require", config.BundlePolicy, config.RTCPMuxPolicy)
+	}
+
+	offerer, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offerer.Close()
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer answerer.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := offerer.AddTransceiverFromKind(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer.SDP = transformOutgoingSDP(offer.SDP)
+	if err := answerer.SetRemoteDescription(offer); err != nil {
+		t.Fatalf("reshaped offer refused: %v", err)
+	}
+	if _, err := answerer.CreateAnswer(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+)
+
+// maxBandwidthBPS is an upper sanity bound for configured bandwidth limits
+const maxBandwidthBPS = 10_000_000_000
+
+var bandwidthTIAS = flag.Int64("bandwidth-tias", 0, "Ask the peer to limit video sent to us to this many bits per second, via b=TIAS with a matching b=AS (0 disables)")
+
+// validateSDPFlags checks the SDP transform settings before any SDP is produced
+func validateSDPFlags() error {
+	if *bandwidthTIAS < 0 || *bandwidthTIAS > maxBandwidthBPS {
+		return errors.New("-bandwidth-tias must be between 0 and 10000000000 bits per second")
+	}
+	if err := validatePeerCompat(); err != nil {
+		return err
+	}
+	if err := validateMaxSDPCandidates(); err != nil {
+		return err
+	}
+	return validateICEPrefer()
+}
+
+// transformOutgoingSDP applies the configured rewrites to an SDP we are about
+// to signal. Pion rejects a SetLocalDescription whose SDP differs from the
+// one it generated, so rewrites are applied to the signalled copy only.
+func transformOutgoingSDP(sdp string) string {
+	if *bandwidthTIAS > 0 {
+		sdp = withVideoBandwidth(sdp, *bandwidthTIAS)
+	}
+	// Capping picks by priority, so it goes before the family reordering
+	sdp = capSDPCandidates(sdp)
+	if *icePrefer != "auto" {
+		sdp = withPreferredFamilyFirst(sdp)
+	}
+	// Last, since it fixes the final attribute order
+	if *peerCompat == "safari" {
+		sdp = withSafariCompat(sdp)
+	}
+	return sdp
+}
+
+// withVideoBandwidth sets the bandwidth of every video section to bps. It
+// writes b=TIAS (RFC 3890, bits per second) and, for endpoints that only
+// understand the legacy form, b=AS (RFC 4566, kilobits per second). Existing
+// b=AS and b=TIAS lines in those sections are replaced.
+func withVideoBandwidth(sdp string, bps int64) string {
+	kbps := (bps + 999) / 1000
+	bandwidth := []string{
+		"b=AS:" + strconv.FormatInt(kbps, 10),
+		"b=TIAS:" + strconv.FormatInt(bps, 10),
+	}
+
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+	out := make([]string, 0, len(lines)+4)
+	inVideo, inserted := false, false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			inVideo = strings.HasPrefix(line, "m=video ")
+			inserted = false
+		}
+		if inVideo && (strings.HasPrefix(line, "b=AS:") || strings.HasPrefix(line, "b=TIAS:")) {
+			continue
+		}
+		out = append(out, line)
+
+		// b= lines follow the m= and optional i=/c= lines of a media section
+		if inVideo && !inserted {
+			nextIsHeader := i+1 < len(lines) && (strings.HasPrefix(lines[i+1], "i=") || strings.HasPrefix(lines[i+1], "c="))
+			if !nextIsHeader {
+				out = append(out, bandwidth...)
+				inserted = true
+			}
+		}
+	}
+	return strings.Join(out, "\r\n") + "\r\n"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// TestVideoBandwidthTIAS sets -bandwidth-tias and checks the signalled offer
+// carries b=TIAS with that value, and the matching b=AS, on video only
+func TestVideoBandwidthTIAS(t *testing.T) {
+	previous := *bandwidthTIAS
+	t.Cleanup(func() { *bandwidthTIAS = previous })
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*bandwidthTIAS = 1_500_000
+	// A limit already in the SDP is replaced rather than doubled
+	signalled := transformOutgoingSDP(withVideoBandwidth(offer.SDP, 300_000))
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(signalled); err != nil {
+		t.Fatalf("transformed SDP no longer parses: %v", err)
+	}
+	for _, media := range parsed.MediaDescriptions {
+		got := media.Bandwidth
+		if media.MediaName.Media != "video" {
+			if len(got) != 0 {
+				t.Errorf("%s section has bandwidth %+v, want none", media.MediaName.Media, got)
+			}
+			continue
+		}
+		want := []sdp.Bandwidth{{Type: "AS", Bandwidth: 1500}, {Type: "TIAS", Bandwidth: 1_500_000}}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("video bandwidth %+v, want %+v", got, want)
+		}
+	}
+
+	for _, bps := range []int64{-1, maxBandwidthBPS + 1} {
+		*bandwidthTIAS = bps
+		if err := validateSDPFlags(); err == nil || !strings.Contains(err.Error(), "-bandwidth-tias") {
+			t.Errorf("-bandwidth-tias %d: %v, want it refused", bps, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// probeTimeout bounds how long a single server is given to answer a probe
+const probeTimeout = 3 * time.Second
+
+var signalingServers = flag.String("servers", "", "Comma-separated signaling server URLs; the client connects to the one with the lowest latency")
+
+// ServerLatency is the result of probing one signaling server
+type ServerLatency struct {
+	URL     string
+	Latency time.Duration // Ping round trip over the probe connection
+	Err     error
+}
+
+var (
+	selectedServer  string
+	serverLatencies []ServerLatency
+	selectionMu     sync.Mutex
+)
+
+// selectServer probes every candidate URL concurrently and returns the fastest
+// reachable one. Call it again before reconnecting to re-evaluate.
+func selectServer(urls []string) (string, error) {
+	results := make([]ServerLatency, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := probeServer(url)
+			results[i] = ServerLatency{URL: url, Latency: latency, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	best := -1
+	for i, r := range results {
+		if r.Err != nil {
+			log.Printf("Signaling server %s unreachable: %v", r.URL, r.Err)
+			continue
+		}
+		log.Printf("Signaling server %s latency: %s", r.URL, r.Latency)
+		if best < 0 || r.Latency < results[best].Latency {
+			best = i
+		}
+	}
+
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	serverLatencies = results
+	if best < 0 {
+		selectedServer = ""
+		return "", errors.New("no signaling server reachable")
+	}
+	selectedServer = results[best].URL
+	return selectedServer, nil
+}
+
+// probeServer opens a throwaway WebSocket to url and times a ping round trip
+func probeServer(url string) (time.Duration, error) {
+	conn, err := dialSignaling(url)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	pong := make(chan time.Time, 1)
+	conn.SetPongHandler(func(string) error {
+		select {
+		case pong <- time.Now():
+		default:
+		}
+		return nil
+	})
+	// Control frames are only processed while reading
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sent := time.Now()
+	if err := conn.WriteControl(websocket.PingMessage, nil, sent.Add(probeTimeout)); err != nil {
+		return 0, err
+	}
+	select {
+	case received := <-pong:
+		return received.Sub(sent), nil
+	case <-time.After(probeTimeout):
+		return 0, errors.New("no pong within " + probeTimeout.String())
+	}
+}
+
+// SelectedServer returns the signaling server chosen by the last selection
+func SelectedServer() string {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	return selectedServer
+}
+
+// ServerLatencies returns the probe results from the last selection
+func ServerLatencies() []ServerLatency {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	return append([]ServerLatency(nil), serverLatencies...)
+}
+
+// serverCandidates splits the -servers flag into URLs
+func serverCandidates() []string {
+	var urls []string
+	for _, url := range strings.Split(*signalingServers, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// slowServer answers pings only after delay, standing in for a distant region
+func slowServer(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetPingHandler(func(data string) error {
+			time.Sleep(delay)
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// TestSelectServerPicksFastest probes a near server, a far one and one that
+// is down, and checks the near one is chosen with every result exposed
+func TestSelectServerPicksFastest(t *testing.T) {
+	far := slowServer(t, 150*time.Millisecond)
+	near := slowServer(t, 0)
+	gone := httptest.NewServer(http.NotFoundHandler())
+	down := "ws" + strings.TrimPrefix(gone.URL, "http")
+	gone.Close()
+	t.Cleanup(func() {
+		selectionMu.Lock()
+		selectedServer, serverLatencies = "", nil
+		selectionMu.Unlock()
+	})
+
+	chosen, err := selectServer([]string{far, down, near})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chosen != near || SelectedServer() != near {
+		t.Fatalf("chose %s, want the near server %s", chosen, near)
+	}
+
+	latencies := ServerLatencies()
+	if len(latencies) != 3 {
+		t.Fatalf("got %d latencies, want 3", len(latencies))
+	}
+	if latencies[0].URL != far || latencies[0].Err != nil || latencies[0].Latency < 150*time.Millisecond {
+		t.Errorf("far server: %+v, want at least 150ms", latencies[0])
+	}
+	if latencies[1].URL != down || latencies[1].Err == nil {
+		t.Errorf("down server: %+v, want an error", latencies[1])
+	}
+	if latencies[2].URL != near || latencies[2].Err != nil || latencies[2].Latency >= latencies[0].Latency {
+		t.Errorf("near server: %+v, want faster than the far one", latencies[2])
+	}
+
+	// Nothing reachable leaves no server selected
+	if _, err := selectServer([]string{down}); err == nil || SelectedServer() != "" {
+		t.Fatalf("selected %q from unreachable servers (%v)", SelectedServer(), err)
+	}
+}
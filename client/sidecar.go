@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	frameMetadataLabel = "frame-metadata"
+
+	// videoClockRate is the RTP clock rate of VP8 video
+	videoClockRate = 90000
+
+	// maxPendingFrameMetadata bounds metadata waiting for its RTP frame
+	maxPendingFrameMetadata = 256
+)
+
+var frameMetadata = flag.Bool("frame-metadata", false, "Send per-frame metadata on a data channel alongside video and correlate it on receipt")
+
+// FrameMetadata describes one sent video frame
+type FrameMetadata struct {
+	FrameID   uint64 `json:"frameId"`
+	PTSMicros int64  `json:"ptsMicros"`
+}
+
+var (
+	metadataChannel   *webrtc.DataChannel
+	metadataChannelMu sync.Mutex
+
+	remoteFrames = &frameCorrelator{pending: make(map[int64]FrameMetadata)}
+)
+
+func init() {
+	dataChannelHandlers[frameMetadataLabel] = attachMetadataChannel
+}
+
+// setupFrameMetadata creates the sidecar channel on the caller side.
+// The callee receives it through OnDataChannel.
+func setupFrameMetadata(pc *webrtc.PeerConnection, isCaller bool) error {
+	if !*frameMetadata || !isCaller {
+		return nil
+	}
+
+	// Late metadata is useless, so don't retransmit or wait for ordering
+	ordered := false
+	maxRetransmits := uint16(0)
+	dc, err := pc.CreateDataChannel(frameMetadataLabel, &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	})
+	if err != nil {
+		return err
+	}
+	attachMetadataChannel(dc)
+	return nil
+}
+
+// attachMetadataChannel uses dc to both send local and receive remote frame metadata
+func attachMetadataChannel(dc *webrtc.DataChannel) {
+	if !*frameMetadata {
+		log.Printf("Ignoring frame metadata channel: -frame-metadata is off")
+		return
+	}
+
+	metadataChannelMu.Lock()
+	metadataChannel = dc
+	metadataChannelMu.Unlock()
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var meta FrameMetadata
+		if err := json.Unmarshal(msg.Data, &meta); err != nil {
+			log.Printf("Invalid frame metadata: %v", err)
+			return
+		}
+		remoteFrames.observeMetadata(meta)
+	})
+}
+
+// sendFrameMetadata is called by the video writer after each frame
+func sendFrameMetadata(frameID uint64, pts time.Duration) {
+	if !*frameMetadata {
+		return
+	}
+	metadataChannelMu.Lock()
+	dc := metadataChannel
+	metadataChannelMu.Unlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	data, err := json.Marshal(FrameMetadata{FrameID: frameID, PTSMicros: pts.Microseconds()})
+	if err != nil {
+		return
+	}
+	if err := dc.Send(data); err != nil {
+		log.Printf("Failed to send frame metadata: %v", err)
+	}
+}
+
+// LastFrameMetadata returns the metadata of the most recent remote frame matched to RTP
+func LastFrameMetadata() (FrameMetadata, bool) {
+	remoteFrames.mu.Lock()
+	defer remoteFrames.mu.Unlock()
+	return remoteFrames.last, remoteFrames.hasLast
+}
+
+// frameCorrelator matches received frame metadata to incoming RTP frames.
+// The sender's RTP timestamps start at a random offset, so the first
+// metadata message is aligned with the latest RTP timestamp seen at that
+// moment; after that each frame's timestamp maps directly to a presentation time.
+type frameCorrelator struct {
+	mu      sync.Mutex
+	pending map[int64]FrameMetadata // keyed by PTSMicros
+
+	aligned bool
+	rtpBase uint32
+	ptsBase int64
+
+	latestRTP uint32
+	haveRTP   bool
+
+	last    FrameMetadata
+	hasLast bool
+}
+
+func (c *frameCorrelator) observeMetadata(meta FrameMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.aligned && c.haveRTP {
+		c.aligned = true
+		c.rtpBase = c.latestRTP
+		c.ptsBase = meta.PTSMicros
+		c.last, c.hasLast = meta, true
+		return
+	}
+
+	// Metadata is sent after the frame, so its RTP has usually already arrived
+	if c.aligned && meta.PTSMicros <= c.ptsAt(c.latestRTP) {
+		c.last, c.hasLast = meta, true
+		return
+	}
+	if len(c.pending) >= maxPendingFrameMetadata {
+		c.pending = make(map[int64]FrameMetadata)
+	}
+	c.pending[meta.PTSMicros] = meta
+}
+
+func (c *frameCorrelator) observeRTP(timestamp uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.latestRTP, c.haveRTP = timestamp, true
+	if !c.aligned {
+		return
+	}
+
+	pts := c.ptsAt(timestamp)
+	if meta, ok := c.pending[pts]; ok {
+		delete(c.pending, pts)
+		c.last, c.hasLast = meta, true
+	}
+}
+
+// ptsAt converts an RTP timestamp to the sender's presentation time in microseconds
+func (c *frameCorrelator) ptsAt(timestamp uint32) int64 {
+	elapsed := int64(int32(timestamp-c.rtpBase)) * 1_000_000 / videoClockRate
+	return c.ptsBase + elapsed
+}
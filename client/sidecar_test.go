@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestFrameMetadataLoopback sends video frames with the metadata sidecar over
+// a loopback connection and checks the receiver gets every frame's ID and
+// matches the last one to its RTP frame
+func TestFrameMetadataLoopback(t *testing.T) {
+	previous := *frameMetadata
+	*frameMetadata = true
+	t.Cleanup(func() {
+		*frameMetadata = previous
+		metadataChannelMu.Lock()
+		metadataChannel = nil
+		metadataChannelMu.Unlock()
+	})
+
+	sender, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	receiver, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupFrameMetadata(sender, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver correlates on its own, since both ends share the sidecar globals here
+	correlator := &frameCorrelator{pending: make(map[int64]FrameMetadata)}
+	received := make(chan FrameMetadata, 64)
+	receiver.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			var meta FrameMetadata
+			if err := json.Unmarshal(msg.Data, &meta); err != nil {
+				t.Errorf("invalid frame metadata %s: %v", msg.Data, err)
+				return
+			}
+			correlator.observeMetadata(meta)
+			received <- meta
+		})
+	})
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		var last uint32
+		for first := true; ; first = false {
+			packet, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			if first || packet.Timestamp != last {
+				last = packet.Timestamp
+				correlator.observeRTP(packet.Timestamp)
+			}
+		}
+	})
+	connectLoopback(t, sender, receiver)
+	waitFor(t, "the sidecar to open", func() bool {
+		metadataChannelMu.Lock()
+		defer metadataChannelMu.Unlock()
+		return metadataChannel != nil && metadataChannel.ReadyState() == webrtc.DataChannelStateOpen
+	})
+
+	const frames = 20
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runSampleWriter(ctx, realClock{}, "video", track, &sampleCursor{}, func() ([]byte, time.Duration) {
+		return make([]byte, 100), videoFrameInterval
+	}, func(frameID uint64, pts time.Duration) {
+		if frameID < frames {
+			sendFrameMetadata(frameID, pts)
+		}
+		if frameID == frames-1 {
+			cancel()
+		}
+	})
+
+	seen := make(map[uint64]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < frames {
+		select {
+		case meta := <-received:
+			if want := int64(meta.FrameID) * videoFrameInterval.Microseconds(); meta.PTSMicros != want {
+				t.Fatalf("frame %d has pts %dus, want %dus", meta.FrameID, meta.PTSMicros, want)
+			}
+			seen[meta.FrameID] = true
+		case <-timeout:
+			t.Fatalf("received metadata for %d of %d frames", len(seen), frames)
+		}
+	}
+	for id := range uint64(frames) {
+		if !seen[id] {
+			t.Errorf("no metadata for frame %d", id)
+		}
+	}
+	waitFor(t, "the last frame to be matched to its RTP", func() bool {
+		correlator.mu.Lock()
+		defer correlator.mu.Unlock()
+		return correlator.hasLast && correlator.last.FrameID == frames-1
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var standbyServer = flag.String("standby-server", "", "Signaling server URL to keep a warm standby connection to; the client fails over to it at once when the primary drops")
+
+// dedupWindow is how long a delivered peer signal is remembered, so the copy
+// arriving over the other connection around a failover is ignored. It is kept
+// well below -offer-timeout so deliberately resent offers still get through.
+const dedupWindow = 2 * time.Second
+
+var (
+	standbyConn   *websocket.Conn // nil while there is no warm standby
+	standbyURL    string
+	standbyConnID string // From the standby server's welcome, applied on promotion
+	standbyStop   bool   // Set when leaving, after which no standby is dialed
+	standbyMu     sync.Mutex
+
+	recentSignals   = map[string]time.Time{}
+	recentSignalsMu sync.Mutex
+)
+
+// startStandby connects to url in the background and keeps the connection
+// warm by reading it
+func startStandby(url string) {
+	go func() {
+		conn := dialStandby(url, *maxReconnectAttempts)
+		if conn == nil {
+			return
+		}
+		standbyMu.Lock()
+		stopped := standbyStop
+		if !stopped {
+			standbyConn, standbyURL, standbyConnID = conn, url, ""
+		}
+		standbyMu.Unlock()
+		if stopped {
+			conn.Close()
+			return
+		}
+		log.Printf("Standby signaling connection to %s ready", url)
+		readStandby(conn)
+	}()
+}
+
+// dialStandby connects to url and registers our UUID there, so the standby
+// server can route signals addressed to us from the moment it is promoted.
+// Failures are retried with the signaling reconnect backoff up to attempts
+// times, or until stopStandby is called; then it returns nil.
+func dialStandby(url string, attempts int) *websocket.Conn {
+	for attempt := 0; ; attempt++ {
+		if standbyStopped() {
+			return nil
+		}
+		conn, err := dialSignaling(url)
+		if err == nil {
+			if err = conn.WriteJSON(Signal{Type: "register", UUID: currentUUID()}); err == nil {
+				return conn
+			}
+			conn.Close()
+		}
+		if attempt >= attempts {
+			log.Printf("Giving up on a standby connection to %s: %v", url, err)
+			return nil
+		}
+		delay := reconnectBackoff(attempt)
+		log.Printf("Standby connection to %s failed, retrying in %v: %v", url, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
+
+// readStandby reads the standby connection until it fails. Until promoted it
+// only dispatches peer signals, deduplicated against the primary; server
+// messages describe the standby's own session. Once promoted it reads as the
+// primary connection.
+func readStandby(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			standbyMu.Lock()
+			taken := standbyConn != conn // Promoted, or closed by stopStandby
+			if !taken {
+				standbyConn = nil
+			}
+			url, stopped := standbyURL, standbyStop
+			standbyMu.Unlock()
+			writeMu.Lock()
+			primary := serverConn == conn
+			writeMu.Unlock()
+
+			switch {
+			case primary || taken && !stopped:
+				// The primary read loop sees the same error and fails over or reconnects
+				handleServerMessages()
+			case stopped:
+			default:
+				log.Printf("Standby connection to %s lost: %v", url, err)
+				startStandby(url)
+			}
+			return
+		}
+
+		writeMu.Lock()
+		primary := serverConn == conn
+		writeMu.Unlock()
+		if primary {
+			if !duplicateDelivery(message) {
+				handleServerMessage(message)
+			}
+			continue
+		}
+
+		var probe Signal
+		if err := json.Unmarshal(message, &probe); err != nil {
+			continue
+		}
+		switch probe.Type {
+		case "welcome":
+			standbyMu.Lock()
+			standbyConnID = probe.ConnID
+			standbyMu.Unlock()
+		case "", "candidates":
+			if !duplicateDelivery(message) {
+				handleServerMessage(message)
+			}
+		}
+	}
+}
+
+// promoteStandby makes the warm standby the primary connection, reporting
+// whether there was one. The standby registered our UUID when it connected.
+// The failed server becomes the new standby.
+func promoteStandby() bool {
+	standbyMu.Lock()
+	conn, url, id := standbyConn, standbyURL, standbyConnID
+	standbyConn = nil
+	standbyMu.Unlock()
+	if conn == nil {
+		return false
+	}
+
+	writeMu.Lock()
+	failedURL := signalingURL
+	serverConn, signalingURL = conn, url
+	writeMu.Unlock()
+	log.Printf("Primary signaling connection lost, promoted standby %s", url)
+
+	if id != "" {
+		setConnID(id)
+	}
+	offers.resendAs(currentUUID())
+	startStandby(failedURL)
+	return true
+}
+
+// stopStandby closes the standby connection and stops dialing new ones
+func stopStandby() {
+	standbyMu.Lock()
+	conn := standbyConn
+	standbyConn, standbyStop = nil, true
+	standbyMu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func standbyStopped() bool {
+	standbyMu.Lock()
+	defer standbyMu.Unlock()
+	return standbyStop
+}
+
+// duplicateDelivery reports whether a peer signal already arrived over the
+// other connection within dedupWindow. Server clock stamps differ between
+// servers, so they are left out of the comparison.
+func duplicateDelivery(message []byte) bool {
+	if *standbyServer == "" {
+		return false
+	}
+	key := string(message)
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(message, &fields) == nil {
+		if _, ok := fields["type"]; ok && string(fields["type"]) != `"candidates"` {
+			// Control messages are per connection and never duplicated
+			return false
+		}
+		delete(fields, "serverTime")
+		if canonical, err := json.Marshal(fields); err == nil {
+			key = string(canonical)
+		}
+	}
+
+	now := time.Now()
+	recentSignalsMu.Lock()
+	defer recentSignalsMu.Unlock()
+	for k, seen := range recentSignals {
+		if now.Sub(seen) > dedupWindow {
+			delete(recentSignals, k)
+		}
+	}
+	if _, ok := recentSignals[key]; ok {
+		return true
+	}
+	recentSignals[key] = now
+	return false
+}
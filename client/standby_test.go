@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeSignalingServer welcomes every WebSocket connection and records the
+// signals its clients send
+type fakeSignalingServer struct {
+	url      string
+	received chan receivedSignal
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+}
+
+// receivedSignal is a message a client sent, as a Signal and as sent
+type receivedSignal struct {
+	Signal
+	raw []byte
+}
+
+func newFakeSignalingServer(t *testing.T, connID string) *fakeSignalingServer {
+	t.Helper()
+	s := &fakeSignalingServer{received: make(chan receivedSignal, 64)}
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		conn.WriteJSON(Signal{Type: "welcome", UUID: "server", ConnID: connID})
+		s.mu.Unlock()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// Messages that aren't plain signals, such as candidate batches,
+			// still decode far enough for their type
+			received := receivedSignal{raw: message}
+			json.Unmarshal(message, &received.Signal)
+			select {
+			case s.received <- received:
+			default:
+			}
+		}
+	}))
+	t.Cleanup(func() {
+		s.drop()
+		srv.Close()
+	})
+	s.url = "ws" + strings.TrimPrefix(srv.URL, "http")
+	return s
+}
+
+// send writes message to every connected client
+func (s *fakeSignalingServer) send(t *testing.T, message string) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// drop closes every client connection, as a failing server would
+func (s *fakeSignalingServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// expect waits for a client to send a signal of type signalType
+func (s *fakeSignalingServer) expect(t *testing.T, signalType string) receivedSignal {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case signal := <-s.received:
+			if signal.Type == signalType {
+				return signal
+			}
+		case <-timeout:
+			t.Fatalf("no %q signal from the client", signalType)
+		}
+	}
+}
+
+// connect dials s and makes it the signaling connection until the test ends
+func (s *fakeSignalingServer) connect(t *testing.T) {
+	t.Helper()
+	conn, err := dialSignaling(s.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMu.Lock()
+	previous, previousURL := serverConn, signalingURL
+	serverConn, signalingURL = conn, s.url
+	writeMu.Unlock()
+	t.Cleanup(func() {
+		writeMu.Lock()
+		serverConn, signalingURL = previous, previousURL
+		writeMu.Unlock()
+	})
+}
+
+// nextCandidate waits for a peer candidate to be dispatched, failing if none
+// arrives within wait
+func nextCandidate(t *testing.T, signals <-chan Signal, wait time.Duration) string {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.ICE != nil {
+				return signal.ICE.Candidate
+			}
+		case <-timeout:
+			return ""
+		}
+	}
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestStandbyFailover connects to a primary and a standby server, fails the
+// primary, and checks that the standby takes over without losing a signal
+func TestStandbyFailover(t *testing.T) {
+	primary := newFakeSignalingServer(t, "primary")
+	backup := newFakeSignalingServer(t, "backup")
+
+	failed := make(chan struct{})
+	previousState, previousStandby := signalingState, *standbyServer
+	signalingState = newConnStateMachine(0, func(_, next ConnState, _ ConnTrigger) {
+		if next == StateFailed {
+			close(failed)
+		}
+	})
+	signalingState.Fire(TriggerConnect)
+	signalingState.Fire(TriggerConnected)
+	*standbyServer = backup.url
+	setUUID("failover-client")
+	standbyMu.Lock()
+	standbyStop = false
+	standbyMu.Unlock()
+	// An empty mesh keeps peer signals from reaching the peer connection code
+	setMeshTargets(nil)
+	recentSignalsMu.Lock()
+	clear(recentSignals)
+	recentSignalsMu.Unlock()
+	t.Cleanup(func() {
+		// Stop the standby and the promoted connection's reader before
+		// putting the globals back
+		stopStandby()
+		primary.drop()
+		backup.drop()
+		select {
+		case <-failed:
+		case <-time.After(2 * time.Second):
+			t.Error("read loop did not stop")
+		}
+		signalingState, *standbyServer = previousState, previousStandby
+		meshTargetsMu.Lock()
+		meshTargets, meshAssigned = nil, false
+		meshTargetsMu.Unlock()
+	})
+
+	conn, err := dialSignaling(primary.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMu.Lock()
+	serverConn, signalingURL = conn, primary.url
+	writeMu.Unlock()
+	register()
+	startStandby(backup.url)
+	if signal := backup.expect(t, "register"); signal.UUID != "failover-client" {
+		t.Fatalf("standby registered %q, want failover-client", signal.UUID)
+	}
+	waitFor(t, "the standby", standbyConnReady)
+
+	signals, cancel := Subscribe()
+	defer cancel()
+	go handleServerMessages()
+
+	// Both servers deliver a signal sent before the failure; it is dispatched once
+	first := `{"uuid":"peer","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`
+	primary.send(t, first)
+	backup.send(t, first)
+	if got := nextCandidate(t, signals, time.Second); got == "" {
+		t.Fatal("signal delivered by both servers was not dispatched")
+	}
+	if got := nextCandidate(t, signals, 200*time.Millisecond); got != "" {
+		t.Fatalf("signal dispatched twice: %s", got)
+	}
+
+	// The standby delivers what arrives while the primary is failing
+	primary.drop()
+	backup.send(t, `{"uuid":"peer","ice":{"candidate":"candidate:2 1 udp 1 192.0.2.1 9 typ host"}}`)
+	if got := nextCandidate(t, signals, time.Second); !strings.HasPrefix(got, "candidate:2 ") {
+		t.Fatalf("got candidate %q during failover, want candidate:2", got)
+	}
+
+	waitFor(t, "the standby to be promoted", func() bool {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return signalingURL == backup.url
+	})
+	if ConnID() != "backup" {
+		t.Errorf("connection ID %q after failover, want the standby's", ConnID())
+	}
+	sendSignal(Signal{Type: "pause", UUID: currentUUID()})
+	backup.expect(t, "pause")
+
+	// The failed server is dialed again as the new standby
+	if signal := primary.expect(t, "register"); signal.UUID != "failover-client" {
+		t.Fatalf("new standby registered %q, want failover-client", signal.UUID)
+	}
+}
+
+// TestStandbyGivesUp checks that dialing an unreachable standby stops once
+// its retries are used up
+func TestStandbyGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	srv.Close()
+
+	standbyMu.Lock()
+	standbyStop = false
+	standbyMu.Unlock()
+
+	done := make(chan *websocket.Conn)
+	go func() { done <- dialStandby(url, 1) }()
+	select {
+	case conn := <-done:
+		if conn != nil {
+			t.Fatal("dialStandby connected to a closed server")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("dialStandby kept retrying")
+	}
+}
+
+func standbyConnReady() bool {
+	standbyMu.Lock()
+	defer standbyMu.Unlock()
+	return standbyConn != nil
+}
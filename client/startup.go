@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var startupKeyframes = flag.Int("startup-keyframes", 0, "Send this many video keyframes spread over the first second after connecting, so a slow-starting decoder shows a picture sooner (0 disables)")
+
+// startupWindow is the time after connecting over which startup keyframes are spread
+const startupWindow = time.Second
+
+var (
+	// keyframesDue holds the times the pending startup keyframes are due, earliest first
+	keyframesDue   []time.Time
+	keyframesDueMu sync.Mutex
+)
+
+// validateStartupKeyframes checks -startup-keyframes. The video source sends
+// at most one keyframe per frame, so no more fit in the window than frames.
+func validateStartupKeyframes() error {
+	maxKeyframes := int(startupWindow / videoFrameInterval)
+	if *startupKeyframes < 0 || *startupKeyframes > maxKeyframes {
+		return fmt.Errorf("-startup-keyframes must be between 0 and %d", maxKeyframes)
+	}
+	return nil
+}
+
+// scheduleStartupKeyframes spaces -startup-keyframes keyframes evenly over the
+// startup window from now, the first one at once
+func scheduleStartupKeyframes() {
+	n := *startupKeyframes
+	if n == 0 {
+		return
+	}
+	now := time.Now()
+	due := make([]time.Time, n)
+	for i := range due {
+		due[i] = now.Add(startupWindow * time.Duration(i) / time.Duration(n))
+	}
+	keyframesDueMu.Lock()
+	keyframesDue = due
+	keyframesDueMu.Unlock()
+	log.Printf("Sending %d startup keyframes over the next %v", n, startupWindow)
+}
+
+// startupKeyframeDue reports whether the next video frame should be a
+// keyframe, consuming the earliest startup keyframe that has come due
+func startupKeyframeDue() bool {
+	keyframesDueMu.Lock()
+	defer keyframesDueMu.Unlock()
+	if len(keyframesDue) == 0 || time.Now().Before(keyframesDue[0]) {
+		return false
+	}
+	keyframesDue = keyframesDue[1:]
+	return true
+}
+
+// markVP8Keyframe overwrites the start of a simulated frame with a VP8 keyframe
+// header: a frame tag with the key frame bit clear, the start code, and a
+// 640x480 frame size. Frames too short to hold the header are left alone.
+func markVP8Keyframe(frame []byte) {
+	if len(frame) < 10 {
+		return
+	}
+	frame[0], frame[1], frame[2] = 0x10, 0, 0 // Key frame, version 0, shown
+	frame[3], frame[4], frame[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(frame[6:], 640)
+	binary.LittleEndian.PutUint16(frame[8:], 480)
+}
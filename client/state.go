@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	maxReconnectAttempts = flag.Int("max-reconnect-attempts", 10, "Signaling reconnect attempts before giving up (0 gives up immediately)")
+	maxReconnectBackoff  = flag.Duration("max-reconnect-backoff", 30*time.Second, "Longest wait between signaling reconnect attempts; the wait doubles from 1s up to this")
+)
+
+// ConnState is the lifecycle state of the signaling connection
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota // Not connected and not trying to be
+	StateConnecting                    // Dialing the server
+	StateConnected                     // Signaling is up
+	StateReconnecting                  // Connection lost, waiting to retry
+	StateFailed                        // Gave up after exhausting reconnect attempts
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// ConnTrigger is something that happened to the signaling connection
+type ConnTrigger int
+
+const (
+	TriggerConnect   ConnTrigger = iota // Start connecting
+	TriggerConnected                    // Dial succeeded
+	TriggerDropped                      // Dial failed or an established connection was lost
+	TriggerRetry                        // Backoff elapsed, dial again
+	TriggerClose                        // Deliberate shutdown
+)
+
+func (t ConnTrigger) String() string {
+	return [...]string{"connect", "connected", "dropped", "retry", "close"}[t]
+}
+
+// connStateMachine holds the signaling state and enforces the allowed transitions:
+//
+//	Disconnected --connect-->   Connecting
+//	Failed       --connect-->   Connecting
+//	Connecting   --connected--> Connected     (resets the attempt counter)
+//	Connecting   --dropped-->   Reconnecting  if attempts remain, else Failed
+//	Connected    --dropped-->   Reconnecting  if attempts remain, else Failed
+//	Reconnecting --retry-->     Connecting    (uses up one attempt)
+//	any          --close-->     Disconnected
+//
+// Any other trigger is rejected and leaves the state unchanged.
+type connStateMachine struct {
+	mu          sync.Mutex
+	state       ConnState
+	attempts    int
+	maxAttempts int
+	onChange    func(prev, next ConnState, trigger ConnTrigger)
+}
+
+// newConnStateMachine starts in Disconnected
+func newConnStateMachine(maxAttempts int, onChange func(prev, next ConnState, trigger ConnTrigger)) *connStateMachine {
+	return &connStateMachine{state: StateDisconnected, maxAttempts: maxAttempts, onChange: onChange}
+}
+
+// Attempts returns how many retries have been used since the last connection
+func (m *connStateMachine) Attempts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts
+}
+
+// State returns the current state
+func (m *connStateMachine) State() ConnState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Fire applies trigger and returns the resulting state, or an error if the
+// trigger isn't valid in the current state
+func (m *connStateMachine) Fire(trigger ConnTrigger) (ConnState, error) {
+	m.mu.Lock()
+	prev := m.state
+	next, err := m.next(trigger)
+	if err != nil {
+		m.mu.Unlock()
+		return prev, err
+	}
+	m.state = next
+	m.mu.Unlock()
+
+	if m.onChange != nil && next != prev {
+		m.onChange(prev, next, trigger)
+	}
+	return next, nil
+}
+
+// next computes the transition for trigger; m.mu must be held
+func (m *connStateMachine) next(trigger ConnTrigger) (ConnState, error) {
+	if trigger == TriggerClose {
+		return StateDisconnected, nil
+	}
+
+	switch m.state {
+	case StateDisconnected, StateFailed:
+		if trigger == TriggerConnect {
+			m.attempts = 0
+			return StateConnecting, nil
+		}
+	case StateConnecting:
+		switch trigger {
+		case TriggerConnected:
+			m.attempts = 0
+			return StateConnected, nil
+		case TriggerDropped:
+			return m.afterDrop(), nil
+		}
+	case StateConnected:
+		if trigger == TriggerDropped {
+			return m.afterDrop(), nil
+		}
+	case StateReconnecting:
+		if trigger == TriggerRetry {
+			m.attempts++
+			return StateConnecting, nil
+		}
+	}
+	return m.state, fmt.Errorf("invalid trigger %s in state %s", trigger, m.state)
+}
+
+// afterDrop decides whether a lost connection is retried; m.mu must be held
+func (m *connStateMachine) afterDrop() ConnState {
+	if m.attempts < m.maxAttempts {
+		return StateReconnecting
+	}
+	return StateFailed
+}
+
+var signalingState *connStateMachine
+
+// newSignalingState creates the machine for the signaling connection, logging
+// every transition and publishing it on Events
+func newSignalingState() *connStateMachine {
+	return newConnStateMachine(*maxReconnectAttempts, func(prev, next ConnState, trigger ConnTrigger) {
+		log.Printf("Signaling state: %s -> %s (%s)", prev, next, trigger)
+		emitEvent(Event{Kind: "state", Prev: prev, State: next, Detail: trigger.String()})
+	})
+}
+
+// reconnectDelay is the pause before the first signaling reconnect attempt
+const reconnectDelay = time.Second
+
+// validateReconnect checks -max-reconnect-attempts and -max-reconnect-backoff
+func validateReconnect() error {
+	if *maxReconnectAttempts < 0 {
+		return errors.New("-max-reconnect-attempts must not be negative")
+	}
+	if *maxReconnectBackoff < reconnectDelay {
+		return fmt.Errorf("-max-reconnect-backoff must be at least %v", reconnectDelay)
+	}
+	return nil
+}
+
+// reconnectBackoff is the wait before retry number attempt+1: reconnectDelay
+// doubled per earlier attempt and capped at -max-reconnect-backoff, then
+// jittered down by up to half so clients dropped together don't redial in step
+func reconnectBackoff(attempt int) time.Duration {
+	backoff := *maxReconnectBackoff
+	if attempt < 30 && reconnectDelay<<attempt < backoff {
+		backoff = reconnectDelay << attempt
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// reconnectSignaling redials the signaling server while the state machine
+// allows it, reporting whether a new connection was established
+func reconnectSignaling() bool {
+	for signalingState.State() == StateReconnecting {
+		delay := reconnectBackoff(signalingState.Attempts())
+		log.Printf("Reconnecting to %s in %v", signalingURL, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+		if _, err := signalingState.Fire(TriggerRetry); err != nil {
+			return false
+		}
+
+		conn, err := dialSignaling(signalingURL)
+		if err != nil {
+			log.Printf("Reconnect to %s failed: %v", signalingURL, err)
+			signalingState.Fire(TriggerDropped)
+			continue
+		}
+
+		writeMu.Lock()
+		previous := serverConn
+		serverConn = conn
+		writeMu.Unlock()
+		previous.Close()
+		signalingState.Fire(TriggerConnected)
+		register()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestReconnectSequence drives reconnectSignaling through a dial that fails
+// on demand and checks the signaling state passes through connect, drop,
+// reconnect and finally give up in order
+func TestReconnectSequence(t *testing.T) {
+	server := newFakeSignalingServer(t, "reconnected")
+
+	var (
+		mu          sync.Mutex
+		transitions []string
+		failures    int
+	)
+	previousState, previousDial, previousBackoff := signalingState, dialSignaling, *maxReconnectBackoff
+	signalingState = newConnStateMachine(2, func(prev, next ConnState, trigger ConnTrigger) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, fmt.Sprintf("%s -%s-> %s", prev, trigger, next))
+	})
+	dialSignaling = func(url string) (*websocket.Conn, error) {
+		mu.Lock()
+		fail := failures > 0
+		if fail {
+			failures--
+		}
+		mu.Unlock()
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return dialWith(websocket.DefaultDialer)(url)
+	}
+	*maxReconnectBackoff = 10 * time.Millisecond
+	t.Cleanup(func() {
+		signalingState, dialSignaling, *maxReconnectBackoff = previousState, previousDial, previousBackoff
+	})
+
+	signalingState.Fire(TriggerConnect)
+	conn, err := dialSignaling(server.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMu.Lock()
+	serverConn, signalingURL = conn, server.url
+	writeMu.Unlock()
+	signalingState.Fire(TriggerConnected)
+
+	// One failed redial, then the server is back
+	mu.Lock()
+	failures = 1
+	mu.Unlock()
+	signalingState.Fire(TriggerDropped)
+	if !reconnectSignaling() {
+		t.Fatal("reconnect gave up while the server was reachable")
+	}
+	server.expect(t, "register")
+
+	// The server stays down until the attempts run out
+	mu.Lock()
+	failures = 100
+	mu.Unlock()
+	signalingState.Fire(TriggerDropped)
+	if reconnectSignaling() {
+		t.Fatal("reconnect succeeded against an unreachable server")
+	}
+
+	want := []string{
+		"disconnected -connect-> connecting",
+		"connecting -connected-> connected",
+		"connected -dropped-> reconnecting",
+		"reconnecting -retry-> connecting",
+		"connecting -dropped-> reconnecting",
+		"reconnecting -retry-> connecting",
+		"connecting -connected-> connected",
+		"connected -dropped-> reconnecting",
+		"reconnecting -retry-> connecting",
+		"connecting -dropped-> reconnecting",
+		"reconnecting -retry-> connecting",
+		"connecting -dropped-> failed",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(transitions, want) {
+		t.Fatalf("transitions:\n%v\nwant:\n%v", transitions, want)
+	}
+}
+
+// TestReconnectRecovers drops the signaling connection under the read loop
+// with a dial that fails twice and then succeeds, and checks the client
+// re-registers under the same UUID and goes on handling the server's messages
+func TestReconnectRecovers(t *testing.T) {
+	server := newFakeSignalingServer(t, "before-drop")
+
+	var (
+		mu       sync.Mutex
+		dials    int
+		failures int
+	)
+	previousState, previousDial, previousBackoff := signalingState, dialSignaling, *maxReconnectBackoff
+	previousUUID := currentUUID()
+	signalingState = newConnStateMachine(3, func(ConnState, ConnState, ConnTrigger) {})
+	dialSignaling = func(url string) (*websocket.Conn, error) {
+		mu.Lock()
+		dials++
+		fail := failures > 0
+		if fail {
+			failures--
+		}
+		mu.Unlock()
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return dialWith(websocket.DefaultDialer)(url)
+	}
+	*maxReconnectBackoff = 10 * time.Millisecond
+	setUUID("reconnecting-client")
+	t.Cleanup(func() {
+		signalingState, dialSignaling, *maxReconnectBackoff = previousState, previousDial, previousBackoff
+		setUUID(previousUUID)
+		connIDMu.Lock()
+		connID = ""
+		connIDMu.Unlock()
+	})
+
+	signalingState.Fire(TriggerConnect)
+	server.connect(t)
+	signalingState.Fire(TriggerConnected)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handleServerMessages()
+	}()
+	waitFor(t, "the first welcome", func() bool { return ConnID() == "before-drop" })
+
+	mu.Lock()
+	dials, failures = 0, 2
+	mu.Unlock()
+	server.drop()
+	if got := server.expect(t, "register"); got.UUID != "reconnecting-client" {
+		t.Fatalf("re-registered as %q, want reconnecting-client", got.UUID)
+	}
+	mu.Lock()
+	if dials != 3 {
+		t.Errorf("dialed %d times, want two failures and then success", dials)
+	}
+	mu.Unlock()
+	if state := signalingState.State(); state != StateConnected {
+		t.Fatalf("signaling %s after reconnecting, want connected", state)
+	}
+
+	server.send(t, `{"type":"welcome","uuid":"server","connId":"after-drop"}`)
+	waitFor(t, "a message on the new connection", func() bool { return ConnID() == "after-drop" })
+
+	// Stop the read loop: the server goes away for good
+	mu.Lock()
+	failures = 100
+	mu.Unlock()
+	server.drop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read loop kept going after the reconnect attempts ran out")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// Direction tells a tap which way an RTP packet was travelling
+type Direction int
+
+const (
+	Inbound  Direction = iota // Received from the peer
+	Outbound                  // Sent to the peer
+)
+
+func (d Direction) String() string {
+	if d == Outbound {
+		return "outbound"
+	}
+	return "inbound"
+}
+
+// rtpTap is the callback installed by TapRTP, or nil
+var rtpTap atomic.Pointer[func(dir Direction, pkt *rtp.Packet)]
+
+// TapRTP calls fn with a copy of every RTP packet sent or received, for
+// debugging. fn runs on the media path and should return quickly; the
+// packet is its own to keep or modify. Passing nil removes the tap.
+func TapRTP(fn func(dir Direction, pkt *rtp.Packet)) {
+	if fn == nil {
+		rtpTap.Store(nil)
+		return
+	}
+	rtpTap.Store(&fn)
+}
+
+// tapFactory builds the interceptor that feeds TapRTP
+type tapFactory struct{}
+
+func (tapFactory) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return &tapInterceptor{}, nil
+}
+
+// tapInterceptor copies RTP packets to the installed tap without altering them
+type tapInterceptor struct {
+	interceptor.NoOp
+}
+
+func (*tapInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		if tap := rtpTap.Load(); tap != nil {
+			(*tap)(Outbound, &rtp.Packet{Header: header.Clone(), Payload: bytes.Clone(payload)})
+		}
+		return writer.Write(header, payload, attributes)
+	})
+}
+
+func (*tapInterceptor) BindRemoteStream(_ *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, attributes interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attributes, err := reader.Read(b, attributes)
+		if tap := rtpTap.Load(); err == nil && tap != nil {
+			pkt := &rtp.Packet{}
+			if pkt.Unmarshal(bytes.Clone(b[:n])) == nil {
+				(*tap)(Inbound, pkt)
+			}
+		}
+		return n, attributes, err
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// TestTapRTP sends audio between two peers built with the client's API and
+// checks the tap sees the packets going out and coming in, and that changing
+// its copies leaves the media the peer receives untouched
+func TestTapRTP(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[Direction]int)
+	)
+	TapRTP(func(dir Direction, pkt *rtp.Packet) {
+		if !bytes.Equal(pkt.Payload, opusSilence) {
+			return
+		}
+		mu.Lock()
+		seen[dir]++
+		mu.Unlock()
+		// The copy is the tap's own
+		clear(pkt.Payload)
+	})
+	t.Cleanup(func() { TapRTP(nil) })
+
+	peers := make([]*webrtc.PeerConnection, 2)
+	for i, isCaller := range []bool{true, false} {
+		api, err := newWebRTCAPI(isCaller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err := api.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		peers[i] = pc
+	}
+	sender, receiver := peers[0], peers[1]
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "tap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte, 100)
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			pkt, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			case received <- pkt.Payload:
+			default:
+			}
+		}
+	})
+	connectLoopback(t, sender, receiver)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: opusSilence, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+
+	for range 10 {
+		select {
+		case payload := <-received:
+			if !bytes.Equal(payload, opusSilence) {
+				t.Fatalf("peer received %x, want the payload that was sent", payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("peer received no audio")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if seen[Outbound] < 10 || seen[Inbound] < 10 {
+		t.Fatalf("tap saw %d outbound and %d inbound packets, want at least 10 each", seen[Outbound], seen[Inbound])
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// readRemoteTrack is the only reader of a remote track. It drains RTP and
+// hands each packet to whichever consumers are enabled.
+func readRemoteTrack(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, mids *midTagger) {
+	var rec *recording
+	var gate *keyframeGate
+	tried := false // Starting the recording was attempted since recording was last enabled
+	defer func() {
+		if rec != nil {
+			rec.close()
+		}
+	}()
+
+	correlate := *frameMetadata && track.Kind() == webrtc.RTPCodecTypeVideo
+	var lastTimestamp uint32
+	first := true
+
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Reading track %s stopped: %v", track.ID(), err)
+			}
+			return
+		}
+		mids.observe(track.ID(), packet)
+		if callPaused.Load() {
+			continue
+		}
+
+		// Recording can be started and stopped while the track plays
+		switch enabled := recordingEnabled(); {
+		case enabled && !tried:
+			tried = true
+			var err error
+			if rec, err = startRecording(peerOf(pc), track, mids.mid); err != nil {
+				log.Printf("Failed to start recording track %s: %v", track.ID(), err)
+			}
+			if rec != nil {
+				// Recordings start on a keyframe rather than mid-GOP
+				gate = newKeyframeGate(pc, track)
+			}
+		case !enabled && tried:
+			tried = false
+			if rec != nil {
+				rec.close()
+				rec = nil
+			}
+		}
+
+		if rec != nil && gate.admit(packet) {
+			if err := rec.write(packet); err != nil {
+				log.Printf("Failed to write packet to %s: %v", rec.path, err)
+			}
+		}
+
+		// A new RTP timestamp marks the start of a new frame
+		if correlate && (first || packet.Timestamp != lastTimestamp) {
+			first = false
+			lastTimestamp = packet.Timestamp
+			remoteFrames.observeRTP(packet.Timestamp)
+		}
+	}
+}
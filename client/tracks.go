@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Modes for -extra-tracks
+const (
+	extraTracksGrid   = "grid"   // Keep every stream's track, for a grid of tiles
+	extraTracksLatest = "latest" // Keep one track per peer and kind, the newest
+)
+
+var extraTracks = flag.String("extra-tracks", extraTracksGrid, "What to do with a second incoming track of a kind from the same peer: grid keeps one per stream; latest keeps only the newest")
+
+// validateExtraTracks checks the -extra-tracks flag
+func validateExtraTracks() error {
+	switch *extraTracks {
+	case extraTracksGrid, extraTracksLatest:
+		return nil
+	}
+	return fmt.Errorf("-extra-tracks must be grid or latest, got %q", *extraTracks)
+}
+
+// RemoteTrack is a track being received, as listed by a TrackManager
+type RemoteTrack struct {
+	Peer     string // UUID of the sending peer
+	Kind     webrtc.RTPCodecType
+	StreamID string
+	Track    *webrtc.TrackRemote
+	Added    time.Time
+}
+
+// trackKey identifies a tile: one track per peer, kind and stream. Under
+// -extra-tracks latest the stream is left out.
+type trackKey struct {
+	peer   string
+	kind   webrtc.RTPCodecType
+	stream string
+}
+
+// TrackManager indexes the tracks being received so a UI can render one tile
+// per entry. Changes are published on Events as "track-added",
+// "track-replaced" and "track-removed", with the track in Event.Track.
+type TrackManager struct {
+	mu     sync.Mutex
+	tracks map[trackKey]*RemoteTrack
+}
+
+// RemoteTracks lists every track this client is receiving
+var RemoteTracks = &TrackManager{tracks: make(map[trackKey]*RemoteTrack)}
+
+// add lists track from peer. A track for a stream that already has one, such
+// as after the sender replaced its camera, takes over that entry.
+func (m *TrackManager) add(peer string, track *webrtc.TrackRemote) *RemoteTrack {
+	key := trackKey{peer: peer, kind: track.Kind(), stream: track.StreamID()}
+	if *extraTracks == extraTracksLatest {
+		key.stream = ""
+	}
+	rt := &RemoteTrack{Peer: peer, Kind: track.Kind(), StreamID: track.StreamID(), Track: track, Added: time.Now()}
+
+	m.mu.Lock()
+	_, replaced := m.tracks[key]
+	m.tracks[key] = rt
+	m.mu.Unlock()
+
+	kind := "track-added"
+	if replaced {
+		kind = "track-replaced"
+		log.Printf("Track %s replaces the %s track of %s stream %s", track.ID(), rt.Kind, peer, rt.StreamID)
+	}
+	emitEvent(Event{Kind: kind, Detail: track.ID(), Track: rt})
+	return rt
+}
+
+// remove unlists rt once it has ended, unless a newer track replaced it
+func (m *TrackManager) remove(rt *RemoteTrack) {
+	key := trackKey{peer: rt.Peer, kind: rt.Kind, stream: rt.StreamID}
+	if *extraTracks == extraTracksLatest {
+		key.stream = ""
+	}
+
+	m.mu.Lock()
+	current := m.tracks[key] == rt
+	if current {
+		delete(m.tracks, key)
+	}
+	m.mu.Unlock()
+
+	if current {
+		emitEvent(Event{Kind: "track-removed", Detail: rt.Track.ID(), Track: rt})
+	}
+}
+
+// Tracks returns the listed tracks, oldest first
+func (m *TrackManager) Tracks() []RemoteTrack {
+	m.mu.Lock()
+	tracks := make([]RemoteTrack, 0, len(m.tracks))
+	for _, rt := range m.tracks {
+		tracks = append(tracks, *rt)
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(tracks, func(a, b RemoteTrack) int { return a.Added.Compare(b.Added) })
+	return tracks
+}
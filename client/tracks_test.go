@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestTrackManager receives video from two peers and checks each is listed
+// as its own track, that a new track on a stream takes over its entry
+// without the old one ending it, and that a peer's track is unlisted when
+// its call ends
+func TestTrackManager(t *testing.T) {
+	m := &TrackManager{tracks: make(map[trackKey]*RemoteTrack)}
+	// receive lists the tracks arriving on a new peer connection as peer's
+	receive := func(peer string) *webrtc.PeerConnection {
+		receiver, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { receiver.Close() })
+		receiver.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			rt := m.add(peer, track)
+			for {
+				if _, _, err := track.ReadRTP(); err != nil {
+					m.remove(rt)
+					return
+				}
+			}
+		})
+		return receiver
+	}
+	frame := append([]byte{0x10}, blackKeyframe...)
+
+	sendLoopback(t, receive("alice"), webrtc.MimeTypeVP8, "alice-camera", frame)
+	expectEvent(t, "track-added", 5*time.Second)
+	bob := sendLoopback(t, receive("bob"), webrtc.MimeTypeVP8, "bob-camera", frame)
+	expectEvent(t, "track-added", 5*time.Second)
+
+	tracks := m.Tracks()
+	if len(tracks) != 2 {
+		t.Fatalf("listed %d tracks, want one from each peer", len(tracks))
+	}
+	for i, want := range []struct{ peer, stream string }{{"alice", "alice-camera"}, {"bob", "bob-camera"}} {
+		got := tracks[i]
+		if got.Peer != want.peer || got.StreamID != want.stream || got.Kind != webrtc.RTPCodecTypeVideo || got.Track == nil {
+			t.Errorf("track %d is %s's %s %s, want %s's video on %s", i, got.Peer, got.Kind, got.StreamID, want.peer, want.stream)
+		}
+	}
+
+	// Alice replaces her camera track on the same stream
+	sendLoopback(t, receive("alice"), webrtc.MimeTypeVP8, "alice-camera", frame)
+	replaced := expectEvent(t, "track-replaced", 5*time.Second)
+	if replaced.Track.Peer != "alice" {
+		t.Fatalf("replaced %s's track, want alice's", replaced.Track.Peer)
+	}
+	if n := len(m.Tracks()); n != 2 {
+		t.Fatalf("listed %d tracks after the replacement, want 2", n)
+	}
+
+	bob.Close()
+	if ev := expectEvent(t, "track-removed", 5*time.Second); ev.Track.Peer != "bob" {
+		t.Fatalf("removed %s's track, want bob's", ev.Track.Peer)
+	}
+	tracks = m.Tracks()
+	if len(tracks) != 1 || tracks[0].Peer != "alice" {
+		t.Fatalf("listed %+v after bob left, want alice's track only", tracks)
+	}
+	if tracks[0].Track != replaced.Track.Track {
+		t.Fatal("alice's entry isn't her replacement track")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// dataStream tags signals belonging to the data-only peer connection
+	dataStream = "data"
+
+	fileTransferLabel = "file-transfer"
+
+	// transferEOF is sent as a text message after a file's last chunk
+	transferEOF = "eof"
+
+	transferChunkSize = 16 << 10
+	// Sending pauses once this much is buffered and resumes when the channel
+	// drains below transferLowWater
+	transferHighWater = 1 << 20
+	transferLowWater  = 256 << 10
+)
+
+var (
+	dataConnection = flag.Bool("data-connection", false, "Open a second, data-only peer connection for file transfers so they don't compete with media")
+	transferDir    = flag.String("transfer-dir", ".", "Directory received files are written to")
+)
+
+var (
+	dataPeerConnection *webrtc.PeerConnection
+	transferChannel    *webrtc.DataChannel
+	transferLow        = make(chan struct{}, 1) // Signalled when transferChannel drains
+	dataMu             sync.Mutex
+
+	// dataSignalMu applies data connection signals one at a time, as each
+	// runs on its own goroutine
+	dataSignalMu sync.Mutex
+
+	// sendFileMu allows one outgoing transfer at a time
+	sendFileMu sync.Mutex
+)
+
+// errNoTransferChannel is returned by SendFile when the data connection isn't open
+var errNoTransferChannel = errors.New("data connection is not open")
+
+func init() {
+	dataChannelHandlers[fileTransferLabel] = attachTransferChannel
+}
+
+// startDataConnection offers the data-only peer connection to the remote peer
+func startDataConnection(config webrtc.Configuration) error {
+	pc, err := newDataPeerConnection(config)
+	if err != nil {
+		return err
+	}
+
+	// Reliable and ordered, the data channel defaults
+	dc, err := pc.CreateDataChannel(fileTransferLabel, nil)
+	if err != nil {
+		return err
+	}
+	attachTransferChannel(dc)
+
+	offer, err := makeOffer(pc, OfferOptions{})
+	if err != nil {
+		return err
+	}
+	if err := setLocalDescription(pc, offer); err != nil {
+		return err
+	}
+	sendDataDescription(pc)
+	return nil
+}
+
+// newDataPeerConnection creates the data-only connection. It uses a plain API
+// without the media interceptors, so it carries no RTP congestion control.
+func newDataPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	pc, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		return nil, err
+	}
+	pc.OnDataChannel(handleDataChannel)
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("Data connection %s", state)
+	})
+
+	dataMu.Lock()
+	dataPeerConnection = pc
+	dataMu.Unlock()
+	return pc, nil
+}
+
+// sendDataDescription signals pc's local description once gathering has
+// finished. The data connection doesn't trickle, so its SDP alone is enough.
+func sendDataDescription(pc *webrtc.PeerConnection) {
+	<-webrtc.GatheringCompletePromise(pc)
+	desc := *pc.LocalDescription()
+	desc.SDP = withEndOfCandidates(desc.SDP)
+	sendSignal(Signal{SDP: &desc, UUID: currentUUID(), Stream: dataStream})
+}
+
+// handleDataSignal applies a signal addressed to the data-only connection
+func handleDataSignal(signal Signal) {
+	dataSignalMu.Lock()
+	defer dataSignalMu.Unlock()
+
+	dataMu.Lock()
+	pc := dataPeerConnection
+	dataMu.Unlock()
+
+	if pc == nil {
+		if signal.SDP == nil || signal.SDP.Type != webrtc.SDPTypeOffer {
+			return
+		}
+		var err error
+		if pc, err = newDataPeerConnection(defaultConfiguration()); err != nil {
+			log.Printf("Failed to create data connection: %v", err)
+			return
+		}
+	}
+
+	if signal.SDP != nil {
+		if err := pc.SetRemoteDescription(*signal.SDP); err != nil {
+			log.Printf("Failed to set data connection remote description: %v", err)
+			return
+		}
+		if signal.SDP.Type != webrtc.SDPTypeOffer {
+			return
+		}
+		answer, err := makeAnswer(pc, AnswerOptions{})
+		if err != nil {
+			log.Printf("Failed to create data connection answer: %v", err)
+			return
+		}
+		if err := setLocalDescription(pc, answer); err != nil {
+			log.Printf("Failed to set data connection local description: %v", err)
+			return
+		}
+		sendDataDescription(pc)
+	}
+
+	if signal.ICE != nil {
+		if err := pc.AddICECandidate(*signal.ICE); err != nil {
+			log.Printf("Failed to add data connection ICE candidate: %v", err)
+		}
+	}
+}
+
+// closeDataConnection tears down the data-only connection, if any
+func closeDataConnection() {
+	dataMu.Lock()
+	pc := dataPeerConnection
+	dataPeerConnection, transferChannel = nil, nil
+	dataMu.Unlock()
+
+	if pc != nil {
+		pc.Close()
+	}
+}
+
+// attachTransferChannel sends files over dc and saves the files received on it
+func attachTransferChannel(dc *webrtc.DataChannel) {
+	dc.SetBufferedAmountLowThreshold(transferLowWater)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case transferLow <- struct{}{}:
+		default:
+		}
+	})
+
+	var file *os.File
+	var fileMu sync.Mutex
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		fileMu.Lock()
+		defer fileMu.Unlock()
+		if msg.IsString {
+			if string(msg.Data) == transferEOF && file != nil {
+				finishReceivedFile(file)
+				file = nil
+			}
+			return
+		}
+
+		if file == nil {
+			var err error
+			if file, err = os.CreateTemp(*transferDir, "transfer-*.bin"); err != nil {
+				log.Printf("Failed to create received file: %v", err)
+				return
+			}
+		}
+		if _, err := file.Write(msg.Data); err != nil {
+			log.Printf("Failed to write received file %s: %v", file.Name(), err)
+		}
+	})
+	dc.OnClose(func() {
+		fileMu.Lock()
+		defer fileMu.Unlock()
+		if file != nil {
+			log.Printf("Transfer channel closed mid-file, keeping partial %s", file.Name())
+			file.Close()
+		}
+	})
+
+	dataMu.Lock()
+	transferChannel = dc
+	dataMu.Unlock()
+}
+
+// finishReceivedFile closes a completed incoming file and announces it
+func finishReceivedFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Printf("Failed to close received file %s: %v", file.Name(), err)
+		return
+	}
+	log.Printf("Received file %s", file.Name())
+	emitEvent(Event{Kind: "file-received", Detail: file.Name()})
+}
+
+// SendFile streams r to the remote peer over the data-only connection. The
+// sender waits whenever more than transferHighWater bytes are buffered, so a
+// large file never sits in memory all at once.
+func SendFile(r io.Reader) error {
+	dataMu.Lock()
+	dc := transferChannel
+	dataMu.Unlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return errNoTransferChannel
+	}
+
+	sendFileMu.Lock()
+	defer sendFileMu.Unlock()
+
+	buf := make([]byte, transferChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			for dc.BufferedAmount() > transferHighWater {
+				// The timeout covers a low-water signal consumed by an earlier transfer
+				select {
+				case <-transferLow:
+				case <-time.After(100 * time.Millisecond):
+				}
+				if dc.ReadyState() != webrtc.DataChannelStateOpen {
+					return errNoTransferChannel
+				}
+			}
+			if sendErr := dc.Send(buf[:n]); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return dc.SendText(transferEOF)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestSendFileOverDataConnection opens the data-only connection to a second
+// in-process peer and sends a file larger than the flow control high water
+// mark each way, checking both arrive byte for byte
+func TestSendFileOverDataConnection(t *testing.T) {
+	server := newFakeSignalingServer(t, "transfer")
+	server.connect(t)
+	previousDir := *transferDir
+	*transferDir = t.TempDir()
+	t.Cleanup(func() {
+		closeDataConnection()
+		*transferDir = previousDir
+	})
+
+	// The remote peer collects what it receives and signals when a file ends
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	var received bytes.Buffer
+	remoteChannel := make(chan *webrtc.DataChannel, 1)
+	receivedAll := make(chan struct{})
+	remote.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnOpen(func() { remoteChannel <- dc })
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			if msg.IsString && string(msg.Data) == transferEOF {
+				close(receivedAll)
+				return
+			}
+			received.Write(msg.Data)
+		})
+	})
+
+	if err := startDataConnection(webrtc.Configuration{}); err != nil {
+		t.Fatal(err)
+	}
+	offer := server.expect(t, "")
+	if offer.SDP == nil || offer.Stream != dataStream {
+		t.Fatalf("sent %s, want an offer on the data stream", offer.raw)
+	}
+	if err := remote.SetRemoteDescription(*offer.SDP); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := remote.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(remote)
+	if err := remote.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	handleDataSignal(Signal{SDP: remote.LocalDescription(), UUID: "remote", Stream: dataStream})
+
+	var dc *webrtc.DataChannel
+	select {
+	case dc = <-remoteChannel:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer channel never opened")
+	}
+	waitFor(t, "our end of the transfer channel to open", func() bool {
+		dataMu.Lock()
+		defer dataMu.Unlock()
+		return transferChannel != nil && transferChannel.ReadyState() == webrtc.DataChannelStateOpen
+	})
+
+	sent := make([]byte, 3*transferHighWater+12345)
+	rand.Read(sent)
+	if err := SendFile(bytes.NewReader(sent)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-receivedAll:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("remote received %d of %d bytes", received.Len(), len(sent))
+	}
+	if !bytes.Equal(received.Bytes(), sent) {
+		t.Fatalf("remote received %d bytes differing from the %d sent", received.Len(), len(sent))
+	}
+
+	// The other way, the file lands in -transfer-dir
+	back := make([]byte, 2*transferChunkSize+7)
+	rand.Read(back)
+	for chunk := range slices.Chunk(back, transferChunkSize) {
+		if err := dc.Send(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dc.SendText(transferEOF); err != nil {
+		t.Fatal(err)
+	}
+	var path string
+	waitFor(t, "the received file", func() bool {
+		matches, _ := filepath.Glob(filepath.Join(*transferDir, "transfer-*.bin"))
+		if len(matches) == 1 {
+			path = matches[0]
+		}
+		return path != ""
+	})
+	waitFor(t, "the received file to complete", func() bool {
+		data, _ := os.ReadFile(path)
+		return bytes.Equal(data, back)
+	})
+}
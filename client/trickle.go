@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	// peerTrickle records whether the remote peer accepts trickled candidates.
+	// It is learned from the trickle field of the peer's SDP messages.
+	peerTrickle   = true
+	peerTrickleMu sync.Mutex
+)
+
+// setPeerTrickle records the remote peer's advertised trickle capability
+func setPeerTrickle(enabled bool) {
+	peerTrickleMu.Lock()
+	defer peerTrickleMu.Unlock()
+	if peerTrickle != enabled {
+		log.Printf("Remote peer trickle ICE: %t", enabled)
+	}
+	peerTrickle = enabled
+}
+
+// trickleEnabled reports whether candidates should be trickled on the current connection.
+// Trickle is used only when both this client and the remote peer support it.
+func trickleEnabled() bool {
+	if *noTrickle {
+		return false
+	}
+	peerTrickleMu.Lock()
+	defer peerTrickleMu.Unlock()
+	return peerTrickle
+}
+
+// sendDescription sends a local offer or answer that has already been applied to pc
+// and returns the signal that was sent. Offers are resent until answered.
+// When trickle is disabled for this connection it first waits for gathering to
+// complete, so the SDP carries every candidate followed by a=end-of-candidates.
+func sendDescription(pc *webrtc.PeerConnection, desc webrtc.SessionDescription) Signal {
+	if !trickleEnabled() {
+		<-webrtc.GatheringCompletePromise(pc)
+		if local := pc.LocalDescription(); local != nil {
+			desc = *local
+		}
+		desc.SDP = withEndOfCandidates(desc.SDP)
+	}
+
+	desc.SDP = transformOutgoingSDP(desc.SDP)
+
+	trickle := !*noTrickle
+	signal := Signal{
+		SDP:     &desc,
+		UUID:    currentUUID(),
+		Trickle: &trickle,
+	}
+	if desc.Type == webrtc.SDPTypeOffer {
+		offers.sent(signal)
+	}
+	sendSignal(signal)
+	return signal
+}
+
+// withEndOfCandidates appends a=end-of-candidates to every media section that lacks it
+func withEndOfCandidates(sdp string) string {
+	const eoc = "a=end-of-candidates"
+
+	lines := strings.Split(strings.TrimSuffix(sdp, "\r\n"), "\r\n")
+	out := make([]string, 0, len(lines)+4)
+	inMedia, seen := false, false
+	closeSection := func() {
+		if inMedia && !seen {
+			out = append(out, eoc)
+		}
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			closeSection()
+			inMedia, seen = true, false
+		} else if line == eoc {
+			seen = true
+		}
+		out = append(out, line)
+	}
+	closeSection()
+	return strings.Join(out, "\r\n") + "\r\n"
+}
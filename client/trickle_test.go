@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestNonTrickleOffer sends an offer to a peer that doesn't trickle and checks
+// it carries the gathered candidates, with every media section ending in
+// a=end-of-candidates
+func TestNonTrickleOffer(t *testing.T) {
+	server := newFakeSignalingServer(t, "non-trickle")
+	server.connect(t)
+	setPeerTrickle(false)
+	t.Cleanup(func() {
+		setPeerTrickle(true)
+		offers.answered()
+	})
+
+	pc := withPeerConnection(t, nil)
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	sendDescription(pc, offer)
+
+	sent := server.expect(t, "")
+	if sent.SDP == nil || sent.Trickle == nil {
+		t.Fatalf("sent %+v, want an offer with its trickle capability", sent)
+	}
+	if !strings.Contains(sent.SDP.SDP, "\r\na=candidate:") {
+		t.Error("offer carries no candidates")
+	}
+	sections := strings.Split(sent.SDP.SDP, "\r\nm=")[1:]
+	if len(sections) != 2 {
+		t.Fatalf("offer has %d media sections, want 2", len(sections))
+	}
+	for _, section := range sections {
+		kind, _, _ := strings.Cut(section, " ")
+		if !strings.HasSuffix(strings.TrimSuffix(section, "\r\n"), "\r\na=end-of-candidates") {
+			t.Errorf("%s section doesn't end with a=end-of-candidates", kind)
+		}
+	}
+}
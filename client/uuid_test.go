@@ -0,0 +1,24 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+// uuidV4Pattern matches a lowercase RFC 4122 version 4 UUID
+var uuidV4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestCreateUUID(t *testing.T) {
+	const n = 10000
+	seen := make(map[string]bool, n)
+	for range n {
+		id := createUUID()
+		if !uuidV4Pattern.MatchString(id) {
+			t.Fatalf("%q is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("%q generated twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -20,9 +20,13 @@ async function pageReady() {
   localVideo = document.getElementById('localVideo');
   remoteVideo = document.getElementById('remoteVideo');
   
-  // Connect to the signaling server
-  serverConnection = new WebSocket(`wss://${window.location.hostname}:8443/ws`);
+  // Connect to the signaling server, in the room named by ?room= if any
+  const room = new URLSearchParams(window.location.search).get('room');
+  const path = room ? `/ws/${encodeURIComponent(room)}` : '/ws';
+  serverConnection = new WebSocket(`wss://${window.location.hostname}:8443${path}`);
   serverConnection.onmessage = gotMessageFromServer;
+  // Announce our UUID so signals addressed to us can be delivered
+  serverConnection.onopen = () => serverConnection.send(JSON.stringify({ type: 'register', uuid }));
   
   // Set up the start button click handler
   document.getElementById('startButton').onclick = function() {
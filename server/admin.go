@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// defaultRoom is the room clients join when they connect to /ws without naming one
+const defaultRoom = "default"
+
+var (
+	adminToken = flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token for the /api admin endpoints; empty disables them")
+
+	// membershipMu guards rooms and serialises joins against room closure so
+	// nobody slips in mid-close
+	membershipMu sync.Mutex
+)
+
+// serverNotice is a control message originated by the server itself
+type serverNotice struct {
+	Type   string `json:"type"`
+	UUID   string `json:"uuid"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// adminAuth requires the admin token as a bearer key
+func adminAuth() echo.MiddlewareFunc {
+	return middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		if *adminToken == "" {
+			return false, nil
+		}
+		return subtle.ConstantTimeCompare([]byte(key), []byte(*adminToken)) == 1, nil
+	})
+}
+
+// registerAdminRoutes mounts the moderator API under /api and the operator
+// event stream on /ops
+func registerAdminRoutes(e *echo.Echo) {
+	e.GET("/ops", opsHandler, adminAuth())
+	api := e.Group("/api", adminAuth())
+	api.POST("/rooms/:id/close", closeRoomHandler)
+	api.GET("/rooms/:id/policy", roomPolicyHandler)
+	api.PUT("/rooms/:id/policy", setRoomPolicyHandler)
+	api.GET("/rooms/:id/bandwidth", roomBandwidthHandler)
+	api.PUT("/rooms/:id/bandwidth", setRoomBandwidthHandler)
+	api.GET("/rooms/:id/clients", roomClientsHandler)
+	api.GET("/rooms/:id/config", roomConfigHandler)
+	api.PUT("/rooms/:id/config", setRoomConfigHandler)
+}
+
+// closeRoomHandler disconnects every member of a room
+func closeRoomHandler(c echo.Context) error {
+	room := c.Param("id")
+	if lookupRoom(room) == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "room not found")
+	}
+
+	disconnected := closeRoom(room, "room closed by moderator")
+	log.Printf("Closed room %s, disconnected %d clients", room, disconnected)
+	return c.JSON(http.StatusOK, map[string]any{
+		"room":         room,
+		"disconnected": disconnected,
+	})
+}
+
+// closeRoom sends bye to every member, closes their sockets and forgets them
+// along with the room. It returns the number of clients disconnected.
+func closeRoom(name, reason string) int {
+	bye, err := json.Marshal(serverNotice{Type: "bye", UUID: "server", Reason: reason})
+	if err != nil {
+		log.Println("bye marshal error:", err)
+		return 0
+	}
+
+	// Empty and forget the room under the lock, so later joins make a new
+	// room, then notify the members without holding it
+	membershipMu.Lock()
+	r := rooms[name]
+	if r == nil {
+		membershipMu.Unlock()
+		return 0
+	}
+	var members []*clientConn
+	r.clients.Range(func(cc *clientConn, _ string) bool {
+		members = append(members, cc)
+		return true
+	})
+	for _, cc := range members {
+		// Drop the client here so its read loop doesn't broadcast a roster to a closed room
+		if uuid, _ := r.clients.Remove(cc); uuid != "" {
+			r.mesh.leave(uuid)
+		}
+	}
+	dropEmptyRoomLocked(r)
+	membershipMu.Unlock()
+
+	for _, cc := range members {
+		// The bye is flushed ahead of the close frame
+		if err := cc.send(bye, true); err != nil {
+			cc.logf("bye send error: %v", err)
+		}
+		cc.shutdown(websocket.CloseNormalClosure, reason)
+	}
+	return len(members)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// startAdminServer serves the WebSocket and admin routes with token as the
+// admin token, returning the server, the /ws URL and the HTTP base URL
+func startAdminServer(t *testing.T, token string) (e *echo.Echo, wsURL, baseURL string) {
+	t.Helper()
+	previous := *adminToken
+	*adminToken = token
+	t.Cleanup(func() { *adminToken = previous })
+
+	e, wsURL = startTestServer(t)
+	registerAdminRoutes(e)
+	return e, wsURL, "http" + strings.TrimSuffix(strings.TrimPrefix(wsURL, "ws"), "/ws")
+}
+
+// adminRequest makes an admin API request, returning the response
+func adminRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// TestCloseRoom fills a room, closes it through the admin API and checks
+// that every member is sent bye and then a close frame
+func TestCloseRoom(t *testing.T) {
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	members := make([]*websocket.Conn, 3)
+	for i := range members {
+		members[i] = dialTest(t, wsURL+"/closing")
+		register(t, members[i], string(rune('a'+i)))
+	}
+	waitFor(t, "every member to register", func() bool {
+		r := lookupRoom("closing")
+		if r == nil {
+			return false
+		}
+		registered := 0
+		r.clients.Range(func(_ *clientConn, uuid string) bool {
+			if uuid != "" {
+				registered++
+			}
+			return true
+		})
+		return registered == len(members)
+	})
+
+	if resp := adminRequest(t, http.MethodPost, baseURL+"/api/rooms/closing/close", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("close with a wrong token: status %d, want 401", resp.StatusCode)
+	}
+	resp := adminRequest(t, http.MethodPost, baseURL+"/api/rooms/closing/close", "secret", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("close: status %d, want 200", resp.StatusCode)
+	}
+	var result struct {
+		Disconnected int `json:"disconnected"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Disconnected != len(members) {
+		t.Fatalf("close reported %d disconnected (%v), want %d", result.Disconnected, err, len(members))
+	}
+
+	for i, ws := range members {
+		readUntil(t, ws, func(env envelope) bool { return env.Type == "bye" })
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			_, _, err := ws.ReadMessage()
+			if err == nil {
+				continue
+			}
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("member %d: read error %v, want a normal close frame", i, err)
+			}
+			break
+		}
+	}
+	if lookupRoom("closing") != nil {
+		t.Fatal("closed room is still listed")
+	}
+	if resp := adminRequest(t, http.MethodPost, baseURL+"/api/rooms/closing/close", "secret", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("closing a closed room: status %d, want 404", resp.StatusCode)
+	}
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	gowebrtc "github.com/shreethaar/go-webrtc"
+)
+
+var assetsDir = flag.String("assets-dir", "", "Serve the browser client from this directory instead of the embedded copy (for development)")
+
+// clientAssets returns the filesystem the browser client is served from
+func clientAssets() (fs.FS, error) {
+	if *assetsDir != "" {
+		return os.DirFS(*assetsDir), nil
+	}
+	return fs.Sub(gowebrtc.ClientAssets, "client")
+}
+
+// registerAssetRoutes serves the browser client's page and script
+func registerAssetRoutes(e *echo.Echo) error {
+	assets, err := clientAssets()
+	if err != nil {
+		return err
+	}
+	e.FileFS("/", "index.html", assets)
+	e.FileFS("/webrtc.js", "webrtc.js", assets)
+	return nil
+}
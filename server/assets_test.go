@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	gowebrtc "github.com/shreethaar/go-webrtc"
+)
+
+// getAsset serves the client assets and returns the body of path
+func getAsset(t *testing.T, path string) string {
+	t.Helper()
+	e := echo.New()
+	if err := registerAssetRoutes(e); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, rec.Code)
+	}
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// TestEmbeddedAssets checks / and /webrtc.js are served from the copy
+// embedded in the binary, or from -assets-dir when it is set
+func TestEmbeddedAssets(t *testing.T) {
+	for path, file := range map[string]string{"/": "client/index.html", "/webrtc.js": "client/webrtc.js"} {
+		embedded, err := fs.ReadFile(gowebrtc.ClientAssets, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getAsset(t, path); got != string(embedded) {
+			t.Errorf("GET %s didn't return the embedded %s", path, file)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>development</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := *assetsDir
+	*assetsDir = dir
+	t.Cleanup(func() { *assetsDir = previous })
+	if got := getAsset(t, "/"); got != "<p>development</p>" {
+		t.Errorf("GET / with -assets-dir returned %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+var roomBandwidthFlag = flag.Int64("room-bandwidth", 0, "Total bits per second of video all senders in the default room may use together (0 is unlimited); other rooms are set through the admin API")
+
+// bandwidthMessage caps the bitrate of each stream a client sends
+type bandwidthMessage struct {
+	Type    string `json:"type"` // Always "bandwidth"
+	UUID    string `json:"uuid"`
+	Bitrate int64  `json:"bitrate"` // Per stream, in bits per second; 0 lifts the cap
+}
+
+var (
+	roomBudgets   = map[string]int64{}
+	roomBudgetsMu sync.RWMutex
+)
+
+// roomBudget returns a room's total bandwidth budget in bits per second, 0 if unlimited
+func roomBudget(room string) int64 {
+	roomBudgetsMu.RLock()
+	defer roomBudgetsMu.RUnlock()
+	return roomBudgets[room]
+}
+
+// setRoomBudget replaces a room's bandwidth budget
+func setRoomBudget(room string, bps int64) error {
+	if bps < 0 {
+		return errors.New("bandwidth budget must not be negative")
+	}
+	roomBudgetsMu.Lock()
+	roomBudgets[room] = bps
+	roomBudgetsMu.Unlock()
+	return nil
+}
+
+// streams counts the media streams flowing in the mesh. Each link carries
+// one stream in each direction.
+func (m *meshTopology) streams() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, links := range m.links {
+		n += len(links)
+	}
+	return n
+}
+
+// broadcastBitrate shares a room's budget evenly between the streams in its
+// mesh and tells every member the resulting per-stream cap. Signaling never
+// sees the media, so the clients enforce the cap themselves; within it they
+// favour their higher priority tracks.
+func broadcastBitrate(r *room) {
+	var bitrate int64
+	if budget := roomBudget(r.name); budget > 0 {
+		streams := r.mesh.streams()
+		if streams == 0 {
+			return
+		}
+		bitrate = budget / int64(streams)
+	}
+
+	message, err := json.Marshal(bandwidthMessage{Type: "bandwidth", UUID: "server", Bitrate: bitrate})
+	if err != nil {
+		log.Println("bandwidth marshal error:", err)
+		return
+	}
+	broadcastMessage(r, nil, message, true)
+}
+
+// roomBandwidthHandler returns a room's bandwidth budget
+func roomBandwidthHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"bitrate": roomBudget(room)})
+}
+
+// setRoomBandwidthHandler replaces a room's bandwidth budget and applies it
+// at once. A room without members gets the budget when it is created.
+func setRoomBandwidthHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var body struct {
+		Bitrate int64 `json:"bitrate"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid budget")
+	}
+	if err := setRoomBudget(room, body.Bitrate); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	log.Printf("Room %s bandwidth budget set to %d bps", room, body.Bitrate)
+	if r := lookupRoom(room); r != nil {
+		broadcastBitrate(r)
+	}
+	return c.JSON(http.StatusOK, body)
+}
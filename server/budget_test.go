@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// expectBitrate reads ws until the server caps each stream at want
+func expectBitrate(t *testing.T, ws *websocket.Conn, want int64) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("no bandwidth cap of %d bps: %v", want, err)
+		}
+		var update bandwidthMessage
+		if json.Unmarshal(message, &update) == nil && update.Type == "bandwidth" && update.Bitrate == want {
+			return
+		}
+	}
+}
+
+// TestRoomBandwidthBudget sets a budget on a full room through the admin API
+// and checks it is shared evenly between the streams in the mesh, that the
+// shares grow when a member leaves, and that lifting the budget lifts the cap
+func TestRoomBandwidthBudget(t *testing.T) {
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	budgetURL := baseURL + "/api/rooms/budgeted/bandwidth"
+	t.Cleanup(func() { setRoomBudget("budgeted", 0) })
+
+	members := make([]*websocket.Conn, 3)
+	for i := range members {
+		members[i] = dialTest(t, wsURL+"/budgeted")
+		register(t, members[i], fmt.Sprintf("member%d", i))
+	}
+	waitFor(t, "the mesh to form", func() bool {
+		r := lookupRoom("budgeted")
+		return r != nil && r.mesh.streams() == 6
+	})
+
+	if resp := adminRequest(t, http.MethodPut, budgetURL, "secret", `{"bitrate":-1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("negative budget: status %d, want 400", resp.StatusCode)
+	}
+	if resp := adminRequest(t, http.MethodPut, budgetURL, "secret", `{"bitrate":1200000}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set budget: status %d, want 200", resp.StatusCode)
+	}
+	resp := adminRequest(t, http.MethodGet, budgetURL, "secret", "")
+	var got struct {
+		Bitrate int64 `json:"bitrate"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || got.Bitrate != 1_200_000 {
+		t.Fatalf("read back %d bps (%v), want 1200000", got.Bitrate, err)
+	}
+
+	// Three members send two streams each
+	for _, ws := range members {
+		expectBitrate(t, ws, 200_000)
+	}
+
+	// Two members left send one stream each
+	members[2].Close()
+	for _, ws := range members[:2] {
+		expectBitrate(t, ws, 600_000)
+	}
+
+	if resp := adminRequest(t, http.MethodPut, budgetURL, "secret", `{"bitrate":0}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("lift budget: status %d, want 200", resp.StatusCode)
+	}
+	for _, ws := range members[:2] {
+		expectBitrate(t, ws, 0)
+	}
+}
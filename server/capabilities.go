@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// capabilitiesMaxAge is how long clients and proxies may cache /capabilities.
+// The document can change on a config reload or policy update, so it is kept short.
+const capabilitiesMaxAge = "60"
+
+// capabilities describes what the server supports, for clients to check
+// before connecting
+type capabilities struct {
+	// Mode is always "mesh": the server only relays signaling and peers
+	// exchange media directly. There is no SFU, WHIP or WHEP endpoint.
+	Mode string `json:"mode"`
+	// MaxMeshPeers caps the peers each client is asked to connect to; 0 is a full mesh
+	MaxMeshPeers int  `json:"maxMeshPeers"`
+	Rooms        bool `json:"rooms"` // Rooms are selected with /ws/<room>
+	WHIP         bool `json:"whip"`
+	WHEP         bool `json:"whep"`
+
+	// DefaultRoomPolicy is the media policy of the default room; other rooms
+	// may have their own
+	DefaultRoomPolicy codecPolicy `json:"defaultRoomPolicy"`
+
+	Auth capabilitiesAuth `json:"auth"`
+
+	// MessageRate is the messages per second each client may send; 0 is unlimited
+	MessageRate float64 `json:"messageRate,omitempty"`
+	// ICEServers says whether the welcome message carries ICE servers
+	ICEServers bool `json:"iceServers"`
+}
+
+// capabilitiesAuth lists what a client must present to connect
+type capabilitiesAuth struct {
+	ClientCertificate bool `json:"clientCertificate"` // Set by -client-ca
+	OriginRestricted  bool `json:"originRestricted"`  // Only allowed origins may open /ws
+}
+
+// capabilitiesHandler serves the capabilities document. It needs no
+// credentials, since it only says what the server supports.
+func capabilitiesHandler(c echo.Context) error {
+	cfg := config()
+	c.Response().Header().Set("Cache-Control", "public, max-age="+capabilitiesMaxAge)
+	return c.JSON(http.StatusOK, capabilities{
+		Mode:              "mesh",
+		MaxMeshPeers:      *maxMeshPeers,
+		Rooms:             true,
+		DefaultRoomPolicy: roomPolicy(defaultRoom),
+		Auth: capabilitiesAuth{
+			ClientCertificate: *clientCAPath != "",
+			OriginRestricted:  len(cfg.AllowedOrigins) > 0,
+		},
+		MessageRate: cfg.MessageRate,
+		ICEServers:  len(cfg.ICEServers) > 0,
+	})
+}
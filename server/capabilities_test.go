@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestCapabilities configures the mesh cap, the default room's codecs, client
+// certificates and the live config, and checks the capabilities document
+// reflects each of them and may be cached
+func TestCapabilities(t *testing.T) {
+	previousPeers, previousCA, previousConfig := *maxMeshPeers, *clientCAPath, config()
+	*maxMeshPeers, *clientCAPath = 3, "ca.pem"
+	setRoomPolicy(defaultRoom, codecPolicy{VideoCodecs: []string{"VP8", "AV1"}})
+	currentConfig.Store(&serverConfig{
+		ICEServers:     []iceServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+		AllowedOrigins: []string{"https://app.example.com"},
+		MessageRate:    20,
+	})
+	t.Cleanup(func() {
+		*maxMeshPeers, *clientCAPath = previousPeers, previousCA
+		setRoomPolicy(defaultRoom, codecPolicy{})
+		currentConfig.Store(previousConfig)
+	})
+
+	rec := httptest.NewRecorder()
+	if err := capabilitiesHandler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/capabilities", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age="+capabilitiesMaxAge {
+		t.Errorf("Cache-Control %q, want it cacheable", got)
+	}
+	var got capabilities
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode != "mesh" || got.MaxMeshPeers != 3 || !got.Rooms || got.WHIP || got.WHEP {
+		t.Errorf("mode %q, %d mesh peers, rooms %v, WHIP %v, WHEP %v; want a mesh of 3 with rooms and no WHIP or WHEP",
+			got.Mode, got.MaxMeshPeers, got.Rooms, got.WHIP, got.WHEP)
+	}
+	if !slices.Equal(got.DefaultRoomPolicy.VideoCodecs, []string{"VP8", "AV1"}) || got.DefaultRoomPolicy.AudioOnly {
+		t.Errorf("default room policy %+v, want video in VP8 or AV1", got.DefaultRoomPolicy)
+	}
+	if !got.Auth.ClientCertificate || !got.Auth.OriginRestricted {
+		t.Errorf("auth %+v, want client certificates and restricted origins", got.Auth)
+	}
+	if got.MessageRate != 20 || !got.ICEServers {
+		t.Errorf("message rate %v, ICE servers %v; want 20 and true", got.MessageRate, got.ICEServers)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+var devMode = flag.Bool("dev", false, "Generate a self-signed certificate for localhost when cert.pem and key.pem are missing")
+
+// ensureCertificate writes a self-signed ECDSA certificate for localhost and
+// 127.0.0.1 to certPath and keyPath when neither exists. It leaves existing
+// files alone, and refuses to pair a new key with a lone existing certificate
+// or a new certificate with a lone key.
+func ensureCertificate(certPath, keyPath string) error {
+	certMissing, err := missing(certPath)
+	if err != nil {
+		return err
+	}
+	keyMissing, err := missing(keyPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !certMissing && !keyMissing:
+		return nil
+	case certMissing != keyMissing:
+		return fmt.Errorf("only one of %s and %s exists; remove it or supply both", certPath, keyPath)
+	}
+
+	certPEM, keyPEM, err := selfSignedCertificate()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return err
+	}
+	log.Printf("Generated a self-signed development certificate in %s and %s", certPath, keyPath)
+	return nil
+}
+
+// missing reports whether nothing exists at path
+func missing(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	return false, err
+}
+
+// selfSignedCertificate returns a PEM certificate and key valid for a year
+// for localhost and 127.0.0.1
+func selfSignedCertificate() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
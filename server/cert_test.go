@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestEnsureCertificate generates a certificate into an empty directory and
+// checks it loads as a TLS key pair valid now for localhost and 127.0.0.1,
+// that a second call leaves it alone and that a lone certificate is refused
+func TestEnsureCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ensureCertificate(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("generated files aren't a TLS key pair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cert.DNSNames, []string{"localhost"}) {
+		t.Errorf("DNS names %v, want [localhost]", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("IP addresses %v, want [127.0.0.1]", cert.IPAddresses)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		t.Errorf("valid from %v to %v, not now", cert.NotBefore, cert.NotAfter)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("not valid for %s: %v", host, err)
+		}
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("key file mode %v, want 0600", mode)
+	}
+
+	written, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureCertificate(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(certPath); !bytes.Equal(again, written) {
+		t.Fatal("existing certificate was replaced")
+	}
+
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureCertificate(certPath, keyPath); err == nil {
+		t.Fatal("new key paired with a lone existing certificate")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// serverEpoch anchors serverNow to wall-clock time while keeping it monotonic
+var serverEpoch = time.Now()
+
+// serverNow returns the server time in Unix nanoseconds. It is derived from
+// the monotonic clock so it never jumps backwards when the wall clock is adjusted.
+func serverNow() int64 {
+	return serverEpoch.UnixNano() + int64(time.Since(serverEpoch))
+}
+
+// stampServerTime appends a serverTime field to a JSON object message.
+// The field is written last so it overrides any value a client put there.
+// Messages that aren't JSON objects are forwarded unchanged. The stamped
+// message is a new slice sized to fit in one allocation.
+func stampServerTime(message []byte) []byte {
+	body, ok := objectBody(message)
+	if !ok {
+		return message
+	}
+	return appendStamped(make([]byte, 0, len(body)+len(`{,"serverTime":}`)+20), body)
+}
+
+// objectBody returns what lies between the braces of a JSON object message,
+// reporting false for anything else
+func objectBody(message []byte) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' || !json.Valid(trimmed) {
+		return nil, false
+	}
+	return bytes.TrimSpace(trimmed[1 : len(trimmed)-1]), true
+}
+
+// appendStamped appends the object with body and the server time to dst
+func appendStamped(dst, body []byte) []byte {
+	dst = append(dst, '{')
+	dst = append(dst, body...)
+	if len(body) > 0 {
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `"serverTime":`...)
+	dst = strconv.AppendInt(dst, serverNow(), 10)
+	return append(dst, '}')
+}
+
+// replyTime answers a clock sync probe by echoing it back with the server time
+func replyTime(cc *clientConn, message []byte) {
+	if err := cc.send(stampServerTime(message), false); err != nil {
+		cc.logf("time reply error: %v", err)
+	}
+}
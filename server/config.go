@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/time/rate"
+)
+
+var configPath = flag.String("config", "", "JSON config file with ICE servers, rate limits and allowed origins; reloaded on SIGHUP")
+
+// iceServer is handed to clients in their welcome message
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// serverConfig holds the settings that can change while the server runs.
+// Each connection reads it once when it is accepted, so a reload applies to
+// new connections and leaves existing ones as they were.
+type serverConfig struct {
+	ICEServers []iceServer `json:"iceServers,omitempty"`
+	// AllowedOrigins lists the Origin headers accepted on /ws; empty allows any
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	// MessageRate limits the messages per second each client may send; 0 is unlimited
+	MessageRate  float64 `json:"messageRate,omitempty"`
+	MessageBurst int     `json:"messageBurst,omitempty"`
+}
+
+var currentConfig atomic.Pointer[serverConfig]
+
+func init() {
+	currentConfig.Store(&serverConfig{})
+}
+
+// config returns the live configuration
+func config() *serverConfig {
+	return currentConfig.Load()
+}
+
+// validate rejects settings that can't be applied
+func (c *serverConfig) validate() error {
+	for _, server := range c.ICEServers {
+		if len(server.URLs) == 0 {
+			return errors.New("ICE server without urls")
+		}
+		for _, u := range server.URLs {
+			if !strings.HasPrefix(u, "stun:") && !strings.HasPrefix(u, "turn:") && !strings.HasPrefix(u, "turns:") {
+				return fmt.Errorf("ICE server URL %q must be stun:, turn: or turns:", u)
+			}
+		}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("allowed origin %q must be a scheme://host URL", origin)
+		}
+	}
+	if c.MessageRate < 0 || c.MessageBurst < 0 {
+		return errors.New("messageRate and messageBurst must not be negative")
+	}
+	return nil
+}
+
+// loadConfig reads and validates a config file
+func loadConfig(path string) (*serverConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &serverConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// watchConfigReload re-reads path on every SIGHUP until ctx is done. A file
+// that fails to load or validate is rejected and the running config is kept.
+func watchConfigReload(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			}
+			cfg, err := loadConfig(path)
+			if err != nil {
+				log.Printf("Config reload rejected, keeping previous config: %v", err)
+				continue
+			}
+			currentConfig.Store(cfg)
+			log.Printf("Reloaded config from %s", path)
+		}
+	}()
+}
+
+// checkOrigin accepts a WebSocket upgrade if its origin is allowed
+func checkOrigin(r *http.Request) bool {
+	allowed := config().AllowedOrigins
+	if len(allowed) == 0 {
+		return true // Allow all connections for simplicity
+	}
+	origin := r.Header.Get("Origin")
+	for _, o := range allowed {
+		if strings.EqualFold(origin, o) {
+			return true
+		}
+	}
+	log.Printf("Rejecting WebSocket from origin %q", origin)
+	return false
+}
+
+// newMessageLimiter returns the rate limiter for a new connection, or nil if unlimited
+func (c *serverConfig) newMessageLimiter() *rate.Limiter {
+	if c.MessageRate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(c.MessageRate), max(c.MessageBurst, 1))
+}
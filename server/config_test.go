@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// welcomeFor dials url with origin and returns its welcome, or the dial error
+func welcomeFor(t *testing.T, url, origin string) (welcomeMessage, error) {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {origin}})
+	if err != nil {
+		return welcomeMessage{}, err
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var welcome welcomeMessage
+	if err := ws.ReadJSON(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	return welcome, nil
+}
+
+// TestConfigReloadOnSIGHUP rewrites the config file, sends SIGHUP and checks
+// new connections get the new ICE servers and origin allowlist, then checks
+// an invalid file is rejected with the previous config kept
+func TestConfigReloadOnSIGHUP(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	previous := config()
+	t.Cleanup(func() { currentConfig.Store(previous) })
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"iceServers":[{"urls":["stun:old.example.com:3478"]}]}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentConfig.Store(cfg)
+	watchConfigReload(t.Context(), path)
+
+	_, wsURL := startTestServer(t)
+	url := wsURL + "/reload"
+	welcome, err := welcomeFor(t, url, "https://anywhere.example.com")
+	if err != nil || len(welcome.ICEServers) != 1 || welcome.ICEServers[0].URLs[0] != "stun:old.example.com:3478" {
+		t.Fatalf("welcome %+v (%v), want the old ICE server", welcome, err)
+	}
+
+	write(`{"iceServers":[{"urls":["turn:new.example.com:3478"],"username":"u","credential":"c"}],"allowedOrigins":["https://app.example.com"]}`)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reload", func() bool { return strings.Contains(logs.String(), "Reloaded config") })
+
+	welcome, err = welcomeFor(t, url, "https://app.example.com")
+	if err != nil || len(welcome.ICEServers) != 1 || welcome.ICEServers[0].URLs[0] != "turn:new.example.com:3478" || welcome.ICEServers[0].Credential != "c" {
+		t.Fatalf("welcome %+v (%v), want the new ICE server", welcome, err)
+	}
+	if _, err := welcomeFor(t, url, "https://anywhere.example.com"); err == nil {
+		t.Fatal("origin outside the reloaded allowlist accepted")
+	}
+
+	write(`{"iceServers":[{"urls":["http://not-ice.example.com"]}]}`)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reload to be rejected", func() bool { return strings.Contains(logs.String(), "Config reload rejected") })
+	if got := config().ICEServers[0].URLs[0]; got != "turn:new.example.com:3478" {
+		t.Fatalf("ICE server %s after a rejected reload, want the previous config kept", got)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeWait bounds how long a single WebSocket write may take
+const writeWait = 10 * time.Second
+
+// Overflow policies for a full send queue
+const (
+	overflowDropOldest = "drop-oldest"        // Evict the oldest queued non-critical message
+	overflowDropNewest = "drop-newest"        // Discard the incoming non-critical message
+	overflowBlock      = "block-with-timeout" // Wait for room, closing the client if none frees up in time
+	overflowClose      = "close"              // Treat the client as too slow and disconnect it
+)
+
+var (
+	sendQueueSize   = flag.Int("send-queue-size", 64, "Messages buffered per client before the overflow policy applies")
+	overflowPolicy  = flag.String("overflow-policy", overflowDropOldest, "What to do when a client's send queue is full: drop-oldest, drop-newest, block-with-timeout or close")
+	overflowTimeout = flag.Duration("overflow-timeout", time.Second, "How long block-with-timeout waits for queue space")
+)
+
+// errQueueClosed is returned when sending to a client that is shutting down
+var errQueueClosed = errors.New("send queue closed")
+
+// validateOverflowPolicy checks the -overflow-policy flag
+func validateOverflowPolicy(policy string) error {
+	switch policy {
+	case overflowDropOldest, overflowDropNewest, overflowBlock, overflowClose:
+		return nil
+	}
+	return fmt.Errorf("unknown overflow policy %q", policy)
+}
+
+// validateSendQueueSize checks the -send-queue-size flag. An empty queue
+// would leave the overflow policy to discard every non-critical message.
+func validateSendQueueSize(size int) error {
+	if size < 1 {
+		return errors.New("-send-queue-size must be at least 1")
+	}
+	return nil
+}
+
+// outbound is a message waiting in a client's send queue
+type outbound struct {
+	data []byte
+	// critical messages (SDP, roster, bye) are only dropped when nothing else can be
+	critical bool
+	queued   time.Time      // When send accepted it, for the delivery latency histogram
+	pooled   *pooledMessage // Holds a reference to data's buffer, if it is pooled
+}
+
+// release drops the message's reference to its pooled buffer, if any, once
+// it has been written or discarded
+func (msg outbound) release() {
+	if msg.pooled != nil {
+		msg.pooled.release()
+	}
+}
+
+// clientConn is one connected WebSocket client. All writes go through a
+// bounded queue drained by a dedicated goroutine, since gorilla connections
+// allow only one concurrent writer and a slow client mustn't stall broadcasts.
+type clientConn struct {
+	ws   *websocket.Conn
+	id   string // Connection ID shared with the client for log correlation
+	room *room  // Room the client joined, set by joinRoom
+
+	// identity is the common name of the verified client certificate under
+	// -client-ca; empty otherwise
+	identity string
+
+	// logger carries the connection's identity into every line it logs
+	logger atomic.Pointer[slog.Logger]
+
+	mu       sync.Mutex
+	queue    []outbound
+	closing  bool   // No more messages accepted; the writer drains and closes
+	closeMsg []byte // Close frame sent once the queue has drained
+	dropped  int
+
+	bytesSent atomic.Int64 // Message bytes written, counted against quota
+	quota     int64        // -send-quota when the client connected
+
+	wake chan struct{} // Signals the writer that the queue changed
+	// space is closed, and replaced, each time the writer makes room, waking
+	// every blocked sender at once. Guarded by mu.
+	space chan struct{}
+	done  chan struct{} // Closed when the writer has exited
+}
+
+// newClientConn wraps ws and starts its writer goroutine
+func newClientConn(ws *websocket.Conn) *clientConn {
+	cc := &clientConn{
+		ws:    ws,
+		id:    newConnID(),
+		wake:  make(chan struct{}, 1),
+		space: make(chan struct{}),
+		done:  make(chan struct{}),
+		quota: *sendQuota,
+	}
+	cc.logger.Store(slog.Default().With("connID", cc.id))
+	go cc.writeLoop()
+	return cc
+}
+
+// newConnID returns a random identifier for a connection
+func newConnID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// logf logs a message tagged with the connection's ID and, once known, its
+// room and UUID
+func (cc *clientConn) logf(format string, args ...any) {
+	cc.logger.Load().Info(fmt.Sprintf(format, args...))
+}
+
+// addLogFields tags the connection's later log lines with args, given as
+// slog key-value pairs
+func (cc *clientConn) addLogFields(args ...any) {
+	cc.logger.Store(cc.logger.Load().With(args...))
+}
+
+// send queues data for delivery according to the overflow policy
+func (cc *clientConn) send(data []byte, critical bool) error {
+	return cc.enqueue(outbound{data: data, critical: critical})
+}
+
+// sendPooled queues a pooled message, keeping a reference to it until it is
+// written or dropped
+func (cc *clientConn) sendPooled(m *pooledMessage, critical bool) error {
+	return cc.enqueue(outbound{data: m.data, critical: critical, pooled: m})
+}
+
+// enqueue adds msg to the queue according to the overflow policy. It takes a
+// reference to a pooled message, released again if msg is discarded.
+func (cc *clientConn) enqueue(msg outbound) error {
+	if msg.pooled != nil {
+		msg.pooled.retain()
+	}
+	deadline := time.Now().Add(*overflowTimeout)
+	for {
+		cc.mu.Lock()
+		if cc.closing {
+			cc.mu.Unlock()
+			msg.release()
+			return errQueueClosed
+		}
+		msg.queued = time.Now()
+		if len(cc.queue) < *sendQueueSize {
+			cc.queue = append(cc.queue, msg)
+			cc.mu.Unlock()
+			notify(cc.wake)
+			return nil
+		}
+
+		switch *overflowPolicy {
+		case overflowDropOldest:
+			if !cc.evictLocked() && !msg.critical {
+				cc.countDrop()
+				cc.mu.Unlock()
+				msg.release()
+				return nil
+			}
+			cc.queue = append(cc.queue, msg)
+			cc.mu.Unlock()
+			notify(cc.wake)
+			return nil
+
+		case overflowDropNewest:
+			if msg.critical && cc.evictLocked() {
+				cc.queue = append(cc.queue, msg)
+				cc.mu.Unlock()
+				notify(cc.wake)
+				return nil
+			}
+			cc.countDrop()
+			cc.mu.Unlock()
+			msg.release()
+			return nil
+
+		case overflowBlock:
+			space := cc.space
+			cc.mu.Unlock()
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				msg.release()
+				cc.abort("send queue blocked for " + overflowTimeout.String())
+				return errQueueClosed
+			}
+			select {
+			case <-space:
+			case <-cc.done:
+				msg.release()
+				return errQueueClosed
+			case <-time.After(wait):
+			}
+
+		default: // overflowClose
+			cc.mu.Unlock()
+			msg.release()
+			cc.abort("send queue overflow")
+			return errQueueClosed
+		}
+	}
+}
+
+// evictLocked removes the oldest non-critical message, reporting whether one
+// was found. If every queued message is critical the oldest one goes instead,
+// so the queue never grows past its bound. cc.mu must be held.
+func (cc *clientConn) evictLocked() bool {
+	for i, msg := range cc.queue {
+		if !msg.critical {
+			cc.queue = append(cc.queue[:i], cc.queue[i+1:]...)
+			cc.countDrop()
+			msg.release()
+			return true
+		}
+	}
+	if len(cc.queue) > 0 {
+		cc.queue[0].release()
+		cc.queue = cc.queue[1:]
+		cc.countDrop()
+		return true
+	}
+	return false
+}
+
+// countDrop records a message discarded by the overflow policy. cc.mu must be held.
+func (cc *clientConn) countDrop() {
+	cc.dropped++
+	metrics.messagesDropped.Add(1)
+}
+
+// shutdown stops accepting messages, lets the writer flush what's queued and
+// then sends a close frame with the given code and reason
+func (cc *clientConn) shutdown(code int, reason string) {
+	cc.mu.Lock()
+	if !cc.closing {
+		cc.closing = true
+		cc.closeMsg = websocket.FormatCloseMessage(code, reason)
+	}
+	cc.mu.Unlock()
+	notify(cc.wake)
+}
+
+// abort disconnects the client immediately, discarding anything queued
+func (cc *clientConn) abort(reason string) {
+	cc.logf("disconnecting client: %s", reason)
+	publishClientOps(opsAborted, cc, reason)
+	cc.mu.Lock()
+	for _, msg := range cc.queue {
+		msg.release()
+	}
+	cc.queue = nil
+	cc.mu.Unlock()
+	cc.shutdown(websocket.ClosePolicyViolation, reason)
+}
+
+// writeLoop delivers queued messages in order until the client shuts down
+func (cc *clientConn) writeLoop() {
+	defer close(cc.done)
+	defer cc.ws.Close()
+	defer func() {
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		if cc.dropped > 0 {
+			cc.logf("client dropped %d messages on a full send queue", cc.dropped)
+		}
+	}()
+
+	for {
+		cc.mu.Lock()
+		batch := cc.queue
+		cc.queue = nil
+		if len(batch) > 0 {
+			close(cc.space)
+			cc.space = make(chan struct{})
+		}
+		closing, closeMsg := cc.closing, cc.closeMsg
+		cc.mu.Unlock()
+
+		for i, msg := range batch {
+			cc.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := cc.ws.WriteMessage(websocket.TextMessage, msg.data)
+			size := len(msg.data)
+			msg.release()
+			if err != nil {
+				// Closing the socket unblocks the read loop, which unregisters the client
+				cc.logf("write error: %v", err)
+				cc.mu.Lock()
+				cc.closing = true
+				cc.mu.Unlock()
+				return
+			}
+			deliveryLatency.Observe(time.Since(msg.queued).Seconds())
+			if cc.countSent(size) {
+				for _, unsent := range batch[i+1:] {
+					unsent.release()
+				}
+				cc.abort(quotaExceededReason)
+				break
+			}
+		}
+
+		if closing && len(batch) == 0 {
+			if closeMsg != nil {
+				cc.ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			}
+			return
+		}
+		if len(batch) == 0 {
+			<-cc.wake
+		}
+	}
+}
+
+// notify performs a non-blocking send on a 1-buffered signal channel
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// withOverflow sets the send queue size and overflow policy for one test
+func withOverflow(t *testing.T, size int, policy string) {
+	t.Helper()
+	previousSize, previousPolicy, previousTimeout := *sendQueueSize, *overflowPolicy, *overflowTimeout
+	*sendQueueSize, *overflowPolicy, *overflowTimeout = size, policy, 50*time.Millisecond
+	t.Cleanup(func() {
+		*sendQueueSize, *overflowPolicy, *overflowTimeout = previousSize, previousPolicy, previousTimeout
+	})
+}
+
+// queuedStrings returns cc's queue as strings, for comparison
+func queuedStrings(cc *clientConn) []string {
+	var messages []string
+	for _, msg := range queued(cc) {
+		messages = append(messages, string(msg))
+	}
+	return messages
+}
+
+// closing reports whether cc has stopped accepting messages
+func closing(cc *clientConn) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.closing
+}
+
+// TestOverflowPolicies fills a two-message queue, with nothing draining it,
+// and checks what each policy does with the messages that follow
+func TestOverflowPolicies(t *testing.T) {
+	t.Run(overflowDropOldest, func(t *testing.T) {
+		withOverflow(t, 2, overflowDropOldest)
+		cc := newQueueConn()
+		cc.send([]byte("sdp"), true)
+		cc.send([]byte("ice 1"), false)
+		if err := cc.send([]byte("ice 2"), false); err != nil {
+			t.Fatal(err)
+		}
+		// With only critical messages left, the oldest goes to keep the bound
+		cc.send([]byte("bye"), true)
+		cc.send([]byte("roster"), true)
+		if got, want := queuedStrings(cc), []string{"bye", "roster"}; !slices.Equal(got, want) {
+			t.Fatalf("queued %q, want %q", got, want)
+		}
+		if cc.dropped != 3 {
+			t.Fatalf("dropped %d, want 3", cc.dropped)
+		}
+	})
+
+	t.Run(overflowDropNewest, func(t *testing.T) {
+		withOverflow(t, 2, overflowDropNewest)
+		cc := newQueueConn()
+		cc.send([]byte("ice 1"), false)
+		cc.send([]byte("sdp"), true)
+		if err := cc.send([]byte("ice 2"), false); err != nil {
+			t.Fatal(err)
+		}
+		// A critical message still gets in, in place of the oldest non-critical one
+		cc.send([]byte("bye"), true)
+		if got, want := queuedStrings(cc), []string{"sdp", "bye"}; !slices.Equal(got, want) {
+			t.Fatalf("queued %q, want %q", got, want)
+		}
+		if cc.dropped != 2 {
+			t.Fatalf("dropped %d, want 2", cc.dropped)
+		}
+	})
+
+	t.Run(overflowBlock, func(t *testing.T) {
+		withOverflow(t, 2, overflowBlock)
+		cc := newQueueConn()
+		cc.send([]byte("ice 1"), false)
+		cc.send([]byte("ice 2"), false)
+
+		// Room freed within the timeout lets the blocked sender through
+		sent := make(chan error, 1)
+		go func() { sent <- cc.send([]byte("ice 3"), false) }()
+		time.Sleep(10 * time.Millisecond)
+		cc.mu.Lock()
+		cc.queue = cc.queue[1:]
+		close(cc.space)
+		cc.space = make(chan struct{})
+		cc.mu.Unlock()
+		if err := <-sent; err != nil {
+			t.Fatalf("blocked send: %v", err)
+		}
+		if got, want := queuedStrings(cc), []string{"ice 2", "ice 3"}; !slices.Equal(got, want) {
+			t.Fatalf("queued %q, want %q", got, want)
+		}
+
+		// No room within the timeout disconnects the client
+		start := time.Now()
+		if err := cc.send([]byte("ice 4"), false); !errors.Is(err, errQueueClosed) {
+			t.Fatalf("send to a stuck client: %v, want %v", err, errQueueClosed)
+		}
+		if waited := time.Since(start); waited < *overflowTimeout {
+			t.Fatalf("gave up after %v, want at least %v", waited, *overflowTimeout)
+		}
+		if !closing(cc) || len(queued(cc)) != 0 {
+			t.Fatal("stuck client not disconnected")
+		}
+	})
+
+	t.Run(overflowClose, func(t *testing.T) {
+		withOverflow(t, 2, overflowClose)
+		cc := newQueueConn()
+		cc.send([]byte("ice 1"), false)
+		cc.send([]byte("ice 2"), false)
+		if err := cc.send([]byte("sdp"), true); !errors.Is(err, errQueueClosed) {
+			t.Fatalf("send on overflow: %v, want %v", err, errQueueClosed)
+		}
+		if !closing(cc) || len(queued(cc)) != 0 {
+			t.Fatal("overflowing client not disconnected")
+		}
+		if err := cc.send([]byte("ice 3"), false); !errors.Is(err, errQueueClosed) {
+			t.Fatalf("send after close: %v, want %v", err, errQueueClosed)
+		}
+	})
+}
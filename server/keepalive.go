@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	pingInterval = flag.Duration("ping-interval", 30*time.Second, "How often each client is pinged to detect dead connections (0 disables keepalive)")
+	pongTimeout  = flag.Duration("pong-timeout", 60*time.Second, "How long a client may go without answering a ping before it is dropped")
+)
+
+// validateKeepalive checks the keepalive flags
+func validateKeepalive() error {
+	if *pingInterval > 0 && *pongTimeout <= *pingInterval {
+		return errors.New("-pong-timeout must be longer than -ping-interval")
+	}
+	return nil
+}
+
+// startKeepalive pings cc every -ping-interval until it closes. Every pong
+// pushes the read deadline back by -pong-timeout, so a client that stops
+// answering fails its next read and is removed like any dropped client.
+func startKeepalive(cc *clientConn) {
+	if *pingInterval <= 0 {
+		return
+	}
+	interval, timeout := *pingInterval, *pongTimeout
+	extend := func() { cc.ws.SetReadDeadline(time.Now().Add(timeout)) }
+	extend()
+	cc.ws.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cc.done:
+				return
+			case <-ticker.C:
+			}
+			// Control frames may be written alongside the queue's writer
+			if err := cc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				cc.logf("ping error: %v", err)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// withKeepalive shortens the keepalive flags for the length of a test
+func withKeepalive(t *testing.T, interval, timeout time.Duration) {
+	t.Helper()
+	savedInterval, savedTimeout := *pingInterval, *pongTimeout
+	*pingInterval, *pongTimeout = interval, timeout
+	t.Cleanup(func() { *pingInterval, *pongTimeout = savedInterval, savedTimeout })
+}
+
+// TestKeepaliveDropsSilentClient connects a client that ignores pings and
+// checks the server closes it once -pong-timeout passes without a pong
+func TestKeepaliveDropsSilentClient(t *testing.T) {
+	withKeepalive(t, 50*time.Millisecond, 300*time.Millisecond)
+	_, ws := dialTestServer(t)
+	ws.SetPingHandler(func(string) error { return nil })
+
+	start := time.Now()
+	ws.SetReadDeadline(start.Add(*pongTimeout + 2*time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("server kept a client that stopped answering pings")
+			}
+			break
+		}
+	}
+	if elapsed := time.Since(start); elapsed < *pongTimeout-*pingInterval {
+		t.Fatalf("client dropped after %v, before the %v pong timeout", elapsed, *pongTimeout)
+	}
+}
+
+// TestKeepaliveKeepsAnsweringClient checks a client that answers pings stays
+// connected well past -pong-timeout
+func TestKeepaliveKeepsAnsweringClient(t *testing.T) {
+	withKeepalive(t, 50*time.Millisecond, 300*time.Millisecond)
+	_, ws := dialTestServer(t)
+
+	ws.SetReadDeadline(time.Now().Add(3 * *pongTimeout))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Fatalf("answering client was dropped: %v", err)
+			}
+			return
+		}
+	}
+}
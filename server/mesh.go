@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"sort"
+	"sync"
+)
+
+var maxMeshPeers = flag.Int("max-mesh-peers", 0, "Cap on peer connections per client, forming a partial mesh (0 means full mesh)")
+
+// peersMessage tells a client which peers it is linked to, on joining and
+// whenever a newcomer is linked to it
+type peersMessage struct {
+	Type  string   `json:"type"` // Always "peers"
+	UUID  string   `json:"uuid"`
+	Peers []string `json:"peers"`
+}
+
+// meshTopology tracks which clients have been told to connect to each other
+type meshTopology struct {
+	mu    sync.Mutex
+	links map[string]map[string]bool
+}
+
+func newMeshTopology() *meshTopology {
+	return &meshTopology{links: make(map[string]map[string]bool)}
+}
+
+// join picks the existing peers a new client should connect to. Peers with
+// the fewest links are preferred and no peer is given more than limit links.
+// A limit of 0 connects the client to everyone.
+func (m *meshTopology) join(uuid string, limit int) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	candidates := make([]string, 0, len(m.links))
+	for peer, links := range m.links {
+		if peer != uuid && (limit <= 0 || len(links) < limit) {
+			candidates = append(candidates, peer)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		li, lj := len(m.links[candidates[i]]), len(m.links[candidates[j]])
+		if li != lj {
+			return li < lj
+		}
+		return candidates[i] < candidates[j]
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	own := make(map[string]bool, len(candidates))
+	for _, peer := range candidates {
+		own[peer] = true
+		m.links[peer][uuid] = true
+	}
+	m.links[uuid] = own
+	return candidates
+}
+
+// leave releases every link held by uuid so its peers can accept new ones
+func (m *meshTopology) leave(uuid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for peer := range m.links[uuid] {
+		delete(m.links[peer], uuid)
+	}
+	delete(m.links, uuid)
+}
+
+// peersOf lists the peers uuid is linked to
+func (m *meshTopology) peersOf(uuid string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make([]string, 0, len(m.links[uuid]))
+	for peer := range m.links[uuid] {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// sendMeshTargets assigns the joining client its peers within its room and
+// tells it who they are. Each of those peers is sent its own updated list, so
+// every client knows which peers it may negotiate with.
+func sendMeshTargets(cc *clientConn, uuid string) {
+	targets := cc.room.mesh.join(uuid, *maxMeshPeers)
+	sendPeers(cc, targets)
+	for _, peer := range targets {
+		if target, ok := cc.room.clients.Lookup(peer); ok {
+			sendPeers(target, cc.room.mesh.peersOf(peer))
+		}
+	}
+}
+
+// sendPeers tells cc which peers it is linked to
+func sendPeers(cc *clientConn, peers []string) {
+	message, err := json.Marshal(peersMessage{Type: "peers", UUID: "server", Peers: peers})
+	if err != nil {
+		cc.logf("peers marshal error: %v", err)
+		return
+	}
+	if err := cc.send(message, true); err != nil {
+		cc.logf("peers write error: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMeshCap joins five clients to a room capped at two peers each and
+// checks every client is told of at most two, that links are mutual, and
+// that every client is linked to someone
+func TestMeshCap(t *testing.T) {
+	previous := *maxMeshPeers
+	*maxMeshPeers = 2
+	t.Cleanup(func() { *maxMeshPeers = previous })
+
+	_, url := startTestServer(t)
+	var (
+		mu    sync.Mutex
+		links = make(map[string][]string) // The last peers list each client was sent
+	)
+	for i := range 5 {
+		uuid := fmt.Sprintf("peer%d", i)
+		ws := dialTest(t, url+"/mesh")
+		register(t, ws, uuid)
+		go func() {
+			for {
+				_, message, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				var update peersMessage
+				if json.Unmarshal(message, &update) == nil && update.Type == "peers" {
+					mu.Lock()
+					links[uuid] = update.Peers
+					mu.Unlock()
+				}
+			}
+		}()
+		// Joining in turn makes each join see the links of those before it
+		waitFor(t, uuid+"'s peers", func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			_, ok := links[uuid]
+			return ok
+		})
+	}
+	// Let the updates sent to earlier clients arrive
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for uuid, peers := range links {
+		if len(peers) > *maxMeshPeers {
+			t.Errorf("%s linked to %v, more than %d peers", uuid, peers, *maxMeshPeers)
+		}
+		if len(peers) == 0 {
+			t.Errorf("%s linked to no one", uuid)
+		}
+		for _, peer := range peers {
+			if !slices.Contains(links[peer], uuid) {
+				t.Errorf("%s lists %s, which doesn't list it back", uuid, peer)
+			}
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import "sync/atomic"
+
+// signalingMetrics counts signaling activity for the metrics exporters.
+// The counters only ever increase; the connected client count is read from
+// the registry when exported.
+type signalingMetrics struct {
+	connections      atomic.Int64 // WebSocket connections accepted
+	messagesReceived atomic.Int64 // Messages read from clients
+	messagesSent     atomic.Int64 // Broadcast messages queued for delivery to clients
+	messagesDropped  atomic.Int64 // Messages discarded by the overflow policy
+	bytesSent        atomic.Int64 // Message bytes written to clients
+	opsEventsDropped atomic.Int64 // Events operators missed by reading too slowly
+}
+
+var metrics signalingMetrics
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var clientCAPath = flag.String("client-ca", "", "PEM file of CA certificates; when set, every TLS client must present a certificate signed by one of them")
+
+// serverTLSConfig returns the TLS settings for the listener: the server's
+// certificate and, with -client-ca, mandatory client certificates verified
+// against that pool
+func serverTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if *clientCAPath == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(*clientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates", *clientCAPath)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// clientIdentity returns the common name of r's verified client certificate.
+// It is empty when client certificates aren't required.
+func clientIdentity(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		if *clientCAPath != "" {
+			return "", errors.New("no verified client certificate")
+		}
+		return "", nil
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// testCA is a certificate authority for issuing test client certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a client certificate for commonName signed by ca
+func (ca *testCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestClientCertificates serves the WebSocket route with -client-ca and
+// checks a client with a certificate from that CA is let in under its common
+// name, while clients with a certificate from another CA or none are refused
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, caPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	if err := ensureCertificate(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	ca, rogue := newTestCA(t), newTestCA(t)
+	if err := os.WriteFile(caPath, ca.pem, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := *clientCAPath
+	*clientCAPath = caPath
+	t.Cleanup(func() { *clientCAPath = previous })
+
+	cfg, err := serverTLSConfig(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.GET("/ws/:room", websocketHandler)
+	srv := httptest.NewUnstartedServer(e)
+	srv.TLS = cfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	url := "wss" + strings.TrimPrefix(srv.URL, "https") + "/ws/mtls"
+
+	serverCert, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(certs ...tls.Certificate) (*websocket.Conn, error) {
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(serverCert)
+		dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}
+		ws, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			return nil, err
+		}
+		t.Cleanup(func() { ws.Close() })
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return nil, err
+		}
+		return ws, nil
+	}
+
+	if _, err := dial(ca.issue(t, "alice")); err != nil {
+		t.Fatalf("client with a trusted certificate refused: %v", err)
+	}
+	var identities []string
+	lookupRoom("mtls").clients.Range(func(cc *clientConn, _ string) bool {
+		identities = append(identities, cc.identity)
+		return true
+	})
+	if len(identities) != 1 || identities[0] != "alice" {
+		t.Fatalf("room holds identities %q, want [alice]", identities)
+	}
+
+	if _, err := dial(rogue.issue(t, "mallory")); err == nil {
+		t.Fatal("client with a certificate from another CA let in")
+	}
+	if _, err := dial(); err == nil {
+		t.Fatal("client without a certificate let in")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"sync"
+)
+
+// maxCachedCandidates caps the candidate messages kept with a cached offer
+const maxCachedCandidates = 64
+
+// offerCache keeps the last offer broadcast in a room for each stream, with
+// the candidates its sender broadcast after it, until the offer is answered.
+// A client that joins while an offer waits gets it at once instead of waiting
+// for the offerer to resend it. Each offer is replayed to one client only,
+// since only one can answer it. The zero offerCache is ready to use.
+type offerCache struct {
+	mu     sync.Mutex
+	offers map[string]*cachedOffer // By the signals' stream, "" for media
+}
+
+// cachedOffer is one waiting offer
+type cachedOffer struct {
+	from     string   // UUID of the offerer
+	to       string   // UUID of the client it was replayed to, if any
+	messages [][]byte // The stamped offer, then its candidates
+}
+
+// observe notes a message broadcast to the room by the client from. An offer
+// replaces the stream's cached one; candidates are kept with their sender's
+// offer. The message is copied, so callers may reuse stamped after return.
+func (c *offerCache) observe(from string, env *envelope, stamped []byte) {
+	if from == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sdpType(env.SDP) == "offer" {
+		if c.offers == nil {
+			c.offers = make(map[string]*cachedOffer)
+		}
+		c.offers[env.Stream] = &cachedOffer{from: from, messages: [][]byte{bytes.Clone(stamped)}}
+		return
+	}
+	if len(env.ICE) == 0 {
+		return
+	}
+	// Candidate batches don't name their stream, so they go with every offer
+	// their sender has waiting
+	var kept []byte
+	for _, offer := range c.offers {
+		if offer.from == from && len(offer.messages) <= maxCachedCandidates {
+			if kept == nil {
+				kept = bytes.Clone(stamped)
+			}
+			offer.messages = append(offer.messages, kept)
+		}
+	}
+}
+
+// answered forgets the offer of the client to on stream once it is answered
+func (c *offerCache) answered(to, stream string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if offer := c.offers[stream]; offer != nil && offer.from == to {
+		delete(c.offers, stream)
+	}
+}
+
+// forget drops the offers of a client that left, and frees the offers that
+// were replayed to it for the next client to join
+func (c *offerCache) forget(uuid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for stream, offer := range c.offers {
+		if offer.from == uuid {
+			delete(c.offers, stream)
+		} else if offer.to == uuid {
+			offer.to = ""
+		}
+	}
+}
+
+// replay sends cc, which just announced uuid, every offer waiting in the room
+// from one of peers, its mesh peers, that no other client has been given
+func (c *offerCache) replay(cc *clientConn, uuid string, peers []string) {
+	c.mu.Lock()
+	var pending []cachedOffer
+	for _, offer := range c.offers {
+		if offer.to == "" && offer.from != uuid && slices.Contains(peers, offer.from) {
+			offer.to = uuid
+			pending = append(pending, cachedOffer{from: offer.from, messages: append([][]byte(nil), offer.messages...)})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, offer := range pending {
+		cc.logf("Replaying the waiting offer from %s", offer.from)
+		for i, message := range offer.messages {
+			if err := cc.send(message, i == 0); err != nil {
+				cc.logf("send error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// sdpType returns the type of a session description, or "" if there is none
+func sdpType(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var desc struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(raw, &desc)
+	return desc.Type
+}
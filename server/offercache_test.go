@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// startTestServer serves the WebSocket routes over httptest, returning the
+// server and its /ws URL
+func startTestServer(t *testing.T) (*echo.Echo, string) {
+	t.Helper()
+	e := echo.New()
+	e.GET("/ws", websocketHandler)
+	e.GET("/ws/:room", websocketHandler)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return e, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// dialTest connects a client to url, reading the welcome so the client is in
+// its room on return
+func dialTest(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatalf("reading welcome: %v", err)
+	}
+	return ws
+}
+
+// readUntil reads ws until a message matches, failing after a second
+func readUntil(t *testing.T, ws *websocket.Conn, match func(env envelope) bool) envelope {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("no matching message: %v", err)
+		}
+		var env envelope
+		if json.Unmarshal(message, &env) == nil && match(env) {
+			return env
+		}
+	}
+}
+
+// TestLateJoinerGetsWaitingOffer connects a viewer after the publisher has
+// broadcast its offer and a candidate, and checks both are replayed to it
+func TestLateJoinerGetsWaitingOffer(t *testing.T) {
+	_, url := startTestServer(t)
+	url += "/late-offer"
+
+	publisher := dialTest(t, url)
+	for _, signal := range []string{
+		`{"type":"register","uuid":"publisher"}`,
+		`{"uuid":"publisher","sdp":{"type":"offer","sdp":""}}`,
+		`{"uuid":"publisher","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`,
+	} {
+		if err := publisher.WriteMessage(websocket.TextMessage, []byte(signal)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The room is only sure to have seen the offer once its sender's time probe is answered
+	publisher.WriteMessage(websocket.TextMessage, []byte(`{"type":"time","uuid":"publisher"}`))
+	readUntil(t, publisher, func(env envelope) bool { return env.Type == "time" })
+
+	viewer := dialTest(t, url)
+	viewer.WriteMessage(websocket.TextMessage, []byte(`{"type":"register","uuid":"viewer"}`))
+	offer := readUntil(t, viewer, func(env envelope) bool { return len(env.SDP) > 0 || len(env.ICE) > 0 })
+	if offer.UUID != "publisher" || sdpType(offer.SDP) != "offer" {
+		t.Fatalf("first replayed message = %+v, want the publisher's offer", offer)
+	}
+	candidate := readUntil(t, viewer, func(env envelope) bool { return len(env.SDP) > 0 || len(env.ICE) > 0 })
+	if candidate.UUID != "publisher" || len(candidate.ICE) == 0 {
+		t.Fatalf("second replayed message = %+v, want the publisher's candidate", candidate)
+	}
+}
+
+func TestOfferCacheForgetsAnsweredOffers(t *testing.T) {
+	offer := &envelope{SDP: json.RawMessage(`{"type":"offer"}`)}
+	dataOffer := &envelope{SDP: json.RawMessage(`{"type":"offer"}`), Stream: "data"}
+
+	var c offerCache
+	c.observe("a", offer, []byte("media"))
+	c.observe("a", dataOffer, []byte("data"))
+	c.answered("b", "")
+	if len(c.offers) != 2 {
+		t.Fatal("an answer to another client cleared a's offer")
+	}
+	c.answered("a", "")
+	if len(c.offers) != 1 || c.offers["data"] == nil {
+		t.Fatalf("answering a's media offer left %v", c.offers)
+	}
+	c.forget("a")
+	if len(c.offers) != 0 {
+		t.Fatalf("a left but its offers remain: %v", c.offers)
+	}
+}
+
+func TestOfferCacheCapsCandidates(t *testing.T) {
+	var c offerCache
+	c.observe("a", &envelope{SDP: json.RawMessage(`{"type":"offer"}`)}, []byte("offer"))
+	candidate := &envelope{ICE: json.RawMessage(`{}`)}
+	for range 2 * maxCachedCandidates {
+		c.observe("a", candidate, []byte("candidate"))
+	}
+	c.observe("b", candidate, []byte("other"))
+	if n := len(c.offers[""].messages); n != maxCachedCandidates+1 {
+		t.Fatalf("kept %d messages, want the offer and %d candidates", n, maxCachedCandidates)
+	}
+}
+
+func TestOfferCacheReplaysToOneClient(t *testing.T) {
+	var c offerCache
+	c.observe("a", &envelope{SDP: json.RawMessage(`{"type":"offer"}`)}, []byte("offer"))
+	c.observe("a", &envelope{ICE: json.RawMessage(`{}`)}, []byte("candidate"))
+
+	b, d := newQueueConn(), newQueueConn()
+	c.replay(b, "b", []string{"a"})
+	if got := queued(b); len(got) != 2 || string(got[0]) != "offer" || string(got[1]) != "candidate" {
+		t.Fatalf("b was sent %q, want the offer and its candidate", got)
+	}
+	c.replay(d, "d", []string{"a"})
+	if got := queued(d); len(got) != 0 {
+		t.Fatalf("d was sent %q, but b already has the offer", got)
+	}
+
+	// Once b leaves, the offer goes to the next client to join
+	c.forget("b")
+	c.replay(d, "d", []string{"a"})
+	if got := queued(d); len(got) != 2 {
+		t.Fatalf("d was sent %q after b left, want the offer and its candidate", got)
+	}
+}
+
+func TestOfferCacheReplayFollowsMesh(t *testing.T) {
+	var c offerCache
+	c.observe("a", &envelope{SDP: json.RawMessage(`{"type":"offer"}`)}, []byte("offer"))
+
+	b := newQueueConn()
+	c.replay(b, "b", []string{"other"})
+	if got := queued(b); len(got) != 0 {
+		t.Fatalf("b was sent %q from a peer outside its mesh", got)
+	}
+	c.replay(b, "b", []string{"a", "other"})
+	if got := queued(b); len(got) != 1 {
+		t.Fatalf("b was sent %q, want a's offer", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// opsQueueSize is how many events an operator may fall behind before new
+// ones are dropped for it
+const opsQueueSize = 256
+
+// Operator event types
+const (
+	opsConnected    = "connected"    // A client opened /ws
+	opsDisconnected = "disconnected" // A client's socket closed
+	opsRoomOpened   = "room-opened"  // A room got its first member
+	opsRoomClosed   = "room-closed"  // A room lost its last member
+	opsRejected     = "rejected"     // A client was refused and disconnected
+	opsAborted      = "aborted"      // A client was cut off, such as over its quota
+	opsDropped      = "dropped"      // Events this operator missed by reading too slowly
+)
+
+// opsEvent is one entry on the operator stream. Roster changes are sent with
+// the roster event as their type: joined, left or dropped.
+type opsEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Room   string    `json:"room,omitempty"`
+	ConnID string    `json:"connId,omitempty"`
+	UUID   string    `json:"uuid,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Count  int64     `json:"count,omitempty"` // Events missed, for "dropped"
+}
+
+// opsSubscriber is one connected operator
+type opsSubscriber struct {
+	events  chan []byte
+	dropped atomic.Int64 // Events missed since the last "dropped" notice
+}
+
+var (
+	opsSubscribers   = make(map[*opsSubscriber]bool)
+	opsSubscribersMu sync.Mutex
+)
+
+// publishOps sends ev to every operator without blocking. An operator whose
+// queue is full misses it and is told how many it missed once it catches up.
+func publishOps(ev opsEvent) {
+	opsSubscribersMu.Lock()
+	defer opsSubscribersMu.Unlock()
+	if len(opsSubscribers) == 0 {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Println("ops event marshal error:", err)
+		return
+	}
+	for sub := range opsSubscribers {
+		select {
+		case sub.events <- data:
+		default:
+			sub.dropped.Add(1)
+			metrics.opsEventsDropped.Add(1)
+		}
+	}
+}
+
+// publishClientOps publishes an event about cc
+func publishClientOps(kind string, cc *clientConn, detail string) {
+	ev := opsEvent{Type: kind, ConnID: cc.id, Detail: detail}
+	if cc.room != nil {
+		ev.Room = cc.room.name
+		ev.UUID = cc.room.clients.UUID(cc)
+	}
+	publishOps(ev)
+}
+
+// opsHandler streams server events to an operator as JSON text messages.
+// Anything the operator sends is ignored; closing the socket unsubscribes.
+func opsHandler(c echo.Context) error {
+	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		log.Println("ops websocket upgrade error:", err)
+		return err
+	}
+	defer ws.Close()
+
+	sub := &opsSubscriber{events: make(chan []byte, opsQueueSize)}
+	opsSubscribersMu.Lock()
+	opsSubscribers[sub] = true
+	opsSubscribersMu.Unlock()
+	defer func() {
+		opsSubscribersMu.Lock()
+		delete(opsSubscribers, sub)
+		opsSubscribersMu.Unlock()
+	}()
+	log.Printf("Operator %s subscribed to server events", c.RealIP())
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var data []byte
+		select {
+		case <-closed:
+			return nil
+		case data = <-sub.events:
+		}
+		if missed := sub.dropped.Swap(0); missed > 0 {
+			notice, err := json.Marshal(opsEvent{Type: opsDropped, Time: time.Now().UTC(), Count: missed})
+			if err == nil && !writeOps(ws, notice) {
+				return nil
+			}
+		}
+		if !writeOps(ws, data) {
+			return nil
+		}
+	}
+}
+
+// writeOps writes one event, reporting whether the operator is still there
+func writeOps(ws *websocket.Conn, data []byte) bool {
+	ws.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		log.Printf("ops write error: %v", err)
+		return false
+	}
+	return true
+}
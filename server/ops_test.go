@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readOps reads the operator stream until an event of each of kinds has
+// arrived, in any order, returning the first of each
+func readOps(t *testing.T, ops *websocket.Conn, kinds ...string) map[string]opsEvent {
+	t.Helper()
+	ops.SetReadDeadline(time.Now().Add(time.Second))
+	defer ops.SetReadDeadline(time.Time{})
+	seen := make(map[string]opsEvent)
+	for len(seen) < len(kinds) {
+		_, message, err := ops.ReadMessage()
+		if err != nil {
+			t.Fatalf("got events %v, want %v: %v", seen, kinds, err)
+		}
+		var ev opsEvent
+		if json.Unmarshal(message, &ev) != nil || !slices.Contains(kinds, ev.Type) {
+			continue
+		}
+		if _, ok := seen[ev.Type]; !ok {
+			seen[ev.Type] = ev
+		}
+	}
+	return seen
+}
+
+// TestOpsStream subscribes an operator to /ops and checks a client joining
+// a room shows up as connected, room-opened and joined events
+func TestOpsStream(t *testing.T) {
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	opsURL := "ws" + strings.TrimPrefix(baseURL, "http") + "/ops"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(opsURL, http.Header{"Authorization": {"Bearer wrong"}}); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("subscribing with a wrong token: %v, want 401", err)
+	}
+	ops, _, err := websocket.DefaultDialer.Dial(opsURL, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ops.Close() })
+	waitFor(t, "the operator to subscribe", func() bool {
+		opsSubscribersMu.Lock()
+		defer opsSubscribersMu.Unlock()
+		return len(opsSubscribers) == 1
+	})
+
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL+"/watched", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	var welcome struct {
+		ConnID string `json:"connId"`
+	}
+	if err := ws.ReadJSON(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	register(t, ws, "watched-client")
+
+	events := readOps(t, ops, opsConnected, opsRoomOpened, "joined")
+	if ev := events[opsConnected]; ev.ConnID != welcome.ConnID || ev.Room != "watched" {
+		t.Fatalf("connected event %+v, want connection %s in room watched", ev, welcome.ConnID)
+	}
+	if ev := events[opsRoomOpened]; ev.Room != "watched" {
+		t.Fatalf("room-opened event %+v, want room watched", ev)
+	}
+	if ev := events["joined"]; ev.UUID != "watched-client" || ev.Room != "watched" {
+		t.Fatalf("joined event %+v, want watched-client in room watched", ev)
+	}
+}
+
+// TestOpsBackpressure publishes to an operator that isn't reading and checks
+// events past its queue are dropped and counted rather than blocking
+func TestOpsBackpressure(t *testing.T) {
+	sub := &opsSubscriber{events: make(chan []byte, 2)}
+	opsSubscribersMu.Lock()
+	opsSubscribers[sub] = true
+	opsSubscribersMu.Unlock()
+	t.Cleanup(func() {
+		opsSubscribersMu.Lock()
+		delete(opsSubscribers, sub)
+		opsSubscribersMu.Unlock()
+	})
+
+	droppedBefore := metrics.opsEventsDropped.Load()
+	for range 5 {
+		publishOps(opsEvent{Type: opsConnected})
+	}
+	if n := len(sub.events); n != 2 {
+		t.Fatalf("%d events queued, want the 2 that fit", n)
+	}
+	if n := sub.dropped.Load(); n != 3 {
+		t.Fatalf("operator missed %d events, want 3", n)
+	}
+	if n := metrics.opsEventsDropped.Load() - droppedBefore; n != 3 {
+		t.Fatalf("dropped counter grew by %d, want 3", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+var (
+	otelEndpoint = flag.String("otel-endpoint", "", "OTLP/HTTP collector URL to export signaling metrics to, e.g. http://localhost:4318 (empty disables)")
+	otelInterval = flag.Duration("otel-interval", 15*time.Second, "How often metrics are pushed to the OTLP collector")
+)
+
+// startOTelExport pushes the signaling metrics to the collector at endpoint
+// every interval. The returned function flushes and stops the exporter.
+func startOTelExport(ctx context.Context, endpoint string, interval time.Duration) (func(context.Context) error, error) {
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+	)
+	if err := registerOTelMetrics(provider.Meter("github.com/shreethaar/go-webrtc/server")); err != nil {
+		provider.Shutdown(ctx)
+		return nil, err
+	}
+	return provider.Shutdown, nil
+}
+
+// registerOTelMetrics exposes the signaling metrics as observable instruments
+// on meter, read from the shared counters at each collection
+func registerOTelMetrics(meter metric.Meter) error {
+	connections, err := meter.Int64ObservableCounter("signaling.connections",
+		metric.WithDescription("WebSocket connections accepted"))
+	if err != nil {
+		return err
+	}
+	connected, err := meter.Int64ObservableGauge("signaling.clients",
+		metric.WithDescription("Clients currently connected"))
+	if err != nil {
+		return err
+	}
+	received, err := meter.Int64ObservableCounter("signaling.messages.received",
+		metric.WithDescription("Messages read from clients"))
+	if err != nil {
+		return err
+	}
+	sent, err := meter.Int64ObservableCounter("signaling.messages.sent",
+		metric.WithDescription("Broadcast messages queued for delivery to clients"))
+	if err != nil {
+		return err
+	}
+	dropped, err := meter.Int64ObservableCounter("signaling.messages.dropped",
+		metric.WithDescription("Messages discarded because a client's send queue was full"))
+	if err != nil {
+		return err
+	}
+
+	bytesSent, err := meter.Int64ObservableCounter("signaling.bytes.sent",
+		metric.WithDescription("Message bytes written to clients"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+
+	opsDropped, err := meter.Int64ObservableCounter("signaling.ops.events.dropped",
+		metric.WithDescription("Server events operators on /ops missed by reading too slowly"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(connections, metrics.connections.Load())
+		o.ObserveInt64(connected, int64(connectedClients()))
+		o.ObserveInt64(received, metrics.messagesReceived.Load())
+		o.ObserveInt64(sent, metrics.messagesSent.Load())
+		o.ObserveInt64(dropped, metrics.messagesDropped.Load())
+		o.ObserveInt64(bytesSent, metrics.bytesSent.Load())
+		o.ObserveInt64(opsDropped, metrics.opsEventsDropped.Load())
+		return nil
+	}, connections, connected, received, sent, dropped, bytesSent, opsDropped)
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectInt64 reads the current value of the named counter or gauge from reader
+func collectInt64(t *testing.T, reader sdkmetric.Reader, name string) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				return data.DataPoints[0].Value
+			case metricdata.Gauge[int64]:
+				return data.DataPoints[0].Value
+			}
+			t.Fatalf("%s has unexpected data %T", name, m.Data)
+		}
+	}
+	t.Fatalf("%s not collected", name)
+	return 0
+}
+
+// TestOTelConnectionCounter registers the metrics with an in-memory reader
+// and checks a new connection is recorded
+func TestOTelConnectionCounter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	if err := registerOTelMetrics(provider.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, wsURL := startTestServer(t)
+	before := collectInt64(t, reader, "signaling.connections")
+	ws := dialTest(t, wsURL+"/otel")
+	register(t, ws, "counted")
+	if got := collectInt64(t, reader, "signaling.connections"); got != before+1 {
+		t.Fatalf("signaling.connections went from %d to %d, want one more", before, got)
+	}
+	if clients := collectInt64(t, reader, "signaling.clients"); clients < 1 {
+		t.Fatalf("signaling.clients is %d with a client connected", clients)
+	}
+}
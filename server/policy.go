@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/pion/sdp/v3"
+)
+
+var (
+	roomPolicyFlag     = flag.String("room-policy", "", "Codec policy for the default room: audio-only, or video=<codec>[,<codec>...] such as video=VP8; other rooms are set through the admin API")
+	maxPublishedTracks = flag.Int("max-published-tracks", 0, "Most audio and video tracks a client in the default room may send in one offer (0 allows any); other rooms are set through the admin API")
+	requireMediaFlag   = flag.String("require-media", "", "Comma-separated media kinds, audio and/or video, every offer in the default room must send; other rooms are set through the admin API")
+)
+
+// codecPolicy restricts the media clients in a room may negotiate
+type codecPolicy struct {
+	AudioOnly bool `json:"audioOnly,omitempty"`
+	// VideoCodecs lists the allowed video codecs, such as "VP8"; empty allows any
+	VideoCodecs []string `json:"videoCodecs,omitempty"`
+	// MaxPublishedTracks caps the sending media sections of an offer; 0 allows any
+	MaxPublishedTracks int `json:"maxPublishedTracks,omitempty"`
+	// RequiredMedia lists the kinds, "audio" or "video", an offer must send
+	RequiredMedia []string `json:"requiredMedia,omitempty"`
+}
+
+var (
+	roomPolicies   = map[string]codecPolicy{}
+	roomPoliciesMu sync.RWMutex
+)
+
+// parseCodecPolicy parses the -room-policy flag syntax
+func parseCodecPolicy(s string) (codecPolicy, error) {
+	switch {
+	case s == "":
+		return codecPolicy{}, nil
+	case s == "audio-only":
+		return codecPolicy{AudioOnly: true}, nil
+	case strings.HasPrefix(s, "video="):
+		var policy codecPolicy
+		for _, codec := range strings.Split(strings.TrimPrefix(s, "video="), ",") {
+			if codec = strings.TrimSpace(codec); codec != "" {
+				policy.VideoCodecs = append(policy.VideoCodecs, codec)
+			}
+		}
+		if len(policy.VideoCodecs) == 0 {
+			return codecPolicy{}, errors.New("video= policy needs at least one codec")
+		}
+		return policy, nil
+	}
+	return codecPolicy{}, fmt.Errorf("unknown room policy %q (want audio-only or video=<codecs>)", s)
+}
+
+// parseRequiredMedia parses the -require-media flag syntax
+func parseRequiredMedia(s string) []string {
+	var kinds []string
+	for _, kind := range strings.Split(s, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			kinds = append(kinds, strings.ToLower(kind))
+		}
+	}
+	return kinds
+}
+
+// validate rejects policies that can't be applied or can never be met
+func (p codecPolicy) validate() error {
+	if p.AudioOnly && len(p.VideoCodecs) > 0 {
+		return errors.New("audioOnly and videoCodecs are mutually exclusive")
+	}
+	if p.MaxPublishedTracks < 0 {
+		return errors.New("maxPublishedTracks must not be negative")
+	}
+	for _, kind := range p.RequiredMedia {
+		switch {
+		case kind != "audio" && kind != "video":
+			return fmt.Errorf("required media %q must be audio or video", kind)
+		case kind == "video" && p.AudioOnly:
+			return errors.New("an audio-only room can't require video")
+		}
+	}
+	if p.MaxPublishedTracks > 0 && len(p.RequiredMedia) > p.MaxPublishedTracks {
+		return errors.New("requiredMedia needs more tracks than maxPublishedTracks allows")
+	}
+	return nil
+}
+
+// setRoomPolicy replaces a room's codec policy
+func setRoomPolicy(room string, policy codecPolicy) {
+	roomPoliciesMu.Lock()
+	roomPolicies[room] = policy
+	roomPoliciesMu.Unlock()
+}
+
+// roomPolicy returns a room's codec policy; the zero policy allows anything
+func roomPolicy(room string) codecPolicy {
+	roomPoliciesMu.RLock()
+	defer roomPoliciesMu.RUnlock()
+	return roomPolicies[room]
+}
+
+// check returns an error describing how desc violates the policy. Offers must
+// include an allowed video codec, send every kind in RequiredMedia and send
+// no more than MaxPublishedTracks tracks; answers must prefer an allowed
+// codec, since the first codec of an answer is the one that will be sent.
+func (p codecPolicy) check(descType, desc string) error {
+	if !p.AudioOnly && len(p.VideoCodecs) == 0 && p.MaxPublishedTracks == 0 && len(p.RequiredMedia) == 0 {
+		return nil
+	}
+
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(desc); err != nil {
+		return fmt.Errorf("unparseable SDP: %w", err)
+	}
+	if descType == "offer" {
+		sent := publishedTracks(&parsed)
+		n := sent["audio"] + sent["video"]
+		if p.MaxPublishedTracks > 0 && n > p.MaxPublishedTracks {
+			return fmt.Errorf("this room allows at most %d published tracks but the offer sends %d", p.MaxPublishedTracks, n)
+		}
+		for _, kind := range p.RequiredMedia {
+			if sent[kind] == 0 {
+				return fmt.Errorf("this room requires %s but the offer sends none", kind)
+			}
+		}
+	}
+	if !p.AudioOnly && len(p.VideoCodecs) == 0 {
+		return nil
+	}
+	for _, media := range parsed.MediaDescriptions {
+		// Port 0 marks a rejected or disabled section
+		if media.MediaName.Media != "video" || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		if p.AudioOnly {
+			return errors.New("this room is audio-only but the SDP includes video")
+		}
+
+		codecs := rtpmapCodecs(media)
+		if descType == "answer" && len(codecs) > 0 {
+			codecs = codecs[:1]
+		}
+		if !p.allowsAny(codecs) {
+			return fmt.Errorf("this room only allows video codecs %s", strings.Join(p.VideoCodecs, ", "))
+		}
+	}
+	return nil
+}
+
+// allowsAny reports whether any of codecs is an allowed video codec
+func (p codecPolicy) allowsAny(codecs []string) bool {
+	for _, codec := range codecs {
+		for _, allowed := range p.VideoCodecs {
+			if strings.EqualFold(codec, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishedTracks counts the active audio and video sections of desc that
+// send media, by kind. A section without a direction attribute takes the
+// session's, which defaults to sendrecv.
+func publishedTracks(desc *sdp.SessionDescription) map[string]int {
+	sessionDirection := "sendrecv"
+	for _, attr := range desc.Attributes {
+		if isDirection(attr.Key) {
+			sessionDirection = attr.Key
+		}
+	}
+
+	sent := make(map[string]int)
+	for _, media := range desc.MediaDescriptions {
+		kind := media.MediaName.Media
+		if (kind != "audio" && kind != "video") || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		direction := sessionDirection
+		for _, attr := range media.Attributes {
+			if isDirection(attr.Key) {
+				direction = attr.Key
+			}
+		}
+		if direction == "sendrecv" || direction == "sendonly" {
+			sent[kind]++
+		}
+	}
+	return sent
+}
+
+// isDirection reports whether an attribute key is a media direction
+func isDirection(key string) bool {
+	switch key {
+	case "sendrecv", "sendonly", "recvonly", "inactive":
+		return true
+	}
+	return false
+}
+
+// rtpmapCodecs returns the codec names of a media section in payload order,
+// skipping retransmission and redundancy formats
+func rtpmapCodecs(media *sdp.MediaDescription) []string {
+	names := make(map[string]string)
+	for _, attr := range media.Attributes {
+		if attr.Key != "rtpmap" {
+			continue
+		}
+		fields := strings.Fields(attr.Value)
+		if len(fields) < 2 {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[1], "/")
+		switch strings.ToLower(name) {
+		case "rtx", "red", "ulpfec", "flexfec-03":
+			continue
+		}
+		names[fields[0]] = name
+	}
+
+	codecs := make([]string, 0, len(names))
+	for _, payload := range media.MediaName.Formats {
+		if name, ok := names[payload]; ok {
+			codecs = append(codecs, name)
+		}
+	}
+	return codecs
+}
+
+// checkSignalPolicy validates the SDP carried by a signal against the room policy
+func checkSignalPolicy(room string, raw json.RawMessage) error {
+	var desc struct {
+		Type string `json:"type"`
+		SDP  string `json:"sdp"`
+	}
+	if err := json.Unmarshal(raw, &desc); err != nil {
+		return fmt.Errorf("malformed session description: %w", err)
+	}
+	if desc.SDP == "" {
+		return nil
+	}
+	return roomPolicy(room).check(desc.Type, desc.SDP)
+}
+
+// rejectClient tells a client why it is being disconnected and drops it,
+// closing the socket with closeText
+func rejectClient(cc *clientConn, reason, closeText string) {
+	cc.logf("Rejecting client %s: %s", cc.room.clients.UUID(cc), reason)
+	publishClientOps(opsRejected, cc, reason)
+	notice, err := json.Marshal(serverNotice{Type: "rejected", UUID: "server", Reason: reason})
+	if err == nil {
+		cc.send(notice, true)
+	}
+	cc.shutdown(websocket.ClosePolicyViolation, closeText)
+	removeClient(cc, rosterDropped)
+}
+
+// roomPolicyHandler returns a room's codec policy
+func roomPolicyHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, roomPolicy(room))
+}
+
+// setRoomPolicyHandler replaces a room's codec policy. It applies to SDP
+// signalled from then on; clients already negotiated are left alone.
+func setRoomPolicyHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var policy codecPolicy
+	if err := c.Bind(&policy); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid policy")
+	}
+	if err := policy.validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	setRoomPolicy(room, policy)
+	log.Printf("Room %s codec policy set to %+v", room, policy)
+	return c.JSON(http.StatusOK, policy)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mediaSDP returns SDP sending one section per entry of media, each given
+// as kind/codecs such as "video/VP8" or, in order of preference, "video/H264,VP8"
+func mediaSDP(media ...string) string {
+	var b strings.Builder
+	b.WriteString("v=0\r\no=- 1 1 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n")
+	pt := 96
+	for i, m := range media {
+		kind, codecs, _ := strings.Cut(m, "/")
+		rate := "90000"
+		if kind == "audio" {
+			rate = "48000/2"
+		}
+		var formats, rtpmaps []string
+		for _, codec := range strings.Split(codecs, ",") {
+			formats = append(formats, strconv.Itoa(pt))
+			rtpmaps = append(rtpmaps, "a=rtpmap:"+strconv.Itoa(pt)+" "+codec+"/"+rate+"\r\n")
+			pt++
+		}
+		b.WriteString("m=" + kind + " 9 UDP/TLS/RTP/SAVPF " + strings.Join(formats, " ") + "\r\n")
+		b.WriteString("a=mid:" + strconv.Itoa(i) + "\r\na=sendrecv\r\n")
+		b.WriteString(strings.Join(rtpmaps, ""))
+	}
+	return b.String()
+}
+
+// offerMessage wraps sdp in an offer signal from uuid
+func offerMessage(t *testing.T, uuid, sdp string) []byte {
+	t.Helper()
+	message, err := json.Marshal(map[string]any{"uuid": uuid, "sdp": map[string]string{"type": "offer", "sdp": sdp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// expectRejected reads ws until the server's rejection notice, returning its
+// reason once the server has closed the connection for a policy violation
+func expectRejected(t *testing.T, ws *websocket.Conn) string {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var notice serverNotice
+	for notice.Type != "rejected" {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("no rejection notice: %v", err)
+		}
+		json.Unmarshal(message, &notice)
+	}
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("read error %v, want a policy violation close", err)
+			}
+			return notice.Reason
+		}
+	}
+}
+
+// TestAudioOnlyRoomRejectsVideo makes a room audio-only through the admin API
+// and checks an audio offer is forwarded while a client offering video is
+// told why, disconnected and never heard by the room
+func TestAudioOnlyRoomRejectsVideo(t *testing.T) {
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	t.Cleanup(func() { setRoomPolicy("audio-room", codecPolicy{}) })
+	policyURL := baseURL + "/api/rooms/audio-room/policy"
+	if resp := adminRequest(t, http.MethodPut, policyURL, "secret", `{"audioOnly":true,"videoCodecs":["VP8"]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("contradictory policy: status %d, want 400", resp.StatusCode)
+	}
+	if resp := adminRequest(t, http.MethodPut, policyURL, "secret", `{"audioOnly":true}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set policy: status %d, want 200", resp.StatusCode)
+	}
+
+	url := wsURL + "/audio-room"
+	listener := dialTest(t, url)
+	register(t, listener, "listener")
+	speaker := dialTest(t, url)
+	register(t, speaker, "speaker")
+	camera := dialTest(t, url)
+	register(t, camera, "camera")
+
+	if err := speaker.WriteMessage(websocket.TextMessage, offerMessage(t, "speaker", mediaSDP("audio/opus"))); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, listener, func(env envelope) bool { return isSignal(env) && env.UUID == "speaker" })
+
+	if err := camera.WriteMessage(websocket.TextMessage, offerMessage(t, "camera", mediaSDP("audio/opus", "video/VP8"))); err != nil {
+		t.Fatal(err)
+	}
+	if reason := expectRejected(t, camera); !strings.Contains(reason, "audio-only") {
+		t.Fatalf("rejected for %q, want the audio-only policy named", reason)
+	}
+	expectNoSignal(t, listener, "camera", 200*time.Millisecond)
+}
+
+// TestCodecPolicyCheck checks offers and answers against a video codec allowlist
+func TestCodecPolicyCheck(t *testing.T) {
+	policy, err := parseCodecPolicy("video=VP8,AV1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		descType string
+		media    []string
+		ok       bool
+	}{
+		{"offer", []string{"audio/opus", "video/H264,VP8"}, true},
+		{"offer", []string{"video/H264"}, false},
+		{"answer", []string{"video/AV1,H264"}, true},
+		// An answer sends its first codec, so that one must be allowed
+		{"answer", []string{"video/H264,VP8"}, false},
+		{"offer", []string{"audio/opus"}, true},
+	} {
+		if err := policy.check(tc.descType, mediaSDP(tc.media...)); (err == nil) != tc.ok {
+			t.Errorf("%s of %v: %v, want allowed %v", tc.descType, tc.media, err, tc.ok)
+		}
+	}
+}
+
+// TestMaxPublishedTracks caps a room at two published tracks through the
+// admin API and checks an offer sending two is forwarded while one sending
+// three is rejected with the limit as the reason. Sections that only receive
+// don't count.
+func TestMaxPublishedTracks(t *testing.T) {
+	policy := codecPolicy{MaxPublishedTracks: 2}
+	receiveFirst := func(sdp string) string { return strings.Replace(sdp, "a=sendrecv", "a=recvonly", 1) }
+	for _, tc := range []struct {
+		name string
+		sdp  string
+		ok   bool
+	}{
+		{"two", mediaSDP("audio/opus", "video/VP8"), true},
+		{"three", mediaSDP("audio/opus", "video/VP8", "video/VP8"), false},
+		{"three receiving one", receiveFirst(mediaSDP("audio/opus", "video/VP8", "video/VP8")), true},
+	} {
+		if err := policy.check("offer", tc.sdp); (err == nil) != tc.ok {
+			t.Errorf("%s: %v, want allowed %v", tc.name, err, tc.ok)
+		}
+	}
+
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	t.Cleanup(func() { setRoomPolicy("track-limit", codecPolicy{}) })
+	if resp := adminRequest(t, http.MethodPut, baseURL+"/api/rooms/track-limit/policy", "secret", `{"maxPublishedTracks":2}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set policy: status %d, want 200", resp.StatusCode)
+	}
+
+	url := wsURL + "/track-limit"
+	viewer := dialTest(t, url)
+	register(t, viewer, "viewer")
+	modest := dialTest(t, url)
+	register(t, modest, "modest")
+	greedy := dialTest(t, url)
+	register(t, greedy, "greedy")
+
+	if err := modest.WriteMessage(websocket.TextMessage, offerMessage(t, "modest", mediaSDP("audio/opus", "video/VP8"))); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, viewer, func(env envelope) bool { return isSignal(env) && env.UUID == "modest" })
+
+	if err := greedy.WriteMessage(websocket.TextMessage, offerMessage(t, "greedy", mediaSDP("audio/opus", "video/VP8", "video/VP8"))); err != nil {
+		t.Fatal(err)
+	}
+	if reason := expectRejected(t, greedy); !strings.Contains(reason, "at most 2 published tracks but the offer sends 3") {
+		t.Fatalf("rejected for %q, want the limit of 2 and the 3 tracks named", reason)
+	}
+	expectNoSignal(t, viewer, "greedy", 200*time.Millisecond)
+}
+
+// TestRequiredMedia makes a room require video through the admin API and
+// checks a publisher sending audio only is rejected with the reason while
+// one sending video is forwarded, and that a policy that can never be met is
+// refused
+func TestRequiredMedia(t *testing.T) {
+	policy := codecPolicy{RequiredMedia: []string{"video"}}
+	receiveVideo := func(sdp string) string {
+		audio, video, _ := strings.Cut(sdp, "m=video")
+		return audio + "m=video" + strings.Replace(video, "a=sendrecv", "a=recvonly", 1)
+	}
+	for _, tc := range []struct {
+		name string
+		sdp  string
+		ok   bool
+	}{
+		{"audio and video", mediaSDP("audio/opus", "video/VP8"), true},
+		{"audio only", mediaSDP("audio/opus"), false},
+		{"receiving video", receiveVideo(mediaSDP("audio/opus", "video/VP8")), false},
+	} {
+		if err := policy.check("offer", tc.sdp); (err == nil) != tc.ok {
+			t.Errorf("%s: %v, want allowed %v", tc.name, err, tc.ok)
+		}
+	}
+
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	t.Cleanup(func() { setRoomPolicy("video-ingest", codecPolicy{}) })
+	policyURL := baseURL + "/api/rooms/video-ingest/policy"
+	for _, body := range []string{`{"requiredMedia":["screen"]}`, `{"audioOnly":true,"requiredMedia":["video"]}`, `{"maxPublishedTracks":1,"requiredMedia":["audio","video"]}`} {
+		if resp := adminRequest(t, http.MethodPut, policyURL, "secret", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("policy %s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+	if resp := adminRequest(t, http.MethodPut, policyURL, "secret", `{"requiredMedia":["video"]}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set policy: status %d, want 200", resp.StatusCode)
+	}
+
+	url := wsURL + "/video-ingest"
+	viewer := dialTest(t, url)
+	register(t, viewer, "viewer")
+	camera := dialTest(t, url)
+	register(t, camera, "camera")
+	microphone := dialTest(t, url)
+	register(t, microphone, "microphone")
+
+	if err := camera.WriteMessage(websocket.TextMessage, offerMessage(t, "camera", mediaSDP("audio/opus", "video/VP8"))); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, viewer, func(env envelope) bool { return isSignal(env) && env.UUID == "camera" })
+
+	if err := microphone.WriteMessage(websocket.TextMessage, offerMessage(t, "microphone", mediaSDP("audio/opus"))); err != nil {
+		t.Fatal(err)
+	}
+	if reason := expectRejected(t, microphone); !strings.Contains(reason, "requires video but the offer sends none") {
+		t.Fatalf("rejected for %q, want the missing video named", reason)
+	}
+	expectNoSignal(t, viewer, "microphone", 200*time.Millisecond)
+}
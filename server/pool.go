@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledMessage keeps unusually large messages from pinning memory in the pool
+const maxPooledMessage = 64 << 10
+
+// pooledMessage is a stamped signal shared by the send queues it is handed
+// to. Each holder keeps a reference, and the buffer goes back to the pool
+// once the last of them has written or dropped it.
+type pooledMessage struct {
+	data []byte
+	refs atomic.Int32
+}
+
+var messagePool = sync.Pool{
+	New: func() any { return new(pooledMessage) },
+}
+
+// stampPooled is stampServerTime writing into a pooled buffer. The caller
+// holds the first reference and must release it once it has handed the
+// message on.
+func stampPooled(message []byte) *pooledMessage {
+	m := messagePool.Get().(*pooledMessage)
+	m.refs.Store(1)
+	if body, ok := objectBody(message); ok {
+		m.data = appendStamped(m.data[:0], body)
+	} else {
+		m.data = append(m.data[:0], message...)
+	}
+	return m
+}
+
+// retain adds a reference for a new holder
+func (m *pooledMessage) retain() {
+	m.refs.Add(1)
+}
+
+// release drops a reference, returning the buffer to the pool with the last
+func (m *pooledMessage) release() {
+	if m.refs.Add(-1) == 0 && cap(m.data) <= maxPooledMessage {
+		messagePool.Put(m)
+	}
+}
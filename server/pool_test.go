@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestPooledMessageOutlivesSender queues a pooled message to a room and
+// checks its buffer isn't reused until every queue has released it
+func TestPooledMessageOutlivesSender(t *testing.T) {
+	r, members := benchRoom()
+	stamped := stampPooled([]byte(`{"uuid":"first"}`))
+	broadcastPooled(r, nil, stamped, false)
+	stamped.release()
+
+	overwrite := func() {
+		for range 100 {
+			stampPooled([]byte(`{"uuid":"later"}`)).release()
+		}
+	}
+
+	last := len(members) - 1
+	overwrite()
+	drainQueues(members[:last])
+	overwrite()
+	if data := queued(members[last])[0]; !bytes.Contains(data, []byte(`"first"`)) {
+		t.Fatalf("queued message overwritten while still held: %s", data)
+	}
+	if refs := stamped.refs.Load(); refs != 1 {
+		t.Fatalf("%d references left, want the last queue's", refs)
+	}
+	drainQueues(members[last:])
+}
+
+func TestStampPooled(t *testing.T) {
+	stamped := stampPooled([]byte(` {"uuid":"a"} `))
+	defer stamped.release()
+	if !bytes.HasPrefix(stamped.data, []byte(`{"uuid":"a","serverTime":`)) {
+		t.Errorf("stamped = %s", stamped.data)
+	}
+
+	raw := stampPooled([]byte("not json"))
+	defer raw.release()
+	if string(raw.data) != "not json" {
+		t.Errorf("non-object message changed to %s", raw.data)
+	}
+}
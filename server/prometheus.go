@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// broadcastFanout times how long broadcastMessage takes to queue a message
+// for every member of a room
+var broadcastFanout = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "signaling_broadcast_fanout_seconds",
+	Help:    "Time taken to queue a broadcast message for every member of a room",
+	Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to about 2.6s
+})
+
+// deliveryLatency times each message from being queued for a client to being
+// written to its socket. A rising tail means writers can't keep up with the
+// broadcast loop.
+var deliveryLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "signaling_delivery_latency_seconds",
+	Help:    "Time a message waits in a client's send queue until it is written",
+	Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to about 2.6s
+})
+
+// registerPrometheusMetrics exposes the signaling metrics on reg, read from
+// the shared counters at each scrape, along with the broadcast fan-out and
+// delivery latency histograms
+func registerPrometheusMetrics(reg prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_connections_total",
+			Help: "WebSocket connections accepted",
+		}, func() float64 { return float64(metrics.connections.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "signaling_clients",
+			Help: "Clients currently connected",
+		}, func() float64 { return float64(connectedClients()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_messages_received_total",
+			Help: "Messages read from clients",
+		}, func() float64 { return float64(metrics.messagesReceived.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_messages_broadcast_total",
+			Help: "Messages queued for delivery to clients",
+		}, func() float64 { return float64(metrics.messagesSent.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_messages_dropped_total",
+			Help: "Messages discarded because a client's send queue was full",
+		}, func() float64 { return float64(metrics.messagesDropped.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_bytes_sent_total",
+			Help: "Message bytes written to clients",
+		}, func() float64 { return float64(metrics.bytesSent.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "signaling_ops_events_dropped_total",
+			Help: "Server events operators on /ops missed by reading too slowly",
+		}, func() float64 { return float64(metrics.opsEventsDropped.Load()) }),
+		broadcastFanout,
+		deliveryLatency,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
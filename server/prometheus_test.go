@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrape returns the value of each metric in reg, or a histogram's sample count
+func scrape(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch {
+			case m.Counter != nil:
+				values[family.GetName()] = m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				values[family.GetName()] = m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				values[family.GetName()] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+// TestPrometheusMetrics drives two clients through a room and checks the
+// counters on an injected registry move by what they did, and that /metrics
+// serves them
+func TestPrometheusMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := registerPrometheusMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+	e, wsURL := startTestServer(t)
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	waitFor(t, "earlier tests' clients to leave", func() bool { return connectedClients() == 0 })
+	before := scrape(t, registry)
+
+	a := dialTest(t, wsURL+"/scraped")
+	b := dialTest(t, wsURL+"/scraped")
+	register(t, a, "a")
+	register(t, b, "b")
+	waitFor(t, "both clients to register", func() bool {
+		r := lookupRoom("scraped")
+		_, okA := r.clients.Lookup("a")
+		_, okB := r.clients.Lookup("b")
+		return okA && okB
+	})
+	for range 3 {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(`{"uuid":"a","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`)); err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, b, isSignal)
+	}
+
+	after := scrape(t, registry)
+	delta := func(name string) float64 { return after[name] - before[name] }
+	if d := delta("signaling_clients"); d != 2 {
+		t.Errorf("connected clients rose by %v, want 2", d)
+	}
+	if d := delta("signaling_connections_total"); d != 2 {
+		t.Errorf("connections rose by %v, want 2", d)
+	}
+	if d := delta("signaling_messages_received_total"); d != 5 {
+		t.Errorf("messages received rose by %v, want 5 for two registers and three candidates", d)
+	}
+	if d := delta("signaling_messages_broadcast_total"); d < 3 {
+		t.Errorf("messages broadcast rose by %v, want at least the 3 candidates", d)
+	}
+	if d := delta("signaling_broadcast_fanout_seconds"); d < 3 {
+		t.Errorf("fan-out histogram gained %v samples, want at least 3", d)
+	}
+
+	resp, err := http.Get("http" + strings.TrimSuffix(strings.TrimPrefix(wsURL, "ws"), "/ws") + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"signaling_clients", "signaling_messages_received_total", "signaling_messages_broadcast_total", "signaling_broadcast_fanout_seconds_bucket"} {
+		if !strings.Contains(string(body), "\n"+name) {
+			t.Errorf("/metrics doesn't serve %s", name)
+		}
+	}
+}
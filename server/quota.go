@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+var sendQuota = flag.Int64("send-quota", 0, "Bytes the server may send one client over its connection before disconnecting it (0 is unlimited)")
+
+// quotaExceededReason is the close reason of a client over -send-quota
+const quotaExceededReason = "send quota exceeded"
+
+// countSent adds n bytes written to cc to its counter and the server total,
+// reporting whether cc has now gone over its quota
+func (cc *clientConn) countSent(n int) bool {
+	sent := cc.bytesSent.Add(int64(n))
+	metrics.bytesSent.Add(int64(n))
+	return cc.quota > 0 && sent > cc.quota
+}
+
+// clientUsage is one client's entry in the room clients listing
+type clientUsage struct {
+	ConnID    string `json:"connId"`
+	UUID      string `json:"uuid,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+	BytesSent int64  `json:"bytesSent"`
+}
+
+// roomClientsHandler lists the members of a room with the bytes sent to each
+func roomClientsHandler(c echo.Context) error {
+	r := lookupRoom(c.Param("id"))
+	if r == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "room not found")
+	}
+	clients := []clientUsage{}
+	r.clients.Range(func(cc *clientConn, uuid string) bool {
+		clients = append(clients, clientUsage{
+			ConnID:    cc.id,
+			UUID:      uuid,
+			Identity:  cc.identity,
+			BytesSent: cc.bytesSent.Load(),
+		})
+		return true
+	})
+	return c.JSON(http.StatusOK, map[string]any{"room": r.name, "clients": clients})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// bytesSentTo reads the bytes sent to the client registered as uuid from the
+// room clients listing
+func bytesSentTo(t *testing.T, baseURL, room, uuid string) int64 {
+	t.Helper()
+	resp := adminRequest(t, http.MethodGet, baseURL+"/api/rooms/"+room+"/clients", "secret", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list clients: status %d, want 200", resp.StatusCode)
+	}
+	var listing struct {
+		Clients []clientUsage `json:"clients"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range listing.Clients {
+		if c.UUID == uuid {
+			return c.BytesSent
+		}
+	}
+	t.Fatalf("%s is not listed", uuid)
+	return 0
+}
+
+// candidateSignal is an ICE signal from uuid padded to a known size
+func candidateSignal(uuid string, i int) string {
+	return fmt.Sprintf(`{"uuid":%q,"ice":{"candidate":"candidate:%d 1 udp 1 192.0.2.1 9 typ host","usernameFragment":%q}}`,
+		uuid, i, strings.Repeat("x", 200))
+}
+
+// TestBytesSentCounter relays a known volume of signals to a client and
+// checks the admin API reports exactly the bytes the client read, and that
+// the server total grew by at least as much
+func TestBytesSentCounter(t *testing.T) {
+	_, wsURL, baseURL := startAdminServer(t, "secret")
+	const room, signals = "metered", 20
+
+	// The counted client tallies every message, its welcome included
+	counted, _, err := websocket.DefaultDialer.Dial(wsURL+"/"+room, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { counted.Close() })
+	var read, relayed atomic.Int64
+	go func() {
+		for {
+			_, message, err := counted.ReadMessage()
+			if err != nil {
+				return
+			}
+			read.Add(int64(len(message)))
+			var env envelope
+			if json.Unmarshal(message, &env) == nil && env.UUID == "sender" && len(env.ICE) > 0 {
+				relayed.Add(1)
+			}
+		}
+	}()
+	register(t, counted, "counted")
+	sender := dialTest(t, wsURL+"/"+room)
+	register(t, sender, "sender")
+	waitFor(t, "both clients to register", func() bool {
+		r := lookupRoom(room)
+		return r != nil && r.clients.Len() == 2
+	})
+
+	totalBefore := metrics.bytesSent.Load()
+	for i := range signals {
+		if err := sender.WriteMessage(websocket.TextMessage, []byte(candidateSignal("sender", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "every signal to be relayed", func() bool { return relayed.Load() == signals })
+
+	// Counting follows the write, so the counter catches up with the reads
+	deadline := time.Now().Add(time.Second)
+	for {
+		sent, got := bytesSentTo(t, baseURL, room, "counted"), read.Load()
+		if sent == got {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d bytes sent, the client read %d", sent, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if grown, want := metrics.bytesSent.Load()-totalBefore, int64(signals*len(candidateSignal("sender", 0))); grown < want {
+		t.Fatalf("server total grew by %d bytes for %d signals, want at least %d", grown, signals, want)
+	}
+}
+
+// TestSendQuota relays signals to a client until it goes over -send-quota
+// and checks it is disconnected with the quota as the reason
+func TestSendQuota(t *testing.T) {
+	previous := *sendQuota
+	*sendQuota = 2000
+	t.Cleanup(func() { *sendQuota = previous })
+
+	_, wsURL := startTestServer(t)
+	limited := dialTest(t, wsURL+"/quota")
+	register(t, limited, "limited")
+	sender := dialTest(t, wsURL+"/quota")
+	register(t, sender, "sender")
+
+	for i := range 20 {
+		if err := sender.WriteMessage(websocket.TextMessage, []byte(candidateSignal("sender", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limited.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := limited.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != quotaExceededReason {
+			t.Fatalf("read error %v, want a close for the send quota", err)
+		}
+		break
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net"
+	"strings"
+)
+
+// Placeholders substituted for redacted values
+const (
+	redactedIP          = "<ip>"
+	redactedFingerprint = "<fingerprint>"
+	redactedSecret      = "<redacted>"
+)
+
+var redactSignals = flag.Bool("redact-sdp", false, "Mask IP addresses, DTLS fingerprints and ICE passwords when logging signals")
+
+// redactSDP returns s with addresses, fingerprints and ICE passwords replaced
+// by placeholders. Every line is kept so the structure stays readable.
+func redactSDP(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line, cr := strings.CutSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "a=fingerprint:"):
+			// a=fingerprint:<hash> <value>
+			if hash, _, ok := strings.Cut(line, " "); ok {
+				line = hash + " " + redactedFingerprint
+			}
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + redactedSecret
+		case strings.HasPrefix(line, "a=candidate:"), strings.HasPrefix(line, "candidate:"),
+			strings.HasPrefix(line, "c="), strings.HasPrefix(line, "o="), strings.HasPrefix(line, "a=rtcp:"):
+			line = redactIPs(line)
+		}
+		if cr {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactIPs replaces every space-separated token that is a specified IP address
+func redactIPs(line string) string {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if ip := net.ParseIP(field); ip != nil && !ip.IsUnspecified() {
+			fields[i] = redactedIP
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// loggableMessage returns a signal as it should appear in the log. With
+// -redact-sdp it masks the SDP and ICE candidate inside JSON signals;
+// anything it can't parse is replaced entirely rather than leaked.
+func loggableMessage(message []byte) string {
+	if !*redactSignals {
+		return string(message)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return redactedSecret
+	}
+	redactField(fields, "sdp", "sdp")
+	redactField(fields, "ice", "candidate")
+	if batch, ok := fields["ice"].([]any); ok {
+		// Candidate batches carry a list of candidates
+		for _, entry := range batch {
+			if candidate, ok := entry.(map[string]any); ok {
+				if value, ok := candidate["candidate"].(string); ok {
+					candidate["candidate"] = redactSDP(value)
+				}
+			}
+		}
+	}
+
+	// Keep the placeholders' angle brackets readable rather than \u003c-escaped
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return redactedSecret
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// redactField redacts the string at fields[outer][inner] in place, if present
+func redactField(fields map[string]any, outer, inner string) {
+	nested, ok := fields[outer].(map[string]any)
+	if !ok {
+		return
+	}
+	if value, ok := nested[inner].(string); ok {
+		nested[inner] = redactSDP(value)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testSDP has an address, fingerprint or ICE password on most lines
+const testSDP = "v=0\r\n" +
+	"o=- 4215775240449105457 2 IN IP4 203.0.113.5\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtcp:9 IN IP6 2001:db8::7\r\n" +
+	"a=ice-ufrag:EsAw\r\n" +
+	"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+	"a=fingerprint:sha-256 19:E2:1C:3B:4B:9F:81:E6:B8:5C:F4:A5:A8:D8:73:04:BB:05:2F:70:9F:04:A9:0E:05:E9:26:33:E8:70:88:A2\r\n" +
+	"a=candidate:1 1 udp 2130706431 192.168.1.20 54400 typ host\r\n" +
+	"a=candidate:2 1 udp 1694498815 203.0.113.7 61000 typ srflx raddr 192.168.1.20 rport 54400\r\n"
+
+// TestRedactSDP checks addresses, the fingerprint and the ICE password are
+// masked while every line, and what isn't sensitive, is kept
+func TestRedactSDP(t *testing.T) {
+	redacted := redactSDP(testSDP)
+	for _, secret := range []string{"203.0.113.5", "203.0.113.7", "192.168.1.20", "2001:db8::7", "19:E2:1C", "P2uYro0UCOQ4zxjKXaWCBui1"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("redacted SDP still contains %s", secret)
+		}
+	}
+	for _, kept := range []string{
+		"a=fingerprint:sha-256 " + redactedFingerprint + "\r\n",
+		"a=ice-pwd:" + redactedSecret + "\r\n",
+		"a=candidate:2 1 udp 1694498815 " + redactedIP + " 61000 typ srflx raddr " + redactedIP + " rport 54400\r\n",
+		"c=IN IP4 0.0.0.0\r\n", // Unspecified addresses reveal nothing
+		"a=ice-ufrag:EsAw\r\n",
+	} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("redacted SDP lacks %q", kept)
+		}
+	}
+	if got, want := strings.Count(redacted, "\r\n"), strings.Count(testSDP, "\r\n"); got != want {
+		t.Errorf("redacted SDP has %d lines, want %d", got, want)
+	}
+}
+
+// TestLoggableMessage checks -redact-sdp masks the SDP and candidates inside
+// signals, and replaces a message it can't parse altogether
+func TestLoggableMessage(t *testing.T) {
+	previous := *redactSignals
+	t.Cleanup(func() { *redactSignals = previous })
+
+	offer, _ := json.Marshal(map[string]any{"uuid": "a", "sdp": map[string]string{"type": "offer", "sdp": testSDP}})
+	batch := `{"type":"candidates","ice":[{"candidate":"candidate:1 1 udp 2130706431 192.168.1.20 54400 typ host"}]}`
+
+	*redactSignals = false
+	if got := loggableMessage(offer); got != string(offer) {
+		t.Fatal("message changed with redaction off")
+	}
+
+	*redactSignals = true
+	for _, message := range [][]byte{offer, []byte(batch)} {
+		got := loggableMessage(message)
+		if strings.Contains(got, "192.168.1.20") || !strings.Contains(got, redactedIP) {
+			t.Errorf("logged %s, want its addresses masked", got)
+		}
+	}
+	if got := loggableMessage([]byte(`not json 192.168.1.20`)); got != redactedSecret {
+		t.Errorf("logged %q for an unparseable message, want %q", got, redactedSecret)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry tracks connected clients and the UUID each one announced.
+// Implementations must be safe for concurrent use.
+type Registry interface {
+	// Add registers a newly connected client
+	Add(cc *clientConn)
+	// Remove unregisters a client, returning its UUID and whether it was registered
+	Remove(cc *clientConn) (uuid string, ok bool)
+	// ClaimUUID records uuid as the client's if the client has none yet and no
+	// other client holds uuid, reporting whether it was recorded. The check
+	// and the claim are one step, so two clients can't both win a UUID.
+	ClaimUUID(cc *clientConn, uuid string) bool
+	// UUID returns the client's announced UUID, or "" if none
+	UUID(cc *clientConn) string
+	// Lookup returns the client that announced uuid
+	Lookup(uuid string) (*clientConn, bool)
+	// Range calls fn for each client until fn returns false. fn must not modify the registry.
+	Range(fn func(cc *clientConn, uuid string) bool)
+	// Len returns the number of registered clients
+	Len() int
+}
+
+// newRegistry returns the registry implementation selected by name
+func newRegistry(kind string) (Registry, error) {
+	switch kind {
+	case "mutex":
+		return newMutexRegistry(), nil
+	case "syncmap":
+		return &syncMapRegistry{}, nil
+	default:
+		return nil, fmt.Errorf("unknown registry %q (want mutex or syncmap)", kind)
+	}
+}
+
+// mutexRegistry is a pair of maps guarded by a sync.RWMutex
+type mutexRegistry struct {
+	mu      sync.RWMutex
+	clients map[*clientConn]string
+	byUUID  map[string]*clientConn
+}
+
+func newMutexRegistry() *mutexRegistry {
+	return &mutexRegistry{clients: make(map[*clientConn]string), byUUID: make(map[string]*clientConn)}
+}
+
+func (r *mutexRegistry) Add(cc *clientConn) {
+	r.mu.Lock()
+	r.clients[cc] = ""
+	r.mu.Unlock()
+}
+
+func (r *mutexRegistry) Remove(cc *clientConn) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uuid, ok := r.clients[cc]
+	delete(r.clients, cc)
+	if r.byUUID[uuid] == cc {
+		delete(r.byUUID, uuid)
+	}
+	return uuid, ok
+}
+
+func (r *mutexRegistry) ClaimUUID(cc *clientConn, uuid string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.clients[cc]
+	if !ok || current != "" {
+		return false
+	}
+	if _, taken := r.byUUID[uuid]; taken {
+		return false
+	}
+	r.clients[cc] = uuid
+	r.byUUID[uuid] = cc
+	return true
+}
+
+func (r *mutexRegistry) UUID(cc *clientConn) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clients[cc]
+}
+
+func (r *mutexRegistry) Lookup(uuid string) (*clientConn, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cc, ok := r.byUUID[uuid]
+	return cc, ok
+}
+
+func (r *mutexRegistry) Range(fn func(cc *clientConn, uuid string) bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for cc, uuid := range r.clients {
+		if !fn(cc, uuid) {
+			return
+		}
+	}
+}
+
+func (r *mutexRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// syncMapRegistry is a lock-free registry built on sync.Map, suited to high connection churn
+type syncMapRegistry struct {
+	clients sync.Map // *clientConn -> *registryEntry
+	byUUID  sync.Map // string -> *clientConn
+	count   atomic.Int64
+}
+
+// registryEntry holds a client's UUID so it can be set once without locking
+type registryEntry struct {
+	uuid atomic.Pointer[string]
+}
+
+func (e *registryEntry) load() string {
+	if uuid := e.uuid.Load(); uuid != nil {
+		return *uuid
+	}
+	return ""
+}
+
+func (r *syncMapRegistry) Add(cc *clientConn) {
+	if _, loaded := r.clients.LoadOrStore(cc, &registryEntry{}); !loaded {
+		r.count.Add(1)
+	}
+}
+
+func (r *syncMapRegistry) Remove(cc *clientConn) (string, bool) {
+	value, ok := r.clients.LoadAndDelete(cc)
+	if !ok {
+		return "", false
+	}
+	r.count.Add(-1)
+	uuid := value.(*registryEntry).load()
+	r.byUUID.CompareAndDelete(uuid, cc)
+	return uuid, true
+}
+
+func (r *syncMapRegistry) ClaimUUID(cc *clientConn, uuid string) bool {
+	value, ok := r.clients.Load(cc)
+	if !ok {
+		return false
+	}
+	if holder, loaded := r.byUUID.LoadOrStore(uuid, cc); loaded && holder != cc {
+		return false
+	}
+	if !value.(*registryEntry).uuid.CompareAndSwap(nil, &uuid) {
+		r.byUUID.CompareAndDelete(uuid, cc)
+		return false
+	}
+	// A Remove that ran before the UUID was set couldn't drop it from byUUID
+	if _, ok := r.clients.Load(cc); !ok {
+		r.byUUID.CompareAndDelete(uuid, cc)
+		return false
+	}
+	return true
+}
+
+func (r *syncMapRegistry) UUID(cc *clientConn) string {
+	value, ok := r.clients.Load(cc)
+	if !ok {
+		return ""
+	}
+	return value.(*registryEntry).load()
+}
+
+func (r *syncMapRegistry) Lookup(uuid string) (*clientConn, bool) {
+	value, ok := r.byUUID.Load(uuid)
+	if !ok {
+		return nil, false
+	}
+	return value.(*clientConn), true
+}
+
+func (r *syncMapRegistry) Range(fn func(cc *clientConn, uuid string) bool) {
+	r.clients.Range(func(key, value any) bool {
+		return fn(key.(*clientConn), value.(*registryEntry).load())
+	})
+}
+
+func (r *syncMapRegistry) Len() int {
+	return int(r.count.Load())
+}
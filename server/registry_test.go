@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// registryKinds are the implementations selectable with -registry
+var registryKinds = []string{"mutex", "syncmap"}
+
+func mustRegistry(tb testing.TB, kind string) Registry {
+	tb.Helper()
+	r, err := newRegistry(kind)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+func TestRegistryBasics(t *testing.T) {
+	for _, kind := range registryKinds {
+		t.Run(kind, func(t *testing.T) {
+			r := mustRegistry(t, kind)
+			a, b := &clientConn{}, &clientConn{}
+			r.Add(a)
+			r.Add(b)
+			if r.Len() != 2 {
+				t.Fatalf("Len = %d, want 2", r.Len())
+			}
+			if !r.ClaimUUID(a, "a") {
+				t.Fatal("ClaimUUID failed on a client without a UUID")
+			}
+			if r.ClaimUUID(a, "again") {
+				t.Fatal("ClaimUUID replaced an existing UUID")
+			}
+			if r.ClaimUUID(b, "a") {
+				t.Fatal("ClaimUUID gave b the UUID a holds")
+			}
+			if got, ok := r.Lookup("a"); !ok || got != a {
+				t.Fatalf("Lookup(a) = %p, %v; want %p", got, ok, a)
+			}
+			if uuid, ok := r.Remove(a); !ok || uuid != "a" {
+				t.Fatalf("Remove(a) = %q, %v", uuid, ok)
+			}
+			if _, ok := r.Lookup("a"); ok {
+				t.Fatal("Lookup found a removed client")
+			}
+			if _, ok := r.Remove(a); ok {
+				t.Fatal("Remove reported a client removed twice")
+			}
+			if r.ClaimUUID(a, "a") {
+				t.Fatal("ClaimUUID succeeded on a removed client")
+			}
+			if r.Len() != 1 || r.UUID(b) != "" {
+				t.Fatalf("Len = %d, UUID(b) = %q", r.Len(), r.UUID(b))
+			}
+		})
+	}
+}
+
+// TestRegistryConcurrent churns clients from many goroutines while others
+// range over the registry. Run it with -race.
+func TestRegistryConcurrent(t *testing.T) {
+	const workers, perWorker = 8, 200
+	for _, kind := range registryKinds {
+		t.Run(kind, func(t *testing.T) {
+			r := mustRegistry(t, kind)
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			for range 2 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						n := 0
+						r.Range(func(cc *clientConn, uuid string) bool {
+							n++
+							return true
+						})
+						r.Len()
+					}
+				}()
+			}
+
+			var churn sync.WaitGroup
+			for w := range workers {
+				churn.Add(1)
+				go func() {
+					defer churn.Done()
+					for i := range perWorker {
+						cc := &clientConn{}
+						uuid := fmt.Sprintf("%d-%d", w, i)
+						r.Add(cc)
+						if !r.ClaimUUID(cc, uuid) {
+							t.Errorf("ClaimUUID(%s) failed", uuid)
+						}
+						if got, ok := r.Lookup(uuid); !ok || got != cc {
+							t.Errorf("Lookup(%s) missed its client", uuid)
+						}
+						if i%2 == 0 {
+							if got, ok := r.Remove(cc); !ok || got != uuid {
+								t.Errorf("Remove = %q, %v; want %s", got, ok, uuid)
+							}
+						}
+					}
+				}()
+			}
+			churn.Wait()
+			close(stop)
+			wg.Wait()
+
+			if want := workers * perWorker / 2; r.Len() != want {
+				t.Fatalf("Len = %d, want %d", r.Len(), want)
+			}
+		})
+	}
+}
+
+// TestRegistryClaimRace has many clients claim one UUID at once; exactly one
+// may win it. Run it with -race.
+func TestRegistryClaimRace(t *testing.T) {
+	const clients, rounds = 16, 100
+	for _, kind := range registryKinds {
+		t.Run(kind, func(t *testing.T) {
+			for round := range rounds {
+				r := mustRegistry(t, kind)
+				uuid := fmt.Sprint(round)
+				ccs := make([]*clientConn, clients)
+				for i := range ccs {
+					ccs[i] = &clientConn{}
+					r.Add(ccs[i])
+				}
+
+				var wg sync.WaitGroup
+				var mu sync.Mutex
+				var winners []*clientConn
+				for _, cc := range ccs {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if r.ClaimUUID(cc, uuid) {
+							mu.Lock()
+							winners = append(winners, cc)
+							mu.Unlock()
+						}
+					}()
+				}
+				wg.Wait()
+
+				if len(winners) != 1 {
+					t.Fatalf("round %d: %d clients claimed the UUID, want 1", round, len(winners))
+				}
+				if got, ok := r.Lookup(uuid); !ok || got != winners[0] {
+					t.Fatalf("round %d: Lookup = %p, want the winner %p", round, got, winners[0])
+				}
+				for _, cc := range ccs {
+					if cc != winners[0] && r.UUID(cc) != "" {
+						t.Fatalf("round %d: a losing client holds UUID %q", round, r.UUID(cc))
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRegistry compares the implementations under parallel churn with
+// concurrent lookups, the pattern of clients joining while signals are routed
+func BenchmarkRegistry(b *testing.B) {
+	for _, kind := range registryKinds {
+		b.Run(kind, func(b *testing.B) {
+			r := mustRegistry(b, kind)
+			for i := range 100 {
+				cc := &clientConn{}
+				r.Add(cc)
+				r.ClaimUUID(cc, fmt.Sprintf("resident-%d", i))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%4 == 0 {
+						cc := &clientConn{}
+						r.Add(cc)
+						r.ClaimUUID(cc, fmt.Sprintf("%p", cc))
+						r.Remove(cc)
+					} else {
+						r.Lookup(fmt.Sprintf("resident-%d", i%100))
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	instanceID = flag.String("instance-id", "", "Name of this server instance on the relay bus (empty picks a random one)")
+	relayTTL   = flag.Int("relay-ttl", 4, "Server instances a relayed signal may pass through before it is dropped")
+	relayBus   = flag.String("relay-bus", "", "Bus relaying signals between server instances: memory, or empty to relay nothing")
+)
+
+// relaySeenWindow is how long an instance remembers the IDs of relayed
+// signals it has handled, so copies arriving by another path are dropped
+const relaySeenWindow = time.Minute
+
+// Bus carries signals between server instances of one deployment, such as a
+// Redis channel. memoryBus connects instances within one process.
+type Bus interface {
+	// Publish sends a signal to the instances on the bus. It may be handed
+	// back to the publisher too, which ignores its own signals.
+	Publish(signal relayedSignal) error
+	// Subscribe calls fn for every signal published on the bus
+	Subscribe(fn func(signal relayedSignal))
+}
+
+// localRelay joins this instance to the relay bus, or is nil without one
+var localRelay *relay
+
+// newBus returns the bus named by -relay-bus, or nil for none
+func newBus(kind string) (Bus, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "memory":
+		return newMemoryBus(), nil
+	default:
+		return nil, fmt.Errorf("unknown relay bus %q (want memory or empty)", kind)
+	}
+}
+
+// relayedSignal wraps a client message travelling between instances
+type relayedSignal struct {
+	ID       string          `json:"id"`           // Unique per signal, kept when it is forwarded
+	Origin   string          `json:"origin"`       // Instance the sending client is connected to
+	Room     string          `json:"room"`         // Room the sending client is in
+	To       string          `json:"to,omitempty"` // Recipient UUID; empty for the whole room
+	From     string          `json:"from"`         // Instance that last forwarded the signal
+	TTL      int             `json:"ttl"`          // Forwards left before the signal is dropped
+	Critical bool            `json:"critical,omitempty"`
+	Message  json.RawMessage `json:"message"`
+}
+
+// memoryBus is a Bus whose instances share a process. Every published signal
+// is handed to every subscriber, the publisher included, before Publish returns.
+type memoryBus struct {
+	mu          sync.Mutex
+	subscribers []func(signal relayedSignal)
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{}
+}
+
+func (b *memoryBus) Publish(signal relayedSignal) error {
+	b.mu.Lock()
+	subscribers := b.subscribers
+	b.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(signal)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(fn func(signal relayedSignal)) {
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers[:len(b.subscribers):len(b.subscribers)], fn)
+	b.mu.Unlock()
+}
+
+// relay is one instance's end of a bus
+type relay struct {
+	id  string
+	bus Bus
+	// deliver hands a signal to this instance's clients, reporting whether
+	// its recipient is connected here
+	deliver func(signal relayedSignal) bool
+
+	mu    sync.Mutex
+	seen  map[string]time.Time // Signal ID to when it was first handled
+	swept time.Time
+}
+
+func newRelay(id string, bus Bus, deliver func(signal relayedSignal) bool) *relay {
+	return &relay{id: id, bus: bus, deliver: deliver, seen: map[string]time.Time{}}
+}
+
+// startRelay names this instance, joins it to bus and starts delivering
+// relayed signals locally
+func startRelay(bus Bus) {
+	if *instanceID == "" {
+		*instanceID = newConnID()
+	}
+	log.Printf("Relaying signals as instance %s", *instanceID)
+	localRelay = newRelay(*instanceID, bus, deliverRelayed)
+	bus.Subscribe(localRelay.receive)
+}
+
+// relaySignal publishes a message from a local client in room, addressed to
+// the client to or to everyone when to is empty, to the other instances. The
+// message is copied, since it may be in a pooled buffer.
+func relaySignal(room, to string, message []byte, critical bool) {
+	if localRelay != nil {
+		localRelay.publish(room, to, bytes.Clone(message), critical)
+	}
+}
+
+func (r *relay) publish(room, to string, message []byte, critical bool) {
+	signal := relayedSignal{
+		ID:       newConnID(),
+		Origin:   r.id,
+		Room:     room,
+		To:       to,
+		From:     r.id,
+		TTL:      *relayTTL,
+		Critical: critical,
+		Message:  message,
+	}
+	r.firstSeen(signal.ID)
+	if err := r.bus.Publish(signal); err != nil {
+		log.Printf("relay publish error: %v", err)
+	}
+}
+
+// receive delivers a signal from another instance and forwards it on with one
+// hop fewer, unless its recipient was found here. Signals this instance sent
+// or already handled, and those out of hops, stop here, so a bus that echoes
+// or loops signals delivers each once.
+func (r *relay) receive(signal relayedSignal) {
+	if signal.From == r.id {
+		return // Our own signal, handed back by the bus
+	}
+	if !r.firstSeen(signal.ID) {
+		return // A copy that came by another path
+	}
+	if signal.Origin == r.id {
+		log.Printf("Dropping relayed signal that looped back from instance %s", signal.From)
+		return
+	}
+	if signal.TTL <= 0 {
+		log.Printf("Dropping relayed signal from instance %s: TTL expired", signal.Origin)
+		return
+	}
+	if r.deliver(signal) {
+		return
+	}
+
+	signal.TTL--
+	if signal.TTL == 0 {
+		return
+	}
+	signal.From = r.id
+	if err := r.bus.Publish(signal); err != nil {
+		log.Printf("relay forward error: %v", err)
+	}
+}
+
+// firstSeen records a signal ID, reporting whether it is new within
+// relaySeenWindow. Older IDs are swept out once per window.
+func (r *relay) firstSeen(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.swept) > relaySeenWindow {
+		for seenID, at := range r.seen {
+			if now.Sub(at) > relaySeenWindow {
+				delete(r.seen, seenID)
+			}
+		}
+		r.swept = now
+	}
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+	r.seen[id] = now
+	return true
+}
+
+// deliverRelayed hands a relayed signal to its recipient or the local members
+// of its room, reporting whether the recipient is connected here
+func deliverRelayed(signal relayedSignal) bool {
+	r := lookupRoom(signal.Room)
+	if r == nil {
+		return false
+	}
+	if signal.To == "" {
+		broadcastMessage(r, nil, signal.Message, signal.Critical)
+		return false
+	}
+	cc, ok := r.clients.Lookup(signal.To)
+	if !ok {
+		return false
+	}
+	if err := cc.send(signal.Message, signal.Critical); err != nil {
+		cc.logf("send error: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testInstance is one server instance on a test bus, counting the signals it
+// delivers to its clients
+type testInstance struct {
+	*relay
+	delivered int
+	hosts     string // UUID of the one client connected here
+}
+
+func newTestInstances(bus Bus, n int) []*testInstance {
+	instances := make([]*testInstance, n)
+	for i := range instances {
+		inst := &testInstance{hosts: fmt.Sprintf("client-%d", i)}
+		inst.relay = newRelay(fmt.Sprintf("instance-%d", i), bus, func(signal relayedSignal) bool {
+			inst.delivered++
+			return signal.To == inst.hosts
+		})
+		bus.Subscribe(inst.receive)
+		instances[i] = inst
+	}
+	return instances
+}
+
+// TestRelayDeliversOnce checks that a room broadcast reaches every other
+// instance exactly once, though each instance forwards what it receives
+func TestRelayDeliversOnce(t *testing.T) {
+	for _, n := range []int{2, 3, 5} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			instances := newTestInstances(newMemoryBus(), n)
+			instances[0].publish("room", "", []byte(`{}`), false)
+
+			if instances[0].delivered != 0 {
+				t.Errorf("origin delivered its own signal %d times", instances[0].delivered)
+			}
+			for _, inst := range instances[1:] {
+				if inst.delivered != 1 {
+					t.Errorf("%s delivered %d times, want 1", inst.id, inst.delivered)
+				}
+			}
+		})
+	}
+}
+
+// TestRelayAddressed checks that a signal for one client is delivered where
+// that client is connected and nowhere twice
+func TestRelayAddressed(t *testing.T) {
+	instances := newTestInstances(newMemoryBus(), 3)
+	instances[0].publish("room", instances[2].hosts, []byte(`{}`), true)
+
+	for _, inst := range instances[1:] {
+		if inst.delivered != 1 {
+			t.Errorf("%s delivered %d times, want 1", inst.id, inst.delivered)
+		}
+	}
+}
+
+// TestRelayDropsLoops feeds an instance signals a misconfigured bus could
+// carry back to it
+func TestRelayDropsLoops(t *testing.T) {
+	inst := newTestInstances(newMemoryBus(), 1)[0]
+	for _, signal := range []relayedSignal{
+		{ID: "own", Origin: inst.id, From: inst.id, TTL: 4},
+		{ID: "looped", Origin: inst.id, From: "elsewhere", TTL: 4},
+		{ID: "expired", Origin: "elsewhere", From: "elsewhere", TTL: 0},
+	} {
+		inst.receive(signal)
+		if inst.delivered != 0 {
+			t.Fatalf("signal %s was delivered", signal.ID)
+		}
+	}
+
+	repeated := relayedSignal{ID: "repeated", Origin: "elsewhere", From: "elsewhere", TTL: 4}
+	inst.receive(repeated)
+	repeated.From = "another"
+	inst.receive(repeated)
+	if inst.delivered != 1 {
+		t.Fatalf("repeated signal delivered %d times, want 1", inst.delivered)
+	}
+}
+
+func TestNewBus(t *testing.T) {
+	if bus, err := newBus(""); bus != nil || err != nil {
+		t.Errorf("newBus(\"\") = %v, %v; want no bus", bus, err)
+	}
+	if bus, err := newBus("memory"); err != nil {
+		t.Errorf("newBus(memory) error: %v", err)
+	} else if _, ok := bus.(*memoryBus); !ok {
+		t.Errorf("newBus(memory) = %T, want *memoryBus", bus)
+	}
+	if _, err := newBus("redis"); err == nil {
+		t.Error("newBus accepted an unknown bus")
+	}
+}
+
+// TestStartRelay joins this instance to a memory bus, as -relay-bus memory
+// does, and checks that a signal another instance publishes for a local
+// client reaches it
+func TestStartRelay(t *testing.T) {
+	_, url := startTestServer(t)
+	ws := dialTest(t, url+"/relayed")
+	register(t, ws, "target")
+	readUntil(t, ws, func(env envelope) bool { return env.Type == "peers" })
+
+	id := *instanceID
+	t.Cleanup(func() {
+		localRelay = nil
+		*instanceID = id
+	})
+	bus, _ := newBus("memory")
+	startRelay(bus)
+
+	bus.Publish(relayedSignal{
+		ID:       "from-elsewhere",
+		Origin:   "elsewhere",
+		From:     "elsewhere",
+		Room:     "relayed",
+		To:       "target",
+		TTL:      4,
+		Critical: true,
+		Message:  []byte(`{"uuid":"remote","sdp":{"type":"offer","sdp":""}}`),
+	})
+	if offer := readUntil(t, ws, isSignal); offer.UUID != "remote" {
+		t.Fatalf("got %+v, want the relayed offer", offer)
+	}
+}
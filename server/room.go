@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// room is one signaling session. Clients only exchange signals with the
+// members of their own room, so separate calls on one server don't collide.
+type room struct {
+	name    string
+	clients Registry // Members of the room
+	mesh    *meshTopology
+	offers  offerCache // Offers waiting for an answer, for late joiners
+}
+
+var (
+	// rooms holds every room with at least one member, guarded by membershipMu.
+	// Rooms are created by their first member and forgotten with their last.
+	rooms = map[string]*room{}
+
+	// newRoomRegistry makes the registry of each new room, chosen by -registry
+	// in main; until then the default mutex registry
+	newRoomRegistry = func() Registry { return newMutexRegistry() }
+)
+
+// roomNamePattern limits room names to something safe to log and put in URLs
+var roomNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateRoomName rejects names that can't be used as a room
+func validateRoomName(name string) error {
+	if !roomNamePattern.MatchString(name) {
+		return errors.New("room names are 1-64 letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+// joinRoom adds cc to the named room, creating the room if needed. It fails
+// if the room's access rules turn cc away.
+func joinRoom(name string, cc *clientConn) (*room, error) {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	access := roomAccessFor(name)
+	if !access.admits(cc.identity) {
+		return nil, errIdentityForbidden
+	}
+	r := rooms[name]
+	if r != nil && access.MaxClients > 0 && r.clients.Len() >= access.MaxClients {
+		return nil, errRoomFull
+	}
+	if r == nil {
+		r = &room{name: name, clients: newRoomRegistry(), mesh: newMeshTopology()}
+		rooms[name] = r
+		publishOps(opsEvent{Type: opsRoomOpened, Room: name})
+	}
+	r.clients.Add(cc)
+	cc.room = r
+	cc.addLogFields("room", name)
+	return r, nil
+}
+
+// lookupRoom returns the named room, or nil if it has no members
+func lookupRoom(name string) *room {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	return rooms[name]
+}
+
+// dropEmptyRoom forgets r once its last member has left
+func dropEmptyRoom(r *room) {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	dropEmptyRoomLocked(r)
+}
+
+func dropEmptyRoomLocked(r *room) {
+	if r.clients.Len() == 0 && rooms[r.name] == r {
+		delete(rooms, r.name)
+		publishOps(opsEvent{Type: opsRoomClosed, Room: r.name})
+	}
+}
+
+// connectedClients counts the members of every room
+func connectedClients() int {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	n := 0
+	for _, r := range rooms {
+		n += r.clients.Len()
+	}
+	return n
+}
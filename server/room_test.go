@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// register announces uuid on ws
+func register(t *testing.T, ws *websocket.Conn, uuid string) {
+	t.Helper()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"register","uuid":"`+uuid+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// isSignal matches SDP and ICE messages
+func isSignal(env envelope) bool {
+	return len(env.SDP) > 0 || len(env.ICE) > 0
+}
+
+// expectNoSignal fails if ws receives an SDP or ICE message from the client
+// from within wait
+func expectNoSignal(t *testing.T, ws *websocket.Conn, from string, wait time.Duration) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(wait))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var env envelope
+		if json.Unmarshal(message, &env) == nil && isSignal(env) && env.UUID == from {
+			t.Fatalf("got a signal from another room: %s", message)
+		}
+	}
+}
+
+// TestRoomIsolation joins two clients to one room and a third to another,
+// and checks that SDP and ICE stay within their room and that the room is
+// forgotten once its last member leaves
+func TestRoomIsolation(t *testing.T) {
+	_, url := startTestServer(t)
+	a1 := dialTest(t, url+"/isolation-a")
+	a2 := dialTest(t, url+"/isolation-a")
+	b := dialTest(t, url+"/isolation-b")
+	register(t, a1, "a1")
+	register(t, a2, "a2")
+	register(t, b, "b")
+
+	for _, signal := range []string{
+		`{"uuid":"a1","sdp":{"type":"offer","sdp":""}}`,
+		`{"uuid":"a1","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`,
+	} {
+		if err := a1.WriteMessage(websocket.TextMessage, []byte(signal)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if offer := readUntil(t, a2, isSignal); offer.UUID != "a1" || sdpType(offer.SDP) != "offer" {
+		t.Fatalf("a2 got %+v, want a1's offer", offer)
+	}
+	if candidate := readUntil(t, a2, isSignal); candidate.UUID != "a1" || len(candidate.ICE) == 0 {
+		t.Fatalf("a2 got %+v, want a1's candidate", candidate)
+	}
+	expectNoSignal(t, b, "a1", 200*time.Millisecond)
+
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"uuid":"b","sdp":{"type":"offer","sdp":""}}`)); err != nil {
+		t.Fatal(err)
+	}
+	expectNoSignal(t, a1, "b", 200*time.Millisecond)
+	expectNoSignal(t, a2, "b", 50*time.Millisecond)
+
+	a1.Close()
+	a2.Close()
+	deadline := time.Now().Add(time.Second)
+	for lookupRoom("isolation-a") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("room isolation-a outlived its last member")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lookupRoom("isolation-b") == nil {
+		t.Fatal("room isolation-b was dropped while b is still in it")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Reasons a client is refused entry to a room
+var (
+	errRoomFull          = errors.New("room is full")
+	errIdentityForbidden = errors.New("client certificate is not allowed in this room")
+)
+
+// roomAccess limits who may join a room
+type roomAccess struct {
+	// MaxClients caps the members of the room; 0 admits any number
+	MaxClients int `json:"maxClients,omitempty"`
+	// AllowedIdentities lists the client certificate common names admitted;
+	// empty admits any client the listener accepts
+	AllowedIdentities []string `json:"allowedIdentities,omitempty"`
+}
+
+// roomConfig is the whole admin-settable configuration of a room, as read and
+// written through /api/rooms/:id/config
+type roomConfig struct {
+	roomAccess
+	Policy    codecPolicy `json:"policy"`
+	Bandwidth int64       `json:"bandwidth,omitempty"` // Total video bits per second, 0 if unlimited
+}
+
+var (
+	roomAccesses   = map[string]roomAccess{}
+	roomAccessesMu sync.RWMutex
+)
+
+// roomAccessFor returns a room's access rules; the zero rules admit anyone
+func roomAccessFor(room string) roomAccess {
+	roomAccessesMu.RLock()
+	defer roomAccessesMu.RUnlock()
+	return roomAccesses[room]
+}
+
+// setRoomAccess replaces a room's access rules
+func setRoomAccess(room string, access roomAccess) {
+	roomAccessesMu.Lock()
+	roomAccesses[room] = access
+	roomAccessesMu.Unlock()
+}
+
+// validate rejects access rules that can't be enforced
+func (a roomAccess) validate() error {
+	if a.MaxClients < 0 {
+		return errors.New("maxClients must not be negative")
+	}
+	if len(a.AllowedIdentities) > 0 && *clientCAPath == "" {
+		return errors.New("allowedIdentities needs client certificates, enabled with -client-ca")
+	}
+	return nil
+}
+
+// admits reports whether a client with the given certificate identity may join
+func (a roomAccess) admits(identity string) bool {
+	return len(a.AllowedIdentities) == 0 || slices.Contains(a.AllowedIdentities, identity)
+}
+
+// validate checks every part of the config, so none of it is applied unless
+// all of it can be
+func (c roomConfig) validate() error {
+	if err := c.roomAccess.validate(); err != nil {
+		return err
+	}
+	if err := c.Policy.validate(); err != nil {
+		return err
+	}
+	if c.Bandwidth < 0 {
+		return errors.New("bandwidth must not be negative")
+	}
+	return nil
+}
+
+// roomConfigHandler returns a room's access rules, codec policy and bandwidth budget
+func roomConfigHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, roomConfig{
+		roomAccess: roomAccessFor(room),
+		Policy:     roomPolicy(room),
+		Bandwidth:  roomBudget(room),
+	})
+}
+
+// setRoomConfigHandler replaces a room's whole configuration. The access
+// rules and codec policy apply to clients joining or signalling from then on;
+// the bandwidth budget is shared out to the current members at once.
+func setRoomConfigHandler(c echo.Context) error {
+	room := c.Param("id")
+	if err := validateRoomName(room); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var cfg roomConfig
+	if err := c.Bind(&cfg); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid room config")
+	}
+	if err := cfg.validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	setRoomAccess(room, cfg.roomAccess)
+	setRoomPolicy(room, cfg.Policy)
+	setRoomBudget(room, cfg.Bandwidth)
+	log.Printf("Room %s config set to %+v", room, cfg)
+	if r := lookupRoom(room); r != nil {
+		broadcastBitrate(r)
+	}
+	return c.JSON(http.StatusOK, cfg)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// testIdentityHeader names the client certificate identity a test client
+// claims, standing in for a verified mTLS certificate
+const testIdentityHeader = "X-Test-Identity"
+
+// withTestIdentities makes e treat the identity in testIdentityHeader as the
+// common name of a verified client certificate
+func withTestIdentities(t *testing.T, e *echo.Echo) {
+	t.Helper()
+	previous := *clientCAPath
+	*clientCAPath = "test-ca.pem"
+	t.Cleanup(func() { *clientCAPath = previous })
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if name := c.Request().Header.Get(testIdentityHeader); name != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+				c.Request().TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			return next(c)
+		}
+	})
+}
+
+// dialAs connects to url as identity, returning the connection once welcomed
+// or the close error it was turned away with
+func dialAs(t *testing.T, url, identity string) (*websocket.Conn, error) {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{testIdentityHeader: {identity}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	if _, _, err := ws.ReadMessage(); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// refusedFor reports whether err is the close a client is refused entry with
+// for reason
+func refusedFor(err, reason error) bool {
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr) && closeErr.Code == websocket.ClosePolicyViolation && closeErr.Text == reason.Error()
+}
+
+// TestRoomConfig sets a room's config through the admin API, reads it back
+// and checks joins are held to its access rules
+func TestRoomConfig(t *testing.T) {
+	e, wsURL, baseURL := startAdminServer(t, "secret")
+	withTestIdentities(t, e)
+	configURL := baseURL + "/api/rooms/configured/config"
+	t.Cleanup(func() {
+		setRoomAccess("configured", roomAccess{})
+		setRoomPolicy("configured", codecPolicy{})
+	})
+
+	if resp := adminRequest(t, http.MethodPut, configURL, "secret", `{"maxClients":-1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("negative maxClients: status %d, want 400", resp.StatusCode)
+	}
+	set := `{"maxClients":2,"allowedIdentities":["alice","bob","carol"],"policy":{"audioOnly":true}}`
+	if resp := adminRequest(t, http.MethodPut, configURL, "secret", set); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set config: status %d, want 200", resp.StatusCode)
+	}
+
+	resp := adminRequest(t, http.MethodGet, configURL, "secret", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get config: status %d, want 200", resp.StatusCode)
+	}
+	var got roomConfig
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MaxClients != 2 || !slices.Equal(got.AllowedIdentities, []string{"alice", "bob", "carol"}) || !got.Policy.AudioOnly {
+		t.Fatalf("read back %+v, want the config that was set", got)
+	}
+
+	url := wsURL + "/configured"
+	alice, err := dialAs(t, url, "alice")
+	if err != nil {
+		t.Fatalf("alice refused: %v", err)
+	}
+	if _, err := dialAs(t, url, "bob"); err != nil {
+		t.Fatalf("bob refused: %v", err)
+	}
+	if _, err := dialAs(t, url, "carol"); !refusedFor(err, errRoomFull) {
+		t.Fatalf("carol joined a full room: %v", err)
+	}
+
+	alice.Close()
+	waitFor(t, "alice to leave", func() bool {
+		r := lookupRoom("configured")
+		return r != nil && r.clients.Len() == 1
+	})
+	if _, err := dialAs(t, url, "mallory"); !refusedFor(err, errIdentityForbidden) {
+		t.Fatalf("mallory joined without being allowed: %v", err)
+	}
+	if _, err := dialAs(t, url, "carol"); err != nil {
+		t.Fatalf("carol refused once there was room: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+)
+
+// Roster events describing why membership changed
+const (
+	rosterJoined  = "joined"
+	rosterLeft    = "left"    // Client sent bye before disconnecting
+	rosterDropped = "dropped" // Connection ended without a bye
+)
+
+// rosterUpdate is sent to every client whenever membership changes
+type rosterUpdate struct {
+	Type  string   `json:"type"`
+	Event string   `json:"event"`
+	UUID  string   `json:"uuid"`
+	Peers []string `json:"peers"`
+}
+
+// removeClient unregisters cc and, if it had announced a UUID, tells the
+// rest of its room. The roster is broadcast before returning so the caller
+// only closes the socket once everyone else has been updated.
+func removeClient(cc *clientConn, event string) {
+	r := cc.room
+	uuid, _ := r.clients.Remove(cc)
+	if uuid != "" {
+		r.mesh.leave(uuid)
+		r.offers.forget(uuid)
+		broadcastRoster(r, event, uuid)
+	}
+	dropEmptyRoom(r)
+}
+
+// uuidConflict is the rejection reason for a UUID another client already uses
+const uuidConflict = "uuid-conflict"
+
+// broadcastRoster sends the current set of client UUIDs in r to its members
+func broadcastRoster(r *room, event, uuid string) {
+	peers := make([]string, 0, r.clients.Len())
+	r.clients.Range(func(_ *clientConn, id string) bool {
+		if id != "" {
+			peers = append(peers, id)
+		}
+		return true
+	})
+	sort.Strings(peers)
+
+	message, err := json.Marshal(rosterUpdate{
+		Type:  "roster",
+		Event: event,
+		UUID:  uuid,
+		Peers: peers,
+	})
+	if err != nil {
+		log.Println("roster marshal error:", err)
+		return
+	}
+	broadcastMessage(r, nil, message, true)
+	publishOps(opsEvent{Type: event, Room: r.name, UUID: uuid})
+
+	// Membership changes how the room's budget divides
+	broadcastBitrate(r)
+}
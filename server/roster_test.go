@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// nextRoster reads ws until a roster update about uuid arrives, failing
+// after wait
+func nextRoster(t *testing.T, ws *websocket.Conn, uuid string, wait time.Duration) rosterUpdate {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(wait))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("no roster update about %s: %v", uuid, err)
+		}
+		var update rosterUpdate
+		if json.Unmarshal(message, &update) == nil && update.Type == "roster" && update.UUID == uuid {
+			return update
+		}
+	}
+}
+
+// TestRosterLeftAndDropped checks a client saying bye is announced as left
+// at once, and one whose connection just ends as dropped
+func TestRosterLeftAndDropped(t *testing.T) {
+	_, url := startTestServer(t)
+	url += "/roster"
+	stay := dialTest(t, url)
+	register(t, stay, "stay")
+	leaver := dialTest(t, url)
+	register(t, leaver, "leaver")
+	dropper := dialTest(t, url)
+	register(t, dropper, "dropper")
+	if update := nextRoster(t, stay, "dropper", time.Second); update.Event != rosterJoined {
+		t.Fatalf("got %+v, want dropper joining", update)
+	}
+
+	if err := leaver.WriteMessage(websocket.TextMessage, []byte(`{"type":"bye","uuid":"leaver"}`)); err != nil {
+		t.Fatal(err)
+	}
+	update := nextRoster(t, stay, "leaver", 200*time.Millisecond)
+	if update.Event != rosterLeft || !slices.Equal(update.Peers, []string{"dropper", "stay"}) {
+		t.Fatalf("got %+v, want leaver left with dropper and stay remaining", update)
+	}
+
+	dropper.Close()
+	update = nextRoster(t, stay, "dropper", time.Second)
+	if update.Event != rosterDropped || !slices.Equal(update.Peers, []string{"stay"}) {
+		t.Fatalf("got %+v, want dropper dropped with stay remaining", update)
+	}
+}
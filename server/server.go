@@ -1,88 +1,350 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const httpsPort = "8443"
 
 var (
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all connections for simplicity
-		},
+		CheckOrigin: checkOrigin,
 	}
-	clients = make(map[*websocket.Conn]bool) // Connected clients
+
+	registryKind = flag.String("registry", "mutex", "Client registry implementation: mutex or syncmap")
 )
 
+// envelope holds the fields the server inspects on otherwise opaque signals
+type envelope struct {
+	Type   string          `json:"type,omitempty"`
+	UUID   string          `json:"uuid"`
+	To     string          `json:"to,omitempty"` // Recipient UUID; empty broadcasts to the room
+	SDP    json.RawMessage `json:"sdp,omitempty"`
+	ICE    json.RawMessage `json:"ice,omitempty"`    // A candidate, or a batch of them
+	Stream string          `json:"stream,omitempty"` // "data" for the data-only connection; empty for media
+}
+
+// websocketHandler connects a client to the room named in the URL, or to the
+// default room on plain /ws
 func websocketHandler(c echo.Context) error {
+	name := c.Param("room")
+	if name == "" {
+		name = defaultRoom
+	}
+	if err := validateRoomName(name); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	identity, err := clientIdentity(c.Request())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		log.Println("websocket upgrade error:", err)
 		return err
 	}
-	defer ws.Close()
-	
+	cc := newClientConn(ws)
+	if identity != "" {
+		cc.identity = identity
+		cc.addLogFields("identity", identity)
+	}
+	defer cc.shutdown(websocket.CloseNormalClosure, "")
+	startKeepalive(cc)
+	// The connection keeps the settings in force when it was accepted
+	cfg := config()
+	limiter := cfg.newMessageLimiter()
+
 	// Register new client
-	clients[ws] = true
-	log.Println("Client connected via websocket")
-	
+	r, err := joinRoom(name, cc)
+	if err != nil {
+		cc.logf("Refused entry to room %s: %v", name, err)
+		publishClientOps(opsRejected, cc, err.Error())
+		cc.shutdown(websocket.ClosePolicyViolation, err.Error())
+		return nil
+	}
+	metrics.connections.Add(1)
+	cc.logf("Client connected via websocket to room %s", r.name)
+	publishClientOps(opsConnected, cc, cc.identity)
+	defer publishClientOps(opsDisconnected, cc, "")
+	sendWelcome(cc, cfg)
+
 	// Handle WebSocket messages
 	for {
 		_, message, err := ws.ReadMessage()
 		if err != nil {
-			log.Println("read error:", err)
-			delete(clients, ws)
+			cc.logf("read error: %v", err)
+			removeClient(cc, rosterDropped)
 			break
 		}
-		log.Printf("Received: %s", message)
-		
-		// Broadcast the message to all clients
-		broadcastMessage(message)
+		cc.logf("Received: %s", loggableMessage(message))
+		metrics.messagesReceived.Add(1)
+		if limiter != nil && !limiter.Allow() {
+			cc.logf("Rate limit exceeded, dropping message")
+			continue
+		}
+
+		var env envelope
+		if err := json.Unmarshal(message, &env); err == nil {
+			// A UUID already held by another connection would make signals ambiguous
+			if env.UUID != "" && r.clients.UUID(cc) == "" {
+				if !r.clients.ClaimUUID(cc, env.UUID) {
+					rejectClient(cc, uuidConflict, "uuid conflict")
+					break
+				}
+				cc.addLogFields("uuid", env.UUID)
+				sendMeshTargets(cc, env.UUID)
+				broadcastRoster(r, rosterJoined, env.UUID)
+				r.offers.replay(cc, env.UUID, r.mesh.peersOf(env.UUID))
+			}
+
+			// A graceful bye updates the roster right away instead of waiting for the socket to drop
+			if env.Type == "bye" {
+				cc.logf("Client %s said bye", env.UUID)
+				removeClient(cc, rosterLeft)
+				break
+			}
+
+			// A register message only announces the UUID, which is recorded above
+			if env.Type == "register" {
+				continue
+			}
+
+			// Clock sync probes are answered directly and never forwarded
+			if env.Type == "time" {
+				replyTime(cc, message)
+				continue
+			}
+
+			// Media the room's policy forbids never reaches other clients
+			if len(env.SDP) > 0 {
+				if err := checkSignalPolicy(r.name, env.SDP); err != nil {
+					rejectClient(cc, err.Error(), "media policy violation")
+					break
+				}
+			}
+		}
+
+		// Deliver the message to its recipient, or else the rest of the room,
+		// stamped with the server clock. Offers and answers are never dropped to
+		// make room in a full queue.
+		stamped := stampPooled(message)
+		critical := len(env.SDP) > 0
+		if env.To != "" {
+			if sdpType(env.SDP) == "answer" {
+				r.offers.answered(env.To, env.Stream)
+			}
+			sendTo(r, env.To, stamped, critical)
+		} else {
+			r.offers.observe(r.clients.UUID(cc), &env, stamped.data)
+			broadcastPooled(r, cc, stamped, critical)
+			relaySignal(r.name, "", stamped.data, critical)
+		}
+		stamped.release()
 	}
 	return nil
 }
 
-// Broadcast message to all connected clients
-func broadcastMessage(message []byte) {
-	for client := range clients {
-		err := client.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Println("write error:", err)
-			client.Close()
-			delete(clients, client)
+// welcomeMessage is the first message on every connection, carrying its ID
+type welcomeMessage struct {
+	Type       string      `json:"type"` // Always "welcome"
+	UUID       string      `json:"uuid"`
+	ConnID     string      `json:"connId"`
+	ICEServers []iceServer `json:"iceServers,omitempty"`
+}
+
+// sendWelcome tells a new client its connection ID, so both sides can tag
+// their logs with it, and the ICE servers it should use
+func sendWelcome(cc *clientConn, cfg *serverConfig) {
+	message, err := json.Marshal(welcomeMessage{Type: "welcome", UUID: "server", ConnID: cc.id, ICEServers: cfg.ICEServers})
+	if err != nil {
+		cc.logf("welcome marshal error: %v", err)
+		return
+	}
+	if err := cc.send(message, true); err != nil {
+		cc.logf("welcome send error: %v", err)
+	}
+}
+
+// Broadcast message to every member of r except sender, which is nil for
+// messages the server originates. Critical messages are kept when a client's
+// send queue overflows. The message is shared by every queue without being
+// copied, so callers must not modify it afterwards.
+func broadcastMessage(r *room, sender *clientConn, message []byte, critical bool) {
+	broadcast(r, sender, outbound{data: message, critical: critical})
+}
+
+// broadcastPooled is broadcastMessage for a pooled message, which each queue
+// keeps a reference to until its client has been sent it
+func broadcastPooled(r *room, sender *clientConn, m *pooledMessage, critical bool) {
+	broadcast(r, sender, outbound{data: m.data, critical: critical, pooled: m})
+}
+
+// broadcast queues msg for every member of r except sender
+func broadcast(r *room, sender *clientConn, msg outbound) {
+	start := time.Now()
+	defer func() { broadcastFanout.Observe(time.Since(start).Seconds()) }()
+	r.clients.Range(func(cc *clientConn, _ string) bool {
+		if cc == sender {
+			return true
+		}
+		if err := cc.enqueue(msg); err != nil {
+			cc.logf("send error: %v", err)
+		} else {
+			metrics.messagesSent.Add(1)
+		}
+		return true
+	})
+}
+
+// sendTo delivers m to the member of r that announced uuid. A recipient not
+// connected here is looked for on the other instances, if relaying is on;
+// otherwise the message is dropped.
+func sendTo(r *room, uuid string, m *pooledMessage, critical bool) {
+	cc, ok := r.clients.Lookup(uuid)
+	if !ok {
+		if localRelay != nil {
+			relaySignal(r.name, uuid, m.data, critical)
+			return
 		}
+		log.Printf("No client %s in room %s, dropping message", uuid, r.name)
+		return
+	}
+	if err := cc.sendPooled(m, critical); err != nil {
+		cc.logf("send error: %v", err)
+	} else {
+		metrics.messagesSent.Add(1)
 	}
 }
 
 func main() {
+	flag.Parse()
+	if err := validateOverflowPolicy(*overflowPolicy); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateSendQueueSize(*sendQueueSize); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateKeepalive(); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := newRegistry(*registryKind); err != nil {
+		log.Fatal(err)
+	}
+	newRoomRegistry = func() Registry {
+		registry, _ := newRegistry(*registryKind)
+		return registry
+	}
+	var err error
+	if *configPath != "" {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		currentConfig.Store(cfg)
+		watchConfigReload(context.Background(), *configPath)
+	}
+	policy, err := parseCodecPolicy(*roomPolicyFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy.MaxPublishedTracks = *maxPublishedTracks
+	policy.RequiredMedia = parseRequiredMedia(*requireMediaFlag)
+	if err := policy.validate(); err != nil {
+		log.Fatal("Invalid default room policy: ", err)
+	}
+	setRoomPolicy(defaultRoom, policy)
+	if err := setRoomBudget(defaultRoom, *roomBandwidthFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	bus, err := newBus(*relayBus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if bus != nil {
+		startRelay(bus)
+	}
+
+	// Optional OpenTelemetry metrics export
+	if *otelEndpoint != "" {
+		shutdown, err := startOTelExport(context.Background(), *otelEndpoint, *otelInterval)
+		if err != nil {
+			log.Fatal("Failed to start OpenTelemetry export:", err)
+		}
+		defer shutdown(context.Background())
+	}
+
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	
+
 	// Serve static files
-	e.GET("/", func(c echo.Context) error {
-		return c.File("client/index.html")
-	})
-	e.GET("/webrtc.js", func(c echo.Context) error {
-		return c.File("client/webrtc.js")
-	})
-	
-	// WebSocket endpoint
+	if err := registerAssetRoutes(e); err != nil {
+		log.Fatal("Failed to load client assets:", err)
+	}
+
+	// WebSocket endpoints; clients only signal with others in the same room
 	e.GET("/ws", websocketHandler)
-	
+	e.GET("/ws/:room", websocketHandler)
+
+	// What the server supports, for clients to check before connecting
+	e.GET("/capabilities", capabilitiesHandler)
+
+	// Moderator API
+	registerAdminRoutes(e)
+
+	// Prometheus scrape endpoint
+	registry := prometheus.NewRegistry()
+	if err := registerPrometheusMetrics(registry); err != nil {
+		log.Fatal("Failed to register Prometheus metrics:", err)
+	}
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+
 	// Print help message
 	printHelp()
-	
+
 	// Start HTTPS server
-	if err := e.StartTLS(":"+httpsPort, "cert.pem", "key.pem"); err != nil {
+	if *devMode {
+		if err := ensureCertificate("cert.pem", "key.pem"); err != nil {
+			log.Fatal("Failed to create development certificate:", err)
+		}
+	}
+	tlsConfig, err := serverTLSConfig("cert.pem", "key.pem")
+	if err != nil {
+		log.Fatal("Failed to configure TLS:", err)
+	}
+	e.TLSServer.Addr = ":" + httpsPort
+	e.TLSServer.TLSConfig = tlsConfig
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- e.StartServer(e.TLSServer) }()
+
+	// Run until the server fails or is told to stop, then close clients cleanly
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
 		log.Fatal("Server failed to start:", err)
+	case <-stop:
+		log.Println("Shutting down")
+		shutdownServer(e)
 	}
 }
 
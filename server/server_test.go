@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// newQueueConn returns a client whose queue nothing drains, for exercising
+// the send path without a socket
+func newQueueConn() *clientConn {
+	cc := &clientConn{
+		wake:  make(chan struct{}, 1),
+		space: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	cc.logger.Store(slog.Default())
+	return cc
+}
+
+// queued returns the messages waiting in cc's queue
+func queued(cc *clientConn) [][]byte {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	var messages [][]byte
+	for _, msg := range cc.queue {
+		messages = append(messages, msg.data)
+	}
+	return messages
+}
+
+// TestUpgrade upgrades a request through echo and checks that the client is
+// welcomed with its connection ID
+func TestUpgrade(t *testing.T) {
+	e := echo.New()
+	e.GET("/ws", websocketHandler)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status %d, want 101", resp.StatusCode)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var welcome welcomeMessage
+	if err := ws.ReadJSON(&welcome); err != nil {
+		t.Fatalf("reading welcome: %v", err)
+	}
+	if welcome.Type != "welcome" || welcome.ConnID == "" {
+		t.Fatalf("first message = %+v, want a welcome with a connection ID", welcome)
+	}
+}
+
+// syncBuffer is a log destination safe for concurrent writers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestConnIDLogged connects a client and checks the server's log lines about
+// it carry the connection ID the client was welcomed with
+func TestConnIDLogged(t *testing.T) {
+	var logs syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	_, wsURL := startTestServer(t)
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL+"/correlated", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var welcome welcomeMessage
+	if err := ws.ReadJSON(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	register(t, ws, "traced")
+	tag := "connID=" + welcome.ConnID
+	waitFor(t, "the message to be logged", func() bool {
+		return strings.Contains(logs.String(), "traced")
+	})
+
+	var tagged int
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		// Only this client connects to the room, and only it sends its UUID
+		if strings.Contains(line, "room correlated") || strings.Contains(line, "traced") {
+			if !strings.Contains(line, tag) {
+				t.Errorf("log line lacks %s: %s", tag, line)
+			}
+			tagged++
+		}
+	}
+	if tagged < 2 {
+		t.Fatalf("found %d log lines about the client, want its connect and message:\n%s", tagged, logs.String())
+	}
+}
+
+// TestConnLoggerFields runs two clients in a room side by side and checks
+// every line logged for a connection once its client has registered carries
+// that client's UUID and room, and never the other client's UUID
+func TestConnLoggerFields(t *testing.T) {
+	var logs syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	_, wsURL := startTestServer(t)
+	connIDs := make(map[string]string)
+	var wg sync.WaitGroup
+	for _, uuid := range []string{"alice", "bob"} {
+		ws, _, err := websocket.DefaultDialer.Dial(wsURL+"/fields", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		var welcome welcomeMessage
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if err := ws.ReadJSON(&welcome); err != nil {
+			t.Fatal(err)
+		}
+		connIDs[uuid] = welcome.ConnID
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, message := range []string{
+				`{"type":"register","uuid":"` + uuid + `"}`,
+				`{"uuid":"` + uuid + `","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`,
+				`{"type":"bye","uuid":"` + uuid + `"}`,
+			} {
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	waitFor(t, "both clients to say bye", func() bool {
+		out := logs.String()
+		return strings.Contains(out, "Client alice said bye") && strings.Contains(out, "Client bob said bye")
+	})
+
+	for uuid, id := range connIDs {
+		other := "bob"
+		if uuid == "bob" {
+			other = "alice"
+		}
+		registered := false
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			if !strings.Contains(line, "connID="+id) {
+				continue
+			}
+			if strings.Contains(line, "uuid="+other) {
+				t.Errorf("%s's line carries %s's UUID: %s", uuid, other, line)
+			}
+			// The register message is logged as received before it is handled
+			if registered && (!strings.Contains(line, "uuid="+uuid) || !strings.Contains(line, "room=fields")) {
+				t.Errorf("%s's line lacks uuid=%s or room=fields: %s", uuid, uuid, line)
+			}
+			registered = registered || strings.Contains(line, `\"type\":\"register\"`)
+		}
+		if !registered {
+			t.Fatalf("no register logged for %s:\n%s", uuid, logs.String())
+		}
+	}
+}
+
+// TestDirectedSignal sends an offer addressed to one member of a room of three
+// and checks only that member gets it, that an offer to an unknown client is
+// logged and dropped, and that the sender can still broadcast afterwards
+func TestDirectedSignal(t *testing.T) {
+	var logs syncBuffer
+	writer := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(writer) })
+
+	_, url := startTestServer(t)
+	members := make(map[string]*websocket.Conn)
+	for _, uuid := range []string{"a", "b", "c"} {
+		members[uuid] = dialTest(t, url+"/directed")
+		register(t, members[uuid], uuid)
+	}
+	waitFor(t, "every member to register", func() bool {
+		r := lookupRoom("directed")
+		if r == nil {
+			return false
+		}
+		for uuid := range members {
+			if _, ok := r.clients.Lookup(uuid); !ok {
+				return false
+			}
+		}
+		return true
+	})
+
+	send := func(message string) {
+		t.Helper()
+		if err := members["a"].WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(`{"uuid":"a","to":"b","sdp":{"type":"offer","sdp":""}}`)
+	send(`{"uuid":"a","to":"ghost","sdp":{"type":"offer","sdp":""}}`)
+	send(`{"uuid":"a","ice":{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host"}}`)
+
+	if offer := readUntil(t, members["b"], isSignal); offer.UUID != "a" || offer.To != "b" || sdpType(offer.SDP) != "offer" {
+		t.Fatalf("b got %+v, want a's offer to it", offer)
+	}
+	// Signals from a arrive in order, so c seeing the broadcast candidate
+	// first means neither offer reached it
+	for _, uuid := range []string{"b", "c"} {
+		if candidate := readUntil(t, members[uuid], isSignal); candidate.UUID != "a" || len(candidate.ICE) == 0 {
+			t.Fatalf("%s got %+v, want a's broadcast candidate", uuid, candidate)
+		}
+	}
+	if !strings.Contains(logs.String(), "No client ghost in room directed, dropping message") {
+		t.Fatal("offer to an unknown client wasn't logged as dropped")
+	}
+}
+
+// BenchmarkBroadcast stamps a signal and fans it out to a room of eight,
+// the per-message work of the read loop, then empties the queues as their
+// writers would. The unpooled message is allocated once and shared by every
+// queue; the pooled one reuses a buffer once every queue has released it.
+func BenchmarkBroadcast(b *testing.B) {
+	message := []byte(`{"uuid":"a","sdp":{"type":"offer","sdp":"v=0"}}`)
+	b.Run("unpooled", func(b *testing.B) {
+		r, members := benchRoom()
+		b.ReportAllocs()
+		for b.Loop() {
+			broadcastMessage(r, nil, stampServerTime(message), false)
+			drainQueues(members)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		r, members := benchRoom()
+		b.ReportAllocs()
+		for b.Loop() {
+			stamped := stampPooled(message)
+			broadcastPooled(r, nil, stamped, false)
+			stamped.release()
+			drainQueues(members)
+		}
+	})
+}
+
+func benchRoom() (*room, []*clientConn) {
+	r := &room{name: "bench", clients: newMutexRegistry(), mesh: newMeshTopology()}
+	members := make([]*clientConn, 8)
+	for i := range members {
+		members[i] = newQueueConn()
+		r.clients.Add(members[i])
+	}
+	return r, members
+}
+
+// drainQueues empties each client's queue as its writer would, releasing
+// what it held
+func drainQueues(members []*clientConn) {
+	for _, cc := range members {
+		cc.mu.Lock()
+		for _, msg := range cc.queue {
+			msg.release()
+		}
+		cc.queue = cc.queue[:0]
+		cc.mu.Unlock()
+	}
+}
+
+// TestConcurrentClients churns 50 clients through one room at once, each
+// joining, broadcasting and leaving a few times, so -race sees the handler's
+// membership and fan-out under contention
+func TestConcurrentClients(t *testing.T) {
+	const clients, rounds, messages = 50, 3, 5
+	_, url := startTestServer(t)
+	url += "/churn"
+
+	errs := make(chan error, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range rounds {
+				if err := churn(url, fmt.Sprintf("client-%d-%d", i, round), messages); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lookupRoom("churn") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("room outlived its members, %d still connected", connectedClients())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// churn connects to url as uuid, broadcasts n signals while draining what
+// the room sends, and disconnects
+func churn(url, uuid string, n int) error {
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"register","uuid":"`+uuid+`"}`)); err != nil {
+		return err
+	}
+	for i := range n {
+		signal := fmt.Sprintf(`{"uuid":%q,"ice":{"candidate":"candidate:%d 1 udp 1 192.0.2.1 9 typ host"}}`, uuid, i)
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(signal)); err != nil {
+			return err
+		}
+	}
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"bye","uuid":"`+uuid+`"}`))
+	ws.Close()
+	<-drained
+	return nil
+}
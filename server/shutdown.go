@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+var shutdownGrace = flag.Duration("shutdown-grace", 10*time.Second, "How long shutdown waits for in-flight requests and client close frames")
+
+// shutdownServer stops accepting connections, then closes every WebSocket
+// client with a normal close frame and waits for the frames to go out, all
+// within -shutdown-grace
+func shutdownServer(e *echo.Echo) {
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+	defer cancel()
+
+	// Upgraded connections are hijacked, so Shutdown doesn't wait for them
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("HTTP shutdown error: %v", err)
+	}
+
+	var open []*clientConn
+	membershipMu.Lock()
+	for _, r := range rooms {
+		r.clients.Range(func(cc *clientConn, _ string) bool {
+			open = append(open, cc)
+			return true
+		})
+	}
+	membershipMu.Unlock()
+
+	for _, cc := range open {
+		cc.shutdown(websocket.CloseNormalClosure, "server shutting down")
+	}
+	for _, cc := range open {
+		select {
+		case <-cc.done:
+		case <-ctx.Done():
+			log.Printf("Shutdown grace period over with clients still closing")
+			return
+		}
+	}
+	log.Printf("Closed %d clients", len(open))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// dialTestServer starts a server and connects one client to its default room
+func dialTestServer(t *testing.T) (*echo.Echo, *websocket.Conn) {
+	t.Helper()
+	e, url := startTestServer(t)
+	return e, dialTest(t, url)
+}
+
+// TestShutdownClosesClients checks that a connected client gets a normal
+// close frame, and shutdownServer returns, within the grace period
+func TestShutdownClosesClients(t *testing.T) {
+	grace := *shutdownGrace
+	*shutdownGrace = 2 * time.Second
+	t.Cleanup(func() { *shutdownGrace = grace })
+
+	e, ws := dialTestServer(t)
+	deadline := time.Now().Add(*shutdownGrace)
+	returned := make(chan struct{})
+	go func() {
+		shutdownServer(e)
+		close(returned)
+	}()
+
+	ws.SetReadDeadline(deadline)
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue // Roster and mesh updates sent before the close
+		}
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Fatalf("read error %v, want a normal close frame", err)
+		}
+		break
+	}
+
+	select {
+	case <-returned:
+	case <-time.After(time.Until(deadline)):
+		t.Fatal("shutdownServer did not return within the grace period")
+	}
+}